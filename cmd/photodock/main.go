@@ -1,30 +1,40 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"embed"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/Alexander-D-Karpov/photodock/internal/config"
 	"github.com/Alexander-D-Karpov/photodock/internal/database"
 	"github.com/Alexander-D-Karpov/photodock/internal/handlers"
-	"github.com/Alexander-D-Karpov/photodock/internal/services"
+	"golang.org/x/crypto/bcrypt"
 )
 
 //go:embed all:web
 var webFS embed.FS
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "hashpass" {
+		hashPass(os.Args[2:])
+		return
+	}
+
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatal(err)
 	}
+	setupLogging(cfg.LogFormat)
 
 	if err := os.MkdirAll(cfg.MediaRoot, 0755); err != nil {
 		log.Fatalf("failed to create MEDIA_ROOT (%s): %v", cfg.MediaRoot, err)
@@ -46,23 +56,11 @@ func main() {
 		log.Fatal(err)
 	}
 
-	thumbService := services.NewThumbnailService(cfg.MediaRoot, cfg.CacheDir)
-
-	log.Println("Prewarming thumbnail cache...")
-	thumbService.PrewarmCache()
-	log.Println("Cache prewarm complete")
-
-	exifService := services.NewExifService()
-	scanService := services.NewScannerService(db, thumbService, exifService, cfg.MediaRoot)
-
-	h := handlers.New(db, cfg, thumbService, scanService, webFS)
-
-	mux := http.NewServeMux()
-	h.RegisterRoutes(mux)
+	handler, lifecycle := handlers.BuildServer(cfg, db, webFS)
 
 	server := &http.Server{
 		Addr:         cfg.ListenAddr,
-		Handler:      handlers.LoggingMiddleware(mux),
+		Handler:      handler,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  120 * time.Second,
@@ -79,10 +77,53 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	log.Println("Shutting down: draining HTTP requests...")
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelHTTP()
+	if err := server.Shutdown(httpCtx); err != nil {
+		log.Printf("http shutdown: %v", err)
+	}
 
-	if err := server.Shutdown(ctx); err != nil {
+	log.Println("Shutting down: stopping background work...")
+	bgCtx, cancelBG := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancelBG()
+	if err := lifecycle.Shutdown(bgCtx); err != nil {
+		log.Printf("background shutdown: %v", err)
+	}
+
+	log.Println("Shutdown complete")
+}
+
+// setupLogging sends slog and the standard logger to stderr in the
+// configured format.
+func setupLogging(format string) {
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, nil)
+	if format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, nil)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// hashPass prints a bcrypt hash for ADMIN_PASS_HASH. The password comes
+// from the argument or, to keep it out of shell history, from stdin.
+func hashPass(args []string) {
+	var pass string
+	if len(args) > 0 {
+		pass = args[0]
+	} else {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			log.Fatal(err)
+		}
+		pass = strings.TrimRight(line, "\r\n")
+	}
+	if pass == "" {
+		log.Fatal("empty password")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	if err != nil {
 		log.Fatal(err)
 	}
+	fmt.Println(string(hash))
 }
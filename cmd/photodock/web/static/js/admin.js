@@ -1,10 +1,84 @@
 let selectedPhotos = new Set();
 
-function scanAll() {
+// Every state-changing admin request carries the session's CSRF token.
+const csrfToken = document.querySelector('meta[name="csrf-token"]')?.content || '';
+const plainFetch = window.fetch.bind(window);
+window.fetch = (input, init = {}) => {
+    const method = (init.method || 'GET').toUpperCase();
+    if (method !== 'GET' && method !== 'HEAD') {
+        init.headers = new Headers(init.headers);
+        init.headers.set('X-CSRF-Token', csrfToken);
+    }
+    return plainFetch(input, init);
+};
+
+async function errorText(r) {
+    // A 409 from a maintenance action carries the status of the running job.
+    if (r.status === 409 && (r.headers.get('Content-Type') || '').startsWith('application/json')) {
+        const st = await r.json();
+        return st.job + ' is already running' +
+            (st.files_processed ? ' (' + st.files_processed + ' done)' : '');
+    }
+    return (await r.text()).trim();
+}
+
+async function scanAll() {
     if (!confirm('Scan all folders for new photos?')) return;
-    fetch('/admin/scan', { method: 'POST' })
-        .then(r => r.json())
-        .then(() => alert('Scan started. Refresh page in a moment to see results.'));
+    const r = await fetch('/admin/scan', { method: 'POST' });
+    if (!r.ok) {
+        alert('Scan not started: ' + await errorText(r));
+        if (r.status === 409) pollScan();
+        return;
+    }
+    const st = await pollScan();
+    if (st.state === 'canceled') {
+        alert('Scan canceled after ' + st.files_processed + ' files.');
+        location.reload();
+        return;
+    }
+    if (st.state === 'failed') {
+        alert('Scan stopped: ' + st.error);
+        return;
+    }
+    alert('Scan complete: ' + st.added + ' added, ' + st.updated + ' updated, ' + st.removed + ' removed' +
+        (st.errors ? ', ' + st.errors + ' errors' : '') + '.');
+    location.reload();
+}
+
+async function pollScan() {
+    // Shows progress on the dashboard's scan button until the scan ends.
+    const btn = document.getElementById('scan-all-btn');
+    const cancelBtn = document.getElementById('scan-cancel-btn');
+    const label = btn ? btn.innerHTML : '';
+    if (btn) btn.disabled = true;
+    let st;
+    for (;;) {
+        st = await (await fetch('/admin/scan/status')).json();
+        if (st.state !== 'running') break;
+        // Other jobs hold the scan button too, but only a scan can be canceled.
+        if (cancelBtn) cancelBtn.hidden = st.job !== 'scan';
+        if (btn) {
+            btn.textContent = (st.job === 'scan' ? 'Scanning… ' : 'Running ' + st.job + '… ') +
+                st.files_processed + ' files' +
+                (st.current_folder ? ' (' + st.current_folder + ')' : '');
+        }
+        await new Promise(resolve => setTimeout(resolve, 1000));
+    }
+    if (btn) {
+        btn.innerHTML = label;
+        btn.disabled = false;
+    }
+    if (cancelBtn) {
+        cancelBtn.hidden = true;
+        cancelBtn.disabled = false;
+    }
+    return st;
+}
+
+function cancelScan(btn) {
+    if (!confirm('Stop the running scan? Photos found so far are kept.')) return;
+    btn.disabled = true;
+    fetch('/admin/scan/cancel', { method: 'POST' });
 }
 
 function scanFolder(id) {
@@ -13,22 +87,73 @@ function scanFolder(id) {
         .then(() => alert('Folder scan started. Refresh to see results.'));
 }
 
-function cleanOrphans() {
-    if (!confirm('Clean orphaned database entries?')) return;
-    fetch('/admin/clean', { method: 'POST' })
-        .then(r => r.json())
-        .then(() => alert('Cleanup started. Refresh to see results.'));
+async function cleanOrphans(execute) {
+    // The first click only lists what would go; the panel's button removes it.
+    const panel = document.getElementById('clean-report');
+    const r = await fetch('/admin/clean' + (execute ? '' : '?dry_run=1'), { method: 'POST' });
+    if (!r.ok) {
+        alert('Cleanup failed: ' + await errorText(r));
+        return;
+    }
+    const res = await r.json();
+    if (execute) {
+        panel.hidden = true;
+        alert('Removed ' + res.photos_removed + ' photos and ' + res.folders_removed + ' folders.');
+        location.reload();
+        return;
+    }
+
+    const list = document.getElementById('clean-list');
+    list.replaceChildren(...res.folders.map(p => p + '/').concat(res.photos).map(p => {
+        const li = document.createElement('li');
+        li.textContent = p;
+        return li;
+    }));
+    const empty = res.photos.length === 0 && res.folders.length === 0;
+    document.getElementById('clean-summary').textContent = empty
+        ? 'Nothing to clean up.'
+        : res.photos.length + ' photos and ' + res.folders.length + ' folders would be removed:';
+    document.getElementById('clean-confirm').hidden = empty;
+    panel.hidden = false;
 }
 
-function deleteFolder(id) {
-    if (!confirm('Delete this folder? All photos within will also be deleted.')) return;
-    fetch('/admin/folders/' + id, { method: 'DELETE' })
-        .then(r => {
-            if (r.ok) location.reload();
-            else alert('Failed to delete folder');
+function createBackup(btn) {
+    btn.disabled = true;
+    fetch('/admin/backups', { method: 'POST' })
+        .then(r => r.ok ? r.json() : r.text().then(t => Promise.reject(new Error(t))))
+        .then(() => location.reload())
+        .catch(err => {
+            btn.disabled = false;
+            alert('Backup failed: ' + err.message);
         });
 }
 
+function restoreBackup(name) {
+    if (!confirm('Replace all folders, photo metadata, settings and redirects with the contents of ' + name + '? Changes made since this backup will be lost.')) return;
+    fetch('/admin/backups/' + encodeURIComponent(name) + '/restore', { method: 'POST' })
+        .then(r => r.ok ? r.json() : r.text().then(t => Promise.reject(new Error(t))))
+        .then(() => alert('Backup restored.'))
+        .catch(err => alert('Restore failed: ' + err.message));
+}
+
+async function deleteFolder(id) {
+    if (!confirm('Remove this folder and all photos within from the library?')) return;
+    const purge = confirm('Also delete its files from disk? This cannot be undone.\n\n' +
+        'Cancel keeps the files in the media directory, where the next scan will add them back.');
+    const r = await fetch('/admin/folders/' + id + (purge ? '?purge=1' : ''), { method: 'DELETE' });
+    if (!r.ok) {
+        alert('Failed to delete folder: ' + await errorText(r));
+        return;
+    }
+    const res = await r.json();
+    if (res.errors && res.errors.length) {
+        alert(res.message + '\n\n' + res.errors.join('\n'));
+    } else if (res.mode === 'detach') {
+        alert(res.message);
+    }
+    location.reload();
+}
+
 function deletePhoto(id) {
     if (!confirm('Delete this photo permanently?')) return;
     fetch('/admin/photos/' + id, { method: 'DELETE' })
@@ -62,6 +187,15 @@ function setCover(folderId, photoId) {
         });
 }
 
+function publishFolder(id) {
+    if (!confirm('Publish this folder? Its photos become publicly visible.')) return;
+    fetch('/admin/folders/' + id + '/publish', { method: 'POST' })
+        .then(r => {
+            if (r.ok) location.reload();
+            else alert('Failed to publish folder');
+        });
+}
+
 function showCreateFolder() {
     document.getElementById('create-folder-dialog').showModal();
 }
@@ -139,26 +273,94 @@ function updateBulkUI() {
     }
 }
 
+function bulkAction(action, extra) {
+    const body = Object.assign({ action, ids: Array.from(selectedPhotos) }, extra || {});
+    fetch('/admin/photos/bulk', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(body)
+    })
+        .then(r => {
+            if (!r.ok) return r.text().then(t => { throw new Error(t.trim()); });
+            return r.json();
+        })
+        .then(res => {
+            if (res.undo_token) sessionStorage.setItem('photodock_undo', JSON.stringify(res));
+            const failed = (res.results || []).filter(x => !x.ok);
+            if (failed.length > 0) {
+                const lines = failed.slice(0, 20).map(x => `#${x.id}: ${x.error}`);
+                if (failed.length > 20) lines.push(`…and ${failed.length - 20} more`);
+                alert(`${action} failed for ${failed.length} of ${res.results.length} photos:\n` + lines.join('\n'));
+            }
+            location.reload();
+        })
+        .catch(err => alert('Bulk ' + action + ' failed: ' + err.message));
+}
+
+// A form post lets the browser stream the archive to disk.
+function bulkZip() {
+    if (selectedPhotos.size === 0) return;
+    const form = document.createElement('form');
+    form.method = 'POST';
+    form.action = '/admin/photos/zip';
+    const input = document.createElement('input');
+    input.type = 'hidden';
+    input.name = 'ids';
+    input.value = Array.from(selectedPhotos).join(',');
+    form.appendChild(input);
+    document.body.appendChild(form);
+    form.submit();
+    form.remove();
+}
+
 function bulkHide() {
     if (selectedPhotos.size === 0) return;
     if (!confirm(`Hide ${selectedPhotos.size} selected photos?`)) return;
+    bulkAction('hide');
+}
 
-    const promises = Array.from(selectedPhotos).map(id =>
-        fetch('/admin/photos/' + id + '/hide', { method: 'POST' })
-    );
-
-    Promise.all(promises).then(() => location.reload());
+function bulkUnhide() {
+    if (selectedPhotos.size === 0) return;
+    bulkAction('unhide');
 }
 
 function bulkDelete() {
     if (selectedPhotos.size === 0) return;
-    if (!confirm(`Delete ${selectedPhotos.size} selected photos permanently?`)) return;
+    if (!confirm(`Delete ${selectedPhotos.size} selected photos permanently? This cannot be undone.`)) return;
+    bulkAction('delete');
+}
+
+function undoBulk(token) {
+    fetch('/admin/undo/' + token, { method: 'POST' })
+        .then(r => {
+            if (!r.ok) return r.text().then(t => alert('Undo failed: ' + t.trim()));
+            sessionStorage.removeItem('photodock_undo');
+            location.reload();
+        });
+}
 
-    const promises = Array.from(selectedPhotos).map(id =>
-        fetch('/admin/photos/' + id, { method: 'DELETE' })
-    );
+function showUndoToast() {
+    const raw = sessionStorage.getItem('photodock_undo');
+    if (!raw) return;
+    sessionStorage.removeItem('photodock_undo');
 
-    Promise.all(promises).then(() => location.reload());
+    const res = JSON.parse(raw);
+    if (new Date(res.undo_expires) < new Date()) return;
+
+    const toast = document.createElement('div');
+    toast.className = 'undo-toast';
+    const text = document.createElement('span');
+    text.textContent = `${res.affected} photos: ${res.action} done.`;
+    const btn = document.createElement('button');
+    btn.className = 'btn btn-small btn-primary';
+    btn.textContent = 'Undo';
+    btn.onclick = () => undoBulk(res.undo_token);
+    const close = document.createElement('button');
+    close.className = 'btn btn-small';
+    close.textContent = 'Dismiss';
+    close.onclick = () => toast.remove();
+    toast.append(text, btn, close);
+    document.body.appendChild(toast);
 }
 
 function bulkMove() {
@@ -169,13 +371,7 @@ function bulkMove() {
 
 function confirmBulkMove() {
     const folderId = document.getElementById('move-folder').value;
-    const promises = Array.from(selectedPhotos).map(id => {
-        const body = new FormData();
-        body.append('folder_id', folderId);
-        return fetch('/admin/photos/' + id + '/move', { method: 'POST', body });
-    });
-
-    Promise.all(promises).then(() => location.reload());
+    bulkAction('move', { folder_id: folderId || null });
 }
 
 function performSearch() {
@@ -197,30 +393,311 @@ function reprocessMeta() {
         .then(() => alert('Metadata reprocessing started. Check server logs for progress.'));
 }
 
-document.addEventListener('DOMContentLoaded', () => {
-    const folderSelect = document.getElementById('upload-folder');
-    if (folderSelect && folderSelect.options.length <= 1) {
-        fetch('/admin/folders')
-            .then(r => r.text())
-            .then(html => {
-                const parser = new DOMParser();
-                const doc = parser.parseFromString(html, 'text/html');
-                const items = doc.querySelectorAll('.tree-item');
-                items.forEach(item => {
-                    const name = item.querySelector('.tree-name');
-                    const path = item.querySelector('.tree-path');
-                    if (name && path) {
-                        const opt = document.createElement('option');
-                        opt.value = item.dataset.id;
-                        const depth = parseInt(item.dataset.depth) || 0;
-                        opt.textContent = '\u00A0\u00A0'.repeat(depth) + name.textContent;
-                        folderSelect.appendChild(opt);
+async function fixOrientation() {
+    if (!confirm('Check all photos for wrong portrait/landscape dimensions? This may take a while.')) return;
+    let checked = 0, corrected = 0;
+    while (true) {
+        const r = await fetch('/admin/fix-orientation', { method: 'POST' });
+        if (!r.ok) {
+            alert('Orientation fix-up stopped: ' + await errorText(r) + '\nRun it again to resume.');
+            return;
+        }
+        const res = await r.json();
+        checked += res.checked;
+        corrected += res.corrected;
+        if (res.done) break;
+    }
+    alert('Orientation fix-up complete: corrected ' + corrected + ' of ' + checked + ' photos.');
+}
+
+async function reexif(ids) {
+    const label = ids ? ids.length + ' selected photos' : 'ALL photos';
+    if (!confirm('Re-extract EXIF for ' + label + '? This may take a while.')) return;
+    const r = await fetch('/admin/reexif', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ ids: ids || [] })
+    });
+    if (!r.ok) {
+        alert('EXIF re-extraction not started: ' + await errorText(r));
+        return;
+    }
+    let st;
+    do {
+        await new Promise(resolve => setTimeout(resolve, 1000));
+        st = await (await fetch('/admin/reexif')).json();
+    } while (st.running);
+    if (st.error) {
+        alert('EXIF re-extraction stopped: ' + st.error);
+        return;
+    }
+    alert('EXIF re-extraction complete: updated ' + st.updated + ' of ' + st.total + ' photos' +
+        (st.missing ? ', ' + st.missing + ' missing files skipped' : '') +
+        (st.failed ? ', ' + st.failed + ' failed' : '') + '.');
+}
+
+function bulkWriteback() {
+    if (selectedPhotos.size === 0) return;
+    if (!confirm(`Write title and description into ${selectedPhotos.size} files? The files are modified in place.`)) return;
+    fetch('/admin/photos/bulk', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ action: 'writeback', ids: Array.from(selectedPhotos) })
+    })
+        .then(r => {
+            if (!r.ok) return r.text().then(t => { throw new Error(t.trim()); });
+            return r.json();
+        })
+        .then(res => alert('Wrote captions into ' + res.affected + ' files' + (res.failed ? ', ' + res.failed + ' failed' : '') + '.'))
+        .catch(err => alert('Writing captions failed: ' + err.message));
+}
+
+function bulkReexif() {
+    if (selectedPhotos.size === 0) return;
+    reexif(Array.from(selectedPhotos)).then(() => location.reload());
+}
+
+function reexifPhoto(id) {
+    fetch('/admin/photos/' + id + '/reexif', { method: 'POST' })
+        .then(r => {
+            if (!r.ok) return r.text().then(t => { throw new Error(t.trim()); });
+            location.reload();
+        })
+        .catch(err => alert('EXIF re-extraction failed: ' + err.message));
+}
+
+async function rescanPhoto(id) {
+    const r = await fetch('/admin/photos/' + id + '/rescan', { method: 'POST' });
+    if (r.status === 410) {
+        const res = await r.json();
+        if (confirm(res.path + ' is no longer on disk. Delete this photo?')) {
+            await fetch('/admin/photos/' + id, { method: 'DELETE' });
+            location = '/admin/photos';
+        }
+        return;
+    }
+    if (!r.ok) {
+        alert('Rescan failed: ' + await errorText(r));
+        return;
+    }
+    location.reload();
+}
+
+async function rotatePhoto(id, degrees) {
+    const body = new URLSearchParams({ degrees: degrees });
+    const r = await fetch('/admin/photos/' + id + '/rotate', { method: 'POST', body: body });
+    if (!r.ok) {
+        alert('Rotate failed: ' + await errorText(r));
+        return;
+    }
+    location.reload();
+}
+
+async function reencodeBlurhash() {
+    if (!confirm('Re-encode placeholders for every photo? Each original is decoded again, so this may take a while.')) return;
+    let checked = 0, reencoded = 0;
+    while (true) {
+        const r = await fetch('/admin/reencode-blurhash', { method: 'POST' });
+        if (!r.ok) {
+            alert('Placeholder re-encode stopped: ' + await errorText(r) + '\nRun it again to resume.');
+            return;
+        }
+        const res = await r.json();
+        checked += res.checked;
+        reencoded += res.reencoded;
+        if (res.done) break;
+    }
+    alert('Placeholder re-encode complete: updated ' + reencoded + ' of ' + checked + ' photos.');
+}
+
+function renderWarnings(warnings) {
+    const section = document.getElementById('warnings-section');
+    const list = document.getElementById('warnings-list');
+    if (!section || !list) return;
+
+    list.innerHTML = '';
+    warnings.forEach(w => {
+        const li = document.createElement('li');
+        li.className = 'warning-item warning-' + w.severity;
+
+        const text = document.createElement('div');
+        text.className = 'warning-text';
+        const title = document.createElement('strong');
+        title.textContent = w.title;
+        const detail = document.createElement('span');
+        detail.textContent = w.detail;
+        text.append(title, detail);
+        li.appendChild(text);
+
+        if (w.link) {
+            const a = document.createElement('a');
+            a.href = w.link;
+            a.className = 'btn btn-small btn-secondary';
+            a.textContent = 'View';
+            li.appendChild(a);
+        }
+        if (w.action) {
+            const btn = document.createElement('button');
+            btn.className = 'btn btn-small btn-primary';
+            btn.textContent = w.action_label;
+            btn.onclick = () => runWarningAction(w.action);
+            li.appendChild(btn);
+        }
+        list.appendChild(li);
+    });
+    section.hidden = warnings.length === 0;
+}
+
+function refreshWarnings(force) {
+    fetch('/api/admin/warnings' + (force ? '?refresh=1' : ''))
+        .then(r => r.json())
+        .then(data => renderWarnings(data.warnings))
+        .catch(() => {});
+}
+
+function runWarningAction(action) {
+    if (!confirm('Run this action now?')) return;
+    fetch(action, { method: 'POST' })
+        .then(r => {
+            if (!r.ok) return r.text().then(t => alert('Action failed: ' + t.trim()));
+            alert('Started. The warning will clear once the next check runs.');
+        });
+}
+
+// Folder picker: loads one level at a time from the picker endpoint and
+// switches to a flat result list while searching.
+function initFolderPicker(picker) {
+    const input = picker.querySelector('input[type=hidden]');
+    const toggle = picker.querySelector('.folder-picker-toggle');
+    const panel = picker.querySelector('.folder-picker-panel');
+    const search = picker.querySelector('.folder-picker-search');
+    const list = picker.querySelector('.folder-picker-list');
+    let loaded = false;
+    let searchTimer = null;
+
+    function fetchFolders(params) {
+        if (picker.dataset.exclude) params.set('exclude_id', picker.dataset.exclude);
+        return fetch('/api/admin/folders/picker?' + params).then(r => r.json());
+    }
+
+    function choose(value, label) {
+        input.value = value;
+        toggle.textContent = label;
+        panel.hidden = true;
+        input.dispatchEvent(new Event('change', { bubbles: true }));
+        if (picker.hasAttribute('data-submit') && input.form) input.form.submit();
+    }
+
+    function renderInto(ul, data, params, flat) {
+        data.folders.forEach(f => {
+            const li = document.createElement('li');
+            const row = document.createElement('div');
+            row.className = 'folder-picker-row';
+
+            const expand = document.createElement('button');
+            expand.type = 'button';
+            expand.className = 'folder-picker-expand';
+            if (!flat && f.has_children) {
+                expand.textContent = '\u25B8';
+                expand.addEventListener('click', () => {
+                    let sub = li.querySelector('ul');
+                    if (sub) {
+                        sub.hidden = !sub.hidden;
+                    } else {
+                        sub = document.createElement('ul');
+                        li.appendChild(sub);
+                        const p = new URLSearchParams({ parent_id: f.id });
+                        fetchFolders(p).then(d => renderInto(sub, d, p, false));
                     }
+                    expand.textContent = sub.hidden ? '\u25B8' : '\u25BE';
                 });
-            })
-            .catch(() => {});
+            } else {
+                expand.disabled = true;
+            }
+
+            const pick = document.createElement('button');
+            pick.type = 'button';
+            pick.className = 'folder-picker-option';
+            pick.textContent = flat ? f.path : f.name;
+            pick.title = f.path;
+            pick.addEventListener('click', () => choose(String(f.id), f.path));
+
+            row.append(expand, pick);
+            li.appendChild(row);
+            ul.appendChild(li);
+        });
+
+        if (data.has_more) {
+            const li = document.createElement('li');
+            const more = document.createElement('button');
+            more.type = 'button';
+            more.className = 'folder-picker-more';
+            more.textContent = 'Load more';
+            more.addEventListener('click', () => {
+                li.remove();
+                const p = new URLSearchParams(params);
+                p.set('offset', (parseInt(p.get('offset')) || 0) + data.folders.length);
+                fetchFolders(p).then(d => renderInto(ul, d, p, flat));
+            });
+            li.appendChild(more);
+            ul.appendChild(li);
+        }
+    }
+
+    function load(query) {
+        const params = new URLSearchParams();
+        if (query) params.set('q', query);
+        fetchFolders(params).then(data => {
+            list.innerHTML = '';
+            renderInto(list, data, params, !!query);
+        });
     }
 
+    toggle.addEventListener('click', () => {
+        panel.hidden = !panel.hidden;
+        if (!panel.hidden) {
+            if (!loaded) {
+                loaded = true;
+                load('');
+            }
+            search.focus();
+        }
+    });
+
+    search.addEventListener('input', () => {
+        clearTimeout(searchTimer);
+        searchTimer = setTimeout(() => load(search.value.trim()), 200);
+    });
+
+    search.addEventListener('keydown', (e) => {
+        if (e.key === 'Enter') e.preventDefault();
+        if (e.key === 'Escape') panel.hidden = true;
+    });
+
+    panel.querySelectorAll(':scope > .folder-picker-option').forEach(btn => {
+        btn.addEventListener('click', () => choose(btn.dataset.value, btn.textContent));
+    });
+
+    document.addEventListener('click', (e) => {
+        if (!picker.contains(e.target)) panel.hidden = true;
+    });
+}
+
+document.addEventListener('DOMContentLoaded', () => {
+    showUndoToast();
+
+    if (document.getElementById('scan-all-btn')) {
+        fetch('/admin/scan/status')
+            .then(r => r.json())
+            .then(st => { if (st.state === 'running') pollScan(); });
+    }
+
+    if (document.getElementById('warnings-section')) {
+        setInterval(() => refreshWarnings(false), 60000);
+    }
+
+    document.querySelectorAll('.folder-picker').forEach(initFolderPicker);
+
     document.querySelectorAll('.tree-toggle').forEach(toggle => {
         toggle.classList.add('expanded');
     });
@@ -54,21 +54,28 @@
         });
     }
 
+    // Photos are sorted by the server; only the folders on the page are
+    // reordered here to match.
+    const folderSorts = {
+        taken_asc: ['date', 'asc'],
+        name: ['name', 'asc'],
+        size: ['size', 'desc']
+    };
+    const slideshowSorts = { '': 'date-desc', taken_asc: 'date-asc', name: 'name-asc', size: 'size-desc' };
+
     const sortSelect = document.getElementById('sort-select');
     if (sortSelect) {
         sortSelect.addEventListener('change', () => {
-            const [col, dir] = sortSelect.value.split('-');
-            sortTable(col, dir);
-            sortGrid(col, dir);
-            localStorage.setItem('photodock-sort', sortSelect.value);
+            if (slideshowSorts[sortSelect.value]) {
+                localStorage.setItem('photodock-sort', slideshowSorts[sortSelect.value]);
+            }
+            savePrefs(sortSelect.value);
         });
 
-        const savedSort = localStorage.getItem('photodock-sort');
-        if (savedSort) {
-            sortSelect.value = savedSort;
-            const [col, dir] = savedSort.split('-');
-            sortTable(col, dir);
-            sortGrid(col, dir);
+        const folderSort = folderSorts[sortSelect.value];
+        if (folderSort) {
+            sortTable(folderSort[0], folderSort[1]);
+            sortGrid(folderSort[0], folderSort[1]);
         }
     }
 
@@ -86,6 +93,7 @@
 
             if (aIsFolder && !bIsFolder) return -1;
             if (!aIsFolder && bIsFolder) return 1;
+            if (!aIsFolder) return 0;
 
             let aVal, bVal;
 
@@ -124,7 +132,6 @@
         if (!gridView) return;
 
         const folderGrid = gridView.querySelector('.folders-grid');
-        const photoGrid = gridView.querySelector('.masonry');
 
         if (folderGrid) {
             const folders = Array.from(folderGrid.querySelectorAll('.folder-card'));
@@ -153,40 +160,32 @@
             });
             folders.forEach(f => folderGrid.appendChild(f));
         }
+    }
 
-        if (photoGrid) {
-            const photos = Array.from(photoGrid.querySelectorAll('.photo-item'));
-            photos.sort((a, b) => {
-                let aVal, bVal;
-                switch (col) {
-                    case 'name':
-                        aVal = (a.dataset.name || '').toLowerCase();
-                        bVal = (b.dataset.name || '').toLowerCase();
-                        break;
-                    case 'size':
-                        aVal = parseInt(a.dataset.size) || 0;
-                        bVal = parseInt(b.dataset.size) || 0;
-                        break;
-                    case 'date':
-                        aVal = parseInt(a.dataset.date) || 0;
-                        bVal = parseInt(b.dataset.date) || 0;
-                        break;
-                    default:
-                        return 0;
-                }
-                if (typeof aVal === 'string') {
-                    if (aVal < bVal) return dir === 'asc' ? -1 : 1;
-                    if (aVal > bVal) return dir === 'asc' ? 1 : -1;
-                } else {
-                    if (dir === 'asc') return aVal - bVal;
-                    return bVal - aVal;
-                }
-                return 0;
-            });
-            photos.forEach(p => photoGrid.appendChild(p));
+    const perPageSelect = document.getElementById('per-page-select');
+    const densitySelect = document.getElementById('density-select');
+
+    // sort is passed when the sort itself changed; otherwise the saved one
+    // is kept, not whatever the current link asked for.
+    function savePrefs(sort) {
+        const params = new URLSearchParams();
+        if (perPageSelect) params.set('per_page', perPageSelect.value);
+        if (densitySelect) params.set('density', densitySelect.value);
+        const savedSort = sort !== undefined ? sort : (sortSelect && sortSelect.dataset.saved);
+        if (savedSort) params.set('sort', savedSort);
+        document.cookie = 'photodock_prefs=' + params.toString() + '; path=/; max-age=31536000; samesite=lax';
+        const url = new URL(window.location.href);
+        url.searchParams.delete('page');
+        if (sort !== undefined) {
+            url.searchParams.delete('sort');
+            url.searchParams.delete('seed');
         }
+        window.location.href = url.toString();
     }
 
+    if (perPageSelect) perPageSelect.addEventListener('change', () => savePrefs());
+    if (densitySelect) densitySelect.addEventListener('change', () => savePrefs());
+
     if (savedView === 'grid') {
         initGallery();
     }
@@ -0,0 +1,177 @@
+(function() {
+    const root = document.getElementById('slideshow');
+    if (!root) return;
+
+    const folderId = root.dataset.folderId;
+    const img = document.getElementById('slideshow-image');
+    const empty = document.getElementById('slideshow-empty');
+    const counter = document.getElementById('slideshow-counter');
+    const title = document.getElementById('slideshow-title');
+    const toggleBtn = document.getElementById('slideshow-toggle');
+    const shuffleBtn = document.getElementById('slideshow-shuffle');
+    const closeUrl = root.querySelector('.viewer-header-left a').href;
+
+    const params = new URLSearchParams(window.location.search);
+    const opts = {
+        sort: params.get('sort') || localStorage.getItem('photodock-sort') || 'date-desc',
+        recursive: params.get('recursive') === '1',
+        shuffle: params.get('shuffle') === '1',
+        seed: params.get('seed') || ''
+    };
+
+    // Position survives reloads within the tab so a refreshed slideshow resumes.
+    const storageKey = 'photodock-slideshow-' + folderId;
+
+    let photos = [];
+    let total = 0;
+    let nextCursor = 0;
+    let index = 0;
+    let timer = null;
+    let playing = true;
+    let loading = null;
+
+    function apiURL(cursor) {
+        const q = new URLSearchParams({ cursor: String(cursor), sort: opts.sort });
+        if (opts.recursive) q.set('recursive', '1');
+        if (opts.shuffle) {
+            q.set('shuffle', '1');
+            if (opts.seed) q.set('seed', opts.seed);
+        }
+        return '/api/slideshow/' + folderId + '?' + q.toString();
+    }
+
+    function fetchMore() {
+        if (nextCursor === null) return Promise.resolve();
+        if (loading) return loading;
+        loading = fetch(apiURL(nextCursor))
+            .then(r => r.ok ? r.json() : Promise.reject(new Error(r.statusText)))
+            .then(data => {
+                photos = photos.concat(data.photos);
+                total = data.total;
+                nextCursor = data.next_cursor;
+                if (opts.shuffle && !opts.seed) opts.seed = String(data.seed);
+            })
+            .finally(() => { loading = null; });
+        return loading;
+    }
+
+    function preload(i) {
+        const p = photos[i];
+        if (p && !p.preloaded) {
+            new Image().src = p.large;
+            p.preloaded = true;
+        }
+    }
+
+    function save() {
+        sessionStorage.setItem(storageKey, JSON.stringify({
+            index, sort: opts.sort, recursive: opts.recursive, shuffle: opts.shuffle, seed: opts.seed
+        }));
+    }
+
+    function show(i) {
+        const p = photos[i];
+        if (!p) return;
+        index = i;
+
+        img.classList.add('fading');
+        const next = new Image();
+        next.onload = next.onerror = () => {
+            img.src = p.large;
+            img.alt = p.title;
+            img.classList.remove('fading');
+        };
+        next.src = p.large;
+
+        title.textContent = p.title;
+        title.href = p.url;
+        counter.textContent = (index + 1) + ' of ' + total;
+        save();
+
+        if (index + 5 >= photos.length) fetchMore();
+        preload(index + 1);
+        schedule();
+    }
+
+    function schedule() {
+        clearTimeout(timer);
+        if (!playing || !photos[index]) return;
+        timer = setTimeout(advance, photos[index].duration_ms);
+    }
+
+    async function advance() {
+        if (index + 1 >= photos.length && nextCursor !== null) await fetchMore();
+        if (index + 1 < photos.length) {
+            show(index + 1);
+        } else {
+            setPlaying(false);
+        }
+    }
+
+    function back() {
+        if (index > 0) show(index - 1);
+    }
+
+    function setPlaying(value) {
+        playing = value;
+        toggleBtn.querySelector('.icon-pause').hidden = !playing;
+        toggleBtn.querySelector('.icon-play').hidden = playing;
+        toggleBtn.title = playing ? 'Pause (Space)' : 'Play (Space)';
+        schedule();
+    }
+
+    async function start(resumeAt) {
+        photos = [];
+        nextCursor = 0;
+        await fetchMore();
+        if (photos.length === 0) {
+            img.hidden = true;
+            empty.hidden = false;
+            return;
+        }
+        while (resumeAt >= photos.length && nextCursor !== null) await fetchMore();
+        show(Math.min(resumeAt, photos.length - 1));
+    }
+
+    toggleBtn.addEventListener('click', (e) => {
+        e.preventDefault();
+        setPlaying(!playing);
+    });
+    document.getElementById('slideshow-next').addEventListener('click', (e) => {
+        e.preventDefault();
+        advance();
+    });
+    document.getElementById('slideshow-prev').addEventListener('click', (e) => {
+        e.preventDefault();
+        back();
+    });
+    shuffleBtn.addEventListener('click', (e) => {
+        e.preventDefault();
+        opts.shuffle = !opts.shuffle;
+        opts.seed = '';
+        shuffleBtn.classList.toggle('active', opts.shuffle);
+        start(0);
+    });
+
+    document.addEventListener('keydown', (e) => {
+        if (e.key === 'ArrowRight') advance();
+        else if (e.key === 'ArrowLeft') back();
+        else if (e.key === ' ') {
+            e.preventDefault();
+            setPlaying(!playing);
+        } else if (e.key === 'Escape') window.location.href = closeUrl;
+    });
+
+    let resumeAt = 0;
+    try {
+        const saved = JSON.parse(sessionStorage.getItem(storageKey) || 'null');
+        if (saved && saved.sort === opts.sort && saved.recursive === opts.recursive &&
+            saved.shuffle === opts.shuffle && (!opts.shuffle || !opts.seed || saved.seed === opts.seed)) {
+            resumeAt = saved.index || 0;
+            opts.seed = saved.seed || opts.seed;
+        }
+    } catch (e) {}
+
+    shuffleBtn.classList.toggle('active', opts.shuffle);
+    start(resumeAt);
+})();
@@ -1,5 +1,6 @@
 (function() {
     const CHUNK_SIZE = 1024 * 1024;
+    const CHUNK_RETRIES = 3;
     const MAX_CONCURRENT = 3;
 
     let uploadQueue = [];
@@ -16,6 +17,12 @@
     const folderSelect = document.getElementById('upload-folder');
     const startBtn = document.getElementById('start-upload');
     const clearBtn = document.getElementById('clear-upload');
+    const reviewToggle = document.getElementById('upload-review');
+    const autoFileToggle = document.getElementById('upload-autofile');
+    const reviewPanel = document.getElementById('upload-review-panel');
+    const reviewBody = document.getElementById('upload-review-body');
+    let stagedIds = [];
+    let stagedDuplicates = 0;
 
     if (!uploadZone) return;
 
@@ -32,10 +39,16 @@
         uploadZone.classList.remove('dragover');
     });
 
-    uploadZone.addEventListener('drop', (e) => {
+    uploadZone.addEventListener('drop', async (e) => {
         e.preventDefault();
         uploadZone.classList.remove('dragover');
-        handleFiles(e.dataTransfer.files);
+        // Entries have to be taken before the first await.
+        const entries = Array.from(e.dataTransfer.items || [], i => i.webkitGetAsEntry && i.webkitGetAsEntry()).filter(Boolean);
+        if (entries.some(entry => entry.isDirectory)) {
+            handleFiles(await readEntries(entries));
+        } else {
+            handleFiles(e.dataTransfer.files);
+        }
     });
 
     fileInput.addEventListener('change', () => {
@@ -359,21 +372,44 @@
         }
     }
 
+    // A dropped directory's files keep their path within the drop, so the
+    // server can recreate its folders.
+    async function readEntries(entries) {
+        const files = [];
+        const walk = async (entry) => {
+            if (entry.isFile) {
+                const file = await new Promise((resolve, reject) => entry.file(resolve, reject));
+                files.push({ file, path: entry.fullPath.replace(/^\/+/, '') });
+                return;
+            }
+            const reader = entry.createReader();
+            for (;;) {
+                const batch = await new Promise((resolve, reject) => reader.readEntries(resolve, reject));
+                if (batch.length === 0) break;
+                for (const child of batch) await walk(child);
+            }
+        };
+        for (const entry of entries) await walk(entry);
+        return files;
+    }
+
     function handleFiles(files) {
-        const validFiles = Array.from(files).filter(f =>
-            f.type === 'image/jpeg' || f.type === 'image/png'
+        const validFiles = Array.from(files, f => f instanceof File ? { file: f, path: f.webkitRelativePath || '' } : f).filter(({ file: f }) =>
+            f.type === 'image/jpeg' || f.type === 'image/png' || f.type === 'image/webp' || f.type === 'image/gif' ||
+            /\.(heic|heif)$/i.test(f.name)
         );
 
         if (validFiles.length === 0) {
-            alert('Please select valid image files (JPG, PNG)');
+            alert('Please select valid image files (JPG, PNG, WebP, HEIC)');
             return;
         }
 
-        validFiles.forEach(file => {
+        validFiles.forEach(({ file, path }) => {
             const id = Date.now().toString(36) + Math.random().toString(36).substr(2, 9);
             const item = {
                 id,
                 file,
+                path,
                 progress: 0,
                 status: 'pending',
                 error: null,
@@ -446,7 +482,13 @@
         const idx = uploadQueue.findIndex(item => item.id === id);
         if (idx === -1) return;
 
-        if (uploadQueue[idx].status !== 'pending') return;
+        const item = uploadQueue[idx];
+        if (item.status === 'uploading' && item.uploadId) {
+            // uploadChunked discards it on the server before the next chunk.
+            item.cancelled = true;
+        } else if (item.status !== 'pending') {
+            return;
+        }
 
         uploadQueue.splice(idx, 1);
         const element = document.getElementById(`preview-${id}`);
@@ -504,6 +546,11 @@
             const complete = uploadQueue.filter(item => item.status === 'complete').length;
             const errors = uploadQueue.filter(item => item.status === 'error').length;
 
+            if (stagedIds.length > 0) {
+                showReview();
+                return;
+            }
+
             if (complete > 0) {
                 setTimeout(() => {
                     alert(`Upload complete! ${complete} files uploaded${errors > 0 ? `, ${errors} failed` : ''}.`);
@@ -530,7 +577,10 @@
         const folderId = folderSelect ? folderSelect.value : '';
 
         try {
-            if (item.file.size <= CHUNK_SIZE) {
+            if (reviewToggle && reviewToggle.checked) {
+                item.uploadId = await uploadChunked(item, folderId, true);
+                stagedIds.push(item.uploadId);
+            } else if (item.file.size <= CHUNK_SIZE) {
                 await uploadSimple(item, folderId);
             } else {
                 await uploadChunked(item, folderId);
@@ -551,8 +601,11 @@
 
     async function uploadSimple(item, folderId) {
         const formData = new FormData();
-        formData.append('file', item.file);
+        // The server streams the file, so the fields it needs go first.
         if (folderId) formData.append('folder_id', folderId);
+        if (autoFileToggle && autoFileToggle.checked) formData.append('auto_file', 'true');
+        if (item.path) formData.append('path', item.path);
+        formData.append('file', item.file);
 
         const xhr = new XMLHttpRequest();
 
@@ -567,6 +620,9 @@
 
             xhr.onload = () => {
                 if (xhr.status >= 200 && xhr.status < 300) {
+                    try {
+                        setDestination(item, JSON.parse(xhr.responseText));
+                    } catch (e) {}
                     resolve();
                 } else {
                     reject(new Error(xhr.statusText || 'Upload failed'));
@@ -576,34 +632,90 @@
             xhr.onerror = () => reject(new Error('Network error'));
 
             xhr.open('POST', '/admin/upload/file');
+            xhr.setRequestHeader('X-CSRF-Token', csrfToken);
             xhr.send(formData);
         });
     }
 
-    async function uploadChunked(item, folderId) {
+    // Unfinished chunked uploads are remembered per file, so adding the
+    // same file again, even after a reload or a server restart, only sends
+    // the chunks the server doesn't have yet.
+    function resumeKey(item) {
+        const file = item.file;
+        return `photodock-upload:${item.path || file.name}:${file.size}:${file.lastModified}`;
+    }
+
+    async function resumeStatus(key) {
+        const uploadId = localStorage.getItem(key);
+        if (!uploadId) return null;
+        const res = await fetch(`/admin/upload/${encodeURIComponent(uploadId)}/status`).catch(() => null);
+        if (!res || !res.ok) {
+            localStorage.removeItem(key);
+            return null;
+        }
+        return res.json();
+    }
+
+    async function uploadChunked(item, folderId, stageOnly) {
         const totalChunks = Math.ceil(item.file.size / CHUNK_SIZE);
-        const uploadId = await initChunkedUpload(item.file.name, item.file.size, folderId);
+        const key = resumeKey(item);
+        const status = await resumeStatus(key);
+
+        let uploadId;
+        let received = new Set();
+        if (status && status.total_chunks === totalChunks) {
+            uploadId = status.upload_id;
+            received = status.staged ? new Set(Array.from({ length: totalChunks }, (_, i) => i)) : new Set(status.received);
+        } else {
+            uploadId = await initChunkedUpload(item, totalChunks, folderId);
+            localStorage.setItem(key, uploadId);
+        }
+        item.uploadId = uploadId;
+        const chunkAt = (i) => item.file.slice(i * CHUNK_SIZE, Math.min((i + 1) * CHUNK_SIZE, item.file.size));
 
         for (let i = 0; i < totalChunks; i++) {
-            const start = i * CHUNK_SIZE;
-            const end = Math.min(start + CHUNK_SIZE, item.file.size);
-            const chunk = item.file.slice(start, end);
-
-            await uploadChunk(uploadId, i, chunk);
+            if (item.cancelled) {
+                localStorage.removeItem(key);
+                await cancelUpload(uploadId);
+                throw new Error('Cancelled');
+            }
+            if (!received.has(i)) await uploadChunkRetrying(uploadId, i, chunkAt(i));
 
             const progress = ((i + 1) / totalChunks) * 100;
             item.progress = progress;
             updatePreviewItem(item.id, progress, 'uploading');
         }
 
-        await finalizeUpload(uploadId);
+        if (!stageOnly) setDestination(item, await finalizeUpload(uploadId, chunkAt));
+        localStorage.removeItem(key);
+        return uploadId;
     }
 
-    async function initChunkedUpload(filename, size, folderId) {
+    // A dropped connection costs a few retries rather than the upload;
+    // what still fails can be resumed by adding the file again.
+    async function uploadChunkRetrying(uploadId, index, chunk) {
+        for (let attempt = 1; ; attempt++) {
+            try {
+                return await uploadChunk(uploadId, index, chunk);
+            } catch (err) {
+                if (attempt >= CHUNK_RETRIES) throw err;
+                await new Promise(resolve => setTimeout(resolve, 1000 * 2 ** attempt));
+            }
+        }
+    }
+
+    async function initChunkedUpload(item, totalChunks, folderId) {
         const res = await fetch('/admin/upload/init', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ filename, size, folder_id: folderId || null })
+            body: JSON.stringify({
+                filename: item.file.name,
+                size: item.file.size,
+                path: item.path || '',
+                total_chunks: totalChunks,
+                folder_id: folderId || null,
+                auto_file: !!(autoFileToggle && autoFileToggle.checked)
+            })
         });
 
         if (!res.ok) throw new Error('Failed to init upload');
@@ -611,10 +723,19 @@
         return data.upload_id;
     }
 
+    async function chunkSHA256(chunk) {
+        // crypto.subtle only exists on HTTPS pages; the check is optional.
+        if (!window.crypto || !crypto.subtle) return '';
+        const digest = await crypto.subtle.digest('SHA-256', await chunk.arrayBuffer());
+        return Array.from(new Uint8Array(digest), b => b.toString(16).padStart(2, '0')).join('');
+    }
+
     async function uploadChunk(uploadId, index, chunk) {
         const formData = new FormData();
         formData.append('upload_id', uploadId);
         formData.append('chunk_index', index);
+        const sum = await chunkSHA256(chunk);
+        if (sum) formData.append('chunk_sha256', sum);
         formData.append('chunk', chunk);
 
         const res = await fetch('/admin/upload/chunk', {
@@ -625,16 +746,100 @@
         if (!res.ok) throw new Error('Chunk upload failed');
     }
 
-    async function finalizeUpload(uploadId) {
-        const res = await fetch('/admin/upload/finalize', {
+    function cancelUpload(uploadId) {
+        return fetch(`/admin/upload/${encodeURIComponent(uploadId)}`, { method: 'DELETE' }).catch(() => {});
+    }
+
+    async function finalizeUpload(uploadId, chunkAt) {
+        const finalize = () => fetch('/admin/upload/finalize', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({ upload_id: uploadId })
         });
 
+        let res = await finalize();
+        if (res.status === 409) {
+            // Chunks the server never got: send them again, once.
+            const data = await res.json();
+            for (const i of data.missing || []) {
+                await uploadChunk(uploadId, i, chunkAt(i));
+            }
+            res = await finalize();
+        }
         if (!res.ok) throw new Error('Failed to finalize upload');
+        return res.json();
     }
 
+    function setDestination(item, data) {
+        if (!data || !data.destination) return;
+        item.destination = data.destination;
+        const el = document.getElementById(`preview-${item.id}`);
+        if (!el) return;
+        el.title = 'Saved to ' + data.destination;
+        if (data.duplicate_of) {
+            el.title += '\nDuplicate of ' + data.duplicate_of.url;
+            el.classList.add('duplicate');
+        }
+        if (data.photo_id) {
+            const name = el.querySelector('.file-name-text');
+            if (name) name.innerHTML = `<a href="/admin/photos/${data.photo_id}" target="_blank">${escapeHtml(item.file.name)}</a>`;
+        }
+    }
+
+    async function showReview() {
+        const res = await fetch('/admin/upload/preview', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ upload_ids: stagedIds })
+        });
+        if (!res.ok) {
+            alert('Failed to preview staged uploads');
+            return;
+        }
+        const data = await res.json();
+        stagedDuplicates = data.files.filter(f => f.duplicate_of).length;
+
+        reviewBody.innerHTML = data.files.map(f => `
+            <tr class="${f.error ? 'error' : ''}">
+                <td>${escapeHtml(f.filename || f.upload_id)}</td>
+                <td>${f.error ? escapeHtml(f.error) : escapeHtml(f.destination) + (f.renamed ? ' <em>(renamed)</em>' : '') + (f.duplicate_of ? ` <em>(duplicate of <a href="${escapeHtml(f.duplicate_of.url)}" target="_blank">#${f.duplicate_of.id}</a>)</em>` : '')}</td>
+                <td>${f.taken_at ? escapeHtml(new Date(f.taken_at).toLocaleString()) : '-'}</td>
+                <td>${f.camera ? escapeHtml(f.camera) : '-'}</td>
+                <td>${f.strips_gps ? 'Will be stripped' : '-'}</td>
+            </tr>
+        `).join('');
+        reviewPanel.hidden = false;
+    }
+
+    window.confirmStaged = async function(action) {
+        if (stagedIds.length === 0) return;
+        if (action === 'discard' && !confirm('Discard all staged files?')) return;
+        const force = action === 'commit' && stagedDuplicates > 0;
+        if (force && !confirm(`${stagedDuplicates} files are already in the library. Import them anyway?`)) return;
+
+        const res = await fetch('/admin/upload/confirm', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ upload_ids: stagedIds, action, force })
+        });
+        if (!res.ok) {
+            alert('Failed to ' + action + ' staged uploads');
+            return;
+        }
+        const data = await res.json();
+        const failed = data.files.filter(f => f.error).length;
+
+        stagedIds = [];
+        stagedDuplicates = 0;
+        reviewPanel.hidden = true;
+        reviewBody.innerHTML = '';
+        window.clearUpload();
+
+        if (action === 'commit') {
+            alert(`Imported ${data.files.length - failed} files${failed > 0 ? `, ${failed} failed` : ''}.`);
+        }
+    };
+
     function updateUI() {
         const pending = uploadQueue.filter(i => i.status === 'pending').length;
         const uploading = uploadQueue.filter(i => i.status === 'uploading').length;
@@ -27,8 +27,8 @@ function initViewer(opts) {
     }
 
     // Prefetch neighbors (helps navigation feel instant)
-    if (opts.prevId) new Image().src = '/original/' + opts.prevId;
-    if (opts.nextId) new Image().src = '/original/' + opts.nextId;
+    if (opts.prevImage) new Image().src = opts.prevImage;
+    if (opts.nextImage) new Image().src = opts.nextImage;
 
     // Keyboard navigation
     document.addEventListener('keydown', (e) => {
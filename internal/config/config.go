@@ -1,11 +1,22 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Config struct {
@@ -15,6 +26,241 @@ type Config struct {
 	ListenAddr  string
 	AdminUser   string
 	AdminPass   string
+	// bcrypt hash checked instead of AdminPass when set.
+	AdminPassHash string
+	// Accept Basic auth on admin routes besides the login session, for
+	// scripts.
+	AllowBasicAuth bool
+	// When SitePassword is set, every public page and image needs a
+	// visitor login (or the admin's). SiteUser is optional.
+	SiteUser     string
+	SitePassword string
+	// Public origin for absolute links, e.g. "https://photos.example.com";
+	// empty means taken from each request.
+	BaseURL string
+	// Key for signed cookies; when SECRET_KEY is unset, a random key kept
+	// in CACHE_DIR/secret_key.
+	SecretKey []byte
+	// Failed admin logins from one IP within AuthLockout before it is
+	// locked out for AuthLockout; zero disables the lockout.
+	AuthMaxFailures int
+	AuthLockout     time.Duration
+	// Header a reverse proxy sets to the client address, e.g.
+	// "X-Forwarded-For"; empty means the connection's address is used.
+	TrustedProxyHeader string
+	// Peers whose forwarding headers are believed.
+	TrustedProxies []netip.Prefix
+
+	DedupHardlinks bool
+	StripGPS       bool
+	WatchMedia     bool
+	// Keep search engines out of the whole site.
+	PrivateMode bool
+
+	// "text" or "json".
+	LogFormat string
+	// Log one in this many successful static and thumbnail requests;
+	// zero logs none of them.
+	LogAssetSample int
+
+	// ExifInfo JSON field names hidden from the public photo page.
+	ExifPrivateFields []string
+	// Zone for EXIF capture times that carry no offset of their own.
+	DefaultTimezone *time.Location
+
+	DiskReserveBytes   uint64
+	CacheCriticalBytes uint64
+	CacheMaxBytes      uint64
+	// Largest upload request body accepted; zero means no limit.
+	MaxUploadSize int64
+
+	UndoWindow time.Duration
+
+	ScanWorkers int
+	// Gitignore-style patterns skipped by scans, before .photodockignore.
+	ScanIgnore []string
+	// Clean Orphans leaves empty folders whose directory still has files.
+	CleanKeepFoldersWithFiles bool
+
+	ThumbSizes      map[string]ThumbSpec
+	ThumbWorkers    int
+	DecodeMaxPixels uint64
+	ThumbBackend    string
+
+	// Bounds for /img/{id}: the largest edge asked for and, unless nil for
+	// IMG_SIZES=any, the only widths and heights served.
+	ImageMaxEdge int
+	ImageSizes   []int
+
+	// Chunked uploads not finished within this long are discarded.
+	UploadTTL time.Duration
+
+	CacheMaxAge CacheMaxAge
+
+	BackupInterval time.Duration
+	BackupKeep     int
+	BackupMaxAge   time.Duration
+}
+
+// Seconds; zero means "no-cache".
+type CacheMaxAge struct {
+	Thumbnails   int
+	Placeholders int
+	Originals    int
+	Static       int
+	HTML         int
+}
+
+func parseCacheMaxAge(v string) (CacheMaxAge, error) {
+	ages := CacheMaxAge{
+		Thumbnails:   31536000,
+		Placeholders: 31536000,
+		Originals:    31536000,
+		Static:       3600,
+		HTML:         0,
+	}
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		class, secs, ok := strings.Cut(entry, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(secs))
+		if !ok || err != nil || n < 0 {
+			return ages, fmt.Errorf("invalid CACHE_MAX_AGE entry %q", entry)
+		}
+		switch strings.TrimSpace(class) {
+		case "thumbnails":
+			ages.Thumbnails = n
+		case "placeholders":
+			ages.Placeholders = n
+		case "originals":
+			ages.Originals = n
+		case "static":
+			ages.Static = n
+		case "html":
+			ages.HTML = n
+		default:
+			return ages, fmt.Errorf("unknown CACHE_MAX_AGE class %q", class)
+		}
+	}
+	return ages, nil
+}
+
+type ThumbSpec struct {
+	Width   int
+	Quality int
+	Square  bool
+}
+
+const defaultThumbSizes = "small=300:80,medium=800:85,large=1440:85,grid=300:80"
+
+// Every allowed size is one more rendition per photo a client can make
+// the server produce and cache.
+const defaultImageSizes = "320,640,960,1280,1920,2560"
+
+var thumbSizeName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+func parseThumbSizes(v string) (map[string]ThumbSpec, error) {
+	// Entries override the defaults by name, so small, medium, large and
+	// grid always exist for the templates and API that link to them. grid
+	// is the one square crop; its width is the edge length.
+	sizes := make(map[string]ThumbSpec)
+	for _, src := range []string{defaultThumbSizes, v} {
+		for _, entry := range strings.Split(src, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			name, spec, ok := strings.Cut(entry, "=")
+			name = strings.TrimSpace(name)
+			if !ok || !thumbSizeName.MatchString(name) || name == "placeholder" || name == "web" {
+				return nil, fmt.Errorf("invalid THUMB_SIZES entry %q", entry)
+			}
+			widthStr, qualityStr, _ := strings.Cut(spec, ":")
+			width, err := strconv.Atoi(strings.TrimSpace(widthStr))
+			if err != nil || width < 16 || width > 10000 {
+				return nil, fmt.Errorf("invalid THUMB_SIZES width in %q", entry)
+			}
+			quality := 85
+			if qualityStr != "" {
+				quality, err = strconv.Atoi(strings.TrimSpace(qualityStr))
+				if err != nil || quality < 1 || quality > 100 {
+					return nil, fmt.Errorf("invalid THUMB_SIZES quality in %q", entry)
+				}
+			}
+			sizes[name] = ThumbSpec{Width: width, Quality: quality, Square: name == "grid"}
+		}
+	}
+	return sizes, nil
+}
+
+// parseTrustedProxies reads a comma-separated list of CIDRs and single
+// addresses.
+func parseTrustedProxies(v string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", entry)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// secretKeyFile keeps the generated signing key when SECRET_KEY is unset.
+// Cookies only sign what their holder already knows, so the key must not
+// be derivable from anything guessable such as the admin password.
+const secretKeyFile = "secret_key"
+
+func loadSecretKey(cacheDir string) ([]byte, error) {
+	path := filepath.Join(cacheDir, secretKeyFile)
+	if b, err := os.ReadFile(path); err == nil {
+		if key, err := hex.DecodeString(strings.TrimSpace(string(b))); err == nil && len(key) >= 32 {
+			return key, nil
+		}
+		return nil, fmt.Errorf("%s is not a hex key of at least 32 bytes", path)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		// Another process got there first.
+		return loadSecretKey(cacheDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.WriteString(hex.EncodeToString(key) + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+	return key, nil
 }
 
 func Load() (*Config, error) {
@@ -48,22 +294,338 @@ func Load() (*Config, error) {
 		listenAddr = ":8080"
 	}
 
+	baseURL := strings.TrimRight(os.Getenv("BASE_URL"), "/")
+	if baseURL != "" {
+		u, err := url.Parse(baseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid BASE_URL: %q", baseURL)
+		}
+	}
+
 	adminUser := os.Getenv("ADMIN_USER")
 	if adminUser == "" {
 		adminUser = "admin"
 	}
 
 	adminPass := os.Getenv("ADMIN_PASS")
-	if adminPass == "" {
-		return nil, fmt.Errorf("ADMIN_PASS is required")
+	adminPassHash := os.Getenv("ADMIN_PASS_HASH")
+	if adminPassHash != "" {
+		if _, err := bcrypt.Cost([]byte(adminPassHash)); err != nil {
+			return nil, fmt.Errorf("invalid ADMIN_PASS_HASH: %w", err)
+		}
+	} else if adminPass == "" {
+		return nil, fmt.Errorf("ADMIN_PASS or ADMIN_PASS_HASH is required")
+	}
+
+	allowBasicAuth := os.Getenv("ALLOW_BASIC_AUTH") == "true"
+
+	siteUser := os.Getenv("SITE_USER")
+	sitePassword := os.Getenv("SITE_PASSWORD")
+	if sitePassword == "" {
+		sitePassword = os.Getenv("SITE_PASS")
+	}
+	if siteUser != "" && sitePassword == "" {
+		return nil, fmt.Errorf("SITE_USER needs SITE_PASS")
+	}
+
+	secretKey := []byte(os.Getenv("SECRET_KEY"))
+	if len(secretKey) == 0 {
+		if secretKey, err = loadSecretKey(cacheDirAbs); err != nil {
+			return nil, fmt.Errorf("SECRET_KEY is unset and no key could be kept in CACHE_DIR: %w", err)
+		}
+	}
+
+	authMaxFailures := 10
+	if v := os.Getenv("AUTH_MAX_FAILURES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid AUTH_MAX_FAILURES: %q", v)
+		}
+		authMaxFailures = n
+	}
+
+	authLockoutMinutes := 15
+	if v := os.Getenv("AUTH_LOCKOUT_MINUTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid AUTH_LOCKOUT_MINUTES: %q", v)
+		}
+		authLockoutMinutes = n
+	}
+
+	trustedProxyHeader := http.CanonicalHeaderKey(strings.TrimSpace(os.Getenv("TRUSTED_PROXY_HEADER")))
+
+	// Loopback and private networks, where a reverse proxy usually runs.
+	proxies := "127.0.0.0/8,::1/128,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7"
+	if v, ok := os.LookupEnv("TRUSTED_PROXIES"); ok {
+		proxies = v
+	}
+	trustedProxies, err := parseTrustedProxies(proxies)
+	if err != nil {
+		return nil, err
+	}
+
+	logFormat := os.Getenv("LOG_FORMAT")
+	switch logFormat {
+	case "":
+		logFormat = "text"
+	case "text", "json":
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT: %q", logFormat)
+	}
+
+	var logAssetSample int
+	if v := os.Getenv("LOG_ASSET_SAMPLE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid LOG_ASSET_SAMPLE: %q", v)
+		}
+		logAssetSample = n
+	}
+
+	dedupHardlinks := os.Getenv("DEDUP_HARDLINKS") == "true"
+	stripGPS := os.Getenv("STRIP_GPS") != "false"
+	watchMedia := os.Getenv("WATCH_MEDIA") == "true"
+	// A site behind a login has nothing for search engines either.
+	privateMode := os.Getenv("PRIVATE_MODE") == "true" || sitePassword != ""
+
+	// Set but empty means nothing is private.
+	exifPrivateFields := []string{"serial_number", "owner_name", "image_unique_id", "file_number"}
+	if v, ok := os.LookupEnv("EXIF_PRIVATE_FIELDS"); ok {
+		exifPrivateFields = nil
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				exifPrivateFields = append(exifPrivateFields, name)
+			}
+		}
+	}
+
+	defaultTimezone := time.UTC
+	if v := os.Getenv("DEFAULT_TIMEZONE"); v != "" {
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DEFAULT_TIMEZONE: %w", err)
+		}
+		defaultTimezone = loc
+	}
+
+	diskReserveMB := uint64(1024)
+	if v := os.Getenv("DISK_RESERVE_MB"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DISK_RESERVE_MB: %w", err)
+		}
+		diskReserveMB = n
+	}
+
+	cacheCriticalMB := uint64(100)
+	if v := os.Getenv("CACHE_CRITICAL_MB"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CACHE_CRITICAL_MB: %w", err)
+		}
+		cacheCriticalMB = n
+	}
+
+	var cacheMaxBytes uint64
+	if v := os.Getenv("CACHE_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CACHE_MAX_BYTES: %w", err)
+		}
+		cacheMaxBytes = n
+	}
+
+	maxUploadSize := int64(4 << 30)
+	if v := os.Getenv("MAX_UPLOAD_SIZE"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid MAX_UPLOAD_SIZE: %q", v)
+		}
+		maxUploadSize = n
+	}
+
+	undoWindowMinutes := 1440
+	if v := os.Getenv("UNDO_WINDOW_MINUTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid UNDO_WINDOW_MINUTES: %q", v)
+		}
+		undoWindowMinutes = n
+	}
+
+	thumbSizes, err := parseThumbSizes(os.Getenv("THUMB_SIZES"))
+	if err != nil {
+		return nil, err
+	}
+
+	thumbWorkers := runtime.NumCPU()
+	if v := os.Getenv("THUMB_WORKERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid THUMB_WORKERS: %q", v)
+		}
+		thumbWorkers = n
+	}
+
+	scanWorkers := runtime.NumCPU()
+	if v := os.Getenv("SCAN_WORKERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid SCAN_WORKERS: %q", v)
+		}
+		scanWorkers = n
+	}
+
+	cleanKeepFoldersWithFiles := os.Getenv("CLEAN_KEEP_FOLDERS_WITH_FILES") != "false"
+
+	var scanIgnore []string
+	for _, p := range strings.Split(os.Getenv("SCAN_IGNORE"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			scanIgnore = append(scanIgnore, p)
+		}
+	}
+
+	decodeMaxMP := uint64(40)
+	if v := os.Getenv("THUMB_DECODE_MAX_MEGAPIXELS"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid THUMB_DECODE_MAX_MEGAPIXELS: %w", err)
+		}
+		decodeMaxMP = n
+	}
+
+	thumbBackend := os.Getenv("THUMB_BACKEND")
+	switch thumbBackend {
+	case "":
+		thumbBackend = "go"
+	case "go", "vips":
+	default:
+		return nil, fmt.Errorf("invalid THUMB_BACKEND: %q", thumbBackend)
+	}
+
+	imageMaxEdge := 2560
+	if v := os.Getenv("IMG_MAX_EDGE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid IMG_MAX_EDGE: %q", v)
+		}
+		imageMaxEdge = n
+	}
+
+	imgSizes := os.Getenv("IMG_SIZES")
+	if imgSizes == "" {
+		imgSizes = defaultImageSizes
+	}
+	var imageSizes []int
+	if imgSizes != "any" {
+		for _, v := range strings.Split(imgSizes, ",") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid IMG_SIZES entry %q", v)
+			}
+			imageSizes = append(imageSizes, n)
+		}
+	}
+
+	uploadTTLHours := 24
+	if v := os.Getenv("UPLOAD_TTL_HOURS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid UPLOAD_TTL_HOURS: %q", v)
+		}
+		uploadTTLHours = n
+	}
+
+	cacheMaxAge, err := parseCacheMaxAge(os.Getenv("CACHE_MAX_AGE"))
+	if err != nil {
+		return nil, err
+	}
+
+	backupIntervalHours := 24
+	if v := os.Getenv("BACKUP_INTERVAL_HOURS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid BACKUP_INTERVAL_HOURS: %q", v)
+		}
+		backupIntervalHours = n
+	}
+
+	backupKeep := 7
+	if v := os.Getenv("BACKUP_KEEP"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid BACKUP_KEEP: %q", v)
+		}
+		backupKeep = n
+	}
+
+	var backupMaxAgeDays int
+	if v := os.Getenv("BACKUP_MAX_AGE_DAYS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid BACKUP_MAX_AGE_DAYS: %q", v)
+		}
+		backupMaxAgeDays = n
 	}
 
 	return &Config{
-		DatabaseURL: dbURL,
-		MediaRoot:   mediaRootAbs,
-		CacheDir:    cacheDirAbs,
-		ListenAddr:  listenAddr,
-		AdminUser:   adminUser,
-		AdminPass:   adminPass,
+		DatabaseURL:    dbURL,
+		MediaRoot:      mediaRootAbs,
+		CacheDir:       cacheDirAbs,
+		ListenAddr:     listenAddr,
+		AdminUser:      adminUser,
+		AdminPass:      adminPass,
+		AdminPassHash:  adminPassHash,
+		AllowBasicAuth: allowBasicAuth,
+		SiteUser:       siteUser,
+		SitePassword:   sitePassword,
+		BaseURL:        baseURL,
+		SecretKey:      secretKey,
+		DedupHardlinks: dedupHardlinks,
+		StripGPS:       stripGPS,
+		WatchMedia:     watchMedia,
+		PrivateMode:    privateMode,
+
+		LogFormat:      logFormat,
+		LogAssetSample: logAssetSample,
+
+		AuthMaxFailures:    authMaxFailures,
+		AuthLockout:        time.Duration(authLockoutMinutes) * time.Minute,
+		TrustedProxyHeader: trustedProxyHeader,
+		TrustedProxies:     trustedProxies,
+
+		ExifPrivateFields: exifPrivateFields,
+		DefaultTimezone:   defaultTimezone,
+
+		DiskReserveBytes:   diskReserveMB << 20,
+		CacheCriticalBytes: cacheCriticalMB << 20,
+		CacheMaxBytes:      cacheMaxBytes,
+		MaxUploadSize:      maxUploadSize,
+
+		UndoWindow: time.Duration(undoWindowMinutes) * time.Minute,
+
+		ScanWorkers:               scanWorkers,
+		ScanIgnore:                scanIgnore,
+		CleanKeepFoldersWithFiles: cleanKeepFoldersWithFiles,
+
+		ThumbSizes:      thumbSizes,
+		ThumbWorkers:    thumbWorkers,
+		DecodeMaxPixels: decodeMaxMP * 1000000,
+		ThumbBackend:    thumbBackend,
+
+		ImageMaxEdge: imageMaxEdge,
+		ImageSizes:   imageSizes,
+
+		UploadTTL: time.Duration(uploadTTLHours) * time.Hour,
+
+		CacheMaxAge: cacheMaxAge,
+
+		BackupInterval: time.Duration(backupIntervalHours) * time.Hour,
+		BackupKeep:     backupKeep,
+		BackupMaxAge:   time.Duration(backupMaxAgeDays) * 24 * time.Hour,
 	}, nil
 }
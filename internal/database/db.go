@@ -11,7 +11,15 @@ type DB struct {
 }
 
 func New(connString string) (*DB, error) {
-	pool, err := pgxpool.New(context.Background(), connString)
+	cfg, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, err
+	}
+	return Open(cfg)
+}
+
+func Open(cfg *pgxpool.Config) (*DB, error) {
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
 	if err != nil {
 		return nil, err
 	}
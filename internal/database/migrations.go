@@ -56,11 +56,322 @@ func (db *DB) Migrate() error {
 
 	CREATE INDEX IF NOT EXISTS idx_photos_url_path ON photos(url_path);
 
+	ALTER TABLE photos ADD COLUMN IF NOT EXISTS sha256 TEXT;
+	CREATE INDEX IF NOT EXISTS idx_photos_sha256 ON photos(sha256);
+
+	CREATE TABLE IF NOT EXISTS settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS url_redirects (
+		id SERIAL PRIMARY KEY,
+		old_path TEXT NOT NULL UNIQUE,
+		new_path TEXT NOT NULL,
+		photo_id INTEGER REFERENCES photos(id) ON DELETE CASCADE,
+		created_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_url_redirects_new_path ON url_redirects(new_path);
+
+	ALTER TABLE folders ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'published';
+	ALTER TABLE folders ADD COLUMN IF NOT EXISTS published_at TIMESTAMPTZ;
+	ALTER TABLE folders ADD COLUMN IF NOT EXISTS draft BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE photos ADD COLUMN IF NOT EXISTS draft BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE photos ADD COLUMN IF NOT EXISTS published_at TIMESTAMPTZ;
+	UPDATE photos SET published_at = created_at WHERE published_at IS NULL AND draft = false;
+	CREATE INDEX IF NOT EXISTS idx_photos_draft ON photos(draft);
+	CREATE INDEX IF NOT EXISTS idx_photos_published_at ON photos(published_at);
+
+	CREATE TABLE IF NOT EXISTS undo_tokens (
+		token TEXT PRIMARY KEY,
+		action TEXT NOT NULL,
+		photo_count INTEGER NOT NULL,
+		payload JSONB NOT NULL,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		expires_at TIMESTAMPTZ NOT NULL,
+		used_at TIMESTAMPTZ
+	);
+
 	CREATE TABLE IF NOT EXISTS photo_stats_cache (
 		key TEXT PRIMARY KEY,
 		data JSONB NOT NULL,
 		updated_at TIMESTAMPTZ DEFAULT NOW()
 	);
+
+	ALTER TABLE folders ADD COLUMN IF NOT EXISTS continue_nav BOOLEAN;
+	ALTER TABLE folders ADD COLUMN IF NOT EXISTS slideshow_interval INTEGER;
+
+	ALTER TABLE photos ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE photos ADD COLUMN IF NOT EXISTS thumb_error TEXT;
+
+	ALTER TABLE folders ADD COLUMN IF NOT EXISTS content_updated_at TIMESTAMPTZ;
+	UPDATE folders f SET content_updated_at = COALESCE(
+		(SELECT MAX(p.updated_at) FROM photos p JOIN folders sf ON sf.id = p.folder_id
+		WHERE sf.id = f.id OR left(sf.path, length(f.path) + 1) = f.path || '/'),
+		f.updated_at, f.created_at, NOW())
+	WHERE content_updated_at IS NULL;
+	ALTER TABLE folders ALTER COLUMN content_updated_at SET DEFAULT NOW();
+
+	CREATE OR REPLACE FUNCTION photodock_touch_updated_at() RETURNS trigger AS $$
+	BEGIN
+		IF (to_jsonb(NEW) - 'updated_at' - 'content_updated_at' - 'thumb_error' - 'live_from' - 'live_until' - 'locked_by')
+			IS DISTINCT FROM (to_jsonb(OLD) - 'updated_at' - 'content_updated_at' - 'thumb_error' - 'live_from' - 'live_until' - 'locked_by') THEN
+			NEW.updated_at = NOW();
+		END IF;
+		RETURN NEW;
+	END $$ LANGUAGE plpgsql;
+
+	CREATE OR REPLACE FUNCTION photodock_bubble_content(folder INTEGER) RETURNS void AS $$
+		UPDATE folders f SET content_updated_at = NOW()
+		FROM folders o
+		WHERE o.id = folder AND (f.id = o.id OR left(o.path, length(f.path) + 1) = f.path || '/');
+	$$ LANGUAGE sql;
+
+	CREATE OR REPLACE FUNCTION photodock_photo_changed() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'INSERT' THEN
+			PERFORM photodock_bubble_content(NEW.folder_id);
+		ELSIF TG_OP = 'DELETE' THEN
+			PERFORM photodock_bubble_content(OLD.folder_id);
+		ELSIF NEW.updated_at IS DISTINCT FROM OLD.updated_at THEN
+			PERFORM photodock_bubble_content(NEW.folder_id);
+			IF NEW.folder_id IS DISTINCT FROM OLD.folder_id THEN
+				PERFORM photodock_bubble_content(OLD.folder_id);
+			END IF;
+		END IF;
+		RETURN NULL;
+	END $$ LANGUAGE plpgsql;
+
+	CREATE OR REPLACE FUNCTION photodock_folder_changed() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			PERFORM photodock_bubble_content(OLD.parent_id);
+		ELSE
+			PERFORM photodock_bubble_content(NEW.id);
+			IF TG_OP = 'UPDATE' AND NEW.parent_id IS DISTINCT FROM OLD.parent_id THEN
+				PERFORM photodock_bubble_content(OLD.parent_id);
+			END IF;
+		END IF;
+		RETURN NULL;
+	END $$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS photos_touch_updated_at ON photos;
+	CREATE TRIGGER photos_touch_updated_at BEFORE UPDATE ON photos
+		FOR EACH ROW EXECUTE FUNCTION photodock_touch_updated_at();
+	DROP TRIGGER IF EXISTS folders_touch_updated_at ON folders;
+	CREATE TRIGGER folders_touch_updated_at BEFORE UPDATE ON folders
+		FOR EACH ROW EXECUTE FUNCTION photodock_touch_updated_at();
+	DROP TRIGGER IF EXISTS photos_bubble_content ON photos;
+	CREATE TRIGGER photos_bubble_content AFTER INSERT OR UPDATE OR DELETE ON photos
+		FOR EACH ROW EXECUTE FUNCTION photodock_photo_changed();
+
+	-- publish_at/expires_at are what the admin sets; live_from/live_until are
+	-- the effective window after intersecting with every ancestor folder, so
+	-- public queries check one row instead of walking the tree.
+	ALTER TABLE folders ADD COLUMN IF NOT EXISTS publish_at TIMESTAMPTZ;
+	ALTER TABLE folders ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+	ALTER TABLE folders ADD COLUMN IF NOT EXISTS live_from TIMESTAMPTZ;
+	ALTER TABLE folders ADD COLUMN IF NOT EXISTS live_until TIMESTAMPTZ;
+	ALTER TABLE photos ADD COLUMN IF NOT EXISTS publish_at TIMESTAMPTZ;
+	ALTER TABLE photos ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+	ALTER TABLE photos ADD COLUMN IF NOT EXISTS live_from TIMESTAMPTZ;
+	ALTER TABLE photos ADD COLUMN IF NOT EXISTS live_until TIMESTAMPTZ;
+	CREATE INDEX IF NOT EXISTS idx_photos_live ON photos(live_from, live_until);
+	CREATE INDEX IF NOT EXISTS idx_folders_live ON folders(live_from, live_until);
+	CREATE INDEX IF NOT EXISTS idx_photos_publish_at ON photos(publish_at) WHERE publish_at IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS idx_photos_expires_at ON photos(expires_at) WHERE expires_at IS NOT NULL;
+
+	-- Simple enough for the planner to inline, so the index above still applies.
+	CREATE OR REPLACE FUNCTION photodock_live(live_from TIMESTAMPTZ, live_until TIMESTAMPTZ) RETURNS boolean AS $$
+		SELECT ($1 IS NULL OR $1 <= NOW()) AND ($2 IS NULL OR $2 > NOW())
+	$$ LANGUAGE sql STABLE;
+
+	CREATE OR REPLACE FUNCTION photodock_folder_window() RETURNS trigger AS $$
+	BEGIN
+		SELECT GREATEST(NEW.publish_at, p.live_from), LEAST(NEW.expires_at, p.live_until)
+			INTO NEW.live_from, NEW.live_until
+			FROM folders p WHERE p.id = NEW.parent_id;
+		IF NOT FOUND THEN
+			NEW.live_from := NEW.publish_at;
+			NEW.live_until := NEW.expires_at;
+		END IF;
+		RETURN NEW;
+	END $$ LANGUAGE plpgsql;
+
+	CREATE OR REPLACE FUNCTION photodock_photo_window() RETURNS trigger AS $$
+	BEGIN
+		SELECT GREATEST(NEW.publish_at, f.live_from), LEAST(NEW.expires_at, f.live_until)
+			INTO NEW.live_from, NEW.live_until
+			FROM folders f WHERE f.id = NEW.folder_id;
+		IF NOT FOUND THEN
+			NEW.live_from := NEW.publish_at;
+			NEW.live_until := NEW.expires_at;
+		END IF;
+		RETURN NEW;
+	END $$ LANGUAGE plpgsql;
+
+	-- Rewriting publish_at in place re-runs the BEFORE triggers of children,
+	-- which recurse down the tree. Not UPDATE OF: column lists ignore values
+	-- set by BEFORE triggers.
+	CREATE OR REPLACE FUNCTION photodock_folder_window_cascade() RETURNS trigger AS $$
+	BEGIN
+		UPDATE folders SET publish_at = publish_at WHERE parent_id = NEW.id;
+		UPDATE photos SET publish_at = publish_at WHERE folder_id = NEW.id;
+		RETURN NULL;
+	END $$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS folders_window ON folders;
+	CREATE TRIGGER folders_window BEFORE INSERT OR UPDATE OF parent_id, publish_at, expires_at ON folders
+		FOR EACH ROW EXECUTE FUNCTION photodock_folder_window();
+	DROP TRIGGER IF EXISTS photos_window ON photos;
+	CREATE TRIGGER photos_window BEFORE INSERT OR UPDATE OF folder_id, publish_at, expires_at ON photos
+		FOR EACH ROW EXECUTE FUNCTION photodock_photo_window();
+	DROP TRIGGER IF EXISTS folders_window_cascade ON folders;
+	CREATE TRIGGER folders_window_cascade AFTER UPDATE ON folders
+		FOR EACH ROW WHEN (OLD.live_from IS DISTINCT FROM NEW.live_from OR OLD.live_until IS DISTINCT FROM NEW.live_until)
+		EXECUTE FUNCTION photodock_folder_window_cascade();
+
+	ALTER TABLE photos ADD COLUMN IF NOT EXISTS lat DOUBLE PRECISION;
+	ALTER TABLE photos ADD COLUMN IF NOT EXISTS lon DOUBLE PRECISION;
+	ALTER TABLE photos ADD COLUMN IF NOT EXISTS altitude DOUBLE PRECISION;
+	CREATE INDEX IF NOT EXISTS idx_photos_located ON photos(id) WHERE lat IS NOT NULL;
+
+	CREATE TABLE IF NOT EXISTS tags (
+		id SERIAL PRIMARY KEY,
+		name TEXT NOT NULL
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_name ON tags(lower(name));
+
+	CREATE TABLE IF NOT EXISTS photo_tags (
+		photo_id INTEGER NOT NULL REFERENCES photos(id) ON DELETE CASCADE,
+		tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+		PRIMARY KEY (photo_id, tag_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_photo_tags_tag ON photo_tags(tag_id);
+
+	ALTER TABLE photos ADD COLUMN IF NOT EXISTS rating SMALLINT CHECK (rating BETWEEN 1 AND 5);
+	CREATE INDEX IF NOT EXISTS idx_photos_rating ON photos(folder_id, rating) WHERE rating IS NOT NULL;
+
+	ALTER TABLE photos ADD COLUMN IF NOT EXISTS file_mtime TIMESTAMPTZ;
+
+	CREATE TABLE IF NOT EXISTS scan_runs (
+		id SERIAL PRIMARY KEY,
+		type TEXT NOT NULL,
+		path TEXT NOT NULL DEFAULT '',
+		state TEXT NOT NULL DEFAULT 'running',
+		started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		finished_at TIMESTAMPTZ,
+		added INTEGER NOT NULL DEFAULT 0,
+		updated INTEGER NOT NULL DEFAULT 0,
+		removed INTEGER NOT NULL DEFAULT 0,
+		error_count INTEGER NOT NULL DEFAULT 0,
+		error TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS scan_errors (
+		id SERIAL PRIMARY KEY,
+		run_id INTEGER NOT NULL REFERENCES scan_runs(id) ON DELETE CASCADE,
+		path TEXT NOT NULL,
+		stage TEXT NOT NULL,
+		message TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS idx_scan_errors_run ON scan_errors(run_id);
+
+	-- Scans still running when the server stopped never finished.
+	UPDATE scan_runs SET state = 'failed', error = 'interrupted by a restart'
+		WHERE finished_at IS NULL AND state = 'running';
+
+	-- access_password is the bcrypt hash the admin sets; locked_by is the
+	-- nearest folder up the tree that has one, kept by triggers like the
+	-- publish window so a request checks a single row.
+	ALTER TABLE folders ADD COLUMN IF NOT EXISTS access_password TEXT;
+	ALTER TABLE folders ADD COLUMN IF NOT EXISTS locked_by INTEGER;
+	ALTER TABLE photos ADD COLUMN IF NOT EXISTS locked_by INTEGER;
+	CREATE INDEX IF NOT EXISTS idx_photos_locked_by ON photos(locked_by) WHERE locked_by IS NOT NULL;
+
+	CREATE OR REPLACE FUNCTION photodock_folder_lock() RETURNS trigger AS $$
+	BEGIN
+		IF NEW.access_password IS NOT NULL THEN
+			NEW.locked_by := NEW.id;
+		ELSE
+			NEW.locked_by := (SELECT p.locked_by FROM folders p WHERE p.id = NEW.parent_id);
+		END IF;
+		RETURN NEW;
+	END $$ LANGUAGE plpgsql;
+
+	CREATE OR REPLACE FUNCTION photodock_photo_lock() RETURNS trigger AS $$
+	BEGIN
+		NEW.locked_by := (SELECT f.locked_by FROM folders f WHERE f.id = NEW.folder_id);
+		RETURN NEW;
+	END $$ LANGUAGE plpgsql;
+
+	CREATE OR REPLACE FUNCTION photodock_folder_lock_cascade() RETURNS trigger AS $$
+	BEGIN
+		UPDATE folders SET parent_id = parent_id WHERE parent_id = NEW.id;
+		UPDATE photos SET folder_id = folder_id WHERE folder_id = NEW.id;
+		RETURN NULL;
+	END $$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS folders_lock ON folders;
+	CREATE TRIGGER folders_lock BEFORE INSERT OR UPDATE OF parent_id, access_password ON folders
+		FOR EACH ROW EXECUTE FUNCTION photodock_folder_lock();
+	DROP TRIGGER IF EXISTS photos_lock ON photos;
+	CREATE TRIGGER photos_lock BEFORE INSERT OR UPDATE OF folder_id ON photos
+		FOR EACH ROW EXECUTE FUNCTION photodock_photo_lock();
+	DROP TRIGGER IF EXISTS folders_lock_cascade ON folders;
+	CREATE TRIGGER folders_lock_cascade AFTER UPDATE ON folders
+		FOR EACH ROW WHEN (OLD.locked_by IS DISTINCT FROM NEW.locked_by)
+		EXECUTE FUNCTION photodock_folder_lock_cascade();
+
+	-- Only the SHA-256 of a token is kept; "write" implies "read".
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id SERIAL PRIMARY KEY,
+		name TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		scope TEXT NOT NULL DEFAULT 'read' CHECK (scope IN ('read', 'write')),
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		last_used_at TIMESTAMPTZ
+	);
+
+	-- Keeps a folder and everything below it out of search engines.
+	ALTER TABLE folders ADD COLUMN IF NOT EXISTS noindex BOOLEAN NOT NULL DEFAULT FALSE;
+
+	-- Listing columns keeps the content_updated_at writes from re-firing it.
+	-- Created here, after every column it lists exists on a new database.
+	DROP TRIGGER IF EXISTS folders_bubble_content ON folders;
+	CREATE TRIGGER folders_bubble_content AFTER INSERT OR DELETE OR UPDATE OF parent_id, name, path, cover_photo_id, status, draft, publish_at, expires_at, access_password, noindex ON folders
+		FOR EACH ROW EXECUTE FUNCTION photodock_folder_changed();
+
+	-- Tags show on photo pages, so they move the content version too.
+	CREATE OR REPLACE FUNCTION photodock_photo_tags_changed() RETURNS trigger AS $$
+	BEGIN
+		PERFORM photodock_bubble_content(p.folder_id) FROM photos p
+		WHERE p.id = CASE WHEN TG_OP = 'DELETE' THEN OLD.photo_id ELSE NEW.photo_id END;
+		RETURN NULL;
+	END $$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS photo_tags_bubble_content ON photo_tags;
+	CREATE TRIGGER photo_tags_bubble_content AFTER INSERT OR DELETE ON photo_tags
+		FOR EACH ROW EXECUTE FUNCTION photodock_photo_tags_changed();
+
+	-- For the latest publish window boundary in page versions.
+	CREATE INDEX IF NOT EXISTS idx_photos_live_until ON photos(live_until) WHERE live_until IS NOT NULL;
+
+	-- Camera and lens listings filter with exif_data @> '{...}'.
+	CREATE INDEX IF NOT EXISTS idx_photos_exif_data ON photos USING GIN (exif_data jsonb_path_ops);
+
+	-- Keyset pages of /timeline.
+	CREATE INDEX IF NOT EXISTS idx_photos_timeline ON photos(taken_at, id) WHERE taken_at IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS idx_photos_timeline_undated ON photos(created_at, id) WHERE taken_at IS NULL;
+
+	-- Content hard-linked under more than one photo path.
+	CREATE TABLE IF NOT EXISTS shared_content (
+		sha256 TEXT PRIMARY KEY,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
 	`
 	_, err := db.pool.Exec(context.Background(), schema)
 	return err
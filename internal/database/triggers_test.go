@@ -0,0 +1,100 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+	"github.com/Alexander-D-Karpov/photodock/internal/testutil"
+)
+
+var longAgo = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// contentTree creates the folders, each below the one before it when its
+// path says so, and returns their IDs by path.
+func contentTree(t *testing.T, db *database.DB, paths ...string) map[string]int {
+	t.Helper()
+	ctx := context.Background()
+	ids := make(map[string]int)
+	for _, path := range paths {
+		var parent *int
+		name := path
+		for i := len(path) - 1; i >= 0; i-- {
+			if path[i] == '/' {
+				id := ids[path[:i]]
+				parent, name = &id, path[i+1:]
+				break
+			}
+		}
+		var id int
+		if err := db.Pool().QueryRow(ctx, "INSERT INTO folders (parent_id, name, path) VALUES ($1, $2, $3) RETURNING id",
+			parent, name, path).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids[path] = id
+	}
+	return ids
+}
+
+// touched resets every folder's content_updated_at, runs change, and
+// returns the paths of the folders it moved.
+func touched(t *testing.T, db *database.DB, change string, args ...any) map[string]bool {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := db.Pool().Exec(ctx, "UPDATE folders SET content_updated_at = $1", longAgo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Pool().Exec(ctx, change, args...); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Pool().Query(ctx, "SELECT path FROM folders WHERE content_updated_at > $1", longAgo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	out := make(map[string]bool)
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			t.Fatal(err)
+		}
+		out[path] = true
+	}
+	return out
+}
+
+func assertTouched(t *testing.T, what string, got map[string]bool, want ...string) {
+	t.Helper()
+	for _, path := range want {
+		if !got[path] {
+			t.Errorf("%s: %s not touched", what, path)
+		}
+		delete(got, path)
+	}
+	for path := range got {
+		t.Errorf("%s: %s touched", what, path)
+	}
+}
+
+func TestContentUpdatedAtBubbles(t *testing.T) {
+	db := testutil.Postgres(t)
+	ctx := context.Background()
+	ids := contentTree(t, db, "A", "A/B", "A/B/C", "X", "X/Y", "Z")
+
+	var photo int
+	if err := db.Pool().QueryRow(ctx,
+		"INSERT INTO photos (folder_id, filename, path) VALUES ($1, 'p.jpg', 'A/B/C/p.jpg') RETURNING id",
+		ids["A/B/C"]).Scan(&photo); err != nil {
+		t.Fatal(err)
+	}
+
+	moved := touched(t, db, "UPDATE photos SET folder_id = $2, path = 'X/Y/p.jpg' WHERE id = $1", photo, ids["X/Y"])
+	assertTouched(t, "move", moved, "A", "A/B", "A/B/C", "X", "X/Y")
+
+	hidden := touched(t, db, "UPDATE photos SET hidden = true WHERE id = $1", photo)
+	assertTouched(t, "hide", hidden, "X", "X/Y")
+
+	unchanged := touched(t, db, "UPDATE photos SET hidden = true WHERE id = $1", photo)
+	assertTouched(t, "no-op update", unchanged)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sessionCookie = "photodock_session"
+	sessionTTL    = 7 * 24 * time.Hour
+	csrfHeader    = "X-CSRF-Token"
+	csrfField     = "csrf_token"
+
+	settingSessionGeneration = "admin.session_generation"
+)
+
+func (h *Handlers) sign(parts ...string) string {
+	mac := hmac.New(sha256.New, h.cfg.SecretKey)
+	mac.Write([]byte(strings.Join(parts, ":")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (h *Handlers) validSession(r *http.Request) bool {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+	exp, sig, _ := strings.Cut(c.Value, ".")
+	expiry, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || expiry < time.Now().Unix() {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(h.sessionSig(r.Context(), exp)))
+}
+
+// The password and a generation that logout bumps are signed too, so a
+// password change or a logout revokes every session issued before it.
+func (h *Handlers) sessionSig(ctx context.Context, exp string) string {
+	cred := sha256.Sum256([]byte(h.cfg.AdminPassHash + "\x00" + h.cfg.AdminPass))
+	gen := h.settings.Get(ctx, settingSessionGeneration, "0")
+	return h.sign("session", h.cfg.AdminUser, hex.EncodeToString(cred[:]), gen, exp)
+}
+
+// csrfToken is tied to the session, so a new login rotates it.
+func (h *Handlers) csrfToken(r *http.Request) string {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return ""
+	}
+	return h.sign("csrf", c.Value)
+}
+
+// Multipart bodies are left for the handler to stream, so uploads send
+// the header.
+func (h *Handlers) validCSRF(r *http.Request) bool {
+	token := r.Header.Get(csrfHeader)
+	if token == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		token = r.PostFormValue(csrfField)
+	}
+	want := h.csrfToken(r)
+	return want != "" && hmac.Equal([]byte(token), []byte(want))
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func (h *Handlers) secureRequest(r *http.Request) bool {
+	return strings.HasPrefix(h.baseURL(r), "https://")
+}
+
+func (h *Handlers) renderAdmin(w http.ResponseWriter, r *http.Request, name string, data map[string]interface{}) {
+	data["CSRFToken"] = h.csrfToken(r)
+	h.render(w, name, data)
+}
+
+func (h *Handlers) adminLoginPage(w http.ResponseWriter, r *http.Request) {
+	if h.validSession(r) {
+		http.Redirect(w, r, safeNext(r.URL.Query().Get("next")), http.StatusSeeOther)
+		return
+	}
+	h.renderLogin(w, r.URL.Query().Get("next"), http.StatusOK, "")
+}
+
+func (h *Handlers) renderLogin(w http.ResponseWriter, next string, status int, errMsg string) {
+	if next == "" {
+		next = "/admin"
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	h.renderStatus(w, status, "admin/login.html", map[string]interface{}{
+		"Title": "Log in",
+		"Next":  safeNext(next),
+		"Error": errMsg,
+	})
+}
+
+func (h *Handlers) adminLogin(w http.ResponseWriter, r *http.Request) {
+	next := r.FormValue("next")
+	if h.authLockedOut(w, r) {
+		h.renderLogin(w, next, http.StatusTooManyRequests, "Too many failed attempts. Try again later.")
+		return
+	}
+	if !h.tryCredentials(r, r.FormValue("username"), r.FormValue("password")) {
+		h.renderLogin(w, next, http.StatusUnauthorized, "Wrong username or password.")
+		return
+	}
+
+	expires := time.Now().Add(sessionTTL)
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    exp + "." + h.sessionSig(r.Context(), exp),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   h.secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, safeNext(next), http.StatusSeeOther)
+}
+
+func (h *Handlers) adminLogout(w http.ResponseWriter, r *http.Request) {
+	gen := h.settings.GetInt(r.Context(), settingSessionGeneration, 0)
+	if err := h.settings.Set(r.Context(), settingSessionGeneration, strconv.Itoa(gen+1)); err != nil {
+		log.Printf("logout: revoking sessions: %v", err)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+}
+
+func loginRedirect(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return false
+	}
+	http.Redirect(w, r, "/admin/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+	return true
+}
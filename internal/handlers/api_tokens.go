@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenPrefix marks PhotoDock tokens so they are easy to spot in scripts
+// and secret scanners.
+const tokenPrefix = "pdk_"
+
+type apiToken struct {
+	ID         int
+	Name       string
+	Scope      string
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	return strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+func (h *Handlers) tokenScope(r *http.Request) string {
+	token, ok := bearerToken(r)
+	if !ok || !strings.HasPrefix(token, tokenPrefix) {
+		return ""
+	}
+	var scope string
+	err := h.db.Pool().QueryRow(r.Context(), `
+		UPDATE api_tokens SET last_used_at = NOW()
+		WHERE token_hash = $1
+		RETURNING scope`, hashToken(token)).Scan(&scope)
+	if err != nil {
+		return ""
+	}
+	return scope
+}
+
+// Read tokens only get safe methods.
+func (h *Handlers) tokenAuth(w http.ResponseWriter, r *http.Request) bool {
+	if h.authLockedOut(w, r) {
+		http.Error(w, "Too many failed login attempts", http.StatusTooManyRequests)
+		return false
+	}
+	scope := h.tokenScope(r)
+	if scope == "" {
+		token, _ := bearerToken(r)
+		h.authFails.fail(h.clientIP(r), "", token)
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return false
+	}
+	if scope != "write" && !safeMethod(r.Method) {
+		http.Error(w, "This token is read-only", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (h *Handlers) listAPITokens(r *http.Request) ([]apiToken, error) {
+	rows, err := h.db.Pool().Query(r.Context(),
+		"SELECT id, name, scope, created_at, last_used_at FROM api_tokens ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []apiToken
+	for rows.Next() {
+		var t apiToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Scope, &t.CreatedAt, &t.LastUsedAt); err != nil {
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (h *Handlers) renderTokens(w http.ResponseWriter, r *http.Request, newToken string) {
+	tokens, err := h.listAPITokens(r)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	h.renderAdmin(w, r, "admin/tokens.html", map[string]interface{}{
+		"Tokens":   tokens,
+		"NewToken": newToken,
+		"Title":    "API Tokens",
+	})
+}
+
+func (h *Handlers) adminTokens(w http.ResponseWriter, r *http.Request) {
+	h.renderTokens(w, r, "")
+}
+
+// This is the only time a token's value is shown.
+func (h *Handlers) adminCreateToken(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		http.Error(w, "Name is required", 400)
+		return
+	}
+	scope := r.FormValue("scope")
+	if scope != "write" {
+		scope = "read"
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	token := tokenPrefix + hex.EncodeToString(b)
+	if _, err := h.db.Pool().Exec(r.Context(),
+		"INSERT INTO api_tokens (name, token_hash, scope) VALUES ($1, $2, $3)", name, hashToken(token), scope); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	h.renderTokens(w, r, token)
+}
+
+func (h *Handlers) adminRevokeToken(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	if _, err := h.db.Pool().Exec(r.Context(), "DELETE FROM api_tokens WHERE id = $1", id); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	http.Redirect(w, r, "/admin/tokens", http.StatusSeeOther)
+}
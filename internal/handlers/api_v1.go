@@ -0,0 +1,662 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/services"
+	"github.com/jackc/pgx/v5"
+)
+
+// /api/v1 answers with these types only, so field names stay put when
+// the models change. Admin sessions and API tokens also see hidden,
+// draft, scheduled and protected items.
+
+const (
+	publicPhotoSQL  = "hidden = false AND draft = false AND photodock_live(live_from, live_until) AND locked_by IS NULL"
+	publicFolderSQL = "draft = false AND photodock_live(live_from, live_until) AND locked_by IS NULL"
+
+	apiDefaultLimit = 50
+	apiMaxLimit     = 200
+)
+
+type apiFolder struct {
+	ID             int       `json:"id"`
+	ParentID       *int      `json:"parent_id"`
+	Name           string    `json:"name"`
+	Path           string    `json:"path"`
+	URL            string    `json:"url"`
+	CoverURL       string    `json:"cover_url"`
+	PhotoCount     int       `json:"photo_count"`
+	SubfolderCount int       `json:"subfolder_count"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Draft          *bool     `json:"draft,omitempty"`
+}
+
+type apiPhoto struct {
+	ID          int               `json:"id"`
+	FolderID    *int              `json:"folder_id"`
+	Filename    string            `json:"filename"`
+	Path        string            `json:"path"`
+	URL         string            `json:"url"`
+	Title       *string           `json:"title"`
+	Description *string           `json:"description"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	SizeBytes   int64             `json:"size_bytes"`
+	Blurhash    *string           `json:"blurhash"`
+	Rating      *int              `json:"rating"`
+	TakenAt     *time.Time        `json:"taken_at"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Thumbnails  map[string]string `json:"thumbnails"`
+	Original    string            `json:"original"`
+	Tags        []string          `json:"tags,omitempty"`
+	Exif        json.RawMessage   `json:"exif,omitempty"`
+	Hidden      *bool             `json:"hidden,omitempty"`
+	Draft       *bool             `json:"draft,omitempty"`
+
+	sortKey time.Time
+}
+
+type apiPhotoPage struct {
+	Photos     []apiPhoto `json:"photos"`
+	Total      int        `json:"total"`
+	Limit      int        `json:"limit"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+func apiError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+func apiCreated(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func nullIntPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int64)
+	return &v
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// A cursor is the sort key and ID of the last photo on a page, opaque to
+// clients.
+func encodeCursor(at time.Time, id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", at.UnixMicro(), id)))
+}
+
+func decodeCursor(s string) (time.Time, int, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	micro, id, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return time.Time{}, 0, false
+	}
+	us, err1 := strconv.ParseInt(micro, 10, 64)
+	n, err2 := strconv.Atoi(id)
+	if err1 != nil || err2 != nil {
+		return time.Time{}, 0, false
+	}
+	return time.UnixMicro(us), n, true
+}
+
+func apiLimit(r *http.Request) int {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 {
+		return apiDefaultLimit
+	}
+	return min(limit, apiMaxLimit)
+}
+
+const apiFolderColumns = `f.id, f.parent_id, f.name, f.path, f.created_at, COALESCE(f.updated_at, f.created_at), f.draft`
+
+func (h *Handlers) apiFolders(ctx context.Context, admin bool, where string, args ...interface{}) ([]apiFolder, error) {
+	photoFilter, folderFilter := "", ""
+	if !admin {
+		photoFilter = " AND " + publicPhotoSQL
+		folderFilter = " AND " + publicFolderSQL
+		where += " AND f." + strings.ReplaceAll(publicFolderSQL, "live_", "f.live_")
+	}
+	rows, err := h.db.Pool().Query(ctx, `
+		SELECT `+apiFolderColumns+`,
+			(SELECT COUNT(*) FROM photos WHERE folder_id = f.id`+photoFilter+`),
+			(SELECT COUNT(*) FROM folders WHERE parent_id = f.id`+folderFilter+`)
+		FROM folders f WHERE `+where+` ORDER BY f.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := []apiFolder{}
+	for rows.Next() {
+		var f apiFolder
+		var parentID sql.NullInt64
+		var draft bool
+		if err := rows.Scan(&f.ID, &parentID, &f.Name, &f.Path, &f.CreatedAt, &f.UpdatedAt, &draft,
+			&f.PhotoCount, &f.SubfolderCount); err != nil {
+			return nil, err
+		}
+		f.ParentID = nullIntPtr(parentID)
+		f.URL = fmt.Sprintf("/folder/%d", f.ID)
+		f.CoverURL = coverURL(f.ID, "medium")
+		if admin {
+			f.Draft = &draft
+		}
+		folders = append(folders, f)
+	}
+	return folders, rows.Err()
+}
+
+const apiPhotoColumns = `id, folder_id, filename, path, COALESCE(url_path, ''), title, description,
+	COALESCE(width, 0), COALESCE(height, 0), COALESCE(size_bytes, 0), blurhash, rating, taken_at, created_at, COALESCE(updated_at, created_at),
+	version, hidden, draft, COALESCE(taken_at, created_at)`
+
+func (h *Handlers) scanAPIPhoto(row pgx.Row, admin bool) (apiPhoto, error) {
+	var p apiPhoto
+	var folderID sql.NullInt64
+	var urlPath string
+	var title, description, blurhash sql.NullString
+	var rating sql.NullInt16
+	var takenAt sql.NullTime
+	var version int
+	var hidden, draft bool
+	err := row.Scan(&p.ID, &folderID, &p.Filename, &p.Path, &urlPath, &title, &description,
+		&p.Width, &p.Height, &p.SizeBytes, &blurhash, &rating, &takenAt, &p.CreatedAt, &p.UpdatedAt,
+		&version, &hidden, &draft, &p.sortKey)
+	if err != nil {
+		return p, err
+	}
+
+	p.FolderID = nullIntPtr(folderID)
+	p.Title = nullStringPtr(title)
+	p.Description = nullStringPtr(description)
+	p.Blurhash = nullStringPtr(blurhash)
+	p.TakenAt = nullTimePtr(takenAt)
+	if rating.Valid {
+		n := int(rating.Int16)
+		p.Rating = &n
+	}
+	p.URL = fmt.Sprintf("/photo/%d", p.ID)
+	if urlPath != "" {
+		p.URL = "/p/" + escapeURLPath(urlPath)
+	}
+
+	// Only the admin thumbnail route serves photos visitors can't see.
+	thumbKind := "thumb/"
+	if hidden || draft {
+		thumbKind = "admin/thumb/"
+	}
+	p.Thumbnails = make(map[string]string)
+	for _, size := range h.thumbSvc.SizeNames() {
+		p.Thumbnails[size] = mediaURL(thumbKind+size, p.ID, version)
+	}
+	p.Original = mediaURL("original", p.ID, version)
+	if admin {
+		p.Hidden, p.Draft = &hidden, &draft
+	}
+	return p, nil
+}
+
+// where's arguments are bound from $1.
+func (h *Handlers) apiPhotoPage(ctx context.Context, admin bool, cursor string, limit int, where string, args ...interface{}) (*apiPhotoPage, error) {
+	if !admin {
+		where += " AND " + publicPhotoSQL
+	}
+	page := &apiPhotoPage{Photos: []apiPhoto{}, Limit: limit}
+	if err := h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE "+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	if cursor != "" {
+		at, id, ok := decodeCursor(cursor)
+		if !ok {
+			return nil, errBadCursor
+		}
+		where += fmt.Sprintf(" AND (COALESCE(taken_at, created_at), id) < ($%d, $%d)", len(args)+1, len(args)+2)
+		args = append(args, at, id)
+	}
+	args = append(args, limit+1)
+	rows, err := h.db.Pool().Query(ctx, fmt.Sprintf("SELECT %s FROM photos WHERE %s ORDER BY %s LIMIT $%d",
+		apiPhotoColumns, where, defaultPhotoOrder, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := h.scanAPIPhoto(rows, admin)
+		if err != nil {
+			return nil, err
+		}
+		page.Photos = append(page.Photos, p)
+	}
+	if len(page.Photos) > limit {
+		page.Photos = page.Photos[:limit]
+		last := page.Photos[limit-1]
+		page.NextCursor = encodeCursor(last.sortKey, last.ID)
+	}
+	return page, rows.Err()
+}
+
+var errBadCursor = errors.New("invalid cursor")
+
+func (h *Handlers) apiPhotoPageError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errBadCursor) {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	apiError(w, http.StatusInternalServerError, err.Error())
+}
+
+func (h *Handlers) apiV1Photo(ctx context.Context, id int, admin bool) (*apiPhoto, error) {
+	where := "id = $1"
+	if !admin {
+		where += " AND " + publicPhotoSQL
+	}
+	p, err := h.scanAPIPhoto(h.db.Pool().QueryRow(ctx, "SELECT "+apiPhotoColumns+" FROM photos WHERE "+where, id), admin)
+	if err != nil {
+		return nil, err
+	}
+	p.Tags = services.PhotoTags(ctx, h.db, id)
+	_ = h.db.Pool().QueryRow(ctx, "SELECT exif_data FROM photos WHERE id = $1", id).Scan(&p.Exif)
+	return &p, nil
+}
+
+func (h *Handlers) apiV1ListFolders(w http.ResponseWriter, r *http.Request) {
+	where, args := "f.parent_id IS NULL", []interface{}{}
+	if v := r.URL.Query().Get("parent_id"); v != "" && v != "root" {
+		pid, err := strconv.Atoi(v)
+		if err != nil {
+			apiError(w, http.StatusBadRequest, "invalid parent_id")
+			return
+		}
+		where, args = "f.parent_id = $1", append(args, pid)
+	}
+	folders, err := h.apiFolders(r.Context(), h.isAdmin(r), where, args...)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.jsonResponse(w, map[string]interface{}{"folders": folders, "total": len(folders)})
+}
+
+// apiV1GetFolder takes "root" for the media root.
+func (h *Handlers) apiV1GetFolder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	admin := h.isAdmin(r)
+
+	var folder *apiFolder
+	subWhere, photoWhere := "f.parent_id IS NULL", "folder_id IS NULL"
+	var args []interface{}
+	if v := r.PathValue("id"); v != "root" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			apiError(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		found, err := h.apiFolders(ctx, admin, "f.id = $1", id)
+		if err != nil {
+			apiError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if len(found) == 0 {
+			apiError(w, http.StatusNotFound, "folder not found")
+			return
+		}
+		folder = &found[0]
+		subWhere, photoWhere, args = "f.parent_id = $1", "folder_id = $1", []interface{}{id}
+	}
+
+	subfolders, err := h.apiFolders(ctx, admin, subWhere, args...)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	page, err := h.apiPhotoPage(ctx, admin, r.URL.Query().Get("cursor"), apiLimit(r), photoWhere, args...)
+	if err != nil {
+		h.apiPhotoPageError(w, err)
+		return
+	}
+	h.jsonResponse(w, map[string]interface{}{
+		"folder":      folder,
+		"subfolders":  subfolders,
+		"photos":      page.Photos,
+		"total":       page.Total,
+		"limit":       page.Limit,
+		"next_cursor": page.NextCursor,
+	})
+}
+
+func (h *Handlers) apiV1GetPhoto(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	photo, err := h.apiV1Photo(r.Context(), id, h.isAdmin(r))
+	if errors.Is(err, pgx.ErrNoRows) {
+		apiError(w, http.StatusNotFound, "photo not found")
+		return
+	}
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.jsonResponse(w, photo)
+}
+
+func (h *Handlers) apiV1Search(w http.ResponseWriter, r *http.Request) {
+	q := searchQuery(r)
+	if q == "" {
+		apiError(w, http.StatusBadRequest, "missing q")
+		return
+	}
+	ctx := r.Context()
+	admin := h.isAdmin(r)
+	pattern := likePattern(q)
+
+	folders, err := h.apiFolders(ctx, admin, "f.name ILIKE $1", pattern)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	page, err := h.apiPhotoPage(ctx, admin, r.URL.Query().Get("cursor"), apiLimit(r),
+		`(filename ILIKE $1 OR title ILIKE $1 OR description ILIKE $1 OR EXISTS (
+			SELECT 1 FROM photo_tags pt JOIN tags t ON t.id = pt.tag_id
+			WHERE pt.photo_id = photos.id AND t.name ILIKE $1))`, pattern)
+	if err != nil {
+		h.apiPhotoPageError(w, err)
+		return
+	}
+	h.jsonResponse(w, map[string]interface{}{
+		"query":       q,
+		"folders":     folders,
+		"photos":      page.Photos,
+		"total":       page.Total,
+		"limit":       page.Limit,
+		"next_cursor": page.NextCursor,
+	})
+}
+
+func (h *Handlers) apiV1CreateFolder(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name     string `json:"name"`
+		ParentID *int   `json:"parent_id"`
+		Draft    bool   `json:"draft"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	name := sanitizeFilename(req.Name)
+	if name == "" || name == "." || name == ".." {
+		apiError(w, http.StatusBadRequest, "invalid name")
+		return
+	}
+
+	id, err := h.createFolder(r.Context(), name, req.ParentID, req.Draft)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	found, err := h.apiFolders(r.Context(), true, "f.id = $1", id)
+	if err != nil || len(found) == 0 {
+		apiError(w, http.StatusInternalServerError, "folder not found after creating it")
+		return
+	}
+	apiCreated(w, found[0])
+}
+
+func (h *Handlers) apiV1UpdateFolder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	var req struct {
+		Name         *string         `json:"name"`
+		Status       *string         `json:"status"`
+		CoverPhotoID json.RawMessage `json:"cover_photo_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	if req.Status != nil && !services.ValidFolderStatus(*req.Status) {
+		apiError(w, http.StatusBadRequest, services.ErrBadFolderStatus.Error())
+		return
+	}
+	ctx := r.Context()
+
+	found, err := h.apiFolders(ctx, true, "f.id = $1", id)
+	if err != nil || len(found) == 0 {
+		apiError(w, http.StatusNotFound, "folder not found")
+		return
+	}
+
+	if req.Name != nil {
+		name := sanitizeFilename(*req.Name)
+		if name == "" || name == "." || name == ".." {
+			apiError(w, http.StatusBadRequest, "invalid name")
+			return
+		}
+		if name != found[0].Name {
+			if _, err := h.scanSvc.MoveFolder(ctx, id, found[0].ParentID, name); err != nil {
+				apiError(w, moveFolderStatus(err), err.Error())
+				return
+			}
+		}
+	}
+	if req.Status != nil {
+		if err := services.SetFolderStatus(ctx, h.db, id, *req.Status); err != nil {
+			apiError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if req.CoverPhotoID != nil {
+		var cover IntPtrOrString
+		if err := cover.UnmarshalJSON(req.CoverPhotoID); err != nil {
+			apiError(w, http.StatusBadRequest, "invalid cover_photo_id")
+			return
+		}
+		_, _ = h.db.Pool().Exec(ctx, "UPDATE folders SET cover_photo_id = $1, updated_at = NOW() WHERE id = $2", cover.V, id)
+	}
+
+	found, _ = h.apiFolders(ctx, true, "f.id = $1", id)
+	h.jsonResponse(w, found[0])
+}
+
+func (h *Handlers) apiV1DeleteFolder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	res, err := h.scanSvc.DeleteFolder(r.Context(), id, r.URL.Query().Get("purge") == "1")
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		apiError(w, http.StatusNotFound, "folder not found")
+	case errors.Is(err, services.ErrMaintenanceRunning):
+		apiError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrOutsideMediaRoot):
+		apiError(w, http.StatusForbidden, err.Error())
+	case err != nil:
+		apiError(w, http.StatusInternalServerError, err.Error())
+	default:
+		h.jsonResponse(w, res)
+	}
+}
+
+func (h *Handlers) apiV1UploadPhoto(w http.ResponseWriter, r *http.Request) {
+	if err := h.checkDiskSpace(r.ContentLength); err != nil {
+		apiError(w, http.StatusInsufficientStorage, err.Error())
+		return
+	}
+	if h.cfg.MaxUploadSize > 0 && r.ContentLength > h.cfg.MaxUploadSize {
+		apiError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("upload larger than %d bytes", h.cfg.MaxUploadSize))
+		return
+	}
+	if !h.limitUpload(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+	relPath, _, err := h.streamUploadFile(r, "file", func(values url.Values) (string, error) {
+		var folderPath string
+		if fidStr := values.Get("folder_id"); fidStr != "" {
+			fid, _ := strconv.Atoi(fidStr)
+			if err := h.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", fid).Scan(&folderPath); err != nil {
+				return "", errFolderNotFound
+			}
+		}
+		return folderPath, nil
+	})
+	if err != nil {
+		apiError(w, uploadStatus(err), err.Error())
+		return
+	}
+	ids := h.processUploads(ctx, []string{relPath})
+	if ids[0] == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]string{"path": relPath})
+		return
+	}
+	photo, err := h.apiV1Photo(ctx, ids[0], true)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	apiCreated(w, photo)
+}
+
+func (h *Handlers) apiV1UpdatePhoto(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	// Only the fields present are changed; null clears a text field or,
+	// for folder_id, moves the photo to the root.
+	var req struct {
+		Title       json.RawMessage `json:"title"`
+		Description json.RawMessage `json:"description"`
+		Note        json.RawMessage `json:"note"`
+		Rating      *int            `json:"rating"`
+		FolderID    json.RawMessage `json:"folder_id"`
+		Hidden      *bool           `json:"hidden"`
+		Tags        *[]string       `json:"tags"`
+		URLPath     *string         `json:"url_path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	ctx := r.Context()
+
+	var exists bool
+	_ = h.db.Pool().QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM photos WHERE id = $1)", id).Scan(&exists)
+	if !exists {
+		apiError(w, http.StatusNotFound, "photo not found")
+		return
+	}
+
+	for column, raw := range map[string]json.RawMessage{"title": req.Title, "description": req.Description, "note": req.Note} {
+		if raw == nil {
+			continue
+		}
+		var v *string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			apiError(w, http.StatusBadRequest, "invalid "+column)
+			return
+		}
+		_, _ = h.db.Pool().Exec(ctx, "UPDATE photos SET "+column+" = NULLIF($1, ''), updated_at = NOW() WHERE id = $2", v, id)
+	}
+	if req.Rating != nil {
+		if *req.Rating < 0 || *req.Rating > 5 {
+			apiError(w, http.StatusBadRequest, "rating must be between 0 and 5")
+			return
+		}
+		_, _ = h.db.Pool().Exec(ctx, "UPDATE photos SET rating = NULLIF($1, 0), updated_at = NOW() WHERE id = $2", *req.Rating, id)
+	}
+	if req.FolderID != nil {
+		var folder IntPtrOrString
+		if err := folder.UnmarshalJSON(req.FolderID); err != nil {
+			apiError(w, http.StatusBadRequest, "invalid folder_id")
+			return
+		}
+		_, _ = h.db.Pool().Exec(ctx, movePhotosSQL, folder.V, []int{id})
+	}
+	if req.Hidden != nil {
+		_, _ = h.db.Pool().Exec(ctx, "UPDATE photos SET hidden = $1, updated_at = NOW() WHERE id = $2", *req.Hidden, id)
+		h.thumbSvc.DeletePlaceholderByID(id)
+	}
+	if req.Tags != nil {
+		if err := services.SetPhotoTags(ctx, h.db, id, *req.Tags); err != nil {
+			apiError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if req.URLPath != nil {
+		if err := h.setPhotoURLPath(ctx, id, *req.URLPath); err != nil {
+			apiError(w, http.StatusConflict, err.Error())
+			return
+		}
+	}
+
+	photo, err := h.apiV1Photo(ctx, id, true)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.jsonResponse(w, photo)
+}
+
+func (h *Handlers) apiV1DeletePhoto(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	var exists bool
+	_ = h.db.Pool().QueryRow(r.Context(), "SELECT EXISTS(SELECT 1 FROM photos WHERE id = $1)", id).Scan(&exists)
+	if !exists {
+		apiError(w, http.StatusNotFound, "photo not found")
+		return
+	}
+	h.deletePhoto(r.Context(), id)
+	w.WriteHeader(http.StatusNoContent)
+}
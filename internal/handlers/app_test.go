@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/config"
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+	"github.com/Alexander-D-Karpov/photodock/internal/testutil"
+)
+
+const (
+	testAdminUser = "admin"
+	testAdminPass = "correct horse"
+)
+
+// testApp is the whole app, as BuildServer assembles it, over the real
+// templates, a scratch MEDIA_ROOT and CACHE_DIR and a schema of its own.
+type testApp struct {
+	t       testing.TB
+	cfg     *config.Config
+	db      *database.DB
+	h       *Handlers
+	handler http.Handler
+}
+
+// newTestApp starts the app with env on top of the test defaults; it is
+// skipped without a test database.
+func newTestApp(t testing.TB, env ...string) *testApp {
+	t.Helper()
+	db := testutil.Postgres(t)
+
+	defaults := []string{
+		"MEDIA_ROOT", t.TempDir(),
+		"CACHE_DIR", t.TempDir(),
+		"DATABASE_URL", "postgres://unused",
+		"ADMIN_USER", testAdminUser,
+		"ADMIN_PASS", testAdminPass,
+		"ADMIN_PASS_HASH", "",
+		"ALLOW_BASIC_AUTH", "true",
+		"SECRET_KEY", "test secret key",
+		"SITE_USER", "",
+		"SITE_PASSWORD", "",
+		"SITE_PASS", "",
+		"PRIVATE_MODE", "",
+		"WATCH_MEDIA", "",
+		"DEDUP_HARDLINKS", "",
+		"DISK_RESERVE_MB", "0",
+		"BACKUP_INTERVAL_HOURS", "0",
+	}
+	env = append(defaults, env...)
+	for i := 0; i+1 < len(env); i += 2 {
+		t.Setenv(env[i], env[i+1])
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(cfg.CacheDir, "uploads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	h, handler, lifecycle := newApp(cfg, db, os.DirFS(filepath.Join("..", "..", "cmd", "photodock")))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = lifecycle.Shutdown(ctx)
+	})
+	return &testApp{t: t, cfg: cfg, db: db, h: h, handler: handler}
+}
+
+// writeMedia puts a file at rel under MEDIA_ROOT.
+func (a *testApp) writeMedia(rel string, data []byte) string {
+	a.t.Helper()
+	abs := filepath.Join(a.cfg.MediaRoot, rel)
+	if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+		a.t.Fatal(err)
+	}
+	if err := os.WriteFile(abs, data, 0644); err != nil {
+		a.t.Fatal(err)
+	}
+	return abs
+}
+
+func (a *testApp) scan() {
+	a.t.Helper()
+	if err := a.h.scanSvc.ScanAll(context.Background()); err != nil {
+		a.t.Fatalf("scan: %v", err)
+	}
+}
+
+// photo is the ID and public URL path of the photo stored at rel.
+func (a *testApp) photo(rel string) (int, string) {
+	a.t.Helper()
+	var id int
+	var urlPath string
+	err := a.db.Pool().QueryRow(context.Background(),
+		"SELECT id, COALESCE(url_path, '') FROM photos WHERE path = $1", rel).Scan(&id, &urlPath)
+	if err != nil {
+		a.t.Fatalf("photo %s: %v", rel, err)
+	}
+	return id, urlPath
+}
+
+// get makes a visitor's request.
+func (a *testApp) get(path string) *httptest.ResponseRecorder {
+	return a.do(httptest.NewRequest(http.MethodGet, path, nil))
+}
+
+// admin makes a request with the admin's Basic credentials.
+func (a *testApp) admin(method, path string, body io.Reader) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, body)
+	r.SetBasicAuth(testAdminUser, testAdminPass)
+	return a.do(r)
+}
+
+func (a *testApp) do(r *http.Request) *httptest.ResponseRecorder {
+	if r.Header.Get("Accept") == "" {
+		r.Header.Set("Accept", "text/html")
+	}
+	w := httptest.NewRecorder()
+	a.handler.ServeHTTP(w, r)
+	return w
+}
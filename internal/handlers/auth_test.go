@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/testutil"
+)
+
+func TestPublicBasicAuthIgnored(t *testing.T) {
+	app := newTestApp(t, "AUTH_MAX_FAILURES", "2", "ALLOW_BASIC_AUTH", "true")
+	app.writeMedia("a.jpg", testutil.JPEG(64, 48, nil))
+	app.scan()
+	id, _ := app.photo("a.jpg")
+
+	for _, path := range []string{
+		fmt.Sprintf("/thumb/small/%d", id),
+		fmt.Sprintf("/placeholder/%d", id),
+		"/",
+		"/api/v1/folders",
+	} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.SetBasicAuth(testAdminUser, "wrong")
+		app.do(r)
+	}
+	if w := app.admin(http.MethodGet, "/admin/scans", nil); w.Code != http.StatusOK {
+		t.Fatalf("admin locked out by public requests: %d", w.Code)
+	}
+
+	if w := app.admin(http.MethodPost, fmt.Sprintf("/admin/photos/%d/hide", id), nil); w.Code != http.StatusOK {
+		t.Fatalf("hide: %d", w.Code)
+	}
+	if w := app.admin(http.MethodGet, fmt.Sprintf("/thumb/small/%d", id), nil); w.Code != http.StatusNotFound {
+		t.Errorf("hidden thumbnail with Basic auth: %d, want 404", w.Code)
+	}
+}
+
+func TestBasicAuthOffByDefault(t *testing.T) {
+	app := newTestApp(t, "ALLOW_BASIC_AUTH", "")
+	if w := app.admin(http.MethodGet, "/admin/scans", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Basic auth without ALLOW_BASIC_AUTH: %d, want 401", w.Code)
+	}
+}
+
+func TestBasicAuthRefusedCrossSite(t *testing.T) {
+	app := newTestApp(t)
+	app.writeMedia("a.jpg", testutil.JPEG(64, 48, nil))
+	app.scan()
+	id, _ := app.photo("a.jpg")
+	hide := fmt.Sprintf("/admin/photos/%d/hide", id)
+
+	for _, header := range [][2]string{
+		{"Origin", "https://evil.example"},
+		{"Origin", "null"},
+		{"Sec-Fetch-Site", "cross-site"},
+		{"Sec-Fetch-Site", "same-site"},
+	} {
+		r := httptest.NewRequest(http.MethodPost, hide, nil)
+		r.SetBasicAuth(testAdminUser, testAdminPass)
+		r.Header.Set(header[0], header[1])
+		if w := app.do(r); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: %s: %d, want 401", header[0], header[1], w.Code)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, hide, nil)
+	r.SetBasicAuth(testAdminUser, testAdminPass)
+	r.Header.Set("Origin", "http://example.com")
+	r.Header.Set("Sec-Fetch-Site", "same-origin")
+	if w := app.do(r); w.Code != http.StatusOK {
+		t.Errorf("same-origin write: %d", w.Code)
+	}
+}
+
+func (a *testApp) login() *http.Cookie {
+	a.t.Helper()
+	form := url.Values{"username": {testAdminUser}, "password": {testAdminPass}}
+	r := httptest.NewRequest(http.MethodPost, "/admin/login", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := a.do(r)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionCookie && c.Value != "" {
+			return c
+		}
+	}
+	a.t.Fatalf("login: %d, no session cookie", w.Code)
+	return nil
+}
+
+func (a *testApp) withSession(c *http.Cookie) int {
+	r := httptest.NewRequest(http.MethodGet, "/admin/scans", nil)
+	r.Header.Set("Accept", "application/json")
+	r.AddCookie(c)
+	return a.do(r).Code
+}
+
+func TestLogoutRevokesSessions(t *testing.T) {
+	app := newTestApp(t)
+	kept := app.login()
+	other := app.login()
+	if code := app.withSession(kept); code != http.StatusOK {
+		t.Fatalf("fresh session: %d", code)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/logout", nil)
+	r.AddCookie(other)
+	r.Header.Set(csrfHeader, app.h.sign("csrf", other.Value))
+	if w := app.do(r); w.Code != http.StatusSeeOther {
+		t.Fatalf("logout: %d", w.Code)
+	}
+	if code := app.withSession(kept); code != http.StatusUnauthorized {
+		t.Errorf("session issued before logout: %d, want 401", code)
+	}
+	if code := app.withSession(app.login()); code != http.StatusOK {
+		t.Errorf("session after logging back in: %d", code)
+	}
+}
+
+func TestPasswordChangeRevokesSessions(t *testing.T) {
+	app := newTestApp(t)
+	c := app.login()
+	app.h.cfg.AdminPass = "a new password"
+	if code := app.withSession(c); code != http.StatusUnauthorized {
+		t.Errorf("session from the old password: %d, want 401", code)
+	}
+}
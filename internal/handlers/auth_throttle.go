@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxTrackedIPs bounds the failure tracker; the least recently seen
+// addresses are forgotten first.
+const maxTrackedIPs = 10000
+
+type authFailure struct {
+	ip          string
+	count       int
+	since       time.Time
+	lockedUntil time.Time
+	// Digest of the last wrong credentials, so one request checking them
+	// several times, or a client retrying them, counts once.
+	last [32]byte
+}
+
+type authThrottle struct {
+	mu      sync.Mutex
+	max     int
+	window  time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newAuthThrottle(max int, window time.Duration) *authThrottle {
+	return &authThrottle{
+		max:     max,
+		window:  window,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (t *authThrottle) retryAfter(ip string) time.Duration {
+	if t.max == 0 {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	el, ok := t.entries[ip]
+	if !ok {
+		return 0
+	}
+	return max(time.Until(el.Value.(*authFailure).lockedUntil), 0)
+}
+
+func (t *authThrottle) fail(ip, user, pass string) bool {
+	if t.max == 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	attempt := sha256.Sum256([]byte(user + "\x00" + pass))
+	var f *authFailure
+	if el, ok := t.entries[ip]; ok {
+		t.order.MoveToFront(el)
+		f = el.Value.(*authFailure)
+		if now.Sub(f.since) > t.window {
+			f.count, f.since = 0, now
+		} else if f.last == attempt {
+			return false
+		}
+	} else {
+		f = &authFailure{ip: ip, since: now}
+		t.entries[ip] = t.order.PushFront(f)
+		if t.order.Len() > maxTrackedIPs {
+			oldest := t.order.Back()
+			t.order.Remove(oldest)
+			delete(t.entries, oldest.Value.(*authFailure).ip)
+		}
+	}
+
+	f.last = attempt
+	f.count++
+	if f.count < t.max {
+		return false
+	}
+	f.count, f.since = 0, now
+	f.lockedUntil = now.Add(t.window)
+	return true
+}
+
+func (t *authThrottle) succeed(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if el, ok := t.entries[ip]; ok {
+		t.order.Remove(el)
+		delete(t.entries, ip)
+	}
+}
+
+func (h *Handlers) authLockedOut(w http.ResponseWriter, r *http.Request) bool {
+	wait := h.authFails.retryAfter(h.clientIP(r))
+	if wait <= 0 {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	return true
+}
+
+func (h *Handlers) tryCredentials(r *http.Request, user, pass string) bool {
+	ip := h.clientIP(r)
+	if h.authFails.retryAfter(ip) > 0 {
+		return false
+	}
+	if h.checkCredentials(user, pass) {
+		h.authFails.succeed(ip)
+		return true
+	}
+	if h.authFails.fail(ip, user, pass) {
+		log.Printf("auth: locked out %s for %s after %d failed admin logins", ip, h.cfg.AuthLockout, h.cfg.AuthMaxFailures)
+	}
+	return false
+}
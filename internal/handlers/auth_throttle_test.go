@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAuthThrottleLockout(t *testing.T) {
+	th := newAuthThrottle(3, time.Hour)
+	for i := 1; i <= 2; i++ {
+		if th.fail("10.0.0.1", "admin", fmt.Sprint("guess", i)) {
+			t.Fatalf("locked out after %d failures", i)
+		}
+	}
+	if wait := th.retryAfter("10.0.0.1"); wait != 0 {
+		t.Fatalf("retryAfter before the limit = %s", wait)
+	}
+	if !th.fail("10.0.0.1", "admin", "guess3") {
+		t.Fatal("not locked out at the limit")
+	}
+	if wait := th.retryAfter("10.0.0.1"); wait <= 59*time.Minute || wait > time.Hour {
+		t.Errorf("retryAfter = %s, want about an hour", wait)
+	}
+	if wait := th.retryAfter("10.0.0.2"); wait != 0 {
+		t.Errorf("another address is locked out too: %s", wait)
+	}
+
+	th.entries["10.0.0.1"].Value.(*authFailure).lockedUntil = time.Now().Add(-time.Second)
+	if wait := th.retryAfter("10.0.0.1"); wait != 0 {
+		t.Errorf("retryAfter once the lockout has passed = %s", wait)
+	}
+}
+
+func TestAuthThrottleWindow(t *testing.T) {
+	th := newAuthThrottle(3, time.Hour)
+	th.fail("10.0.0.1", "admin", "guess1")
+	th.fail("10.0.0.1", "admin", "guess2")
+	th.entries["10.0.0.1"].Value.(*authFailure).since = time.Now().Add(-2 * time.Hour)
+	if th.fail("10.0.0.1", "admin", "guess3") {
+		t.Error("failures from an earlier window counted")
+	}
+}
+
+func TestAuthThrottleRepeatedAttempt(t *testing.T) {
+	th := newAuthThrottle(3, time.Hour)
+	for i := 0; i < 10; i++ {
+		if th.fail("10.0.0.1", "admin", "same guess") {
+			t.Fatalf("locked out by repeating one attempt %d times", i+1)
+		}
+	}
+	th.fail("10.0.0.1", "admin", "other guess")
+	if !th.fail("10.0.0.1", "admin", "same guess") {
+		t.Error("an attempt repeated after a different one was not counted")
+	}
+}
+
+func TestAuthThrottleSuccessResets(t *testing.T) {
+	th := newAuthThrottle(3, time.Hour)
+	th.fail("10.0.0.1", "admin", "guess1")
+	th.fail("10.0.0.1", "admin", "guess2")
+	th.succeed("10.0.0.1")
+	if _, ok := th.entries["10.0.0.1"]; ok {
+		t.Error("address still tracked after a success")
+	}
+	th.fail("10.0.0.1", "admin", "guess3")
+	if th.fail("10.0.0.1", "admin", "guess4") {
+		t.Error("failures before the success counted")
+	}
+}
+
+func TestAuthThrottleEvictsLeastRecent(t *testing.T) {
+	th := newAuthThrottle(3, time.Hour)
+	th.fail("first", "admin", "guess")
+	th.fail("second", "admin", "guess")
+	for i := 2; i < maxTrackedIPs; i++ {
+		th.fail(fmt.Sprint("ip", i), "admin", "guess")
+	}
+	// Seen again, so it is no longer the oldest.
+	th.fail("first", "admin", "guess again")
+	th.fail("newest", "admin", "guess")
+
+	if len(th.entries) != maxTrackedIPs || th.order.Len() != maxTrackedIPs {
+		t.Fatalf("tracking %d addresses (%d in order), want %d", len(th.entries), th.order.Len(), maxTrackedIPs)
+	}
+	if _, ok := th.entries["second"]; ok {
+		t.Error("least recently seen address kept")
+	}
+	for _, ip := range []string{"first", "newest"} {
+		if _, ok := th.entries[ip]; !ok {
+			t.Errorf("%s evicted", ip)
+		}
+	}
+}
+
+func TestAuthThrottleDisabled(t *testing.T) {
+	th := newAuthThrottle(0, time.Hour)
+	for i := 0; i < 10; i++ {
+		if th.fail("10.0.0.1", "admin", fmt.Sprint("guess", i)) {
+			t.Fatal("locked out with the lockout disabled")
+		}
+	}
+	if len(th.entries) != 0 {
+		t.Errorf("tracking %d addresses with the lockout disabled", len(th.entries))
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/services"
+)
+
+func (h *Handlers) adminBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := h.backups.List()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	lastSuccess, lastErr, lastErrAt := h.backups.Status()
+
+	var lastErrMsg string
+	if lastErr != nil && lastErrAt.After(lastSuccess) {
+		lastErrMsg = lastErr.Error()
+	}
+
+	h.renderAdmin(w, r, "admin/backups.html", map[string]interface{}{
+		"Backups":     backups,
+		"Interval":    h.backups.Interval(),
+		"LastSuccess": lastSuccess,
+		"LastError":   lastErrMsg,
+		"LastErrorAt": lastErrAt,
+		"Title":       "Backups",
+	})
+}
+
+func (h *Handlers) adminCreateBackup(w http.ResponseWriter, r *http.Request) {
+	info, err := h.backups.Create(r.Context())
+	if errors.Is(err, services.ErrBackupBusy) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	// The warnings panel shows the outcome either way.
+	h.warnings.Refresh(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	h.jsonResponse(w, info)
+}
+
+func (h *Handlers) adminDownloadBackup(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	path, err := h.backups.Path(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	http.ServeFile(w, r, path)
+}
+
+func (h *Handlers) adminRestoreBackup(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, err := h.backups.Path(name); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err := h.backups.Restore(r.Context(), name)
+	if errors.Is(err, services.ErrBackupBusy) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("restore %s failed: %v", name, err)
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	h.settings.Reload()
+	h.anyLocked.Store(0)
+	h.warnings.Refresh(r.Context())
+	h.jsonResponse(w, map[string]string{"status": "restored"})
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/services"
+)
+
+type bulkRequest struct {
+	Action   string         `json:"action"`
+	IDs      []int          `json:"ids"`
+	FolderID IntPtrOrString `json:"folder_id"`
+}
+
+type bulkResult struct {
+	ID    int    `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func bulkResults(ids []int, failed map[int]string) []bulkResult {
+	results := make([]bulkResult, len(ids))
+	for i, id := range ids {
+		msg, bad := failed[id]
+		results[i] = bulkResult{ID: id, OK: !bad, Error: msg}
+	}
+	return results
+}
+
+func (h *Handlers) adminBulkPhotos(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req bulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", 400)
+		return
+	}
+	if len(req.IDs) == 0 {
+		http.Error(w, "no photos selected", 400)
+		return
+	}
+
+	if req.Action == "delete" {
+		failed, err := h.deletePhotos(ctx, req.IDs)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		h.jsonResponse(w, map[string]interface{}{
+			"action":   req.Action,
+			"affected": len(req.IDs) - len(failed),
+			"results":  bulkResults(req.IDs, failed),
+		})
+		return
+	}
+
+	if req.Action == "writeback" {
+		if !h.scanSvc.CanWriteCaptions() {
+			http.Error(w, services.ErrNoExiftool.Error(), http.StatusBadRequest)
+			return
+		}
+		failed := map[int]string{}
+		for _, id := range req.IDs {
+			if err := h.scanSvc.WriteCaptionToFile(ctx, id); err != nil {
+				log.Printf("write caption photo %d: %v", id, err)
+				failed[id] = err.Error()
+			}
+		}
+		h.jsonResponse(w, map[string]interface{}{
+			"action":   req.Action,
+			"affected": len(req.IDs) - len(failed),
+			"failed":   len(failed),
+			"results":  bulkResults(req.IDs, failed),
+		})
+		return
+	}
+
+	if req.Action != "hide" && req.Action != "unhide" && req.Action != "move" {
+		http.Error(w, "unknown action", 400)
+		return
+	}
+	if req.Action == "move" && req.FolderID.V != nil {
+		var exists bool
+		_ = h.db.Pool().QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM folders WHERE id = $1)", *req.FolderID.V).Scan(&exists)
+		if !exists {
+			http.Error(w, "folder not found", 400)
+			return
+		}
+	}
+
+	tx, err := h.db.Pool().Begin(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	rows, err := tx.Query(ctx, "SELECT id, hidden, folder_id FROM photos WHERE id = ANY($1) FOR UPDATE", req.IDs)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	failed := make(map[int]string, len(req.IDs))
+	for _, id := range req.IDs {
+		failed[id] = "photo not found"
+	}
+	var prior []services.PhotoPriorState
+	for rows.Next() {
+		var p services.PhotoPriorState
+		if err := rows.Scan(&p.ID, &p.Hidden, &p.FolderID); err != nil {
+			continue
+		}
+		delete(failed, p.ID)
+		switch req.Action {
+		case "hide":
+			if p.Hidden {
+				continue
+			}
+		case "unhide":
+			if !p.Hidden {
+				continue
+			}
+		}
+		prior = append(prior, p)
+	}
+	rows.Close()
+
+	ids := make([]int, len(prior))
+	for i, p := range prior {
+		ids[i] = p.ID
+	}
+
+	switch req.Action {
+	case "hide", "unhide":
+		_, err = tx.Exec(ctx, "UPDATE photos SET hidden = $1, updated_at = NOW() WHERE id = ANY($2)",
+			req.Action == "hide", ids)
+	case "move":
+		_, err = tx.Exec(ctx, movePhotosSQL, req.FolderID.V, ids)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if req.Action == "hide" {
+		for _, id := range ids {
+			h.thumbSvc.DeletePlaceholderByID(id)
+		}
+	}
+
+	resp := map[string]interface{}{
+		"action":   req.Action,
+		"affected": len(prior),
+		"results":  bulkResults(req.IDs, failed),
+	}
+	if len(prior) > 0 {
+		token, err := services.RecordUndo(ctx, h.db, req.Action, prior, h.cfg.UndoWindow)
+		if err != nil {
+			log.Printf("record undo for bulk %s: %v", req.Action, err)
+		} else {
+			resp["undo_token"] = token.Token
+			resp["undo_expires"] = token.ExpiresAt
+		}
+	}
+	h.jsonResponse(w, resp)
+}
+
+// deletePhotos returns the IDs that failed, with why.
+func (h *Handlers) deletePhotos(ctx context.Context, ids []int) (map[int]string, error) {
+	tx, err := h.db.Pool().Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	rows, err := tx.Query(ctx, "DELETE FROM photos WHERE id = ANY($1) RETURNING id, path, COALESCE(sha256, '')", ids)
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[int]string, len(ids))
+	sums := make(map[int]string, len(ids))
+	for rows.Next() {
+		var id int
+		var path, sum string
+		if err := rows.Scan(&id, &path, &sum); err == nil {
+			paths[id] = path
+			sums[id] = sum
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	failed := make(map[int]string)
+	for _, id := range ids {
+		path, ok := paths[id]
+		if !ok {
+			failed[id] = "photo not found"
+			continue
+		}
+		_ = h.thumbSvc.DeleteThumbnailsByID(id)
+		h.thumbSvc.DeleteWebOriginal(path)
+		if err := services.RemovePhotoFile(ctx, h.db, h.cfg.MediaRoot, path, sums[id]); err != nil {
+			failed[id] = "removed from the library, but the file remains: " + err.Error()
+		}
+	}
+	return failed, nil
+}
+
+// The ids come as one comma-separated value, so a plain form post can
+// download the zip.
+func (h *Handlers) adminZipPhotos(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var ids []int
+	for _, s := range strings.Split(r.FormValue("ids"), ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		http.Error(w, "no photos selected", 400)
+		return
+	}
+
+	rows, err := h.db.Pool().Query(ctx,
+		"SELECT filename, path FROM photos WHERE id = ANY($1) ORDER BY COALESCE(taken_at, created_at), id", ids)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	type zipEntry struct{ name, path string }
+	var entries []zipEntry
+	for rows.Next() {
+		var e zipEntry
+		if err := rows.Scan(&e.name, &e.path); err == nil {
+			entries = append(entries, e)
+		}
+	}
+	rows.Close()
+	if len(entries) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="photodock-%d-photos.zip"`, len(entries)))
+
+	zw := zip.NewWriter(newProgressWriter(w))
+	used := make(map[string]int)
+	for _, e := range entries {
+		// Photos from different folders may share a file name.
+		name := e.name
+		if n := used[strings.ToLower(name)]; n > 0 {
+			ext := filepath.Ext(name)
+			name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n+1, ext)
+		}
+		used[strings.ToLower(e.name)]++
+
+		if err := addZipFile(zw, name, services.ResolveMediaPath(h.cfg.MediaRoot, e.path)); err != nil {
+			// Headers are gone by now; a truncated archive is all that can
+			// signal the failure.
+			log.Printf("zip photos %s: %v", e.path, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("zip photos: %v", err)
+	}
+}
+
+func addZipFile(zw *zip.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Photos are compressed already; storing them keeps the CPU idle.
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Store
+	dst, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+func (h *Handlers) adminUndo(w http.ResponseWriter, r *http.Request) {
+	token, err := services.ApplyUndo(r.Context(), h.db, r.PathValue("token"))
+	if errors.Is(err, services.ErrUndoNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, services.ErrUndoExpired) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	h.jsonResponse(w, map[string]interface{}{"action": token.Action, "restored": token.PhotoCount})
+}
+
+func (h *Handlers) adminUndoList(w http.ResponseWriter, r *http.Request) {
+	tokens, _ := services.RecentUndoTokens(r.Context(), h.db, 100)
+	h.renderAdmin(w, r, "admin/undo.html", map[string]interface{}{
+		"Tokens": tokens,
+		"Title":  "Recent Bulk Changes",
+	})
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type cacheClass int
+
+const (
+	cacheThumbnails cacheClass = iota
+	cachePlaceholders
+	cacheOriginals
+	cacheStatic
+	cacheHTML
+)
+
+// Media URLs without a ?v= cache-buster may change content in place, so they
+// never get more than this regardless of the configured lifetime.
+const unversionedMaxAge = 300
+
+func (h *Handlers) cacheMaxAge(class cacheClass) int {
+	ages := h.cfg.CacheMaxAge
+	switch class {
+	case cacheThumbnails:
+		return ages.Thumbnails
+	case cachePlaceholders:
+		return ages.Placeholders
+	case cacheOriginals:
+		return ages.Originals
+	case cacheStatic:
+		return ages.Static
+	default:
+		return ages.HTML
+	}
+}
+
+func (h *Handlers) setCacheControl(w http.ResponseWriter, r *http.Request, class cacheClass) {
+	age := h.cacheMaxAge(class)
+	versioned := r != nil && r.URL.Query().Get("v") != ""
+
+	switch class {
+	case cacheThumbnails, cachePlaceholders, cacheOriginals:
+		if !versioned && age > unversionedMaxAge {
+			age = unversionedMaxAge
+		}
+	}
+
+	if age <= 0 {
+		w.Header().Set("Cache-Control", "no-cache")
+		return
+	}
+	value := "public, max-age=" + strconv.Itoa(age)
+	if versioned {
+		value += ", immutable"
+	}
+	w.Header().Set("Cache-Control", value)
+}
+
+func privateCache(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", strings.Replace(w.Header().Get("Cache-Control"), "public", "private", 1))
+}
+
+func (h *Handlers) staticCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.setCacheControl(w, r, cacheStatic)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func notModified(w http.ResponseWriter, r *http.Request, id int, path string) bool {
+	// Taken from the served file rather than the photo row, so a rotate or
+	// replace that rewrites the file also changes the tag. Only a stat: a
+	// matching request never opens the file.
+	st, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	etag := fmt.Sprintf(`"%d-%s-%x-%x"`, id, strings.TrimPrefix(filepath.Ext(path), "."), st.ModTime().UnixNano(), st.Size())
+	w.Header().Set("ETag", etag)
+
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+func mediaURL(kind string, id, version int) string {
+	if version < 1 {
+		version = 1
+	}
+	return fmt.Sprintf("/%s/%d?v=%d", kind, id, version)
+}
+
+func (h *Handlers) photoMediaURL(ctx context.Context, kind string, id int) string {
+	if id == 0 {
+		return ""
+	}
+	var version int
+	_ = h.db.Pool().QueryRow(ctx, "SELECT version FROM photos WHERE id = $1", id).Scan(&version)
+	return mediaURL(kind, id, version)
+}
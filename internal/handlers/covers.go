@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/services"
+)
+
+func coverURL(folderID int, size string) string {
+	return fmt.Sprintf("/cover/%d/%s", folderID, size)
+}
+
+func (h *Handlers) resolveCoverPhoto(ctx context.Context, folderID int) (int, string, string, error) {
+	var id int
+	var path, blurhash string
+	err := h.db.Pool().QueryRow(ctx, `
+		WITH RECURSIVE subtree AS (
+			SELECT id, cover_photo_id FROM folders WHERE id = $1
+			UNION ALL
+			SELECT f.id, f.cover_photo_id FROM folders f JOIN subtree s ON f.parent_id = s.id
+		)
+		SELECT p.id, p.path, COALESCE(p.blurhash, '')
+		FROM photos p
+		WHERE p.hidden = false AND p.draft = false AND photodock_live(p.live_from, p.live_until)
+			AND p.locked_by IS NOT DISTINCT FROM (SELECT locked_by FROM folders WHERE id = $1)
+			AND (p.folder_id IN (SELECT id FROM subtree) OR p.id = (SELECT cover_photo_id FROM folders WHERE id = $1))
+		ORDER BY p.id = (SELECT cover_photo_id FROM folders WHERE id = $1) DESC NULLS LAST,
+			COALESCE(p.taken_at, p.created_at) DESC, p.id DESC
+		LIMIT 1`, folderID).Scan(&id, &path, &blurhash)
+	return id, path, blurhash, err
+}
+
+func (h *Handlers) serveCover(w http.ResponseWriter, r *http.Request) {
+	folderID, _ := strconv.Atoi(r.PathValue("id"))
+	size := r.PathValue("size")
+
+	if size != "placeholder" && !h.thumbSvc.HasSize(size) {
+		http.NotFound(w, r)
+		return
+	}
+
+	var lockedBy sql.NullInt64
+	if err := h.db.Pool().QueryRow(r.Context(), "SELECT locked_by FROM folders WHERE id = $1 AND draft = false AND photodock_live(live_from, live_until)", folderID).Scan(&lockedBy); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !h.canView(r, lockedBy) {
+		denyLocked(w)
+		return
+	}
+
+	// Covers follow whichever photo currently represents the folder, so they
+	// are never requested with a version and stay on the short lifetime.
+	h.setCacheControl(w, r, cacheThumbnails)
+	if lockedBy.Valid {
+		privateCache(w)
+	}
+
+	photoID, path, blurhash, err := h.resolveCoverPhoto(r.Context(), folderID)
+	if err != nil {
+		emptyPath, err := h.thumbSvc.EmptyCoverPath()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		http.ServeFile(w, r, emptyPath)
+		return
+	}
+
+	var filePath string
+	if size == "placeholder" {
+		filePath, err = h.thumbSvc.GetPlaceholderPathByID(photoID, blurhash)
+	} else {
+		filePath, err = h.thumbSvc.GetThumbnailPathByID(r.Context(), photoID, path, size)
+	}
+	if errors.Is(err, services.ErrThumbnailFailed) {
+		h.serveBrokenThumbnail(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", imageContentType(filePath))
+
+	if r.Header.Get("X-Real-IP") != "" {
+		w.Header().Set("X-Accel-Redirect", fmt.Sprintf("/internal/cache/%s/%s", filepath.Base(filepath.Dir(filePath)), filepath.Base(filePath)))
+		return
+	}
+
+	http.ServeFile(w, r, filePath)
+}
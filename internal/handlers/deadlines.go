@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// How long a streamed transfer may stall before the connection is
+// dropped; it replaces the server's timeouts for the whole exchange.
+const streamIdleTimeout = 30 * time.Second
+
+// progressWriter keeps a response that outlasts the server's
+// WriteTimeout alive for as long as it keeps making progress.
+type progressWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func newProgressWriter(w http.ResponseWriter) *progressWriter {
+	return &progressWriter{w: w, rc: http.NewResponseController(w)}
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	_ = p.rc.SetWriteDeadline(time.Now().Add(streamIdleTimeout))
+	return p.w.Write(b)
+}
+
+// progressReader does the same for a request body that takes longer than
+// the server's ReadTimeout to arrive. The response is written once the
+// body is in, so its deadline moves too.
+type progressReader struct {
+	io.ReadCloser
+	rc *http.ResponseController
+}
+
+func newProgressReader(w http.ResponseWriter, body io.ReadCloser) *progressReader {
+	return &progressReader{ReadCloser: body, rc: http.NewResponseController(w)}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	deadline := time.Now().Add(streamIdleTimeout)
+	_ = p.rc.SetReadDeadline(deadline)
+	_ = p.rc.SetWriteDeadline(deadline)
+	return p.ReadCloser.Read(b)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressWriterOutlastsWriteTimeout(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pw := newProgressWriter(w)
+		for i := 0; i < 6; i++ {
+			_, _ = io.WriteString(pw, strings.Repeat("x", 1<<10))
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("response cut after %d bytes: %v", len(body), err)
+	}
+	if len(body) != 6<<10 {
+		t.Errorf("got %d bytes, want %d", len(body), 6<<10)
+	}
+}
+
+func TestProgressReaderOutlastsReadTimeout(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := io.Copy(io.Discard, newProgressReader(w, r.Body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, _ = fmt.Fprint(w, n)
+	}))
+	srv.Config.ReadTimeout = 100 * time.Millisecond
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 0; i < 6; i++ {
+			_, _ = io.WriteString(pw, strings.Repeat("x", 1<<10))
+			time.Sleep(50 * time.Millisecond)
+		}
+		_ = pw.Close()
+	}()
+	resp, err := http.Post(srv.URL, "application/octet-stream", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != fmt.Sprint(6<<10) {
+		t.Errorf("slow upload: %d %s, want all %d bytes read", resp.StatusCode, body, 6<<10)
+	}
+}
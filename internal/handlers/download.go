@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/services"
+)
+
+func (h *Handlers) serveDownload(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	size := r.URL.Query().Get("size")
+	if size != "" && !h.thumbSvc.HasSize(size) {
+		http.Error(w, "Unknown size", http.StatusBadRequest)
+		return
+	}
+
+	var path, filename string
+	var hidden bool
+	var lockedBy sql.NullInt64
+	err := h.db.Pool().QueryRow(r.Context(), "SELECT path, filename, hidden OR draft OR NOT photodock_live(live_from, live_until), locked_by FROM photos WHERE id = $1", id).Scan(&path, &filename, &hidden, &lockedBy)
+	if err != nil || hidden || !h.isPathSafe(path) {
+		http.NotFound(w, r)
+		return
+	}
+	if !h.canView(r, lockedBy) {
+		denyLocked(w)
+		return
+	}
+
+	filePath := services.ResolveMediaPath(h.cfg.MediaRoot, path)
+	accel := ""
+	if rel, err := filepath.Rel(h.cfg.MediaRoot, filePath); err == nil {
+		accel = "/internal/photos/" + rel
+	}
+	class := cacheOriginals
+	if size != "" {
+		thumbPath, err := h.thumbSvc.GetThumbnailPathByIDFormat(r.Context(), id, path, size, "")
+		if errors.Is(err, services.ErrThumbnailFailed) {
+			services.SetThumbError(r.Context(), h.db, id, err)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		filePath, class = thumbPath, cacheThumbnails
+		accel = fmt.Sprintf("/internal/cache/%s/%s", filepath.Base(filepath.Dir(thumbPath)), filepath.Base(thumbPath))
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + "_" + size + filepath.Ext(thumbPath)
+	}
+
+	h.setCacheControl(w, r, class)
+	if lockedBy.Valid {
+		privateCache(w)
+	}
+	w.Header().Set("Content-Type", imageContentType(filePath))
+	w.Header().Set("Content-Disposition", attachmentDisposition(filename))
+	if notModified(w, r, id, filePath) {
+		return
+	}
+
+	if r.Header.Get("X-Real-IP") != "" && accel != "" {
+		w.Header().Set("X-Accel-Redirect", accel)
+		return
+	}
+	http.ServeFile(w, r, filePath)
+}
+
+// Old clients get an ASCII stand-in; the RFC 5987 filename* carries the
+// real name.
+func attachmentDisposition(name string) string {
+	var fallback, encoded strings.Builder
+	for _, c := range name {
+		if c < 0x20 || c > 0x7e || c == '"' || c == '\\' {
+			fallback.WriteByte('_')
+		} else {
+			fallback.WriteRune(c)
+		}
+	}
+	for _, b := range []byte(name) {
+		if isAttrChar(b) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, fallback.String(), encoded.String())
+}
+
+func isAttrChar(b byte) bool {
+	switch {
+	case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
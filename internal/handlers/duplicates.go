@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/services"
+)
+
+func (h *Handlers) adminDuplicates(w http.ResponseWriter, r *http.Request) {
+	groups, err := services.DuplicateGroups(r.Context(), h.db)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	var extra int
+	for _, g := range groups {
+		extra += len(g.Photos) - 1
+	}
+
+	h.renderAdmin(w, r, "admin/duplicates.html", map[string]interface{}{
+		"Groups": groups,
+		"Extra":  extra,
+		"Title":  "Duplicates",
+	})
+}
+
+func (h *Handlers) adminKeepDuplicate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	keepID, _ := strconv.Atoi(r.FormValue("keep"))
+
+	others, err := services.DuplicatesOf(ctx, h.db, keepID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	for _, id := range others {
+		h.deletePhoto(ctx, id)
+	}
+
+	http.Redirect(w, r, "/admin/duplicates", http.StatusSeeOther)
+}
+
+type duplicateRef struct {
+	ID  int    `json:"id"`
+	URL string `json:"url"`
+}
+
+func (h *Handlers) duplicateOf(ctx context.Context, sum string) *duplicateRef {
+	// The oldest photo with the same content, for upload responses.
+	if sum == "" {
+		return nil
+	}
+	var ref duplicateRef
+	var urlPath string
+	err := h.db.Pool().QueryRow(ctx,
+		"SELECT id, COALESCE(url_path, '') FROM photos WHERE sha256 = $1 ORDER BY id LIMIT 1", sum).Scan(&ref.ID, &urlPath)
+	if err != nil {
+		return nil
+	}
+	ref.URL = fmt.Sprintf("/photo/%d", ref.ID)
+	if urlPath != "" {
+		ref.URL = "/p/" + escapeURLPath(urlPath)
+	}
+	return &ref
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/testutil"
+)
+
+type uploadResult struct {
+	Destination string        `json:"destination"`
+	PhotoID     int           `json:"photo_id"`
+	DuplicateOf *duplicateRef `json:"duplicate_of"`
+}
+
+// Fields go before the file, where a streamed upload reads them.
+func (a *testApp) uploadFile(name string, data []byte, fields ...string) uploadResult {
+	a.t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for i := 0; i+1 < len(fields); i += 2 {
+		_ = mw.WriteField(fields[i], fields[i+1])
+	}
+	fw, _ := mw.CreateFormFile("file", name)
+	_, _ = fw.Write(data)
+	_ = mw.Close()
+
+	r, _ := http.NewRequest(http.MethodPost, "/admin/upload/file", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r.Header.Set("Accept", "application/json")
+	r.SetBasicAuth(testAdminUser, testAdminPass)
+	w := a.do(r)
+	if w.Code != http.StatusOK {
+		a.t.Fatalf("upload %s: %d %s", name, w.Code, w.Body)
+	}
+	var res uploadResult
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		a.t.Fatal(err)
+	}
+	return res
+}
+
+func TestUploadDuplicateWithGPS(t *testing.T) {
+	app := newTestApp(t, "DEDUP_HARDLINKS", "true")
+	data := testutil.JPEG(320, 240, &testutil.EXIF{
+		Make: "Canon",
+		GPS:  &testutil.GPS{Lat: 60.1, Lon: 19.9},
+	})
+
+	first := app.uploadFile("first.jpg", data)
+	if first.PhotoID == 0 || first.DuplicateOf != nil {
+		t.Fatalf("first upload = %+v", first)
+	}
+	second := app.uploadFile("second.jpg", data, "force", "true")
+	if second.DuplicateOf == nil || second.DuplicateOf.ID != first.PhotoID {
+		t.Fatalf("second upload duplicate_of = %+v, want photo %d", second.DuplicateOf, first.PhotoID)
+	}
+	if !app.sameFile(first.Destination, second.Destination) {
+		t.Error("forced duplicate was not hard-linked to the first upload")
+	}
+}
+
+func TestUploadDuplicateCopiedUnlessForced(t *testing.T) {
+	app := newTestApp(t, "DEDUP_HARDLINKS", "true")
+	data := testutil.JPEG(320, 240, nil)
+
+	first := app.uploadFile("first.jpg", data)
+	second := app.uploadFile("second.jpg", data)
+	if app.sameFile(first.Destination, second.Destination) {
+		t.Error("duplicate uploaded without force was hard-linked")
+	}
+
+	app = newTestApp(t)
+	first = app.uploadFile("first.jpg", data)
+	second = app.uploadFile("second.jpg", data, "force", "true")
+	if app.sameFile(first.Destination, second.Destination) {
+		t.Error("forced duplicate was hard-linked with DEDUP_HARDLINKS off")
+	}
+}
+
+func TestDeleteSharedContent(t *testing.T) {
+	app := newTestApp(t, "DEDUP_HARDLINKS", "true")
+	data := testutil.JPEG(320, 240, nil)
+
+	first := app.uploadFile("first.jpg", data)
+	second := app.uploadFile("second.jpg", data, "force", "true")
+	markers := func() int {
+		var n int
+		if err := app.db.Pool().QueryRow(context.Background(), "SELECT count(*) FROM shared_content").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := markers(); n != 1 {
+		t.Fatalf("shared content markers = %d, want 1", n)
+	}
+
+	app.admin(http.MethodDelete, fmt.Sprintf("/admin/photos/%d", first.PhotoID), nil)
+	if _, err := os.Stat(filepath.Join(app.cfg.MediaRoot, first.Destination)); !os.IsNotExist(err) {
+		t.Errorf("deleted photo's file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(app.cfg.MediaRoot, second.Destination)); err != nil {
+		t.Errorf("remaining photo's file: %v", err)
+	}
+	if n := markers(); n != 1 {
+		t.Errorf("markers after deleting one of two = %d, want 1", n)
+	}
+
+	app.admin(http.MethodDelete, fmt.Sprintf("/admin/photos/%d", second.PhotoID), nil)
+	if n := markers(); n != 0 {
+		t.Errorf("markers after deleting both = %d, want 0", n)
+	}
+}
+
+func (a *testApp) sameFile(x, y string) bool {
+	a.t.Helper()
+	fx, err := os.Stat(filepath.Join(a.cfg.MediaRoot, x))
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	fy, err := os.Stat(filepath.Join(a.cfg.MediaRoot, y))
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return os.SameFile(fx, fy)
+}
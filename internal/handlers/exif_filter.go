@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// isoSQL is a photo's ISO, or NULL when exif_data has none or it isn't a
+// number, so comparisons on it never fail the query.
+const isoSQL = "CASE WHEN jsonb_typeof(exif_data->'iso') = 'number' THEN (exif_data->'iso')::numeric END"
+
+// Zero values are unset; numbers that don't parse are ignored.
+type exifFilter struct {
+	Camera   string
+	Lens     string
+	Aperture string
+	ISOMin   int
+	ISOMax   int
+	Year     int
+}
+
+func parseExifFilter(r *http.Request) exifFilter {
+	q := r.URL.Query()
+	f := exifFilter{
+		Camera:   q.Get("camera"),
+		Lens:     q.Get("lens"),
+		Aperture: q.Get("aperture"),
+	}
+	positive := func(name string) int {
+		n, err := strconv.Atoi(strings.TrimSpace(q.Get(name)))
+		if err != nil || n < 0 {
+			return 0
+		}
+		return n
+	}
+	f.ISOMin = positive("iso_min")
+	f.ISOMax = positive("iso_max")
+	if y := positive("year"); y >= 1800 && y <= 9999 {
+		f.Year = y
+	}
+	return f
+}
+
+func (f exifFilter) conditions(argIdx int) (string, []interface{}) {
+	var sql strings.Builder
+	var args []interface{}
+	add := func(format string, arg interface{}) {
+		fmt.Fprintf(&sql, " AND "+format, argIdx)
+		args = append(args, arg)
+		argIdx++
+	}
+	// Exact values go through containment, which the GIN index on
+	// exif_data answers.
+	for _, c := range []struct{ field, value string }{
+		{"camera_model", f.Camera},
+		{"lens_model", f.Lens},
+		{"aperture", f.Aperture},
+	} {
+		if c.value != "" {
+			add("exif_data @> jsonb_build_object('"+c.field+"', $%d::text)", c.value)
+		}
+	}
+	if f.ISOMin > 0 {
+		add(isoSQL+" >= $%d", f.ISOMin)
+	}
+	if f.ISOMax > 0 {
+		add(isoSQL+" <= $%d", f.ISOMax)
+	}
+	if f.Year > 0 {
+		add("EXTRACT(YEAR FROM taken_at) = $%d", f.Year)
+	}
+	return sql.String(), args
+}
+
+func (f exifFilter) Query() template.URL {
+	v := url.Values{}
+	for name, value := range map[string]string{"camera": f.Camera, "lens": f.Lens, "aperture": f.Aperture} {
+		if value != "" {
+			v.Set(name, value)
+		}
+	}
+	for name, n := range map[string]int{"iso_min": f.ISOMin, "iso_max": f.ISOMax, "year": f.Year} {
+		if n > 0 {
+			v.Set(name, strconv.Itoa(n))
+		}
+	}
+	return template.URL(v.Encode())
+}
+
+type exifFilterOptions struct {
+	Cameras   []string
+	Lenses    []string
+	Apertures []string
+	Years     []int
+}
+
+func (h *Handlers) exifOptions(ctx context.Context) exifFilterOptions {
+	var o exifFilterOptions
+	distinct := func(field string) []string {
+		rows, err := h.db.Pool().Query(ctx, fmt.Sprintf(
+			"SELECT DISTINCT exif_data->>'%s' v FROM photos WHERE exif_data->>'%s' != '' ORDER BY v", field, field))
+		if err != nil {
+			return nil
+		}
+		defer rows.Close()
+		var values []string
+		for rows.Next() {
+			var v string
+			if rows.Scan(&v) == nil {
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+	o.Cameras = distinct("camera_model")
+	o.Lenses = distinct("lens_model")
+
+	// "f/2.8" sorts as text before "f/16"; order by the number instead.
+	o.Apertures = distinct("aperture")
+	fNumber := func(s string) float64 {
+		n, _ := strconv.ParseFloat(strings.TrimPrefix(s, "f/"), 64)
+		return n
+	}
+	sort.SliceStable(o.Apertures, func(i, j int) bool { return fNumber(o.Apertures[i]) < fNumber(o.Apertures[j]) })
+
+	rows, err := h.db.Pool().Query(ctx,
+		"SELECT DISTINCT EXTRACT(YEAR FROM taken_at)::int y FROM photos WHERE taken_at IS NOT NULL ORDER BY y DESC")
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var y int
+			if rows.Scan(&y) == nil {
+				o.Years = append(o.Years, y)
+			}
+		}
+	}
+	return o
+}
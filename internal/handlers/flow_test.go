@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/services"
+	"github.com/Alexander-D-Karpov/photodock/internal/testutil"
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestScanToPublicPages(t *testing.T) {
+	app := newTestApp(t)
+	beach := app.writeMedia("Trip/beach.jpg", testutil.JPEG(640, 480, &testutil.EXIF{
+		Make:             "Canon",
+		Model:            "EOS R5",
+		DateTimeOriginal: "2023:07:14 10:30:00",
+		GPS:              &testutil.GPS{Lat: 60.1, Lon: 19.9},
+	}))
+	app.writeMedia("Trip/hill.jpg", testutil.JPEG(480, 640, nil))
+	app.scan()
+
+	id, urlPath := app.photo("Trip/beach.jpg")
+	if urlPath == "" {
+		t.Fatal("scanned photo has no URL path")
+	}
+	var takenAt time.Time
+	var cameraMake string
+	if err := app.db.Pool().QueryRow(context.Background(),
+		"SELECT taken_at, COALESCE(exif_data->>'camera_make', '') FROM photos WHERE id = $1", id).Scan(&takenAt, &cameraMake); err != nil {
+		t.Fatal(err)
+	}
+	if cameraMake != "Canon" || takenAt.Year() != 2023 {
+		t.Errorf("stored EXIF = %q, %v", cameraMake, takenAt)
+	}
+	if services.NewExifService(true, time.UTC).HasGPS(beach) {
+		t.Error("GPS left in the scanned file")
+	}
+
+	folder := app.get("/p/Trip/")
+	if folder.Code != http.StatusOK {
+		t.Fatalf("folder page: %d", folder.Code)
+	}
+	for _, want := range []string{"beach.jpg", "hill.jpg", "/p/" + urlPath} {
+		if !strings.Contains(folder.Body.String(), want) {
+			t.Errorf("folder page lacks %q", want)
+		}
+	}
+
+	page := app.get("/p/" + urlPath)
+	if page.Code != http.StatusOK {
+		t.Fatalf("photo page: %d", page.Code)
+	}
+	if !strings.Contains(page.Body.String(), fmt.Sprintf("/download/%d", id)) {
+		t.Error("photo page lacks its download link")
+	}
+
+	thumb := app.get(fmt.Sprintf("/thumb/small/%d", id))
+	if thumb.Code != http.StatusOK {
+		t.Fatalf("thumbnail: %d", thumb.Code)
+	}
+	img, _, err := image.Decode(bytes.NewReader(thumb.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("thumbnail does not decode: %v", err)
+	}
+	if w := img.Bounds().Dx(); w > app.cfg.ThumbSizes["small"].Width {
+		t.Errorf("thumbnail is %dpx wide", w)
+	}
+}
+
+func TestAdminHideAndDelete(t *testing.T) {
+	app := newTestApp(t)
+	abs := app.writeMedia("Trip/beach.jpg", testutil.JPEG(320, 240, nil))
+	app.scan()
+	id, urlPath := app.photo("Trip/beach.jpg")
+
+	if w := app.get(fmt.Sprintf("/thumb/small/%d", id)); w.Code != http.StatusOK {
+		t.Fatalf("thumbnail before hiding: %d", w.Code)
+	}
+
+	if w := app.do(httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/photos/%d/hide", id), nil)); w.Code == http.StatusOK {
+		t.Fatal("hide allowed without credentials")
+	}
+	if w := app.admin(http.MethodPost, fmt.Sprintf("/admin/photos/%d/hide", id), nil); w.Code != http.StatusOK {
+		t.Fatalf("hide: %d", w.Code)
+	}
+	if w := app.get("/p/" + urlPath); w.Code != http.StatusNotFound {
+		t.Errorf("hidden photo page: %d", w.Code)
+	}
+	if w := app.get(fmt.Sprintf("/thumb/small/%d", id)); w.Code != http.StatusNotFound {
+		t.Errorf("hidden photo thumbnail: %d", w.Code)
+	}
+	if strings.Contains(app.get("/p/Trip/").Body.String(), "beach.jpg") {
+		t.Error("hidden photo listed in its folder")
+	}
+	if w := app.admin(http.MethodGet, fmt.Sprintf("/admin/thumb/small/%d", id), nil); w.Code != http.StatusOK {
+		t.Errorf("admin thumbnail of hidden photo: %d", w.Code)
+	}
+
+	if w := app.admin(http.MethodPost, fmt.Sprintf("/admin/photos/%d/hide", id), nil); w.Code != http.StatusOK {
+		t.Fatalf("unhide: %d", w.Code)
+	}
+	if w := app.get("/p/" + urlPath); w.Code != http.StatusOK {
+		t.Errorf("unhidden photo page: %d", w.Code)
+	}
+
+	if w := app.admin(http.MethodDelete, fmt.Sprintf("/admin/photos/%d", id), nil); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d", w.Code)
+	}
+	var n int
+	_ = app.db.Pool().QueryRow(context.Background(), "SELECT count(*) FROM photos WHERE id = $1", id).Scan(&n)
+	if n != 0 {
+		t.Error("deleted photo still in the database")
+	}
+	if _, err := os.Stat(abs); !os.IsNotExist(err) {
+		t.Errorf("deleted photo still on disk: %v", err)
+	}
+	if w := app.get(fmt.Sprintf("/thumb/small/%d", id)); w.Code != http.StatusNotFound {
+		t.Errorf("deleted photo thumbnail: %d", w.Code)
+	}
+}
+
+func TestFolderStatusRejectsUnknown(t *testing.T) {
+	app := newTestApp(t)
+	app.writeMedia("Trip/beach.jpg", testutil.JPEG(320, 240, nil))
+	app.scan()
+	var id int
+	if err := app.db.Pool().QueryRow(context.Background(), "SELECT id FROM folders WHERE path = 'Trip'").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+
+	for status, want := range map[string]int{"bogus": http.StatusBadRequest, "draft": http.StatusSeeOther} {
+		r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/folders/%d", id),
+			strings.NewReader("name=Trip&status="+status))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth(testAdminUser, testAdminPass)
+		if w := app.do(r); w.Code != want {
+			t.Errorf("status %s: %d, want %d", status, w.Code, want)
+		}
+	}
+	var status string
+	_ = app.db.Pool().QueryRow(context.Background(), "SELECT status FROM folders WHERE id = $1", id).Scan(&status)
+	if status != "draft" {
+		t.Errorf("folder status = %q, want draft", status)
+	}
+}
+
+func TestDecomposedNamesOnDisk(t *testing.T) {
+	app := newTestApp(t)
+	// As macOS writes them, decomposed; URLs and rows use the composed form.
+	app.writeMedia(norm.NFD.String("Åland/Kökar.jpg"), testutil.JPEG(320, 240, nil))
+	app.scan()
+
+	id, urlPath := app.photo("Åland/Kökar.jpg")
+	if w := app.get("/p/" + url.PathEscape("Åland") + "/"); w.Code != http.StatusOK {
+		t.Errorf("folder page: %d", w.Code)
+	}
+	if w := app.get("/p/" + urlPath); w.Code != http.StatusOK {
+		t.Errorf("photo page: %d", w.Code)
+	}
+	if w := app.get(fmt.Sprintf("/thumb/small/%d", id)); w.Code != http.StatusOK {
+		t.Errorf("thumbnail: %d", w.Code)
+	}
+	if w := app.get(fmt.Sprintf("/original/%d", id)); w.Code != http.StatusOK {
+		t.Errorf("original: %d", w.Code)
+	}
+}
+
+func TestHiddenPhotoFiles(t *testing.T) {
+	app := newTestApp(t)
+	app.writeMedia("Trip/beach.jpg", testutil.JPEG(320, 240, nil))
+	app.scan()
+	id, _ := app.photo("Trip/beach.jpg")
+
+	paths := []string{
+		fmt.Sprintf("/thumb/small/%d", id),
+		fmt.Sprintf("/placeholder/%d", id),
+		fmt.Sprintf("/original/%d", id),
+	}
+	// Fetched while visible, so cached copies exist when it is hidden.
+	for _, path := range paths {
+		if w := app.get(path); w.Code != http.StatusOK {
+			t.Fatalf("%s before hiding: %d", path, w.Code)
+		}
+	}
+	if w := app.admin(http.MethodPost, fmt.Sprintf("/admin/photos/%d/hide", id), nil); w.Code != http.StatusOK {
+		t.Fatalf("hide: %d", w.Code)
+	}
+	for _, path := range paths {
+		if w := app.get(path); w.Code != http.StatusNotFound {
+			t.Errorf("%s of a hidden photo: %d", path, w.Code)
+		}
+		if w := app.get(path + "?v=2"); w.Code != http.StatusNotFound {
+			t.Errorf("%s of a hidden photo with a cache buster: %d", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	unlockCookiePrefix = "photodock_unlock_"
+	unlockTTL          = 30 * 24 * time.Hour
+)
+
+// hasLockedFolders lets the query-free fast paths stay query-free while
+// no folder is protected.
+func (h *Handlers) hasLockedFolders(r *http.Request) bool {
+	switch h.anyLocked.Load() {
+	case 1:
+		return false
+	case 2:
+		return true
+	}
+	var exists bool
+	if err := h.db.Pool().QueryRow(r.Context(), "SELECT EXISTS(SELECT 1 FROM folders WHERE access_password IS NOT NULL)").Scan(&exists); err != nil {
+		return true
+	}
+	if exists {
+		h.anyLocked.Store(2)
+	} else {
+		h.anyLocked.Store(1)
+	}
+	return exists
+}
+
+// The password hash is signed too, so changing or removing the password
+// revokes every cookie.
+func (h *Handlers) unlockSig(folderID int, expiry int64, pwHash string) string {
+	return h.sign("unlock", strconv.Itoa(folderID), strconv.FormatInt(expiry, 10), pwHash)
+}
+
+func (h *Handlers) unlockedFolders(r *http.Request) []int {
+	claims := make(map[int]string)
+	var ids []int
+	for _, c := range r.Cookies() {
+		rest, ok := strings.CutPrefix(c.Name, unlockCookiePrefix)
+		if !ok {
+			continue
+		}
+		if id, err := strconv.Atoi(rest); err == nil {
+			claims[id] = c.Value
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := h.db.Pool().Query(r.Context(), "SELECT id, access_password FROM folders WHERE id = ANY($1) AND access_password IS NOT NULL", ids)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var unlocked []int
+	now := time.Now().Unix()
+	for rows.Next() {
+		var id int
+		var pwHash string
+		if rows.Scan(&id, &pwHash) != nil {
+			continue
+		}
+		exp, sig, _ := strings.Cut(claims[id], ".")
+		expiry, err := strconv.ParseInt(exp, 10, 64)
+		if err != nil || expiry < now {
+			continue
+		}
+		if hmac.Equal([]byte(sig), []byte(h.unlockSig(id, expiry, pwHash))) {
+			unlocked = append(unlocked, id)
+		}
+	}
+	return unlocked
+}
+
+func (h *Handlers) canView(r *http.Request, lockedBy sql.NullInt64) bool {
+	if !lockedBy.Valid || h.isAdmin(r) {
+		return true
+	}
+	return slices.Contains(h.unlockedFolders(r), int(lockedBy.Int64))
+}
+
+// lockFilter is a WHERE clause suffix that keeps out rows whose column
+// points at a protected folder the request hasn't unlocked.
+func (h *Handlers) lockFilter(r *http.Request, column string) string {
+	if h.isAdmin(r) {
+		return ""
+	}
+	ids := h.unlockedFolders(r)
+	if len(ids) == 0 {
+		return " AND " + column + " IS NULL"
+	}
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = strconv.Itoa(id)
+	}
+	return fmt.Sprintf(" AND (%[1]s IS NULL OR %[1]s IN (%[2]s))", column, strings.Join(list, ","))
+}
+
+// The response must not be cached for other visitors.
+func denyLocked(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.Error(w, "This folder is password protected", http.StatusForbidden)
+}
+
+func (h *Handlers) renderUnlock(w http.ResponseWriter, r *http.Request, folderID int, next string, failed bool) {
+	var name string
+	_ = h.db.Pool().QueryRow(r.Context(), "SELECT name FROM folders WHERE id = $1", folderID).Scan(&name)
+	w.Header().Set("Cache-Control", "private, no-store")
+	h.renderStatus(w, http.StatusUnauthorized, "public/unlock.html", map[string]interface{}{
+		"Title":    name,
+		"FolderID": folderID,
+		"Next":     next,
+		"Failed":   failed,
+	})
+}
+
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func (h *Handlers) publicUnlock(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	next := safeNext(r.FormValue("next"))
+
+	var pwHash string
+	if err := h.db.Pool().QueryRow(r.Context(), "SELECT access_password FROM folders WHERE id = $1 AND access_password IS NOT NULL", id).Scan(&pwHash); err != nil {
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(pwHash), []byte(r.FormValue("password"))) != nil {
+		h.renderUnlock(w, r, id, next, true)
+		return
+	}
+
+	expires := time.Now().Add(unlockTTL)
+	http.SetCookie(w, &http.Cookie{
+		Name:     unlockCookiePrefix + strconv.Itoa(id),
+		Value:    strconv.FormatInt(expires.Unix(), 10) + "." + h.unlockSig(id, expires.Unix(), pwHash),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   h.secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+func (h *Handlers) setFolderPassword(r *http.Request, id int, password string) error {
+	var pwHash *string
+	if password != "" {
+		b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		s := string(b)
+		pwHash = &s
+	}
+	_, err := h.db.Pool().Exec(r.Context(), "UPDATE folders SET access_password = $2 WHERE id = $1", id, pwHash)
+	h.anyLocked.Store(0)
+	return err
+}
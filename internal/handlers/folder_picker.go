@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const folderPickerLimit = 50
+
+type pickerFolder struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	Depth       int    `json:"depth"`
+	HasChildren bool   `json:"has_children"`
+}
+
+func (h *Handlers) apiAdminFolderPicker(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	where := []string{"true"}
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if search := strings.TrimSpace(q.Get("q")); search != "" {
+		p := arg("%" + search + "%")
+		where = append(where, "(f.name ILIKE "+p+" OR f.path ILIKE "+p+")")
+	} else if v := q.Get("parent_id"); v != "" && v != "root" {
+		pid, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid parent_id", 400)
+			return
+		}
+		where = append(where, "f.parent_id = "+arg(pid))
+	} else {
+		where = append(where, "f.parent_id IS NULL")
+	}
+
+	if v := q.Get("exclude_id"); v != "" {
+		eid, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid exclude_id", 400)
+			return
+		}
+		// A folder can't become its own ancestor, so its whole subtree is
+		// left out of the choices.
+		p := arg(eid)
+		where = append(where, `NOT EXISTS (SELECT 1 FROM folders ex WHERE ex.id = `+p+`
+			AND (f.id = ex.id OR left(f.path, length(ex.path) + 1) = ex.path || '/'))`)
+	}
+
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, err := h.db.Pool().Query(ctx, `
+		SELECT f.id, f.name, f.path, EXISTS(SELECT 1 FROM folders c WHERE c.parent_id = f.id)
+		FROM folders f WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY f.path LIMIT `+strconv.Itoa(folderPickerLimit+1)+` OFFSET `+strconv.Itoa(offset), args...)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+
+	folders := []pickerFolder{}
+	for rows.Next() {
+		var f pickerFolder
+		if err := rows.Scan(&f.ID, &f.Name, &f.Path, &f.HasChildren); err != nil {
+			continue
+		}
+		f.Depth = strings.Count(f.Path, "/")
+		folders = append(folders, f)
+	}
+
+	hasMore := len(folders) > folderPickerLimit
+	if hasMore {
+		folders = folders[:folderPickerLimit]
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"folders":  folders,
+		"has_more": hasMore,
+	})
+}
+
+func (h *Handlers) folderPath(ctx context.Context, id int64) string {
+	var path string
+	_ = h.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", id).Scan(&path)
+	return path
+}
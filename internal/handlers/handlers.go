@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
-	"embed"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -17,15 +19,19 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Alexander-D-Karpov/photodock/internal/config"
 	"github.com/Alexander-D-Karpov/photodock/internal/database"
 	"github.com/Alexander-D-Karpov/photodock/internal/models"
 	"github.com/Alexander-D-Karpov/photodock/internal/services"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Handlers struct {
@@ -33,27 +39,41 @@ type Handlers struct {
 	cfg        *config.Config
 	thumbSvc   *services.ThumbnailService
 	scanSvc    *services.ScannerService
+	settings   *services.SettingsService
+	warnings   *services.WarningsService
+	backups    *services.BackupService
+	lifecycle  *services.Lifecycle
 	tmpl       *template.Template
-	webFS      embed.FS
+	webFS      fs.FS
 	uploads    map[string]*ChunkedUpload
 	uploadsMux sync.RWMutex
+	// Whether some folder has a password: 0 unknown, 1 none, 2 some.
+	anyLocked    atomic.Int32
+	open         openPhotos
+	authFails    *authThrottle
+	randomCounts sync.Map
 }
 
 type ChunkedUpload struct {
-	ID        string
-	Filename  string
-	Size      int64
-	FolderID  *int
-	TempDir   string
-	Chunks    map[int]bool
-	CreatedAt time.Time
+	ID          string
+	Filename    string
+	Size        int64
+	TotalChunks int
+	SHA256      string
+	FolderID    *int
+	Dirs        []string
+	TempDir     string
+	Chunks      map[int]bool
+	Staged      string
+	AutoFile    bool
+	CreatedAt   time.Time
 }
 
 type IntPtrOrString struct {
 	V *int
 }
 
-func New(db *database.DB, cfg *config.Config, thumbSvc *services.ThumbnailService, scanSvc *services.ScannerService, webFS embed.FS) *Handlers {
+func New(db *database.DB, cfg *config.Config, thumbSvc *services.ThumbnailService, scanSvc *services.ScannerService, settings *services.SettingsService, warnings *services.WarningsService, backups *services.BackupService, lifecycle *services.Lifecycle, webFS fs.FS) *Handlers {
 	funcMap := template.FuncMap{
 		"json": func(v interface{}) template.JS {
 			b, _ := json.Marshal(v)
@@ -63,12 +83,15 @@ func New(db *database.DB, cfg *config.Config, thumbSvc *services.ThumbnailServic
 		"formatDate": func(t time.Time) string {
 			return t.Format("2006-01-02 15:04")
 		},
-		"add":       func(a, b int) int { return a + b },
-		"sub":       func(a, b int) int { return a - b },
-		"int64":     func(i int) int64 { return int64(i) },
-		"urlpath":   escapeURLPath,
-		"mulf":      func(a, b float64) float64 { return a * b },
-		"hasPrefix": strings.HasPrefix,
+		"add":            func(a, b int) int { return a + b },
+		"sub":            func(a, b int) int { return a - b },
+		"int64":          func(i int) int64 { return int64(i) },
+		"urlpath":        escapeURLPath,
+		"mulf":           func(a, b float64) float64 { return a * b },
+		"hasPrefix":      strings.HasPrefix,
+		"join":           strings.Join,
+		"stars":          stars,
+		"perPageOptions": perPageOptions,
 		"iterate": func(n int) []int {
 			result := make([]int, n)
 			for i := range result {
@@ -76,6 +99,20 @@ func New(db *database.DB, cfg *config.Config, thumbSvc *services.ThumbnailServic
 			}
 			return result
 		},
+		"mediaURL":      mediaURL,
+		"datetimeLocal": formatDatetimeLocal,
+		"srcset": func(size string, id, version int) string {
+			if thumbSvc == nil {
+				return mediaURL("thumb/"+size, id, version)
+			}
+			return thumbSvc.Srcset("thumb", size, id, version)
+		},
+		"adminSrcset": func(size string, id, version int) string {
+			if thumbSvc == nil {
+				return mediaURL("admin/thumb/"+size, id, version)
+			}
+			return thumbSvc.Srcset("admin/thumb", size, id, version)
+		},
 		"divf": func(a, b int) float64 {
 			if b == 0 {
 				return 1.0
@@ -103,13 +140,18 @@ func New(db *database.DB, cfg *config.Config, thumbSvc *services.ThumbnailServic
 	}
 
 	return &Handlers{
-		db:       db,
-		cfg:      cfg,
-		thumbSvc: thumbSvc,
-		scanSvc:  scanSvc,
-		tmpl:     tmpl,
-		webFS:    webFS,
-		uploads:  make(map[string]*ChunkedUpload),
+		db:        db,
+		cfg:       cfg,
+		thumbSvc:  thumbSvc,
+		scanSvc:   scanSvc,
+		settings:  settings,
+		warnings:  warnings,
+		backups:   backups,
+		lifecycle: lifecycle,
+		tmpl:      tmpl,
+		webFS:     webFS,
+		uploads:   make(map[string]*ChunkedUpload),
+		authFails: newAuthThrottle(cfg.AuthMaxFailures, cfg.AuthLockout),
 	}
 }
 
@@ -150,17 +192,38 @@ func (x *IntPtrOrString) UnmarshalJSON(b []byte) error {
 
 func (h *Handlers) RegisterRoutes(mux *http.ServeMux) {
 	staticFS, _ := fs.Sub(h.webFS, "web/static")
-	mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
+	mux.Handle("GET /static/", h.staticCache(http.StripPrefix("/static/", http.FileServer(http.FS(staticFS)))))
 
+	mux.HandleFunc("GET /healthz", h.healthz)
+	mux.HandleFunc("GET /readyz", h.readyz)
+	mux.HandleFunc("GET /robots.txt", h.robotsTxt)
+	mux.HandleFunc("GET /sitemap.xml", h.sitemap)
 	mux.HandleFunc("GET /", h.publicIndex)
 	mux.HandleFunc("GET /folder/{id}", h.publicFolder)
+	mux.HandleFunc("GET /folder/{id}/manifest.json", h.folderManifest)
 	mux.HandleFunc("GET /p/{path...}", h.publicPath)
 	mux.HandleFunc("GET /photo/{id}", h.publicPhotoByID)
+	mux.HandleFunc("GET /tag/{name}", h.publicTag)
+	mux.HandleFunc("GET /search", h.publicSearch)
+	mux.HandleFunc("GET /stats", h.publicStats)
+	mux.HandleFunc("GET /timeline", h.publicTimeline)
+	mux.HandleFunc("GET /oembed", h.oembed)
 	mux.HandleFunc("GET /thumb/{size}/{id}", h.serveThumbnail)
 	mux.HandleFunc("GET /original/{id}", h.serveOriginal)
+	mux.HandleFunc("GET /download/{id}", h.serveDownload)
+	mux.HandleFunc("GET /img/{id}", h.serveCustomImage)
+	mux.HandleFunc("GET /web/{id}", h.serveWebOriginal)
 	mux.HandleFunc("GET /placeholder/{id}", h.servePlaceholder)
-
+	mux.HandleFunc("GET /cover/{id}/{size}", h.serveCover)
+	mux.HandleFunc("POST /unlock/{id}", h.publicUnlock)
+	mux.HandleFunc("GET /login", h.siteLoginPage)
+	mux.HandleFunc("POST /login", h.siteLogin)
+
+	mux.HandleFunc("GET /admin/login", h.adminLoginPage)
+	mux.HandleFunc("POST /admin/login", h.adminLogin)
+	mux.HandleFunc("POST /admin/logout", h.adminAuth(h.adminLogout))
 	mux.HandleFunc("GET /admin", h.adminAuth(h.adminDashboard))
+	mux.HandleFunc("GET /admin/thumb/{size}/{id}", h.adminAuth(h.adminServeThumbnail))
 	mux.HandleFunc("GET /admin/stats", h.adminAuth(h.adminStats))
 	mux.HandleFunc("GET /api/stats", h.adminAuth(h.apiStats))
 	mux.HandleFunc("GET /admin/folders", h.adminAuth(h.adminFolders))
@@ -169,41 +232,157 @@ func (h *Handlers) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /admin/folders/{id}", h.adminAuth(h.adminUpdateFolder))
 	mux.HandleFunc("DELETE /admin/folders/{id}", h.adminAuth(h.adminDeleteFolder))
 	mux.HandleFunc("POST /admin/folders/{id}/cover", h.adminAuth(h.adminSetCover))
+	mux.HandleFunc("POST /admin/folders/{id}/publish", h.adminAuth(h.adminPublishFolder))
 	mux.HandleFunc("GET /admin/photos", h.adminAuth(h.adminPhotos))
 	mux.HandleFunc("GET /admin/photos/{id}", h.adminAuth(h.adminEditPhoto))
 	mux.HandleFunc("POST /admin/photos/{id}", h.adminAuth(h.adminUpdatePhoto))
 	mux.HandleFunc("DELETE /admin/photos/{id}", h.adminAuth(h.adminDeletePhoto))
 	mux.HandleFunc("POST /admin/photos/{id}/hide", h.adminAuth(h.adminToggleHide))
 	mux.HandleFunc("POST /admin/photos/{id}/move", h.adminAuth(h.adminMovePhoto))
+	mux.HandleFunc("POST /admin/photos/{id}/reexif", h.adminAuth(h.adminReexifPhoto))
+	mux.HandleFunc("POST /admin/photos/{id}/rescan", h.adminAuth(h.adminRescanPhoto))
+	mux.HandleFunc("POST /admin/photos/{id}/rotate", h.adminAuth(h.adminRotatePhoto))
+	mux.HandleFunc("POST /admin/photos/bulk", h.adminAuth(h.adminBulkPhotos))
+	mux.HandleFunc("POST /admin/photos/zip", h.adminAuth(h.adminZipPhotos))
+	mux.HandleFunc("GET /admin/undo", h.adminAuth(h.adminUndoList))
+	mux.HandleFunc("POST /admin/undo/{token}", h.adminAuth(h.adminUndo))
 	mux.HandleFunc("POST /admin/scan", h.adminAuth(h.adminScan))
+	mux.HandleFunc("GET /admin/scan/status", h.adminAuth(h.adminScanStatus))
+	mux.HandleFunc("POST /admin/scan/cancel", h.adminAuth(h.adminScanCancel))
 	mux.HandleFunc("POST /admin/scan/{id}", h.adminAuth(h.adminScanFolder))
 	mux.HandleFunc("POST /admin/clean", h.adminAuth(h.adminClean))
 	mux.HandleFunc("POST /admin/regenerate-urls", h.adminAuth(h.adminRegenerateURLs))
+	mux.HandleFunc("GET /admin/backups", h.adminAuth(h.adminBackups))
+	mux.HandleFunc("POST /admin/backups", h.adminAuth(h.adminCreateBackup))
+	mux.HandleFunc("GET /admin/backups/{name}", h.adminAuth(h.adminDownloadBackup))
+	mux.HandleFunc("POST /admin/backups/{name}/restore", h.adminAuth(h.adminRestoreBackup))
 	mux.HandleFunc("POST /admin/upload", h.adminAuth(h.adminUpload))
 	mux.HandleFunc("POST /admin/upload/file", h.adminAuth(h.adminUploadFile))
+	mux.HandleFunc("POST /admin/upload/url", h.adminAuth(h.adminUploadURL))
 	mux.HandleFunc("POST /admin/upload/init", h.adminAuth(h.adminUploadInit))
 	mux.HandleFunc("POST /admin/upload/chunk", h.adminAuth(h.adminUploadChunk))
 	mux.HandleFunc("POST /admin/upload/finalize", h.adminAuth(h.adminUploadFinalize))
+	mux.HandleFunc("POST /admin/upload/preview", h.adminAuth(h.adminUploadPreview))
+	mux.HandleFunc("POST /admin/upload/confirm", h.adminAuth(h.adminUploadConfirm))
+	mux.HandleFunc("GET /admin/upload/{id}/status", h.adminAuth(h.adminUploadStatus))
+	mux.HandleFunc("DELETE /admin/upload/{id}", h.adminAuth(h.adminUploadCancel))
 
 	mux.HandleFunc("GET /api/folders", h.apiListFolders)
 	mux.HandleFunc("GET /api/folders/{id}", h.apiGetFolder)
 	mux.HandleFunc("GET /api/photos", h.apiListPhotos)
 	mux.HandleFunc("GET /api/photos/{id}", h.apiGetPhoto)
 	mux.HandleFunc("GET /api/random", h.apiRandomPhoto)
+	mux.HandleFunc("GET /api/slideshow/{folder_id}", h.apiSlideshow)
+
+	mux.HandleFunc("GET /api/v1/folders", h.apiV1ListFolders)
+	mux.HandleFunc("GET /api/v1/folders/{id}", h.apiV1GetFolder)
+	mux.HandleFunc("GET /api/v1/photos/{id}", h.apiV1GetPhoto)
+	mux.HandleFunc("GET /api/v1/search", h.apiV1Search)
+	mux.HandleFunc("POST /api/v1/folders", h.adminAuth(h.apiV1CreateFolder))
+	mux.HandleFunc("PATCH /api/v1/folders/{id}", h.adminAuth(h.apiV1UpdateFolder))
+	mux.HandleFunc("DELETE /api/v1/folders/{id}", h.adminAuth(h.apiV1DeleteFolder))
+	mux.HandleFunc("POST /api/v1/photos", h.adminAuth(h.apiV1UploadPhoto))
+	mux.HandleFunc("PATCH /api/v1/photos/{id}", h.adminAuth(h.apiV1UpdatePhoto))
+	mux.HandleFunc("DELETE /api/v1/photos/{id}", h.adminAuth(h.apiV1DeletePhoto))
 	mux.HandleFunc("GET /random", h.publicRandomPhoto)
 	mux.HandleFunc("POST /admin/reprocess", h.adminAuth(h.adminReprocess))
-}
-
+	mux.HandleFunc("POST /admin/reexif", h.adminAuth(h.adminReexif))
+	mux.HandleFunc("GET /admin/reexif", h.adminAuth(h.adminReexifStatus))
+	mux.HandleFunc("POST /admin/fix-orientation", h.adminAuth(h.adminFixOrientation))
+	mux.HandleFunc("POST /admin/reencode-blurhash", h.adminAuth(h.adminReencodeBlurhash))
+	mux.HandleFunc("GET /admin/settings", h.adminAuth(h.adminSettings))
+	mux.HandleFunc("POST /admin/settings", h.adminAuth(h.adminUpdateSettings))
+	mux.HandleFunc("GET /admin/duplicates", h.adminAuth(h.adminDuplicates))
+	mux.HandleFunc("POST /admin/duplicates/keep", h.adminAuth(h.adminKeepDuplicate))
+	mux.HandleFunc("GET /admin/redirects", h.adminAuth(h.adminRedirects))
+	mux.HandleFunc("POST /admin/redirects/prune", h.adminAuth(h.adminPruneRedirects))
+	mux.HandleFunc("GET /admin/tokens", h.adminAuth(h.adminTokens))
+	mux.HandleFunc("POST /admin/tokens", h.adminAuth(h.adminCreateToken))
+	mux.HandleFunc("POST /admin/tokens/{id}/revoke", h.adminAuth(h.adminRevokeToken))
+	mux.HandleFunc("GET /admin/scans", h.adminAuth(h.adminScans))
+	mux.Handle("GET /admin/scan-errors", http.RedirectHandler("/admin/scans", http.StatusMovedPermanently))
+	mux.HandleFunc("POST /admin/cache/gc", h.adminAuth(h.adminCacheGC))
+	mux.HandleFunc("GET /api/admin/warnings", h.adminAuth(h.apiAdminWarnings))
+	mux.HandleFunc("GET /api/admin/folders/picker", h.adminAuth(h.apiAdminFolderPicker))
+}
+
+// No Basic challenge is sent, so browsers never cache credentials
+// another site could ride on.
 func (h *Handlers) adminAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		user, pass, ok := r.BasicAuth()
-		if !ok || user != h.cfg.AdminUser || pass != h.cfg.AdminPass {
-			w.Header().Set("WWW-Authenticate", `Basic realm="Admin"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		switch {
+		case h.validSession(r):
+			if !safeMethod(r.Method) && !h.validCSRF(r) {
+				http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		case strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "):
+			if !h.tokenAuth(w, r) {
+				return
+			}
+		case h.basicAuthAdmin(r):
+		case h.authLockedOut(w, r):
+			http.Error(w, "Too many failed login attempts", http.StatusTooManyRequests)
+			return
+		default:
+			if !loginRedirect(w, r) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			}
 			return
 		}
+		w.Header().Set("Cache-Control", "private, no-store")
 		next(w, r)
+		if !safeMethod(r.Method) {
+			h.open.reset()
+		}
+	}
+}
+
+// Basic auth is left to admin routes, so stray headers on public
+// requests never count toward the lockout.
+func (h *Handlers) isAdmin(r *http.Request) bool {
+	return h.validSession(r) || h.tokenScope(r) != ""
+}
+
+func (h *Handlers) basicAuthAdmin(r *http.Request) bool {
+	if !h.cfg.AllowBasicAuth {
+		return false
+	}
+	// A browser replays cached Basic credentials on requests from any
+	// site, so writes another origin started don't get them.
+	if !safeMethod(r.Method) && h.crossSite(r) {
+		return false
+	}
+	user, pass, ok := r.BasicAuth()
+	return ok && h.tryCredentials(r, user, pass)
+}
+
+func (h *Handlers) crossSite(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	return origin != "" && origin != h.baseURL(r)
+}
+
+// Both sides are hashed to the same length first, so not even a length
+// mismatch shows in timing.
+func (h *Handlers) checkCredentials(user, pass string) bool {
+	userOK := digestEqual(user, h.cfg.AdminUser)
+	var passOK bool
+	if h.cfg.AdminPassHash != "" {
+		passOK = bcrypt.CompareHashAndPassword([]byte(h.cfg.AdminPassHash), []byte(pass)) == nil
+	} else {
+		passOK = digestEqual(pass, h.cfg.AdminPass)
 	}
+	return userOK && passOK
+}
+
+func digestEqual(a, b string) bool {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
 }
 
 func (h *Handlers) publicIndex(w http.ResponseWriter, r *http.Request) {
@@ -213,24 +392,38 @@ func (h *Handlers) publicIndex(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
+	prefs := h.viewerPrefs(r)
+	listing := parsePhotoListing(r, prefs.Sort)
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
 
 	if r.URL.Query().Get("ajax") == "1" {
-		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-		if page < 1 {
-			page = 1
-		}
-		h.jsonPhotosPage(w, r, ctx, nil, page)
+		h.jsonPhotosPage(w, r, ctx, nil, listing, page, prefs.PerPage)
 		return
 	}
+	if h.pageNotModified(w, r, 0, prefs, false) {
+		return
+	}
+
+	var rootPhotoCount int
+	_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE folder_id IS NULL AND hidden = false AND draft = false AND photodock_live(live_from, live_until)"+listing.filter()).Scan(&rootPhotoCount)
+
+	totalPages := pageCount(rootPhotoCount, prefs.PerPage)
+	if page > totalPages {
+		page = totalPages
+	}
 
 	folders, _ := h.getRootFolders(ctx)
-	photos, _ := h.getRootPhotos(ctx)
+	photos, _ := h.getRootPhotosPage(ctx, listing, prefs.PerPage, (page-1)*prefs.PerPage)
 
 	var photoCount, folderCount int
 	var totalSize int64
-	_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE hidden = false").Scan(&photoCount)
-	_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM folders WHERE parent_id IS NULL").Scan(&folderCount)
-	_ = h.db.Pool().QueryRow(ctx, "SELECT COALESCE(SUM(size_bytes), 0) FROM photos WHERE hidden = false").Scan(&totalSize)
+	_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE hidden = false AND draft = false AND photodock_live(live_from, live_until)").Scan(&photoCount)
+	_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM folders WHERE parent_id IS NULL AND draft = false AND photodock_live(live_from, live_until)").Scan(&folderCount)
+	_ = h.db.Pool().QueryRow(ctx, "SELECT COALESCE(SUM(size_bytes), 0) FROM photos WHERE hidden = false AND draft = false AND photodock_live(live_from, live_until)").Scan(&totalSize)
 
 	h.render(w, "public/index.html", map[string]interface{}{
 		"Folders":     folders,
@@ -239,30 +432,34 @@ func (h *Handlers) publicIndex(w http.ResponseWriter, r *http.Request) {
 		"PhotoCount":  photoCount,
 		"FolderCount": folderCount,
 		"TotalSize":   totalSize,
+		"Prefs":       prefs,
+		"Listing":     listing,
+		"Page":        page,
+		"TotalPages":  totalPages,
 	})
 }
 
-func (h *Handlers) jsonPhotosPage(w http.ResponseWriter, r *http.Request, ctx context.Context, folderID *int, page int) {
-	const perPage = 50
+func (h *Handlers) jsonPhotosPage(w http.ResponseWriter, r *http.Request, ctx context.Context, folderID *int, listing photoListing, page, perPage int) {
 	offset := (page - 1) * perPage
 
 	var where string
 	var args []interface{}
 
 	if folderID != nil {
-		where = "folder_id = $1 AND hidden = false"
+		where = "folder_id = $1 AND hidden = false AND draft = false AND photodock_live(live_from, live_until)"
 		args = []interface{}{*folderID, perPage, offset}
 	} else {
-		where = "folder_id IS NULL AND hidden = false"
+		where = "folder_id IS NULL AND hidden = false AND draft = false AND photodock_live(live_from, live_until)"
 		args = []interface{}{perPage, offset}
 	}
+	where += listing.filter()
 
 	query := fmt.Sprintf(`
 		SELECT id, filename, COALESCE(url_path, ''), title, size_bytes, blurhash, 
 		       COALESCE(EXTRACT(EPOCH FROM taken_at), EXTRACT(EPOCH FROM created_at))::bigint as date
 		FROM photos WHERE %s 
-		ORDER BY COALESCE(taken_at, created_at) DESC, id DESC 
-		LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args))
+		ORDER BY %s 
+		LIMIT $%d OFFSET $%d`, where, listing.order(), len(args)-1, len(args))
 
 	if folderID != nil {
 		args = []interface{}{*folderID, perPage, offset}
@@ -303,6 +500,9 @@ func (h *Handlers) jsonPhotosPage(w http.ResponseWriter, r *http.Request, ctx co
 		} else {
 			p.URL = fmt.Sprintf("/photo/%d", p.ID)
 		}
+		if q := listing.Query(); q != "" {
+			p.URL += "?" + string(q)
+		}
 		if title.Valid {
 			p.Title = title.String
 		}
@@ -314,9 +514,9 @@ func (h *Handlers) jsonPhotosPage(w http.ResponseWriter, r *http.Request, ctx co
 
 	var totalCount int
 	if folderID != nil {
-		_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE folder_id = $1 AND hidden = false", *folderID).Scan(&totalCount)
+		_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE "+where, *folderID).Scan(&totalCount)
 	} else {
-		_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE folder_id IS NULL AND hidden = false").Scan(&totalCount)
+		_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE "+where).Scan(&totalCount)
 	}
 
 	hasMore := page*perPage < totalCount
@@ -334,7 +534,7 @@ func (h *Handlers) publicFolder(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var folderPath string
-	if err := h.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", id).Scan(&folderPath); err != nil {
+	if err := h.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1 AND draft = false AND photodock_live(live_from, live_until)", id).Scan(&folderPath); err != nil {
 		http.NotFound(w, r)
 		return
 	}
@@ -349,15 +549,36 @@ func (h *Handlers) publicPath(w http.ResponseWriter, r *http.Request) {
 	}
 
 	isFolderReq := strings.HasSuffix(r.URL.Path, "/")
-	cleaned := strings.Trim(raw, "/")
+	cleaned := services.NormalizePath(strings.Trim(raw, "/"))
 	if cleaned == "" {
 		http.Redirect(w, r, "/", http.StatusMovedPermanently)
 		return
 	}
 
+	if folderPath, ok := strings.CutSuffix(cleaned, "/manifest.json"); ok {
+		folder, err := h.getFolderByPath(r.Context(), folderPath)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		h.serveManifest(w, r, folder)
+		return
+	}
+
+	if folderPath, ok := strings.CutSuffix(cleaned, "/slideshow"); ok {
+		if folder, err := h.getFolderByPath(r.Context(), folderPath); err == nil {
+			h.renderSlideshow(w, r, folder)
+			return
+		}
+	}
+
 	if isFolderReq {
 		folder, err := h.getFolderByPath(r.Context(), cleaned)
 		if err != nil {
+			if target, ok := h.urlRedirect(r.Context(), cleaned); ok {
+				http.Redirect(w, r, "/p/"+escapeURLPath(target)+"/", http.StatusMovedPermanently)
+				return
+			}
 			http.NotFound(w, r)
 			return
 		}
@@ -372,6 +593,10 @@ func (h *Handlers) publicPath(w http.ResponseWriter, r *http.Request) {
 
 	photo, err := h.getPhotoByURLPath(r.Context(), cleaned)
 	if err != nil {
+		if target, ok := h.urlRedirect(r.Context(), cleaned); ok {
+			http.Redirect(w, r, "/p/"+escapeURLPath(target), http.StatusMovedPermanently)
+			return
+		}
 		http.NotFound(w, r)
 		return
 	}
@@ -381,8 +606,8 @@ func (h *Handlers) publicPath(w http.ResponseWriter, r *http.Request) {
 func (h *Handlers) getFolderByPath(ctx context.Context, path string) (*models.Folder, error) {
 	var folder models.Folder
 	err := h.db.Pool().QueryRow(ctx,
-		"SELECT id, parent_id, name, path FROM folders WHERE path = $1", path).
-		Scan(&folder.ID, &folder.ParentID, &folder.Name, &folder.Path)
+		"SELECT id, parent_id, name, path, locked_by FROM folders WHERE path = $1 AND draft = false AND photodock_live(live_from, live_until)", path).
+		Scan(&folder.ID, &folder.ParentID, &folder.Name, &folder.Path, &folder.LockedBy)
 	if err != nil {
 		return nil, err
 	}
@@ -390,10 +615,34 @@ func (h *Handlers) getFolderByPath(ctx context.Context, path string) (*models.Fo
 }
 
 func (h *Handlers) renderFolder(w http.ResponseWriter, r *http.Request, folder *models.Folder) {
+	if !h.canView(r, folder.LockedBy) {
+		h.renderUnlock(w, r, int(folder.LockedBy.Int64), r.URL.RequestURI(), false)
+		return
+	}
 	ctx := r.Context()
+	prefs := h.viewerPrefs(r)
+	noindex := h.folderNoindex(ctx, w, folder.ID)
+	if h.pageNotModified(w, r, folder.ID, prefs, folder.LockedBy.Valid) {
+		return
+	}
+	listing := parsePhotoListing(r, prefs.Sort)
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	var photoTotal, bestCount int
+	_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE folder_id = $1 AND hidden = false AND draft = false AND photodock_live(live_from, live_until)"+listing.filter(), folder.ID).Scan(&photoTotal)
+	_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE folder_id = $1 AND rating >= 4 AND hidden = false AND draft = false AND photodock_live(live_from, live_until)", folder.ID).Scan(&bestCount)
+
+	totalPages := pageCount(photoTotal, prefs.PerPage)
+	if page > totalPages {
+		page = totalPages
+	}
 
 	subfolders, _ := h.getSubfolders(ctx, folder.ID)
-	photos, _ := h.getFolderPhotos(ctx, folder.ID)
+	photos, _ := h.getFolderPhotosPage(ctx, folder.ID, listing, prefs.PerPage, (page-1)*prefs.PerPage)
 	breadcrumbs := h.getBreadcrumbs(ctx, folder)
 
 	parentURL := "/"
@@ -404,13 +653,24 @@ func (h *Handlers) renderFolder(w http.ResponseWriter, r *http.Request, folder *
 		}
 	}
 
+	baseURL := h.baseURL(r)
 	h.render(w, "public/folder.html", map[string]interface{}{
+		"BaseURL":     baseURL,
+		"PageURL":     baseURL + "/p/" + escapeURLPath(folder.Path) + "/",
+		"CoverURL":    baseURL + coverURL(folder.ID, shareThumbSize),
 		"Folder":      *folder,
 		"Subfolders":  subfolders,
 		"Photos":      photos,
 		"Breadcrumbs": breadcrumbs,
 		"ParentURL":   parentURL,
 		"Title":       folder.Name,
+		"Prefs":       prefs,
+		"Page":        page,
+		"TotalPages":  totalPages,
+		"PhotoTotal":  photoTotal,
+		"Listing":     listing,
+		"BestCount":   bestCount,
+		"Noindex":     noindex,
 	})
 }
 
@@ -432,16 +692,52 @@ func (h *Handlers) publicPhotoByID(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) renderPhoto(w http.ResponseWriter, r *http.Request, photo *models.Photo) {
+	if !h.canView(r, photo.LockedBy) {
+		h.renderUnlock(w, r, int(photo.LockedBy.Int64), r.URL.RequestURI(), false)
+		return
+	}
 	ctx := r.Context()
+	prefs := h.viewerPrefs(r)
+	// Continue-nav leads into sibling folders, whose changes reach the
+	// folder's chain through the parent; top-level siblings have none.
+	var scope int
+	noindex := false
+	if photo.FolderID.Valid {
+		_ = h.db.Pool().QueryRow(ctx, "SELECT CASE WHEN parent_id IS NULL THEN 0 ELSE id END FROM folders WHERE id = $1", photo.FolderID.Int64).Scan(&scope)
+		noindex = h.folderNoindex(ctx, w, int(photo.FolderID.Int64))
+	}
+	if h.pageNotModified(w, r, scope, prefs, photo.LockedBy.Valid) {
+		return
+	}
+	photo.Tags = services.PhotoTags(ctx, h.db, photo.ID)
 
 	var exifInfo models.ExifInfo
 	if photo.ExifData != nil {
 		_ = json.Unmarshal(photo.ExifData, &exifInfo)
 	}
-
-	prevURL, nextURL, prevID, nextID := h.getAdjacentPhotoInfo(ctx, photo)
+	services.RedactExif(&exifInfo, h.cfg.ExifPrivateFields)
+
+	listing := parsePhotoListing(r, prefs.Sort)
+	var prevURL, nextURL, prevFolder, nextFolder string
+	var prevID, nextID, position, total int
+	listed := false
+	if !listing.isDefault() {
+		var prev, next navPhoto
+		prev, next, position, total, listed = h.listingNav(ctx, photo, listing)
+		prevID, nextID = prev.ID, next.ID
+		if prev.ID > 0 {
+			prevURL = prev.url() + "?" + string(listing.Query())
+		}
+		if next.ID > 0 {
+			nextURL = next.url() + "?" + string(listing.Query())
+		}
+	}
+	if !listed {
+		listing = photoListing{}
+		prevURL, nextURL, prevID, nextID, prevFolder, nextFolder = h.getAdjacentPhotoInfo(ctx, photo)
+		position, total = h.getPhotoPosition(ctx, photo)
+	}
 	breadcrumbs := h.getPhotoBreadcrumbs(ctx, photo)
-	position, total := h.getPhotoPosition(ctx, photo)
 
 	title := photo.Filename
 	if photo.Title.Valid && photo.Title.String != "" {
@@ -452,20 +748,23 @@ func (h *Handlers) renderPhoto(w http.ResponseWriter, r *http.Request, photo *mo
 	if len(breadcrumbs) > 0 {
 		folderURL = "/p/" + escapeURLPath(breadcrumbs[len(breadcrumbs)-1].Path) + "/"
 	}
-
-	baseURL := "https://" + r.Host
-	if r.TLS == nil && r.Header.Get("X-Forwarded-Proto") != "https" {
-		baseURL = "http://" + r.Host
+	folderQuery := listing.values()
+	if position > 0 {
+		if page := (position-1)/prefs.PerPage + 1; page > 1 {
+			folderQuery.Set("page", strconv.Itoa(page))
+		}
+	}
+	if len(folderQuery) > 0 {
+		folderURL += "?" + folderQuery.Encode()
 	}
 
-	previewWidth := 1920
-	previewHeight := 0
-	if photo.Width > 0 && photo.Height > 0 {
-		previewHeight = int(float64(photo.Height) * (float64(previewWidth) / float64(photo.Width)))
-		if photo.Width < previewWidth {
-			previewWidth = photo.Width
-			previewHeight = photo.Height
-		}
+	baseURL := h.baseURL(r)
+	previewWidth, previewHeight := h.shareThumbDims(photo.Width, photo.Height)
+	description := title
+	if photo.Description.Valid && photo.Description.String != "" {
+		description = photo.Description.String
+	} else if camera := strings.TrimSpace(exifInfo.CameraMake + " " + exifInfo.CameraModel); camera != "" {
+		description = "Taken with " + camera
 	}
 
 	var colorInfo *models.ColorInfo
@@ -477,22 +776,35 @@ func (h *Handlers) renderPhoto(w http.ResponseWriter, r *http.Request, photo *mo
 		colorInfo = combined.Colors
 	}
 
+	originalURL := mediaURL("original", photo.ID, photo.Version)
+	displayURL := mediaURL("thumb/large", photo.ID, photo.Version)
+	if services.IsGIF(photo.Path) {
+		displayURL = originalURL
+	}
+
 	h.render(w, "public/photo.html", map[string]interface{}{
 		"Photo":         photo,
 		"ExifInfo":      exifInfo,
 		"PrevURL":       prevURL,
 		"NextURL":       nextURL,
-		"PrevID":        prevID,
-		"NextID":        nextID,
+		"PrevImage":     h.photoMediaURL(ctx, "thumb/large", prevID),
+		"NextImage":     h.photoMediaURL(ctx, "thumb/large", nextID),
+		"PrevFolder":    prevFolder,
+		"NextFolder":    nextFolder,
 		"Breadcrumbs":   breadcrumbs,
 		"Title":         title,
 		"FolderURL":     folderURL,
 		"PhotoPosition": position,
 		"PhotoTotal":    total,
 		"BaseURL":       baseURL,
+		"PageURL":       baseURL + photoPageURL(photo),
+		"Description":   description,
 		"PreviewWidth":  previewWidth,
 		"PreviewHeight": previewHeight,
 		"ColorInfo":     colorInfo,
+		"DisplayURL":    displayURL,
+		"OriginalURL":   originalURL,
+		"Noindex":       noindex,
 	})
 }
 
@@ -505,59 +817,128 @@ func escapeURLPath(p string) string {
 }
 
 func (h *Handlers) serveThumbnail(w http.ResponseWriter, r *http.Request) {
+	h.thumbnail(w, r, false)
+}
+
+func (h *Handlers) adminServeThumbnail(w http.ResponseWriter, r *http.Request) {
+	h.thumbnail(w, r, true)
+}
+
+func (h *Handlers) thumbnail(w http.ResponseWriter, r *http.Request, admin bool) {
 	size := r.PathValue("size")
 	id, _ := strconv.Atoi(r.PathValue("id"))
 
-	if size != "small" && size != "medium" && size != "large" {
+	if !h.thumbSvc.HasSize(size) {
 		http.NotFound(w, r)
 		return
 	}
 
 	var path string
-	if err := h.db.Pool().QueryRow(r.Context(), "SELECT path FROM photos WHERE id = $1", id).Scan(&path); err != nil {
+	var hidden, broken bool
+	var lockedBy sql.NullInt64
+	if err := h.db.Pool().QueryRow(r.Context(), "SELECT path, hidden OR draft OR NOT photodock_live(live_from, live_until), thumb_error IS NOT NULL, locked_by FROM photos WHERE id = $1", id).Scan(&path, &hidden, &broken, &lockedBy); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if hidden && !admin {
 		http.NotFound(w, r)
 		return
 	}
+	if !admin && !h.canView(r, lockedBy) {
+		denyLocked(w)
+		return
+	}
+
+	var format string
+	if acceptsWebP(r) {
+		format = "webp"
+	}
 
-	thumbPath, err := h.thumbSvc.GetThumbnailPathByID(id, path, size)
+	thumbPath, err := h.thumbSvc.GetThumbnailPathByIDFormat(r.Context(), id, path, size, format)
+	if errors.Is(err, services.ErrThumbnailFailed) {
+		services.SetThumbError(r.Context(), h.db, id, err)
+		h.serveBrokenThumbnail(w, r)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
-
-	contentType := "image/jpeg"
-	if strings.HasSuffix(strings.ToLower(path), ".png") {
-		contentType = "image/png"
+	if broken {
+		services.SetThumbError(r.Context(), h.db, id, nil)
 	}
 
-	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
-	w.Header().Set("Content-Type", contentType)
+	h.setCacheControl(w, r, cacheThumbnails)
+	if admin || lockedBy.Valid {
+		privateCache(w)
+	}
+	w.Header().Set("Content-Type", imageContentType(thumbPath))
+	w.Header().Set("Vary", "Accept")
+	if notModified(w, r, id, thumbPath) {
+		return
+	}
 
 	if r.Header.Get("X-Real-IP") != "" {
-		w.Header().Set("X-Accel-Redirect", fmt.Sprintf("/internal/cache/%s/%d%s", size, id, filepath.Ext(thumbPath)))
+		w.Header().Set("X-Accel-Redirect", fmt.Sprintf("/internal/cache/%s/%s", filepath.Base(filepath.Dir(thumbPath)), filepath.Base(thumbPath)))
 		return
 	}
 
 	http.ServeFile(w, r, thumbPath)
 }
 
+func (h *Handlers) serveBrokenThumbnail(w http.ResponseWriter, r *http.Request) {
+	// Short-lived so a fixed source shows up without waiting out the
+	// thumbnail max-age.
+	grayPath, err := h.thumbSvc.EmptyCoverPath()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	w.Header().Set("Content-Type", "image/png")
+	http.ServeFile(w, r, grayPath)
+}
+
 func (h *Handlers) servePlaceholder(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(r.PathValue("id"))
 
+	// Served without a query only for photos known to stay visible; the
+	// rest, and anything changed since, are checked here.
+	placeholderPath, ok := h.thumbSvc.CachedPlaceholderPath(id)
 	var blurhash string
-	if err := h.db.Pool().QueryRow(r.Context(), "SELECT COALESCE(blurhash, '') FROM photos WHERE id = $1", id).Scan(&blurhash); err != nil {
-		http.NotFound(w, r)
-		return
+	var lockedBy sql.NullInt64
+	if !ok || !h.open.has(id) || h.hasLockedFolders(r) {
+		gen := h.open.generation()
+		var hidden, open bool
+		if err := h.db.Pool().QueryRow(r.Context(), "SELECT COALESCE(blurhash, ''), hidden OR draft OR NOT photodock_live(live_from, live_until), live_until IS NULL, locked_by FROM photos WHERE id = $1", id).Scan(&blurhash, &hidden, &open, &lockedBy); err != nil || hidden {
+			http.NotFound(w, r)
+			return
+		}
+		if !h.canView(r, lockedBy) {
+			denyLocked(w)
+			return
+		}
+		if open && !lockedBy.Valid {
+			h.open.add(id, gen)
+		}
+	}
+	if !ok {
+		var err error
+		placeholderPath, err = h.thumbSvc.GetPlaceholderPathByID(id, blurhash)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
 	}
 
-	placeholderPath, err := h.thumbSvc.GetPlaceholderPathByID(id, blurhash)
-	if err != nil {
-		http.Error(w, err.Error(), 500)
+	h.setCacheControl(w, r, cachePlaceholders)
+	if lockedBy.Valid {
+		privateCache(w)
+	}
+	if notModified(w, r, id, placeholderPath) {
 		return
 	}
 
-	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
-
 	if r.Header.Get("X-Real-IP") != "" {
 		w.Header().Set("X-Accel-Redirect", fmt.Sprintf("/internal/cache/placeholder/%d.png", id))
 		w.Header().Set("Content-Type", "image/png")
@@ -569,18 +950,22 @@ func (h *Handlers) servePlaceholder(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handlers) adminDeletePhoto(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(r.PathValue("id"))
-	ctx := r.Context()
+	h.deletePhoto(r.Context(), id)
+	w.WriteHeader(http.StatusOK)
+}
 
-	var path string
-	_ = h.db.Pool().QueryRow(ctx, "SELECT path FROM photos WHERE id = $1", id).Scan(&path)
+func (h *Handlers) deletePhoto(ctx context.Context, id int) {
+	var path, sum string
+	_ = h.db.Pool().QueryRow(ctx, "SELECT path, COALESCE(sha256, '') FROM photos WHERE id = $1", id).Scan(&path, &sum)
 	_, _ = h.db.Pool().Exec(ctx, "DELETE FROM photos WHERE id = $1", id)
 
 	if path != "" {
 		_ = h.thumbSvc.DeleteThumbnailsByID(id)
-		_ = os.Remove(filepath.Join(h.cfg.MediaRoot, path))
+		h.thumbSvc.DeleteWebOriginal(path)
+		if err := services.RemovePhotoFile(ctx, h.db, h.cfg.MediaRoot, path, sum); err != nil {
+			log.Printf("delete photo %d: %v", id, err)
+		}
 	}
-
-	w.WriteHeader(http.StatusOK)
 }
 
 func (h *Handlers) serveOriginal(w http.ResponseWriter, r *http.Request) {
@@ -588,23 +973,70 @@ func (h *Handlers) serveOriginal(w http.ResponseWriter, r *http.Request) {
 
 	var path string
 	var hidden bool
-	err := h.db.Pool().QueryRow(r.Context(), "SELECT path, hidden FROM photos WHERE id = $1", id).Scan(&path, &hidden)
+	var lockedBy sql.NullInt64
+	err := h.db.Pool().QueryRow(r.Context(), "SELECT path, hidden OR draft OR NOT photodock_live(live_from, live_until), locked_by FROM photos WHERE id = $1", id).Scan(&path, &hidden, &lockedBy)
 	if err != nil || hidden || !h.isPathSafe(path) {
 		http.NotFound(w, r)
 		return
 	}
+	if !h.canView(r, lockedBy) {
+		denyLocked(w)
+		return
+	}
+
+	absPath := services.ResolveMediaPath(h.cfg.MediaRoot, path)
+	h.setCacheControl(w, r, cacheOriginals)
+	if lockedBy.Valid {
+		privateCache(w)
+	}
+	if notModified(w, r, id, absPath) {
+		return
+	}
 
 	if r.Header.Get("X-Real-IP") != "" {
-		w.Header().Set("X-Accel-Redirect", "/internal/photos/"+path)
-		w.Header().Set("Content-Type", "image/jpeg")
-		if strings.HasSuffix(strings.ToLower(path), ".png") {
-			w.Header().Set("Content-Type", "image/png")
+		if rel, err := filepath.Rel(h.cfg.MediaRoot, absPath); err == nil {
+			path = rel
 		}
+		w.Header().Set("X-Accel-Redirect", "/internal/photos/"+path)
+		w.Header().Set("Content-Type", imageContentType(path))
+		return
+	}
+
+	w.Header().Set("Content-Type", imageContentType(path))
+	http.ServeFile(w, r, absPath)
+}
+
+func (h *Handlers) serveWebOriginal(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+
+	var path string
+	var hidden bool
+	var lockedBy sql.NullInt64
+	err := h.db.Pool().QueryRow(r.Context(), "SELECT path, hidden OR draft OR NOT photodock_live(live_from, live_until), locked_by FROM photos WHERE id = $1", id).Scan(&path, &hidden, &lockedBy)
+	if err != nil || hidden || !h.isPathSafe(path) {
+		http.NotFound(w, r)
+		return
+	}
+	if !h.canView(r, lockedBy) {
+		denyLocked(w)
 		return
 	}
 
-	w.Header().Set("Cache-Control", "public, max-age=31536000")
-	http.ServeFile(w, r, filepath.Join(h.cfg.MediaRoot, path))
+	webPath, err := h.thumbSvc.WebOriginalPath(r.Context(), path)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	h.setCacheControl(w, r, cacheOriginals)
+	if lockedBy.Valid {
+		privateCache(w)
+	}
+	if notModified(w, r, id, webPath) {
+		return
+	}
+	w.Header().Set("Content-Type", imageContentType(webPath))
+	http.ServeFile(w, r, webPath)
 }
 
 func (h *Handlers) adminDashboard(w http.ResponseWriter, r *http.Request) {
@@ -617,14 +1049,29 @@ func (h *Handlers) adminDashboard(w http.ResponseWriter, r *http.Request) {
 	_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE hidden = true").Scan(&hiddenCount)
 	_ = h.db.Pool().QueryRow(ctx, "SELECT COALESCE(SUM(size_bytes), 0) FROM photos").Scan(&totalSize)
 
-	folders, _ := h.getAllFolders(ctx)
+	var uniqueSize int64
+	_ = h.db.Pool().QueryRow(ctx, `
+		SELECT COALESCE(SUM(size_bytes), 0) FROM (
+			SELECT DISTINCT ON (COALESCE(s.sha256, p.id::text)) p.size_bytes
+			FROM photos p LEFT JOIN shared_content s ON s.sha256 = p.sha256
+		) t`).Scan(&uniqueSize)
 
-	h.render(w, "admin/dashboard.html", map[string]interface{}{
+	mediaFree, _ := services.FreeSpace(h.cfg.MediaRoot)
+	cacheFree, _ := services.FreeSpace(h.cfg.CacheDir)
+
+	warnings, _ := h.warnings.Current()
+
+	h.renderAdmin(w, r, "admin/dashboard.html", map[string]interface{}{
+		"Warnings":    warnings,
+		"MediaFree":   int64(mediaFree),
+		"CacheFree":   int64(cacheFree),
+		"LowSpace":    mediaFree < h.cfg.DiskReserveBytes || cacheFree < h.cfg.DiskReserveBytes,
 		"PhotoCount":  photoCount,
 		"FolderCount": folderCount,
 		"HiddenCount": hiddenCount,
-		"TotalSize":   totalSize,
-		"Folders":     folders,
+		"TotalSize":   uniqueSize,
+		"SharedSize":  totalSize - uniqueSize,
+		"Windows":     h.upcomingWindowEvents(ctx),
 		"Title":       "Admin Dashboard",
 	})
 }
@@ -636,7 +1083,7 @@ func (h *Handlers) adminFolders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.render(w, "admin/folders.html", map[string]interface{}{
+	h.renderAdmin(w, r, "admin/folders.html", map[string]interface{}{
 		"Folders": folders,
 		"Title":   "Manage Folders",
 	})
@@ -649,14 +1096,24 @@ func (h *Handlers) adminCreateFolder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
 	var parentID *int
-	var parentPath string
-
 	if pidStr := r.FormValue("parent_id"); pidStr != "" {
 		pid, _ := strconv.Atoi(pidStr)
 		parentID = &pid
-		_ = h.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", pid).Scan(&parentPath)
+	}
+
+	if _, err := h.createFolder(r.Context(), name, parentID, r.FormValue("draft") != ""); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	http.Redirect(w, r, "/admin/folders", http.StatusSeeOther)
+}
+
+// name must be sanitized.
+func (h *Handlers) createFolder(ctx context.Context, name string, parentID *int, draft bool) (int, error) {
+	var parentPath string
+	if parentID != nil {
+		_ = h.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", *parentID).Scan(&parentPath)
 	}
 
 	path := name
@@ -665,15 +1122,25 @@ func (h *Handlers) adminCreateFolder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := os.MkdirAll(filepath.Join(h.cfg.MediaRoot, path), 0755); err != nil {
-		http.Error(w, err.Error(), 500)
-		return
+		return 0, err
 	}
 
-	_, _ = h.db.Pool().Exec(ctx,
-		"INSERT INTO folders (parent_id, name, path) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
-		parentID, name, path)
+	status := services.FolderStatusPublished
+	if draft {
+		status = services.FolderStatusDraft
+	}
 
-	http.Redirect(w, r, "/admin/folders", http.StatusSeeOther)
+	var id int
+	err := h.db.Pool().QueryRow(ctx,
+		`INSERT INTO folders (parent_id, name, path, status, draft)
+		VALUES ($1, $2, $3, $4, $4 = 'draft' OR COALESCE((SELECT draft FROM folders WHERE id = $1), false))
+		ON CONFLICT DO NOTHING
+		RETURNING id`,
+		parentID, name, path, status).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = h.db.Pool().QueryRow(ctx, "SELECT id FROM folders WHERE path = $1", path).Scan(&id)
+	}
+	return id, err
 }
 
 func (h *Handlers) adminEditFolder(w http.ResponseWriter, r *http.Request) {
@@ -682,21 +1149,50 @@ func (h *Handlers) adminEditFolder(w http.ResponseWriter, r *http.Request) {
 
 	var folder models.Folder
 	err := h.db.Pool().QueryRow(ctx,
-		"SELECT id, parent_id, name, path, cover_photo_id FROM folders WHERE id = $1", id).
-		Scan(&folder.ID, &folder.ParentID, &folder.Name, &folder.Path, &folder.CoverPhotoID)
+		"SELECT id, parent_id, name, path, cover_photo_id, status, draft, published_at, continue_nav, slideshow_interval, publish_at, expires_at, live_from, live_until, locked_by, noindex FROM folders WHERE id = $1", id).
+		Scan(&folder.ID, &folder.ParentID, &folder.Name, &folder.Path, &folder.CoverPhotoID, &folder.Status, &folder.Draft, &folder.PublishedAt, &folder.ContinueNav, &folder.SlideshowInterval,
+			&folder.PublishAt, &folder.ExpiresAt, &folder.LiveFrom, &folder.LiveUntil, &folder.LockedBy, &folder.Noindex)
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
 
-	photos, _ := h.getFolderPhotos(ctx, id)
-	allFolders, _ := h.getAllFolders(ctx)
+	var lockedByPath string
+	if folder.LockedBy.Valid && folder.LockedBy.Int64 != int64(folder.ID) {
+		_ = h.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", folder.LockedBy.Int64).Scan(&lockedByPath)
+	}
+
+	var noindexByPath string
+	_ = h.db.Pool().QueryRow(ctx, `
+		SELECT a.path FROM folders a
+		WHERE a.noindex AND left($1, length(a.path) + 1) = a.path || '/'
+		ORDER BY length(a.path) DESC LIMIT 1`, folder.Path).Scan(&noindexByPath)
+
+	const perPage = 100
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	var photoTotal int
+	_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE folder_id = $1 AND hidden = false", id).Scan(&photoTotal)
+	totalPages := pageCount(photoTotal, perPage)
+	page = max(1, min(page, totalPages))
+
+	photos, _ := h.getFolderPhotos(ctx, id, perPage, (page-1)*perPage)
+
+	parentPath := ""
+	if i := strings.LastIndex(folder.Path, "/"); i >= 0 {
+		parentPath = folder.Path[:i]
+	}
 
-	h.render(w, "admin/folder_edit.html", map[string]interface{}{
-		"Folder":     folder,
-		"Photos":     photos,
-		"AllFolders": allFolders,
-		"Title":      "Edit " + folder.Name,
+	h.renderAdmin(w, r, "admin/folder_edit.html", map[string]interface{}{
+		"Folder":       folder,
+		"ParentPath":   parentPath,
+		"HasPassword":  folder.LockedBy.Valid && folder.LockedBy.Int64 == int64(folder.ID),
+		"LockedByPath": lockedByPath,
+		"NoindexBy":    noindexByPath,
+		"Photos":       photos,
+		"Title":        "Edit " + folder.Name,
+		"Page":         page,
+		"TotalPages":   totalPages,
+		"PhotoTotal":   photoTotal,
 	})
 }
 
@@ -708,17 +1204,125 @@ func (h *Handlers) adminUpdateFolder(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid name", 400)
 		return
 	}
+	status := r.FormValue("status")
+	if status != "" && !services.ValidFolderStatus(status) {
+		http.Error(w, services.ErrBadFolderStatus.Error(), 400)
+		return
+	}
 
-	_, _ = h.db.Pool().Exec(r.Context(), "UPDATE folders SET name = $1, updated_at = NOW() WHERE id = $2", name, id)
+	var parentID *int
+	var oldName string
+	if err := h.db.Pool().QueryRow(r.Context(), "SELECT parent_id, name FROM folders WHERE id = $1", id).Scan(&parentID, &oldName); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	moved := false
+	if _, ok := r.Form["parent_id"]; ok {
+		var pid *int
+		if v := r.FormValue("parent_id"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "invalid parent_id", 400)
+				return
+			}
+			pid = &n
+		}
+		moved = (pid == nil) != (parentID == nil) || (pid != nil && *pid != *parentID)
+		parentID = pid
+	}
+
+	if moved || name != oldName {
+		if _, err := h.scanSvc.MoveFolder(r.Context(), id, parentID, name); err != nil {
+			if errors.Is(err, services.ErrMaintenanceRunning) {
+				h.jobConflict(w, h.scanSvc.RunningJob())
+				return
+			}
+			http.Error(w, err.Error(), moveFolderStatus(err))
+			return
+		}
+	}
+
+	if status != "" {
+		if err := services.SetFolderStatus(r.Context(), h.db, id, status); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+
+	if _, ok := r.Form["continue_nav"]; ok {
+		var continueNav *bool
+		if v, err := strconv.ParseBool(r.FormValue("continue_nav")); err == nil {
+			continueNav = &v
+		}
+		_, _ = h.db.Pool().Exec(r.Context(), "UPDATE folders SET continue_nav = $1 WHERE id = $2", continueNav, id)
+	}
+
+	if _, ok := r.Form["slideshow_interval"]; ok {
+		var interval *int
+		if n, err := strconv.Atoi(r.FormValue("slideshow_interval")); err == nil && n > 0 {
+			interval = &n
+		}
+		_, _ = h.db.Pool().Exec(r.Context(), "UPDATE folders SET slideshow_interval = $1 WHERE id = $2", interval, id)
+	}
+
+	if values, ok := r.Form["noindex"]; ok {
+		// The checkbox follows a hidden "false", so the last value wins.
+		if noindex, err := strconv.ParseBool(values[len(values)-1]); err == nil {
+			_, _ = h.db.Pool().Exec(r.Context(), "UPDATE folders SET noindex = $1 WHERE id = $2", noindex, id)
+		}
+	}
+
+	password, remove := r.FormValue("access_password"), r.FormValue("remove_password") == "1"
+	if password != "" || remove {
+		if remove {
+			password = ""
+		}
+		if err := h.setFolderPassword(r, id, password); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+
+	h.updateWindow(r.Context(), r, "folders", id)
 	http.Redirect(w, r, "/admin/folders", http.StatusSeeOther)
 }
 
-func (h *Handlers) adminDeleteFolder(w http.ResponseWriter, r *http.Request) {
+func moveFolderStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrFolderIntoItself), errors.Is(err, pgx.ErrNoRows):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrFolderExists), errors.Is(err, services.ErrMaintenanceRunning):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *Handlers) adminPublishFolder(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(r.PathValue("id"))
-	_, _ = h.db.Pool().Exec(r.Context(), "DELETE FROM folders WHERE id = $1", id)
+	if err := services.SetFolderStatus(r.Context(), h.db, id, services.FolderStatusPublished); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
+func (h *Handlers) adminDeleteFolder(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	res, err := h.scanSvc.DeleteFolder(r.Context(), id, r.URL.Query().Get("purge") == "1")
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.NotFound(w, r)
+	case errors.Is(err, services.ErrMaintenanceRunning):
+		h.jobConflict(w, h.scanSvc.RunningJob())
+	case errors.Is(err, services.ErrOutsideMediaRoot):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case err != nil:
+		http.Error(w, err.Error(), 500)
+	default:
+		h.jsonResponse(w, res)
+	}
+}
+
 func (h *Handlers) adminSetCover(w http.ResponseWriter, r *http.Request) {
 	folderID, _ := strconv.Atoi(r.PathValue("id"))
 
@@ -745,9 +1349,14 @@ func (h *Handlers) adminPhotos(w http.ResponseWriter, r *http.Request) {
 	offset := (page - 1) * perPage
 	folderFilter := r.URL.Query().Get("folder")
 	showHidden := r.URL.Query().Get("hidden") == "1"
+	onlyBroken := r.URL.Query().Get("broken") == "1"
+	onlyLocated := r.URL.Query().Get("location") == "1"
+	tagFilter := strings.TrimSpace(r.URL.Query().Get("tag"))
+	exif := parseExifFilter(r)
+	listing := parsePhotoListing(r, "")
 	searchQuery := r.URL.Query().Get("q")
 
-	query := "SELECT id, folder_id, filename, path, title, hidden, width, height FROM photos WHERE 1=1"
+	query := "SELECT id, folder_id, filename, path, title, hidden, width, height, version, thumb_error, COALESCE(updated_at, created_at), rating FROM photos WHERE 1=1"
 	countQuery := "SELECT COUNT(*) FROM photos WHERE 1=1"
 	var args []interface{}
 	argIdx := 1
@@ -755,7 +1364,7 @@ func (h *Handlers) adminPhotos(w http.ResponseWriter, r *http.Request) {
 	if searchQuery != "" {
 		query += fmt.Sprintf(" AND (filename ILIKE $%d OR title ILIKE $%d OR description ILIKE $%d)", argIdx, argIdx, argIdx)
 		countQuery += fmt.Sprintf(" AND (filename ILIKE $%d OR title ILIKE $%d OR description ILIKE $%d)", argIdx, argIdx, argIdx)
-		args = append(args, "%"+searchQuery+"%")
+		args = append(args, likePattern(searchQuery))
 		argIdx++
 	}
 
@@ -775,10 +1384,37 @@ func (h *Handlers) adminPhotos(w http.ResponseWriter, r *http.Request) {
 		countQuery += " AND hidden = false"
 	}
 
+	if onlyBroken {
+		query += " AND thumb_error IS NOT NULL"
+		countQuery += " AND thumb_error IS NOT NULL"
+	}
+
+	if onlyLocated {
+		query += " AND lat IS NOT NULL"
+		countQuery += " AND lat IS NOT NULL"
+	}
+
+	if tagFilter != "" {
+		cond := fmt.Sprintf(" AND id IN (SELECT pt.photo_id FROM photo_tags pt JOIN tags t ON t.id = pt.tag_id WHERE lower(t.name) = lower($%d))", argIdx)
+		query += cond
+		countQuery += cond
+		args = append(args, tagFilter)
+		argIdx++
+	}
+
+	exifCond, exifArgs := exif.conditions(argIdx)
+	query += exifCond
+	countQuery += exifCond
+	args = append(args, exifArgs...)
+	argIdx += len(exifArgs)
+
+	query += listing.filter()
+	countQuery += listing.filter()
+
 	var totalCount int
 	_ = h.db.Pool().QueryRow(ctx, countQuery, args...).Scan(&totalCount)
 
-	query += fmt.Sprintf(" ORDER BY COALESCE(taken_at, created_at) DESC, id DESC LIMIT $%d OFFSET $%d", argIdx, argIdx+1)
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d OFFSET $%d", listing.order(), argIdx, argIdx+1)
 	args = append(args, perPage, offset)
 
 	rows, _ := h.db.Pool().Query(ctx, query, args...)
@@ -787,24 +1423,37 @@ func (h *Handlers) adminPhotos(w http.ResponseWriter, r *http.Request) {
 	var photos []models.Photo
 	for rows.Next() {
 		var p models.Photo
-		if err := rows.Scan(&p.ID, &p.FolderID, &p.Filename, &p.Path, &p.Title, &p.Hidden, &p.Width, &p.Height); err != nil {
+		if err := rows.Scan(&p.ID, &p.FolderID, &p.Filename, &p.Path, &p.Title, &p.Hidden, &p.Width, &p.Height, &p.Version, &p.ThumbError, &p.UpdatedAt, &p.Rating); err != nil {
 			continue
 		}
 		photos = append(photos, p)
 	}
 
-	folders, _ := h.getAllFolders(ctx)
-
-	h.render(w, "admin/photos.html", map[string]interface{}{
-		"Photos":       photos,
-		"Folders":      folders,
-		"CurrentPage":  page,
-		"TotalPages":   (totalCount + perPage - 1) / perPage,
-		"TotalCount":   totalCount,
-		"FolderFilter": folderFilter,
-		"ShowHidden":   showHidden,
-		"SearchQuery":  searchQuery,
-		"Title":        "Manage Photos",
+	folderLabel := "All Folders"
+	if folderFilter == "root" {
+		folderLabel = "Root Only"
+	} else if fid, err := strconv.ParseInt(folderFilter, 10, 64); err == nil {
+		folderLabel = h.folderPath(ctx, fid)
+	}
+
+	h.renderAdmin(w, r, "admin/photos.html", map[string]interface{}{
+		"Photos":           photos,
+		"FolderLabel":      folderLabel,
+		"CurrentPage":      page,
+		"TotalPages":       (totalCount + perPage - 1) / perPage,
+		"TotalCount":       totalCount,
+		"FolderFilter":     folderFilter,
+		"ShowHidden":       showHidden,
+		"OnlyBroken":       onlyBroken,
+		"OnlyLocated":      onlyLocated,
+		"TagFilter":        tagFilter,
+		"Exif":             exif,
+		"ExifOptions":      h.exifOptions(ctx),
+		"Listing":          listing,
+		"AllTags":          h.allTags(ctx),
+		"CanWriteCaptions": h.scanSvc.CanWriteCaptions(),
+		"SearchQuery":      searchQuery,
+		"Title":            "Manage Photos",
 	})
 }
 
@@ -815,29 +1464,36 @@ func (h *Handlers) adminEditPhoto(w http.ResponseWriter, r *http.Request) {
 	var photo models.Photo
 	err := h.db.Pool().QueryRow(ctx,
 		`SELECT id, folder_id, filename, path, COALESCE(url_path, ''), title, description, note, 
-		width, height, size_bytes, exif_data, hidden, created_at, taken_at 
+		width, height, size_bytes, exif_data, hidden, created_at, taken_at, version,
+		publish_at, expires_at, live_from, live_until, rating
 		FROM photos WHERE id = $1`, id).
 		Scan(&photo.ID, &photo.FolderID, &photo.Filename, &photo.Path, &photo.URLPath,
 			&photo.Title, &photo.Description, &photo.Note,
 			&photo.Width, &photo.Height, &photo.SizeBytes,
-			&photo.ExifData, &photo.Hidden, &photo.CreatedAt, &photo.TakenAt)
+			&photo.ExifData, &photo.Hidden, &photo.CreatedAt, &photo.TakenAt, &photo.Version,
+			&photo.PublishAt, &photo.ExpiresAt, &photo.LiveFrom, &photo.LiveUntil, &photo.Rating)
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
+	photo.Tags = services.PhotoTags(ctx, h.db, photo.ID)
 
 	var exifInfo models.ExifInfo
 	if photo.ExifData != nil {
 		_ = json.Unmarshal(photo.ExifData, &exifInfo)
 	}
 
-	folders, _ := h.getAllFolders(ctx)
+	var folderPath string
+	if photo.FolderID.Valid {
+		folderPath = h.folderPath(ctx, photo.FolderID.Int64)
+	}
 
-	h.render(w, "admin/photo_edit.html", map[string]interface{}{
-		"Photo":    photo,
-		"ExifInfo": exifInfo,
-		"Folders":  folders,
-		"Title":    "Edit " + photo.Filename,
+	h.renderAdmin(w, r, "admin/photo_edit.html", map[string]interface{}{
+		"Photo":            photo,
+		"ExifInfo":         exifInfo,
+		"FolderPath":       folderPath,
+		"CanWriteCaptions": h.scanSvc.CanWriteCaptions(),
+		"Title":            "Edit " + photo.Filename,
 	})
 }
 
@@ -850,20 +1506,78 @@ func (h *Handlers) adminUpdatePhoto(w http.ResponseWriter, r *http.Request) {
 		folderID = &fid
 	}
 
+	writeFile := r.FormValue("write_file") == "1"
+	if writeFile && !h.scanSvc.CanWriteCaptions() {
+		http.Error(w, services.ErrNoExiftool.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rating, _ := strconv.Atoi(r.FormValue("rating"))
+	if rating < 0 || rating > 5 {
+		rating = 0
+	}
+
 	_, _ = h.db.Pool().Exec(r.Context(),
 		`UPDATE photos SET title = NULLIF($1, ''), description = NULLIF($2, ''), 
-		note = NULLIF($3, ''), folder_id = $4, updated_at = NOW() WHERE id = $5`,
-		r.FormValue("title"), r.FormValue("description"), r.FormValue("note"), folderID, id)
+		note = NULLIF($3, ''), folder_id = $4, rating = NULLIF($6, 0), updated_at = NOW() WHERE id = $5`,
+		r.FormValue("title"), r.FormValue("description"), r.FormValue("note"), folderID, id, rating)
+	if err := services.SetPhotoTags(r.Context(), h.db, id, strings.Split(r.FormValue("tags"), ",")); err != nil {
+		log.Printf("set tags photo %d: %v", id, err)
+	}
+	h.updateWindow(r.Context(), r, "photos", id)
+
+	if writeFile {
+		if err := h.scanSvc.WriteCaptionToFile(r.Context(), id); err != nil {
+			log.Printf("write caption photo %d: %v", id, err)
+			http.Error(w, "Saved, but writing the caption into the file failed: "+err.Error(), 500)
+			return
+		}
+	}
+
+	if err := h.setPhotoURLPath(r.Context(), id, r.FormValue("url_path")); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 
 	http.Redirect(w, r, fmt.Sprintf("/admin/photos/%d", id), http.StatusSeeOther)
 }
 
+var errURLPathInUse = errors.New("URL path already in use")
+
+func (h *Handlers) setPhotoURLPath(ctx context.Context, id int, v string) error {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil
+	}
+	newPath := services.SanitizeURLPath(strings.TrimPrefix(v, "/p/"))
+	var oldPath string
+	_ = h.db.Pool().QueryRow(ctx, "SELECT COALESCE(url_path, '') FROM photos WHERE id = $1", id).Scan(&oldPath)
+
+	if newPath == "" || newPath == oldPath {
+		return nil
+	}
+	if _, err := h.db.Pool().Exec(ctx, "UPDATE photos SET url_path = $1, updated_at = NOW() WHERE id = $2", newPath, id); err != nil {
+		return errURLPathInUse
+	}
+	if err := services.RecordURLRedirect(ctx, h.db, id, oldPath, newPath); err != nil {
+		log.Printf("record redirect %s -> %s: %v", oldPath, newPath, err)
+	}
+	return nil
+}
+
 func (h *Handlers) adminToggleHide(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(r.PathValue("id"))
 	_, _ = h.db.Pool().Exec(r.Context(), "UPDATE photos SET hidden = NOT hidden, updated_at = NOW() WHERE id = $1", id)
+	h.thumbSvc.DeletePlaceholderByID(id)
 	w.WriteHeader(http.StatusOK)
 }
 
+const movePhotosSQL = `
+	UPDATE photos SET folder_id = $1, draft = COALESCE((SELECT draft FROM folders WHERE id = $1), false),
+		published_at = CASE WHEN COALESCE((SELECT draft FROM folders WHERE id = $1), false) THEN published_at ELSE COALESCE(published_at, NOW()) END,
+		updated_at = NOW()
+	WHERE id = ANY($2)`
+
 func (h *Handlers) adminMovePhoto(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(r.PathValue("id"))
 
@@ -875,17 +1589,39 @@ func (h *Handlers) adminMovePhoto(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	_, _ = h.db.Pool().Exec(r.Context(), "UPDATE photos SET folder_id = $1, updated_at = NOW() WHERE id = $2", folderID, id)
+	_, _ = h.db.Pool().Exec(r.Context(), movePhotosSQL, folderID, []int{id})
 	w.WriteHeader(http.StatusOK)
 }
 
 func (h *Handlers) adminScan(w http.ResponseWriter, r *http.Request) {
-	go func() {
-		_ = h.scanSvc.ScanAll(context.Background())
-	}()
+	if st, ok := h.scanSvc.BeginJob(services.JobScan); !ok {
+		h.jobConflict(w, st)
+		return
+	}
+	h.lifecycle.Go("scan", func(ctx context.Context) {
+		_ = h.scanSvc.ScanAll(ctx)
+	})
 	h.jsonResponse(w, map[string]string{"status": "started"})
 }
 
+func (h *Handlers) jobConflict(w http.ResponseWriter, st services.JobStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	_ = json.NewEncoder(w).Encode(st)
+}
+
+func (h *Handlers) adminScanStatus(w http.ResponseWriter, r *http.Request) {
+	h.jsonResponse(w, h.scanSvc.JobStatus())
+}
+
+func (h *Handlers) adminScanCancel(w http.ResponseWriter, r *http.Request) {
+	if !h.scanSvc.CancelScan() {
+		h.jobConflict(w, h.scanSvc.JobStatus())
+		return
+	}
+	h.jsonResponse(w, map[string]string{"status": "canceling"})
+}
+
 func (h *Handlers) adminScanFolder(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(r.PathValue("id"))
 
@@ -895,104 +1631,237 @@ func (h *Handlers) adminScanFolder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	go func() {
-		_ = h.scanSvc.ScanFolder(context.Background(), path)
-	}()
+	h.lifecycle.Go("scan", func(ctx context.Context) {
+		_ = h.scanSvc.ScanFolder(ctx, path)
+	})
 	h.jsonResponse(w, map[string]string{"status": "started"})
 }
 
 func (h *Handlers) adminClean(w http.ResponseWriter, r *http.Request) {
-	go func() {
-		_ = h.scanSvc.CleanOrphans(context.Background())
-	}()
-	h.jsonResponse(w, map[string]string{"status": "started"})
+	dryRun := r.URL.Query().Get("dry_run") == "1"
+	if !dryRun {
+		if st, ok := h.scanSvc.BeginJob(services.JobClean); !ok {
+			h.jobConflict(w, st)
+			return
+		}
+	}
+	report, err := h.scanSvc.CleanOrphans(r.Context(), services.CleanOptions{
+		DryRun:               dryRun,
+		KeepFoldersWithFiles: h.cfg.CleanKeepFoldersWithFiles,
+	})
+	if errors.Is(err, services.ErrMaintenanceRunning) {
+		h.jobConflict(w, h.scanSvc.RunningJob())
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !dryRun {
+		log.Printf("clean orphans: removed %d photos and %d folders", report.PhotosRemoved, report.FoldersRemoved)
+	}
+	h.jsonResponse(w, report)
 }
 
 func (h *Handlers) adminRegenerateURLs(w http.ResponseWriter, r *http.Request) {
-	go func() {
-		_ = h.scanSvc.RegenerateURLPaths(context.Background())
-	}()
+	if st, ok := h.scanSvc.BeginJob(services.JobRegenerate); !ok {
+		h.jobConflict(w, st)
+		return
+	}
+	h.lifecycle.Go("regenerate-urls", func(ctx context.Context) {
+		if err := h.scanSvc.RegenerateURLPaths(ctx); err != nil {
+			log.Printf("regenerate urls error: %v", err)
+		}
+	})
 	h.jsonResponse(w, map[string]string{"status": "started"})
 }
 
 func (h *Handlers) adminUpload(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseMultipartForm(100 << 20); err != nil {
-		http.Error(w, err.Error(), 400)
+	if err := h.checkDiskSpace(r.ContentLength); err != nil {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
 		return
 	}
-
-	ctx := r.Context()
-	var folderPath string
-	if fidStr := r.FormValue("folder_id"); fidStr != "" && fidStr != "null" {
-		fid, _ := strconv.Atoi(fidStr)
-		_ = h.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", fid).Scan(&folderPath)
+	if !h.limitUpload(w, r) {
+		return
 	}
 
-	for _, fh := range r.MultipartForm.File["files"] {
-		if !isImageFile(fh.Filename) {
-			continue
+	ctx := r.Context()
+	var saved []string
+	rejected := []rejectedUpload{}
+	var tree *uploadTree
+	var paths []string
+	fileIndex := 0
+	values, err := readUploadForm(r, func(field, filename string, part io.Reader, values url.Values) error {
+		if field != "files" && field != "files[]" {
+			return nil
 		}
-
-		filename := sanitizeFilename(fh.Filename)
-		relPath := filename
-		if folderPath != "" {
-			relPath = filepath.Join(folderPath, filename)
+		if tree == nil {
+			tree = h.newUploadTree(ctx, formFolderID(values))
+			paths = uploadPaths(values)
 		}
-
-		absPath := h.resolveConflict(filepath.Join(h.cfg.MediaRoot, relPath))
-
-		if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
-			continue
+		var rel string
+		if len(paths) > 0 {
+			if fileIndex >= len(paths) {
+				return errUploadPaths
+			}
+			rel = paths[fileIndex]
 		}
-
-		file, err := fh.Open()
+		fileIndex++
+		dirs, err := uploadDirs(rel)
 		if err != nil {
-			continue
+			rejected = append(rejected, rejectedUpload{Filename: filename, Error: err.Error()})
+			return nil
 		}
-
-		dst, err := os.Create(absPath)
+		if !isImageFile(filename) {
+			rejected = append(rejected, rejectedUpload{Filename: filename, Error: errInvalidFileType.Error()})
+			return nil
+		}
+		folderPath, err := tree.folder(ctx, dirs)
 		if err != nil {
-			_ = file.Close()
-			continue
+			rejected = append(rejected, rejectedUpload{Filename: filename, Error: err.Error()})
+			return nil
+		}
+		relPath, _, err := h.storeUpload(ctx, folderPath, sanitizeFilename(filename), part, formFlag(values, "auto_file"), formFlag(values, "force"))
+		if err != nil {
+			rejected = append(rejected, rejectedUpload{Filename: filename, Error: err.Error()})
+			if tooLarge(err) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return err
+			}
+			return nil
 		}
+		saved = append(saved, relPath)
+		return nil
+	})
+	if err == nil && (len(uploadPaths(values)) != len(paths) || len(paths) > 0 && fileIndex != len(paths)) {
+		err = errUploadPaths
+	}
+	if errors.Is(err, errUploadPaths) {
+		for _, relPath := range saved {
+			_ = os.Remove(filepath.Join(h.cfg.MediaRoot, relPath))
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-		_, _ = io.Copy(dst, file)
-		_ = dst.Close()
-		_ = file.Close()
+	h.processUploads(ctx, saved)
+	if err == nil && len(rejected) == 0 && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, "/admin/photos", http.StatusSeeOther)
+		return
 	}
 
-	go func() {
-		_ = h.scanSvc.ScanFolder(context.Background(), folderPath)
-	}()
-	http.Redirect(w, r, "/admin/photos", http.StatusSeeOther)
+	created := []string{}
+	if tree != nil {
+		created = tree.created
+	}
+	resp := map[string]interface{}{"saved": saved, "rejected": rejected, "photos": len(saved), "created_folders": created}
+	if saved == nil {
+		resp["saved"] = []string{}
+	}
+	status := http.StatusOK
+	if err != nil {
+		resp["error"] = err.Error()
+		status = http.StatusBadRequest
+		if tooLarge(err) {
+			status = http.StatusRequestEntityTooLarge
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
 }
 
 func (h *Handlers) adminUploadFile(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		http.Error(w, err.Error(), 400)
+	if err := h.checkDiskSpace(r.ContentLength); err != nil {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	if !h.limitUpload(w, r) {
 		return
 	}
 
-	file, header, err := r.FormFile("file")
+	ctx := r.Context()
+	relPath, sum, err := h.streamUploadFile(r, "file", func(values url.Values) (string, error) {
+		dirs, err := uploadDirs(values.Get("path"))
+		if err != nil || len(dirs) == 0 {
+			return h.formFolderPath(ctx, values), err
+		}
+		folderPath, err := h.newUploadTree(ctx, formFolderID(values)).folder(ctx, dirs)
+		if err != nil {
+			return "", &storeError{err}
+		}
+		return folderPath, nil
+	})
 	if err != nil {
-		http.Error(w, err.Error(), 400)
+		http.Error(w, err.Error(), uploadStatus(err))
 		return
 	}
-	defer func() { _ = file.Close() }()
+	// Looked up before the upload itself is added.
+	dup := h.duplicateOf(ctx, sum)
+	ids := h.processUploads(ctx, []string{relPath})
 
-	if !isImageFile(header.Filename) {
-		http.Error(w, "Invalid file type", 400)
-		return
+	h.jsonResponse(w, uploadResponse(relPath, dup, ids[0]))
+}
+
+// While a maintenance job runs the files are left for it to add, and
+// their IDs come back as 0.
+func (h *Handlers) processUploads(ctx context.Context, paths []string) []int {
+	// The files are in place, so add them even if the client goes away.
+	ids, err := h.scanSvc.TryProcessFiles(context.WithoutCancel(ctx), paths)
+	if errors.Is(err, services.ErrMaintenanceRunning) {
+		h.lifecycle.Go("process-uploads", func(ctx context.Context) {
+			_, _ = h.scanSvc.ProcessFiles(ctx, paths)
+		})
+		return make([]int, len(paths))
+	}
+	if err != nil {
+		log.Printf("process uploads: %v", err)
 	}
+	if ids == nil {
+		ids = make([]int, len(paths))
+	}
+	return ids
+}
 
-	ctx := r.Context()
-	var folderPath string
-	if fidStr := r.FormValue("folder_id"); fidStr != "" {
-		fid, _ := strconv.Atoi(fidStr)
-		_ = h.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", fid).Scan(&folderPath)
+func uploadResponse(relPath string, dup *duplicateRef, photoID int) map[string]interface{} {
+	res := map[string]interface{}{"status": "ok", "destination": relPath, "duplicate_of": dup}
+	if photoID != 0 {
+		res["photo_id"] = photoID
+	}
+	return res
+}
+
+func (h *Handlers) storeUpload(ctx context.Context, folderPath, filename string, src io.Reader, autoFile, force bool) (string, string, error) {
+	if autoFile {
+		// EXIF has to be read before the destination is known, so park the
+		// bytes in the cache dir first.
+		tmpDir := filepath.Join(h.cfg.CacheDir, "uploads")
+		if err := os.MkdirAll(tmpDir, 0755); err != nil {
+			return "", "", err
+		}
+		tmp, err := os.CreateTemp(tmpDir, "autofile-*"+strings.ToLower(filepath.Ext(filename)))
+		if err != nil {
+			return "", "", err
+		}
+		defer func() { _ = os.Remove(tmp.Name()) }()
+		_, err = io.Copy(tmp, src)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return "", "", err
+		}
+
+		info, takenAt, _ := h.scanSvc.InspectFile(tmp.Name())
+		folderPath = h.autoFileFolder(ctx, folderPath, takenAt, info)
+
+		f, err := os.Open(tmp.Name())
+		if err != nil {
+			return "", "", err
+		}
+		defer func() { _ = f.Close() }()
+		src = f
 	}
 
-	filename := sanitizeFilename(header.Filename)
 	relPath := filename
 	if folderPath != "" {
 		relPath = filepath.Join(folderPath, filename)
@@ -1001,31 +1870,27 @@ func (h *Handlers) adminUploadFile(w http.ResponseWriter, r *http.Request) {
 	absPath := h.resolveConflict(filepath.Join(h.cfg.MediaRoot, relPath))
 
 	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
-		http.Error(w, err.Error(), 500)
-		return
+		return "", "", err
 	}
 
-	dst, err := os.Create(absPath)
+	sum, err := h.writeUpload(ctx, absPath, src, force)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
+		return "", "", err
 	}
-	defer func() { _ = dst.Close() }()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		http.Error(w, err.Error(), 500)
-		return
-	}
+	rel, _ := filepath.Rel(h.cfg.MediaRoot, absPath)
+	return rel, sum, nil
+}
 
-	go func() {
-		_ = h.scanSvc.ScanFolder(context.Background(), folderPath)
-	}()
-	h.jsonResponse(w, map[string]string{"status": "ok"})
+func (h *Handlers) autoFileFolder(ctx context.Context, baseFolder string, takenAt time.Time, info *models.ExifInfo) string {
+	pattern := h.settings.Get(ctx, settingAutoFilePattern, services.DefaultAutoFilePattern)
+	return filepath.Join(baseFolder, services.AutoFilePath(pattern, takenAt, info))
 }
 
 func (h *Handlers) adminUploadFinalize(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		UploadID string `json:"upload_id"`
+		Force    bool   `json:"force"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1033,11 +1898,28 @@ func (h *Handlers) adminUploadFinalize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.uploadsMux.Lock()
+	h.uploadsMux.RLock()
 	upload, exists := h.uploads[req.UploadID]
-	if exists {
-		delete(h.uploads, req.UploadID)
+	h.uploadsMux.RUnlock()
+
+	if !exists {
+		http.Error(w, "Upload not found", 404)
+		return
+	}
+
+	if err := h.verifyUpload(upload); err != nil {
+		h.uploadVerifyError(w, err)
+		return
 	}
+
+	if err := h.checkDiskSpace(upload.Size); err != nil {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+
+	h.uploadsMux.Lock()
+	_, exists = h.uploads[req.UploadID]
+	delete(h.uploads, req.UploadID)
 	h.uploadsMux.Unlock()
 
 	if !exists {
@@ -1047,52 +1929,104 @@ func (h *Handlers) adminUploadFinalize(w http.ResponseWriter, r *http.Request) {
 
 	defer func() { _ = os.RemoveAll(upload.TempDir) }()
 
-	ctx := r.Context()
-	var folderPath string
-	if upload.FolderID != nil {
-		_ = h.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", *upload.FolderID).Scan(&folderPath)
+	relPath, sum, err := h.commitUpload(r.Context(), upload, req.Force)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	dup := h.duplicateOf(r.Context(), sum)
+	ids := h.processUploads(r.Context(), []string{relPath})
+
+	h.jsonResponse(w, uploadResponse(relPath, dup, ids[0]))
+}
+
+func (h *Handlers) commitUpload(ctx context.Context, upload *ChunkedUpload, force bool) (string, string, error) {
+	destFolder, err := h.uploadDestFolder(ctx, upload)
+	if err != nil {
+		return "", "", err
 	}
 
 	relPath := upload.Filename
-	if folderPath != "" {
-		relPath = filepath.Join(folderPath, upload.Filename)
+	if destFolder != "" {
+		relPath = filepath.Join(destFolder, upload.Filename)
 	}
 
 	absPath := h.resolveConflict(filepath.Join(h.cfg.MediaRoot, relPath))
 
 	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
-		http.Error(w, err.Error(), 500)
-		return
+		return "", "", err
 	}
 
-	dst, err := os.Create(absPath)
+	var src io.Reader
+	if upload.Staged != "" {
+		f, err := os.Open(upload.Staged)
+		if err != nil {
+			return "", "", err
+		}
+		defer func() { _ = f.Close() }()
+		src = f
+	} else {
+		count, err := h.uploadChunks(upload)
+		if err != nil {
+			return "", "", err
+		}
+		var chunks []io.Reader
+		for i := 0; i < count; i++ {
+			chunk, err := os.Open(chunkPath(upload, i))
+			if err != nil {
+				return "", "", err
+			}
+			defer func() { _ = chunk.Close() }()
+			chunks = append(chunks, chunk)
+		}
+		src = io.MultiReader(chunks...)
+	}
+
+	sum, err := h.writeUpload(ctx, absPath, src, force)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
+		return "", "", err
 	}
-	defer func() { _ = dst.Close() }()
 
-	for i := 0; i < len(upload.Chunks); i++ {
-		chunk, err := os.Open(filepath.Join(upload.TempDir, fmt.Sprintf("chunk_%d", i)))
-		if err != nil {
-			http.Error(w, err.Error(), 500)
-			return
-		}
-		_, _ = io.Copy(dst, chunk)
-		_ = chunk.Close()
+	rel, _ := filepath.Rel(h.cfg.MediaRoot, absPath)
+	return rel, sum, nil
+}
+
+func (h *Handlers) uploadFolderPath(ctx context.Context, folderID *int) string {
+	var folderPath string
+	if folderID != nil {
+		_ = h.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", *folderID).Scan(&folderPath)
 	}
+	return folderPath
+}
 
-	go func() {
-		_ = h.scanSvc.ScanFolder(context.Background(), folderPath)
-	}()
-	h.jsonResponse(w, map[string]string{"status": "ok"})
+func (h *Handlers) uploadDestFolder(ctx context.Context, upload *ChunkedUpload) (string, error) {
+	folderPath := h.uploadFolderPath(ctx, upload.FolderID)
+	if len(upload.Dirs) > 0 {
+		var err error
+		if folderPath, err = h.newUploadTree(ctx, upload.FolderID).folder(ctx, upload.Dirs); err != nil {
+			return "", err
+		}
+	}
+	if !upload.AutoFile {
+		return folderPath, nil
+	}
+	staged, err := h.stageUpload(upload)
+	if err != nil {
+		return "", err
+	}
+	info, takenAt, _ := h.scanSvc.InspectFile(staged)
+	return h.autoFileFolder(ctx, folderPath, takenAt, info), nil
 }
 
 func (h *Handlers) adminUploadInit(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Filename string         `json:"filename"`
-		Size     int64          `json:"size"`
-		FolderID IntPtrOrString `json:"folder_id"`
+		Filename    string         `json:"filename"`
+		Size        int64          `json:"size"`
+		TotalChunks int            `json:"total_chunks"`
+		SHA256      string         `json:"sha256"`
+		FolderID    IntPtrOrString `json:"folder_id"`
+		AutoFile    bool           `json:"auto_file"`
+		Path        string         `json:"path"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1104,76 +2038,169 @@ func (h *Handlers) adminUploadInit(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid file type", 400)
 		return
 	}
+	dirs, err := uploadDirs(req.Path)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	if req.Size <= 0 || req.TotalChunks < 1 || req.TotalChunks > maxUploadChunks(req.Size) {
+		http.Error(w, "Invalid size or total_chunks", 400)
+		return
+	}
+	if req.SHA256 != "" && !validSHA256(req.SHA256) {
+		http.Error(w, "Invalid sha256", 400)
+		return
+	}
 
-	uploadID := fmt.Sprintf("%d-%s", time.Now().UnixNano(), randString(8))
-	tempDir := filepath.Join(h.cfg.CacheDir, "uploads", uploadID)
-
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		http.Error(w, err.Error(), 500)
+	if h.cfg.MaxUploadSize > 0 && req.Size > h.cfg.MaxUploadSize {
+		http.Error(w, fmt.Sprintf("Upload larger than %d bytes", h.cfg.MaxUploadSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := h.checkDiskSpace(req.Size); err != nil {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
 		return
 	}
 
-	h.uploadsMux.Lock()
-	h.uploads[uploadID] = &ChunkedUpload{
-		ID:        uploadID,
-		Filename:  sanitizeFilename(req.Filename),
-		Size:      req.Size,
-		FolderID:  req.FolderID.V,
-		TempDir:   tempDir,
-		Chunks:    make(map[int]bool),
-		CreatedAt: time.Now(),
+	uploadID := fmt.Sprintf("%d-%s", time.Now().UnixNano(), randString(8))
+	tempDir := filepath.Join(h.uploadsDir(), uploadID)
+
+	// Registered before the directory exists, so the janitor's sweep never
+	// sees it unowned.
+	upload := &ChunkedUpload{
+		ID:          uploadID,
+		Filename:    sanitizeFilename(req.Filename),
+		Size:        req.Size,
+		TotalChunks: req.TotalChunks,
+		SHA256:      strings.ToLower(req.SHA256),
+		FolderID:    req.FolderID.V,
+		Dirs:        dirs,
+		AutoFile:    req.AutoFile,
+		TempDir:     tempDir,
+		Chunks:      make(map[int]bool),
+		CreatedAt:   time.Now(),
 	}
+	h.uploadsMux.Lock()
+	h.uploads[uploadID] = upload
 	h.uploadsMux.Unlock()
 
+	err = os.MkdirAll(tempDir, 0755)
+	if err == nil {
+		err = h.saveUploadState(upload)
+	}
+	if err != nil {
+		h.uploadsMux.Lock()
+		delete(h.uploads, uploadID)
+		h.uploadsMux.Unlock()
+		_ = os.RemoveAll(tempDir)
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
 	h.jsonResponse(w, map[string]string{"upload_id": uploadID})
 }
 
 func (h *Handlers) adminUploadChunk(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseMultipartForm(2 << 20); err != nil {
-		http.Error(w, err.Error(), 400)
+	if !h.limitUpload(w, r) {
 		return
 	}
 
-	uploadID := r.FormValue("upload_id")
-	chunkIndex, _ := strconv.Atoi(r.FormValue("chunk_index"))
+	status, found := http.StatusOK, false
+	_, err := readUploadForm(r, func(field, _ string, part io.Reader, values url.Values) error {
+		if field != "chunk" || found {
+			return nil
+		}
+		found = true
+		var err error
+		status, err = h.storeChunk(values, part)
+		return err
+	})
+	if err == nil && !found {
+		status, err = 400, errMissingFile
+	}
+	if err != nil {
+		if status == http.StatusOK {
+			status = 400
+			if tooLarge(err) {
+				status = http.StatusRequestEntityTooLarge
+			}
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{"status": "ok"})
+}
+
+func (h *Handlers) storeChunk(values url.Values, chunk io.Reader) (int, error) {
+	chunkIndex, err := strconv.Atoi(values.Get("chunk_index"))
+	if err != nil || chunkIndex < 0 {
+		return 400, errors.New("invalid chunk_index")
+	}
 
 	h.uploadsMux.RLock()
-	upload, exists := h.uploads[uploadID]
+	upload, exists := h.uploads[values.Get("upload_id")]
 	h.uploadsMux.RUnlock()
 
 	if !exists {
-		http.Error(w, "Upload not found", 404)
-		return
+		return 404, errors.New("upload not found")
 	}
-
-	file, _, err := r.FormFile("chunk")
-	if err != nil {
-		http.Error(w, err.Error(), 400)
-		return
+	if chunkIndex >= upload.TotalChunks {
+		return 400, errors.New("chunk_index out of range")
+	}
+	h.uploadsMux.RLock()
+	staged := upload.Staged != ""
+	h.uploadsMux.RUnlock()
+	if staged {
+		return http.StatusOK, nil
 	}
-	defer func() { _ = file.Close() }()
 
-	chunkPath := filepath.Join(upload.TempDir, fmt.Sprintf("chunk_%d", chunkIndex))
-	dst, err := os.Create(chunkPath)
+	// Written aside and renamed over, so re-sending a chunk the server
+	// already has replaces it whole or not at all.
+	path := chunkPath(upload, chunkIndex)
+	tmpPath := path + ".part"
+	dst, err := os.Create(tmpPath)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
+		return 500, err
 	}
-	defer func() { _ = dst.Close() }()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		http.Error(w, err.Error(), 500)
-		return
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(dst, hasher), chunk)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = checkChunkSum(hasher.Sum(nil), values.Get("chunk_sha256"))
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		switch {
+		case errors.Is(err, errUploadMismatch):
+			return http.StatusUnprocessableEntity, err
+		case tooLarge(err):
+			return http.StatusRequestEntityTooLarge, err
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return 400, err
+		}
+		return 500, err
 	}
 
 	h.uploadsMux.Lock()
 	upload.Chunks[chunkIndex] = true
 	h.uploadsMux.Unlock()
-
-	h.jsonResponse(w, map[string]string{"status": "ok"})
+	return http.StatusOK, nil
 }
 
 func (h *Handlers) render(w http.ResponseWriter, name string, data map[string]interface{}) {
+	h.renderStatus(w, http.StatusOK, name, data)
+}
+
+func (h *Handlers) renderStatus(w http.ResponseWriter, status int, name string, data map[string]interface{}) {
+	if h.cfg.PrivateMode && data != nil {
+		data["Noindex"] = true
+	}
 	var buf bytes.Buffer
 	if err := h.tmpl.ExecuteTemplate(&buf, name, data); err != nil {
 		log.Printf("ERROR render %s: %v", name, err)
@@ -1181,6 +2208,13 @@ func (h *Handlers) render(w http.ResponseWriter, name string, data map[string]in
 		return
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if data["Noindex"] == true {
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
+	if w.Header().Get("Cache-Control") == "" {
+		h.setCacheControl(w, nil, cacheHTML)
+	}
+	w.WriteHeader(status)
 	_, _ = buf.WriteTo(w)
 }
 
@@ -1189,38 +2223,17 @@ func (h *Handlers) jsonResponse(w http.ResponseWriter, data interface{}) {
 	_ = json.NewEncoder(w).Encode(data)
 }
 
-func LoggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		rw := &responseWriter{ResponseWriter: w, status: 200}
-		next.ServeHTTP(rw, r)
-		duration := time.Since(start)
-		if rw.status >= 400 || duration > 2*time.Second {
-			log.Printf("%s %s %d %s", r.Method, r.URL.Path, rw.status, duration)
-		}
-	})
-}
-
-type responseWriter struct {
-	http.ResponseWriter
-	status int
-}
-
-func (rw *responseWriter) WriteHeader(code int) {
-	rw.status = code
-	rw.ResponseWriter.WriteHeader(code)
-}
-
 func (h *Handlers) getPhotoByID(ctx context.Context, id int) (*models.Photo, error) {
 	var photo models.Photo
 	err := h.db.Pool().QueryRow(ctx,
 		`SELECT id, folder_id, filename, path, COALESCE(url_path, ''), title, description, note, 
-		width, height, size_bytes, blurhash, exif_data, hidden, created_at, taken_at 
-		FROM photos WHERE id = $1 AND hidden = false`, id).
+		width, height, size_bytes, blurhash, exif_data, hidden, created_at, taken_at, version, lat, lon, altitude, rating, locked_by 
+		FROM photos WHERE id = $1 AND hidden = false AND draft = false AND photodock_live(live_from, live_until)`, id).
 		Scan(&photo.ID, &photo.FolderID, &photo.Filename, &photo.Path, &photo.URLPath,
 			&photo.Title, &photo.Description, &photo.Note,
 			&photo.Width, &photo.Height, &photo.SizeBytes, &photo.Blurhash,
-			&photo.ExifData, &photo.Hidden, &photo.CreatedAt, &photo.TakenAt)
+			&photo.ExifData, &photo.Hidden, &photo.CreatedAt, &photo.TakenAt, &photo.Version,
+			&photo.Lat, &photo.Lon, &photo.Altitude, &photo.Rating, &photo.LockedBy)
 	return &photo, err
 }
 
@@ -1228,16 +2241,17 @@ func (h *Handlers) getPhotoByURLPath(ctx context.Context, urlPath string) (*mode
 	var photo models.Photo
 	err := h.db.Pool().QueryRow(ctx,
 		`SELECT id, folder_id, filename, path, url_path, title, description, note, 
-		width, height, size_bytes, blurhash, exif_data, hidden, created_at, taken_at 
-		FROM photos WHERE url_path = $1 AND hidden = false`, urlPath).
+		width, height, size_bytes, blurhash, exif_data, hidden, created_at, taken_at, version, lat, lon, altitude, rating, locked_by 
+		FROM photos WHERE url_path = $1 AND hidden = false AND draft = false AND photodock_live(live_from, live_until)`, urlPath).
 		Scan(&photo.ID, &photo.FolderID, &photo.Filename, &photo.Path, &photo.URLPath,
 			&photo.Title, &photo.Description, &photo.Note,
 			&photo.Width, &photo.Height, &photo.SizeBytes, &photo.Blurhash,
-			&photo.ExifData, &photo.Hidden, &photo.CreatedAt, &photo.TakenAt)
+			&photo.ExifData, &photo.Hidden, &photo.CreatedAt, &photo.TakenAt, &photo.Version,
+			&photo.Lat, &photo.Lon, &photo.Altitude, &photo.Rating, &photo.LockedBy)
 	return &photo, err
 }
 
-func (h *Handlers) getAdjacentPhotoInfo(ctx context.Context, photo *models.Photo) (prevURL, nextURL string, prevID, nextID int) {
+func (h *Handlers) getAdjacentPhotoInfo(ctx context.Context, photo *models.Photo) (prevURL, nextURL string, prevID, nextID int, prevFolder, nextFolder string) {
 	var prev, next struct {
 		ID      int
 		URLPath string
@@ -1251,33 +2265,43 @@ func (h *Handlers) getAdjacentPhotoInfo(ctx context.Context, photo *models.Photo
 	if photo.FolderID.Valid {
 		_ = h.db.Pool().QueryRow(ctx,
 			`SELECT id, COALESCE(url_path, '') FROM photos 
-			WHERE folder_id = $1 AND hidden = false 
+			WHERE folder_id = $1 AND hidden = false AND draft = false AND photodock_live(live_from, live_until) 
 			AND (COALESCE(taken_at, created_at) > $2 OR (COALESCE(taken_at, created_at) = $2 AND id > $3))
 			ORDER BY COALESCE(taken_at, created_at) ASC, id ASC LIMIT 1`,
 			photo.FolderID.Int64, sortTime, photo.ID).Scan(&prev.ID, &prev.URLPath)
 
 		_ = h.db.Pool().QueryRow(ctx,
 			`SELECT id, COALESCE(url_path, '') FROM photos 
-			WHERE folder_id = $1 AND hidden = false 
+			WHERE folder_id = $1 AND hidden = false AND draft = false AND photodock_live(live_from, live_until) 
 			AND (COALESCE(taken_at, created_at) < $2 OR (COALESCE(taken_at, created_at) = $2 AND id < $3))
 			ORDER BY COALESCE(taken_at, created_at) DESC, id DESC LIMIT 1`,
 			photo.FolderID.Int64, sortTime, photo.ID).Scan(&next.ID, &next.URLPath)
 	} else {
 		_ = h.db.Pool().QueryRow(ctx,
 			`SELECT id, COALESCE(url_path, '') FROM photos 
-			WHERE folder_id IS NULL AND hidden = false 
+			WHERE folder_id IS NULL AND hidden = false AND draft = false AND photodock_live(live_from, live_until) 
 			AND (COALESCE(taken_at, created_at) > $1 OR (COALESCE(taken_at, created_at) = $1 AND id > $2))
 			ORDER BY COALESCE(taken_at, created_at) ASC, id ASC LIMIT 1`,
 			sortTime, photo.ID).Scan(&prev.ID, &prev.URLPath)
 
 		_ = h.db.Pool().QueryRow(ctx,
 			`SELECT id, COALESCE(url_path, '') FROM photos 
-			WHERE folder_id IS NULL AND hidden = false 
+			WHERE folder_id IS NULL AND hidden = false AND draft = false AND photodock_live(live_from, live_until) 
 			AND (COALESCE(taken_at, created_at) < $1 OR (COALESCE(taken_at, created_at) = $1 AND id < $2))
 			ORDER BY COALESCE(taken_at, created_at) DESC, id DESC LIMIT 1`,
 			sortTime, photo.ID).Scan(&next.ID, &next.URLPath)
 	}
 
+	if (prev.ID == 0 || next.ID == 0) && photo.FolderID.Valid && h.continuesNav(ctx, int(photo.FolderID.Int64)) {
+		folderID := int(photo.FolderID.Int64)
+		if prev.ID == 0 {
+			prev.ID, prev.URLPath, prevFolder = h.siblingFolderPhoto(ctx, folderID, false)
+		}
+		if next.ID == 0 {
+			next.ID, next.URLPath, nextFolder = h.siblingFolderPhoto(ctx, folderID, true)
+		}
+	}
+
 	if prev.ID > 0 {
 		prevID = prev.ID
 		if prev.URLPath != "" {
@@ -1299,12 +2323,12 @@ func (h *Handlers) getAdjacentPhotoInfo(ctx context.Context, photo *models.Photo
 
 func (h *Handlers) getPhotoPosition(ctx context.Context, photo *models.Photo) (position, total int) {
 	_ = h.db.Pool().QueryRow(ctx,
-		`SELECT COUNT(*) FROM photos WHERE folder_id IS NOT DISTINCT FROM $1 AND hidden = false`,
+		`SELECT COUNT(*) FROM photos WHERE folder_id IS NOT DISTINCT FROM $1 AND hidden = false AND draft = false AND photodock_live(live_from, live_until)`,
 		photo.FolderID).Scan(&total)
 
 	_ = h.db.Pool().QueryRow(ctx,
 		`SELECT COUNT(*) + 1 FROM photos 
-		WHERE folder_id IS NOT DISTINCT FROM $1 AND hidden = false 
+		WHERE folder_id IS NOT DISTINCT FROM $1 AND hidden = false AND draft = false AND photodock_live(live_from, live_until) 
 		AND (COALESCE(taken_at, created_at), id) > (COALESCE($2, $3), $4)`,
 		photo.FolderID, photo.TakenAt, photo.CreatedAt, photo.ID).Scan(&position)
 
@@ -1332,19 +2356,25 @@ func (h *Handlers) getSubfolders(ctx context.Context, parentID int) ([]models.Fo
 	return h.getFoldersWithCounts(ctx, fmt.Sprintf("parent_id = %d", parentID))
 }
 
-func (h *Handlers) getFoldersWithCounts(ctx context.Context, where string) ([]models.Folder, error) {
+func (h *Handlers) getFoldersWithCounts(ctx context.Context, where string, args ...interface{}) ([]models.Folder, error) {
 	query := fmt.Sprintf(`
-		SELECT f.id, f.parent_id, f.name, f.path, f.cover_photo_id, f.created_at,
-			(SELECT COUNT(*) FROM photos WHERE folder_id = f.id AND hidden = false) as photo_count,
-			(SELECT COUNT(*) FROM folders WHERE parent_id = f.id) as subfolder_count,
-			(SELECT COALESCE(SUM(size_bytes), 0) FROM photos WHERE folder_id = f.id AND hidden = false) as total_size,
+		SELECT f.id, f.parent_id, f.name, f.path, f.cover_photo_id, f.created_at, f.locked_by,
+			(SELECT COUNT(*) FROM photos WHERE folder_id = f.id AND hidden = false AND draft = false AND photodock_live(live_from, live_until)) as photo_count,
+			(SELECT COUNT(*) FROM folders WHERE parent_id = f.id AND draft = false AND photodock_live(live_from, live_until)) as subfolder_count,
+			(SELECT COALESCE(SUM(size_bytes), 0) FROM photos WHERE folder_id = f.id AND hidden = false AND draft = false AND photodock_live(live_from, live_until)) as total_size,
 			(SELECT ARRAY(
-				SELECT p.id FROM photos p WHERE p.folder_id = f.id AND p.hidden = false 
+				SELECT p.id || '?v=' || p.version FROM photos p WHERE p.folder_id = f.id AND p.hidden = false AND p.draft = false AND photodock_live(p.live_from, p.live_until)
+					AND p.id IS DISTINCT FROM f.cover_photo_id
 				ORDER BY COALESCE(p.taken_at, p.created_at) DESC, p.id DESC LIMIT 4
-			)) as preview_ids
-		FROM folders f WHERE %s ORDER BY f.created_at DESC`, where)
+			)) as preview_ids,
+			EXISTS(
+				SELECT 1 FROM photos p JOIN folders sf ON sf.id = p.folder_id
+				WHERE p.hidden = false AND p.draft = false AND photodock_live(p.live_from, p.live_until) AND (sf.id = f.id OR left(sf.path, length(f.path) + 1) = f.path || '/')
+					AND p.locked_by IS NOT DISTINCT FROM f.locked_by
+			) as has_photos
+		FROM folders f WHERE %s AND f.draft = false AND photodock_live(f.live_from, f.live_until) ORDER BY f.created_at DESC, f.id DESC`, where)
 
-	rows, err := h.db.Pool().Query(ctx, query)
+	rows, err := h.db.Pool().Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1353,37 +2383,54 @@ func (h *Handlers) getFoldersWithCounts(ctx context.Context, where string) ([]mo
 	var folders []models.Folder
 	for rows.Next() {
 		var f models.Folder
-		var previewIDs []int64
-		if err := rows.Scan(&f.ID, &f.ParentID, &f.Name, &f.Path, &f.CoverPhotoID, &f.CreatedAt,
-			&f.PhotoCount, &f.SubfolderCount, &f.TotalSize, &previewIDs); err != nil {
+		var previewIDs []string
+		var hasPhotos bool
+		if err := rows.Scan(&f.ID, &f.ParentID, &f.Name, &f.Path, &f.CoverPhotoID, &f.CreatedAt, &f.LockedBy,
+			&f.PhotoCount, &f.SubfolderCount, &f.TotalSize, &previewIDs, &hasPhotos); err != nil {
 			continue
 		}
 
-		for _, pid := range previewIDs {
-			f.PreviewURLs = append(f.PreviewURLs, fmt.Sprintf("/thumb/small/%d", pid))
-		}
-		if len(f.PreviewURLs) > 0 {
-			f.CoverURL = f.PreviewURLs[0]
+		f.Locked = f.LockedBy.Valid && f.LockedBy.Int64 == int64(f.ID)
+		if hasPhotos && !f.Locked {
+			f.CoverURL = coverURL(f.ID, "small")
+			f.PreviewURLs = append(f.PreviewURLs, f.CoverURL)
+			for _, pid := range previewIDs {
+				if len(f.PreviewURLs) == 4 {
+					break
+				}
+				f.PreviewURLs = append(f.PreviewURLs, "/thumb/small/"+pid)
+			}
 		}
 		folders = append(folders, f)
 	}
 	return folders, nil
 }
 
-func (h *Handlers) getRootPhotos(ctx context.Context) ([]models.Photo, error) {
-	return h.getPhotos(ctx, "folder_id IS NULL AND hidden = false")
+func (h *Handlers) getFolderPhotos(ctx context.Context, folderID, limit, offset int) ([]models.Photo, error) {
+	return h.getPhotosPage(ctx, fmt.Sprintf("folder_id = %d AND hidden = false", folderID), limit, offset)
+}
+
+func (h *Handlers) getRootPhotosPage(ctx context.Context, listing photoListing, limit, offset int) ([]models.Photo, error) {
+	return h.getPhotosPageOrdered(ctx, "folder_id IS NULL AND hidden = false AND draft = false AND photodock_live(live_from, live_until)"+listing.filter(), listing.order(), limit, offset)
+}
+
+func (h *Handlers) getFolderPhotosPage(ctx context.Context, folderID int, listing photoListing, limit, offset int) ([]models.Photo, error) {
+	return h.getPhotosPageOrdered(ctx, fmt.Sprintf("folder_id = %d AND hidden = false AND draft = false AND photodock_live(live_from, live_until)", folderID)+listing.filter(), listing.order(), limit, offset)
 }
 
-func (h *Handlers) getFolderPhotos(ctx context.Context, folderID int) ([]models.Photo, error) {
-	return h.getPhotos(ctx, fmt.Sprintf("folder_id = %d AND hidden = false", folderID))
+func (h *Handlers) getPhotosPage(ctx context.Context, where string, limit, offset int) ([]models.Photo, error) {
+	return h.getPhotosPageOrdered(ctx, where, defaultPhotoOrder, limit, offset)
 }
 
-func (h *Handlers) getPhotos(ctx context.Context, where string) ([]models.Photo, error) {
+func (h *Handlers) getPhotosPageOrdered(ctx context.Context, where, order string, limit, offset int, args ...interface{}) ([]models.Photo, error) {
 	query := fmt.Sprintf(`
-		SELECT id, folder_id, filename, path, COALESCE(url_path, ''), title, width, height, blurhash, size_bytes, taken_at, created_at
-		FROM photos WHERE %s ORDER BY COALESCE(taken_at, created_at) DESC, id DESC`, where)
+		SELECT id, folder_id, filename, path, COALESCE(url_path, ''), title, width, height, blurhash, size_bytes, taken_at, created_at, version, rating
+		FROM photos WHERE %s ORDER BY %s`, where, order)
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	}
 
-	rows, err := h.db.Pool().Query(ctx, query)
+	rows, err := h.db.Pool().Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1392,7 +2439,7 @@ func (h *Handlers) getPhotos(ctx context.Context, where string) ([]models.Photo,
 	var photos []models.Photo
 	for rows.Next() {
 		var p models.Photo
-		if err := rows.Scan(&p.ID, &p.FolderID, &p.Filename, &p.Path, &p.URLPath, &p.Title, &p.Width, &p.Height, &p.Blurhash, &p.SizeBytes, &p.TakenAt, &p.CreatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.FolderID, &p.Filename, &p.Path, &p.URLPath, &p.Title, &p.Width, &p.Height, &p.Blurhash, &p.SizeBytes, &p.TakenAt, &p.CreatedAt, &p.Version, &p.Rating); err != nil {
 			continue
 		}
 		photos = append(photos, p)
@@ -1400,39 +2447,21 @@ func (h *Handlers) getPhotos(ctx context.Context, where string) ([]models.Photo,
 	return photos, nil
 }
 
-func (h *Handlers) getAllFolders(ctx context.Context) ([]models.Folder, error) {
-	rows, err := h.db.Pool().Query(ctx, "SELECT id, parent_id, name, path FROM folders ORDER BY path")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var folders []models.Folder
-	for rows.Next() {
-		var f models.Folder
-		if err := rows.Scan(&f.ID, &f.ParentID, &f.Name, &f.Path); err != nil {
-			continue
-		}
-		folders = append(folders, f)
-	}
-	return folders, nil
-}
-
 func (h *Handlers) getFolderTree(ctx context.Context) ([]models.Folder, error) {
 	query := `
 		WITH RECURSIVE folder_tree AS (
-			SELECT id, parent_id, name, path, cover_photo_id, created_at, 0 as depth
+			SELECT id, parent_id, name, path, cover_photo_id, created_at, updated_at, content_updated_at, status, draft, 0 as depth
 			FROM folders WHERE parent_id IS NULL
 			UNION ALL
-			SELECT f.id, f.parent_id, f.name, f.path, f.cover_photo_id, f.created_at, ft.depth + 1
+			SELECT f.id, f.parent_id, f.name, f.path, f.cover_photo_id, f.created_at, f.updated_at, f.content_updated_at, f.status, f.draft, ft.depth + 1
 			FROM folders f INNER JOIN folder_tree ft ON f.parent_id = ft.id
 		)
-		SELECT ft.id, ft.parent_id, ft.name, ft.path, ft.cover_photo_id, ft.created_at, ft.depth,
+		SELECT ft.id, ft.parent_id, ft.name, ft.path, ft.cover_photo_id, ft.created_at,
+			COALESCE(ft.updated_at, ft.created_at), COALESCE(ft.content_updated_at, ft.updated_at, ft.created_at),
+			ft.status, ft.draft, ft.depth,
 			(SELECT COUNT(*) FROM photos WHERE folder_id = ft.id AND hidden = false),
 			(SELECT COUNT(*) FROM folders WHERE parent_id = ft.id),
-			(SELECT COALESCE(SUM(size_bytes), 0) FROM photos WHERE folder_id = ft.id AND hidden = false),
-			COALESCE(ft.cover_photo_id, (SELECT p.id FROM photos p WHERE p.folder_id = ft.id AND p.hidden = false 
-				ORDER BY COALESCE(p.taken_at, p.created_at) DESC, p.id DESC LIMIT 1))
+			(SELECT COALESCE(SUM(size_bytes), 0) FROM photos WHERE folder_id = ft.id AND hidden = false)
 		FROM folder_tree ft ORDER BY ft.path`
 
 	rows, err := h.db.Pool().Query(ctx, query)
@@ -1444,13 +2473,12 @@ func (h *Handlers) getFolderTree(ctx context.Context) ([]models.Folder, error) {
 	var folders []models.Folder
 	for rows.Next() {
 		var f models.Folder
-		var firstPhotoID sql.NullInt64
-		if err := rows.Scan(&f.ID, &f.ParentID, &f.Name, &f.Path, &f.CoverPhotoID, &f.CreatedAt, &f.Depth,
-			&f.PhotoCount, &f.SubfolderCount, &f.TotalSize, &firstPhotoID); err != nil {
+		if err := rows.Scan(&f.ID, &f.ParentID, &f.Name, &f.Path, &f.CoverPhotoID, &f.CreatedAt, &f.UpdatedAt, &f.ContentUpdatedAt, &f.Status, &f.Draft, &f.Depth,
+			&f.PhotoCount, &f.SubfolderCount, &f.TotalSize); err != nil {
 			continue
 		}
-		if firstPhotoID.Valid {
-			f.CoverURL = fmt.Sprintf("/thumb/small/%d", firstPhotoID.Int64)
+		if !f.Draft {
+			f.CoverURL = coverURL(f.ID, "small")
 		}
 		f.HasChildren = f.SubfolderCount > 0
 		folders = append(folders, f)
@@ -1485,8 +2513,90 @@ func (h *Handlers) isPathSafe(path string) bool {
 	return strings.HasPrefix(filepath.Join(h.cfg.MediaRoot, cleaned), h.cfg.MediaRoot)
 }
 
+func (h *Handlers) checkDiskSpace(incoming int64) error {
+	if incoming < 0 {
+		incoming = 0
+	}
+	for _, dir := range []string{h.cfg.MediaRoot, h.cfg.CacheDir} {
+		free, err := services.FreeSpace(dir)
+		if err != nil {
+			continue
+		}
+		if free < uint64(incoming)+h.cfg.DiskReserveBytes {
+			return fmt.Errorf("insufficient storage: %s has %s free, upload needs %s plus a %s reserve",
+				dir, formatSize(int64(free)), formatSize(incoming), formatSize(int64(h.cfg.DiskReserveBytes)))
+		}
+	}
+	return nil
+}
+
+func (h *Handlers) writeUpload(ctx context.Context, absPath string, src io.Reader, force bool) (string, error) {
+	dst, err := os.Create(absPath)
+	if err != nil {
+		return "", err
+	}
+
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(dst, hasher), src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(absPath)
+		return "", err
+	}
+
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	// Stored hashes are of files the scan has already stripped, so strip
+	// here too and hash what is left.
+	if stripped, err := h.scanSvc.StripGPS(absPath); err == nil && stripped {
+		if sum, err = services.HashFile(absPath); err != nil {
+			return "", err
+		}
+	}
+	if force && h.cfg.DedupHardlinks {
+		h.linkDuplicate(ctx, absPath, sum)
+	}
+	return sum, nil
+}
+
+func (h *Handlers) linkDuplicate(ctx context.Context, absPath, sum string) {
+	var existing string
+	err := h.db.Pool().QueryRow(ctx,
+		"SELECT path FROM photos WHERE sha256 = $1 ORDER BY id LIMIT 1", sum).Scan(&existing)
+	if err != nil || !h.isPathSafe(existing) {
+		return
+	}
+
+	tmpPath := absPath + ".link"
+	if err := os.Link(services.ResolveMediaPath(h.cfg.MediaRoot, existing), tmpPath); err != nil {
+		log.Printf("hard link %s -> %s failed, keeping copy: %v", existing, absPath, err)
+		return
+	}
+	if err := os.Rename(tmpPath, absPath); err != nil {
+		log.Printf("replace %s with hard link failed, keeping copy: %v", absPath, err)
+		_ = os.Remove(tmpPath)
+		return
+	}
+	if err := services.MarkSharedContent(ctx, h.db, sum); err != nil {
+		log.Printf("marking %s as shared content: %v", sum, err)
+	}
+}
+
 func (h *Handlers) resolveConflict(path string) string {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	return h.resolveConflictReserved(path, nil)
+}
+
+func (h *Handlers) resolveConflictReserved(path string, reserved map[string]bool) string {
+	free := func(p string) bool {
+		if reserved[p] {
+			return false
+		}
+		_, err := os.Stat(p)
+		return os.IsNotExist(err)
+	}
+
+	if free(path) {
 		return path
 	}
 
@@ -1495,7 +2605,7 @@ func (h *Handlers) resolveConflict(path string) string {
 
 	for i := 1; i < 10000; i++ {
 		newPath := fmt.Sprintf("%s_%d%s", base, i, ext)
-		if _, err := os.Stat(newPath); os.IsNotExist(err) {
+		if free(newPath) {
 			return newPath
 		}
 	}
@@ -1516,7 +2626,7 @@ func formatSize(b int64) string {
 }
 
 func sanitizeFilename(name string) string {
-	name = filepath.Base(name)
+	name = services.NormalizePath(filepath.Base(name))
 	name = strings.ReplaceAll(name, "..", "")
 	name = strings.Map(func(r rune) rune {
 		if r == '/' || r == '\\' || r == ':' || r == '*' || r == '?' || r == '"' || r == '<' || r == '>' || r == '|' {
@@ -1538,7 +2648,40 @@ func randString(n int) string {
 
 func isImageFile(name string) bool {
 	ext := strings.ToLower(filepath.Ext(name))
-	return ext == ".jpg" || ext == ".jpeg" || ext == ".png"
+	return ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".webp" || ext == ".gif" || ext == ".heic" || ext == ".heif"
+}
+
+func acceptsWebP(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(mediaType) != "image/webp" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func imageContentType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return "image/webp"
+	case ".gif":
+		return "image/gif"
+	case ".heic":
+		return "image/heic"
+	case ".heif":
+		return "image/heif"
+	default:
+		return "image/jpeg"
+	}
 }
 
 func (h *Handlers) apiListFolders(w http.ResponseWriter, r *http.Request) {
@@ -1562,13 +2705,15 @@ func (h *Handlers) apiListFolders(w http.ResponseWriter, r *http.Request) {
 		where = "parent_id = $1"
 		args = append(args, pid)
 	}
+	where += h.lockFilter(r, "f.locked_by")
 
 	query := fmt.Sprintf(`
 		SELECT f.id, f.parent_id, f.name, f.path, f.cover_photo_id, f.created_at,
-			(SELECT COUNT(*) FROM photos WHERE folder_id = f.id AND hidden = false) as photo_count,
-			(SELECT COUNT(*) FROM folders WHERE parent_id = f.id) as subfolder_count,
-			(SELECT COALESCE(SUM(size_bytes), 0) FROM photos WHERE folder_id = f.id AND hidden = false) as total_size
-		FROM folders f WHERE %s ORDER BY f.name`, where)
+			COALESCE(f.updated_at, f.created_at), COALESCE(f.content_updated_at, f.updated_at, f.created_at),
+			(SELECT COUNT(*) FROM photos WHERE folder_id = f.id AND hidden = false AND draft = false AND photodock_live(live_from, live_until)) as photo_count,
+			(SELECT COUNT(*) FROM folders WHERE parent_id = f.id AND draft = false AND photodock_live(live_from, live_until)) as subfolder_count,
+			(SELECT COALESCE(SUM(size_bytes), 0) FROM photos WHERE folder_id = f.id AND hidden = false AND draft = false AND photodock_live(live_from, live_until)) as total_size
+		FROM folders f WHERE %s AND f.draft = false AND photodock_live(f.live_from, f.live_until) ORDER BY f.name`, where)
 
 	rows, err := h.db.Pool().Query(ctx, query, args...)
 	if err != nil {
@@ -1578,15 +2723,18 @@ func (h *Handlers) apiListFolders(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	type folderJSON struct {
-		ID             int    `json:"id"`
-		ParentID       *int   `json:"parent_id"`
-		Name           string `json:"name"`
-		Path           string `json:"path"`
-		CoverPhotoID   *int   `json:"cover_photo_id"`
-		CreatedAt      string `json:"created_at"`
-		PhotoCount     int    `json:"photo_count"`
-		SubfolderCount int    `json:"subfolder_count"`
-		TotalSize      int64  `json:"total_size"`
+		ID               int    `json:"id"`
+		ParentID         *int   `json:"parent_id"`
+		Name             string `json:"name"`
+		Path             string `json:"path"`
+		CoverPhotoID     *int   `json:"cover_photo_id"`
+		CoverURL         string `json:"cover_url"`
+		CreatedAt        string `json:"created_at"`
+		UpdatedAt        string `json:"updated_at"`
+		ContentUpdatedAt string `json:"content_updated_at"`
+		PhotoCount       int    `json:"photo_count"`
+		SubfolderCount   int    `json:"subfolder_count"`
+		TotalSize        int64  `json:"total_size"`
 	}
 
 	var folders []folderJSON
@@ -1594,9 +2742,9 @@ func (h *Handlers) apiListFolders(w http.ResponseWriter, r *http.Request) {
 		var f folderJSON
 		var parentID sql.NullInt64
 		var coverPhotoID sql.NullInt64
-		var createdAt time.Time
+		var createdAt, updatedAt, contentUpdatedAt time.Time
 
-		if err := rows.Scan(&f.ID, &parentID, &f.Name, &f.Path, &coverPhotoID, &createdAt,
+		if err := rows.Scan(&f.ID, &parentID, &f.Name, &f.Path, &coverPhotoID, &createdAt, &updatedAt, &contentUpdatedAt,
 			&f.PhotoCount, &f.SubfolderCount, &f.TotalSize); err != nil {
 			continue
 		}
@@ -1609,7 +2757,10 @@ func (h *Handlers) apiListFolders(w http.ResponseWriter, r *http.Request) {
 			cid := int(coverPhotoID.Int64)
 			f.CoverPhotoID = &cid
 		}
+		f.CoverURL = coverURL(f.ID, "medium")
 		f.CreatedAt = createdAt.Format(time.RFC3339)
+		f.UpdatedAt = updatedAt.Format(time.RFC3339)
+		f.ContentUpdatedAt = contentUpdatedAt.Format(time.RFC3339)
 		folders = append(folders, f)
 	}
 
@@ -1634,17 +2785,18 @@ func (h *Handlers) apiGetFolder(w http.ResponseWriter, r *http.Request) {
 	var parentID sql.NullInt64
 	var coverPhotoID sql.NullInt64
 	var name, path string
-	var createdAt time.Time
+	var createdAt, updatedAt, contentUpdatedAt time.Time
 	var photoCount, subfolderCount int
 	var totalSize int64
 
 	err = h.db.Pool().QueryRow(ctx, `
 		SELECT f.id, f.parent_id, f.name, f.path, f.cover_photo_id, f.created_at,
-			(SELECT COUNT(*) FROM photos WHERE folder_id = f.id AND hidden = false),
-			(SELECT COUNT(*) FROM folders WHERE parent_id = f.id),
-			(SELECT COALESCE(SUM(size_bytes), 0) FROM photos WHERE folder_id = f.id AND hidden = false)
-		FROM folders f WHERE f.id = $1`, id).
-		Scan(&id, &parentID, &name, &path, &coverPhotoID, &createdAt,
+			COALESCE(f.updated_at, f.created_at), COALESCE(f.content_updated_at, f.updated_at, f.created_at),
+			(SELECT COUNT(*) FROM photos WHERE folder_id = f.id AND hidden = false AND draft = false AND photodock_live(live_from, live_until)),
+			(SELECT COUNT(*) FROM folders WHERE parent_id = f.id AND draft = false AND photodock_live(live_from, live_until)),
+			(SELECT COALESCE(SUM(size_bytes), 0) FROM photos WHERE folder_id = f.id AND hidden = false AND draft = false AND photodock_live(live_from, live_until))
+		FROM folders f WHERE f.id = $1 AND f.draft = false AND photodock_live(f.live_from, f.live_until)`+h.lockFilter(r, "f.locked_by"), id).
+		Scan(&id, &parentID, &name, &path, &coverPhotoID, &createdAt, &updatedAt, &contentUpdatedAt,
 			&photoCount, &subfolderCount, &totalSize)
 
 	if err != nil {
@@ -1653,15 +2805,18 @@ func (h *Handlers) apiGetFolder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	folder := map[string]interface{}{
-		"id":              id,
-		"parent_id":       nil,
-		"name":            name,
-		"path":            path,
-		"cover_photo_id":  nil,
-		"created_at":      createdAt.Format(time.RFC3339),
-		"photo_count":     photoCount,
-		"subfolder_count": subfolderCount,
-		"total_size":      totalSize,
+		"id":                 id,
+		"parent_id":          nil,
+		"name":               name,
+		"path":               path,
+		"cover_photo_id":     nil,
+		"cover_url":          coverURL(id, "medium"),
+		"created_at":         createdAt.Format(time.RFC3339),
+		"updated_at":         updatedAt.Format(time.RFC3339),
+		"content_updated_at": contentUpdatedAt.Format(time.RFC3339),
+		"photo_count":        photoCount,
+		"subfolder_count":    subfolderCount,
+		"total_size":         totalSize,
 	}
 
 	if parentID.Valid {
@@ -1691,9 +2846,9 @@ func (h *Handlers) apiListPhotos(w http.ResponseWriter, r *http.Request) {
 	folderFilter := r.URL.Query().Get("folder_id")
 
 	query := `SELECT id, folder_id, filename, path, COALESCE(url_path, ''), title, description,
-		width, height, size_bytes, blurhash, hidden, created_at, taken_at
-		FROM photos WHERE hidden = false`
-	countQuery := "SELECT COUNT(*) FROM photos WHERE hidden = false"
+		width, height, size_bytes, blurhash, hidden, created_at, COALESCE(updated_at, created_at), taken_at, version
+		FROM photos WHERE hidden = false AND draft = false AND photodock_live(live_from, live_until)` + h.lockFilter(r, "locked_by")
+	countQuery := "SELECT COUNT(*) FROM photos WHERE hidden = false AND draft = false AND photodock_live(live_from, live_until)" + h.lockFilter(r, "locked_by")
 
 	var args []interface{}
 	argIdx := 1
@@ -1739,6 +2894,7 @@ func (h *Handlers) apiListPhotos(w http.ResponseWriter, r *http.Request) {
 		SizeBytes   int64   `json:"size_bytes"`
 		Blurhash    *string `json:"blurhash"`
 		CreatedAt   string  `json:"created_at"`
+		UpdatedAt   string  `json:"updated_at"`
 		TakenAt     *string `json:"taken_at"`
 		Thumbnails  struct {
 			Small  string `json:"small"`
@@ -1753,12 +2909,13 @@ func (h *Handlers) apiListPhotos(w http.ResponseWriter, r *http.Request) {
 		var folderID sql.NullInt64
 		var urlPath string
 		var title, description, blurhash sql.NullString
-		var createdAt time.Time
+		var createdAt, updatedAt time.Time
 		var takenAt sql.NullTime
 		var hidden bool
+		var version int
 
 		if err := rows.Scan(&p.ID, &folderID, &p.Filename, &p.Path, &urlPath, &title, &description,
-			&p.Width, &p.Height, &p.SizeBytes, &blurhash, &hidden, &createdAt, &takenAt); err != nil {
+			&p.Width, &p.Height, &p.SizeBytes, &blurhash, &hidden, &createdAt, &updatedAt, &takenAt, &version); err != nil {
 			continue
 		}
 
@@ -1781,13 +2938,14 @@ func (h *Handlers) apiListPhotos(w http.ResponseWriter, r *http.Request) {
 			p.Blurhash = &blurhash.String
 		}
 		p.CreatedAt = createdAt.Format(time.RFC3339)
+		p.UpdatedAt = updatedAt.Format(time.RFC3339)
 		if takenAt.Valid {
 			t := takenAt.Time.Format(time.RFC3339)
 			p.TakenAt = &t
 		}
-		p.Thumbnails.Small = fmt.Sprintf("/thumb/small/%d", p.ID)
-		p.Thumbnails.Medium = fmt.Sprintf("/thumb/medium/%d", p.ID)
-		p.Thumbnails.Large = fmt.Sprintf("/thumb/large/%d", p.ID)
+		p.Thumbnails.Small = mediaURL("thumb/small", p.ID, version)
+		p.Thumbnails.Medium = mediaURL("thumb/medium", p.ID, version)
+		p.Thumbnails.Large = mediaURL("thumb/large", p.ID, version)
 
 		photos = append(photos, p)
 	}
@@ -1812,8 +2970,21 @@ func (h *Handlers) apiGetPhoto(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
+	var lockedBy sql.NullInt64
+	_ = h.db.Pool().QueryRow(r.Context(), "SELECT locked_by FROM photos WHERE id = $1", id).Scan(&lockedBy)
+	if !h.canView(r, lockedBy) {
+		http.NotFound(w, r)
+		return
+	}
+	photo, err := h.photoJSON(r.Context(), id, false)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.jsonResponse(w, photo)
+}
 
+func (h *Handlers) photoJSON(ctx context.Context, id int, admin bool) (map[string]interface{}, error) {
 	var folderID sql.NullInt64
 	var filename, path, urlPath string
 	var title, description, note, blurhash sql.NullString
@@ -1821,19 +2992,22 @@ func (h *Handlers) apiGetPhoto(w http.ResponseWriter, r *http.Request) {
 	var sizeBytes int64
 	var exifData json.RawMessage
 	var hidden bool
-	var createdAt time.Time
+	var createdAt, updatedAt time.Time
 	var takenAt sql.NullTime
+	var version int
 
-	err = h.db.Pool().QueryRow(ctx, `
+	query := `
 		SELECT id, folder_id, filename, path, COALESCE(url_path, ''), title, description, note,
-			width, height, size_bytes, blurhash, exif_data, hidden, created_at, taken_at
-		FROM photos WHERE id = $1 AND hidden = false`, id).
+			width, height, size_bytes, blurhash, exif_data, hidden, created_at, COALESCE(updated_at, created_at), taken_at, version
+		FROM photos WHERE id = $1`
+	if !admin {
+		query += " AND hidden = false AND draft = false AND photodock_live(live_from, live_until)"
+	}
+	err := h.db.Pool().QueryRow(ctx, query, id).
 		Scan(&id, &folderID, &filename, &path, &urlPath, &title, &description, &note,
-			&width, &height, &sizeBytes, &blurhash, &exifData, &hidden, &createdAt, &takenAt)
-
+			&width, &height, &sizeBytes, &blurhash, &exifData, &hidden, &createdAt, &updatedAt, &takenAt, &version)
 	if err != nil {
-		http.NotFound(w, r)
-		return
+		return nil, err
 	}
 
 	photo := map[string]interface{}{
@@ -1850,13 +3024,14 @@ func (h *Handlers) apiGetPhoto(w http.ResponseWriter, r *http.Request) {
 		"size_bytes":  sizeBytes,
 		"blurhash":    nil,
 		"created_at":  createdAt.Format(time.RFC3339),
+		"updated_at":  updatedAt.Format(time.RFC3339),
 		"taken_at":    nil,
 		"thumbnails": map[string]string{
-			"small":  fmt.Sprintf("/thumb/small/%d", id),
-			"medium": fmt.Sprintf("/thumb/medium/%d", id),
-			"large":  fmt.Sprintf("/thumb/large/%d", id),
+			"small":  mediaURL("thumb/small", id, version),
+			"medium": mediaURL("thumb/medium", id, version),
+			"large":  mediaURL("thumb/large", id, version),
 		},
-		"original": fmt.Sprintf("/original/%d", id),
+		"original": mediaURL("original", id, version),
 	}
 
 	if folderID.Valid {
@@ -1887,16 +3062,12 @@ func (h *Handlers) apiGetPhoto(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	h.jsonResponse(w, photo)
+	return photo, nil
 }
 
 func (h *Handlers) apiRandomPhoto(w http.ResponseWriter, r *http.Request) {
-	var id int
-	var urlPath string
-	err := h.db.Pool().QueryRow(r.Context(),
-		`SELECT id, COALESCE(url_path, '') FROM photos 
-		WHERE hidden = false ORDER BY RANDOM() LIMIT 1`).Scan(&id, &urlPath)
-	if err != nil {
+	id, urlPath, ok := h.randomPhoto(r)
+	if !ok {
 		http.Error(w, "no photos", 404)
 		return
 	}
@@ -1908,17 +3079,11 @@ func (h *Handlers) apiRandomPhoto(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) publicRandomPhoto(w http.ResponseWriter, r *http.Request) {
-	var count int
-	_ = h.db.Pool().QueryRow(r.Context(), "SELECT COUNT(*) FROM photos WHERE hidden = false").Scan(&count)
-	if count == 0 {
+	id, urlPath, ok := h.randomPhoto(r)
+	if !ok {
 		http.Redirect(w, r, "/", http.StatusFound)
 		return
 	}
-	var id int
-	var urlPath string
-	_ = h.db.Pool().QueryRow(r.Context(),
-		`SELECT id, COALESCE(url_path, '') FROM photos WHERE hidden = false 
-		OFFSET floor(random() * $1) LIMIT 1`, count).Scan(&id, &urlPath)
 	if urlPath != "" {
 		http.Redirect(w, r, "/p/"+urlPath, http.StatusFound)
 	} else {
@@ -1928,28 +3093,54 @@ func (h *Handlers) publicRandomPhoto(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handlers) adminStats(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	stats := h.collectStats(ctx)
-	h.render(w, "admin/stats.html", map[string]interface{}{
+	stats := h.collectStats(ctx, "hidden = false")
+	h.renderAdmin(w, r, "admin/stats.html", map[string]interface{}{
+		"Stats": stats,
+		"Title": "Statistics",
+	})
+}
+
+var statsFields = map[string]string{
+	"cameras":        "camera_model",
+	"camera_sizes":   "camera_model",
+	"lenses":         "lens_model",
+	"focal_lengths":  "focal_length",
+	"apertures":      "aperture",
+	"iso_ranges":     "iso",
+	"exposure_modes": "exposure_mode",
+}
+
+func (h *Handlers) publicStats(w http.ResponseWriter, r *http.Request) {
+	visible := "hidden = false AND draft = false AND photodock_live(live_from, live_until)" + h.lockFilter(r, "locked_by")
+	stats := h.collectStats(r.Context(), visible)
+	delete(stats, "overview")
+	for chart, field := range statsFields {
+		if slices.Contains(h.cfg.ExifPrivateFields, field) {
+			delete(stats, chart)
+		}
+	}
+	h.render(w, "public/stats.html", map[string]interface{}{
 		"Stats": stats,
 		"Title": "Statistics",
 	})
 }
 
 func (h *Handlers) apiStats(w http.ResponseWriter, r *http.Request) {
-	h.jsonResponse(w, h.collectStats(r.Context()))
+	h.jsonResponse(w, h.collectStats(r.Context(), "hidden = false"))
 }
 
-func (h *Handlers) collectStats(ctx context.Context) map[string]interface{} {
+// visible is a WHERE condition without arguments.
+func (h *Handlers) collectStats(ctx context.Context, visible string) map[string]interface{} {
 	stats := make(map[string]interface{})
 
 	var photoCount, folderCount, hiddenCount int
 	var totalSize int64
 	var avgWidth, avgHeight float64
-	_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE hidden = false").Scan(&photoCount)
+	_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE "+visible).Scan(&photoCount)
 	_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM folders").Scan(&folderCount)
 	_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE hidden = true").Scan(&hiddenCount)
 	_ = h.db.Pool().QueryRow(ctx, "SELECT COALESCE(SUM(size_bytes), 0) FROM photos").Scan(&totalSize)
-	_ = h.db.Pool().QueryRow(ctx, "SELECT COALESCE(AVG(width), 0), COALESCE(AVG(height), 0) FROM photos WHERE hidden = false").Scan(&avgWidth, &avgHeight)
+	_ = h.db.Pool().QueryRow(ctx, "SELECT COALESCE(AVG(width), 0), COALESCE(AVG(height), 0) FROM photos WHERE "+visible).Scan(&avgWidth, &avgHeight)
 
 	stats["overview"] = map[string]interface{}{
 		"photo_count":  photoCount,
@@ -1968,7 +3159,7 @@ func (h *Handlers) collectStats(ctx context.Context) map[string]interface{} {
 	cameras := []kv{}
 	rows, _ := h.db.Pool().Query(ctx, `
 		SELECT exif_data->>'camera_model' as camera, COUNT(*) as cnt 
-		FROM photos WHERE exif_data->>'camera_model' != '' AND hidden = false
+		FROM photos WHERE exif_data->>'camera_model' != '' AND `+visible+`
 		GROUP BY camera ORDER BY cnt DESC LIMIT 20`)
 	if rows != nil {
 		for rows.Next() {
@@ -1983,7 +3174,7 @@ func (h *Handlers) collectStats(ctx context.Context) map[string]interface{} {
 	lenses := []kv{}
 	rows, _ = h.db.Pool().Query(ctx, `
 		SELECT exif_data->>'lens_model' as lens, COUNT(*) as cnt 
-		FROM photos WHERE exif_data->>'lens_model' != '' AND hidden = false
+		FROM photos WHERE exif_data->>'lens_model' != '' AND `+visible+`
 		GROUP BY lens ORDER BY cnt DESC LIMIT 20`)
 	if rows != nil {
 		for rows.Next() {
@@ -1997,9 +3188,17 @@ func (h *Handlers) collectStats(ctx context.Context) map[string]interface{} {
 
 	focalLengths := []kv{}
 	rows, _ = h.db.Pool().Query(ctx, `
-		SELECT exif_data->>'focal_length' as fl, COUNT(*) as cnt 
-		FROM photos WHERE exif_data->>'focal_length' != '' AND hidden = false
-		GROUP BY fl ORDER BY cnt DESC LIMIT 20`)
+		SELECT CASE
+			WHEN fl < 24 THEN '<24 mm'
+			WHEN fl <= 35 THEN '24-35 mm'
+			WHEN fl <= 70 THEN '36-70 mm'
+			WHEN fl <= 135 THEN '71-135 mm'
+			WHEN fl <= 300 THEN '136-300 mm'
+			ELSE '>300 mm'
+		END as fl_range, COUNT(*) as cnt
+		FROM (SELECT split_part(exif_data->>'focal_length', ' ', 1)::numeric as fl
+			FROM photos WHERE exif_data->>'focal_length' ~ '^[0-9.]+ mm$' AND `+visible+`) f
+		GROUP BY fl_range ORDER BY MIN(fl)`)
 	if rows != nil {
 		for rows.Next() {
 			var item kv
@@ -2013,7 +3212,7 @@ func (h *Handlers) collectStats(ctx context.Context) map[string]interface{} {
 	apertures := []kv{}
 	rows, _ = h.db.Pool().Query(ctx, `
 		SELECT exif_data->>'aperture' as ap, COUNT(*) as cnt 
-		FROM photos WHERE exif_data->>'aperture' != '' AND hidden = false
+		FROM photos WHERE exif_data->>'aperture' != '' AND `+visible+`
 		GROUP BY ap ORDER BY cnt DESC LIMIT 20`)
 	if rows != nil {
 		for rows.Next() {
@@ -2034,8 +3233,8 @@ func (h *Handlers) collectStats(ctx context.Context) map[string]interface{} {
 			WHEN (exif_data->>'iso')::int <= 6400 THEN '1601-6400'
 			ELSE '>6400'
 		END as iso_range, COUNT(*) as cnt
-		FROM photos WHERE exif_data->>'iso' != '' AND exif_data->>'iso' != '0' AND hidden = false
-		GROUP BY iso_range ORDER BY cnt DESC`)
+		FROM photos WHERE exif_data->>'iso' != '' AND exif_data->>'iso' != '0' AND `+visible+`
+		GROUP BY iso_range ORDER BY MIN((exif_data->>'iso')::int)`)
 	if rows != nil {
 		for rows.Next() {
 			var item kv
@@ -2053,7 +3252,7 @@ func (h *Handlers) collectStats(ctx context.Context) map[string]interface{} {
 	timeline := []monthCount{}
 	rows, _ = h.db.Pool().Query(ctx, `
 		SELECT TO_CHAR(COALESCE(taken_at, created_at), 'YYYY-MM') as month, COUNT(*) as cnt
-		FROM photos WHERE hidden = false
+		FROM photos WHERE `+visible+`
 		GROUP BY month ORDER BY month DESC LIMIT 36`)
 	if rows != nil {
 		for rows.Next() {
@@ -2068,7 +3267,7 @@ func (h *Handlers) collectStats(ctx context.Context) map[string]interface{} {
 	exposureModes := []kv{}
 	rows, _ = h.db.Pool().Query(ctx, `
 		SELECT exif_data->>'exposure_mode' as mode, COUNT(*) as cnt
-		FROM photos WHERE exif_data->>'exposure_mode' != '' AND hidden = false
+		FROM photos WHERE exif_data->>'exposure_mode' != '' AND `+visible+`
 		GROUP BY mode ORDER BY cnt DESC`)
 	if rows != nil {
 		for rows.Next() {
@@ -2088,7 +3287,7 @@ func (h *Handlers) collectStats(ctx context.Context) map[string]interface{} {
 	var cameraSizes []cameraSize
 	rows, _ = h.db.Pool().Query(ctx, `
 		SELECT exif_data->>'camera_model', AVG(size_bytes), COUNT(*)
-		FROM photos WHERE exif_data->>'camera_model' != '' AND hidden = false
+		FROM photos WHERE exif_data->>'camera_model' != '' AND `+visible+`
 		GROUP BY exif_data->>'camera_model' ORDER BY COUNT(*) DESC LIMIT 10`)
 	if rows != nil {
 		for rows.Next() {
@@ -2104,10 +3303,36 @@ func (h *Handlers) collectStats(ctx context.Context) map[string]interface{} {
 }
 
 func (h *Handlers) adminReprocess(w http.ResponseWriter, r *http.Request) {
-	go func() {
-		if err := h.scanSvc.ReprocessAllMetadata(context.Background()); err != nil {
+	h.lifecycle.Go("reprocess", func(ctx context.Context) {
+		if err := h.scanSvc.ReprocessAllMetadata(ctx); err != nil {
 			log.Printf("reprocess error: %v", err)
 		}
-	}()
+	})
 	h.jsonResponse(w, map[string]string{"status": "started"})
 }
+
+func (h *Handlers) adminFixOrientation(w http.ResponseWriter, r *http.Request) {
+	res, err := h.scanSvc.FixOrientation(r.Context(), 20*time.Second)
+	if errors.Is(err, services.ErrMaintenanceRunning) {
+		h.jobConflict(w, h.scanSvc.RunningJob())
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	h.jsonResponse(w, res)
+}
+
+func (h *Handlers) adminReencodeBlurhash(w http.ResponseWriter, r *http.Request) {
+	res, err := h.scanSvc.ReencodeBlurhashes(r.Context(), 20*time.Second)
+	if errors.Is(err, services.ErrMaintenanceRunning) {
+		h.jobConflict(w, h.scanSvc.RunningJob())
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	h.jsonResponse(w, res)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestDigestEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"secret", "secret", true},
+		{"", "", true},
+		{"secret", "Secret", false},
+		{"secret", "secret ", false},
+		{"s", "a much longer secret", false},
+		{"", "secret", false},
+	}
+	for _, tt := range tests {
+		if got := digestEqual(tt.a, tt.b); got != tt.want {
+			t.Errorf("digestEqual(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCredentials(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hashed pass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := &Handlers{cfg: &config.Config{AdminUser: "admin", AdminPass: "plain pass"}}
+	// ADMIN_PASS_HASH wins over ADMIN_PASS when both are set.
+	hashed := &Handlers{cfg: &config.Config{AdminUser: "admin", AdminPass: "plain pass", AdminPassHash: string(hash)}}
+
+	tests := []struct {
+		name       string
+		h          *Handlers
+		user, pass string
+		want       bool
+	}{
+		{"plain", plain, "admin", "plain pass", true},
+		{"plain wrong password", plain, "admin", "plain pas", false},
+		{"plain longer password", plain, "admin", "plain pass and more", false},
+		{"plain empty password", plain, "admin", "", false},
+		{"plain wrong user", plain, "root", "plain pass", false},
+		{"plain longer user", plain, "administrator", "plain pass", false},
+		{"hash", hashed, "admin", "hashed pass", true},
+		{"hash ignores ADMIN_PASS", hashed, "admin", "plain pass", false},
+		{"hash wrong password", hashed, "admin", "hashed", false},
+		{"hash wrong user", hashed, "Admin", "hashed pass", false},
+		{"hash password matching the hash itself", hashed, "admin", string(hash), false},
+	}
+	for _, tt := range tests {
+		if got := tt.h.checkCredentials(tt.user, tt.pass); got != tt.want {
+			t.Errorf("%s: checkCredentials(%q, %q) = %v, want %v", tt.name, tt.user, tt.pass, got, tt.want)
+		}
+	}
+}
+
+func TestImageDimension(t *testing.T) {
+	t.Setenv("MEDIA_ROOT", t.TempDir())
+	t.Setenv("CACHE_DIR", t.TempDir())
+	t.Setenv("DATABASE_URL", "postgres://unused")
+	t.Setenv("ADMIN_PASS", "pass")
+	for _, tt := range []struct {
+		sizes string
+		n     string
+		want  bool
+	}{
+		{"", "640", true},
+		{"", "641", false},
+		{"", "2560", true},
+		{"", "3000", false},
+		{"100,200", "200", true},
+		{"100,200", "640", false},
+		{"any", "641", true},
+		{"any", "3000", false},
+	} {
+		t.Setenv("IMG_SIZES", tt.sizes)
+		cfg, err := config.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := &Handlers{cfg: cfg}
+		if _, ok := h.imageDimension(tt.n, false); ok != tt.want {
+			t.Errorf("IMG_SIZES=%q: imageDimension(%s) = %v, want %v", tt.sizes, tt.n, ok, tt.want)
+		}
+	}
+}
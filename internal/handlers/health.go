@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+)
+
+func (h *Handlers) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	h.jsonResponse(w, map[string]string{"status": "ok"})
+}
+
+func (h *Handlers) readyz(w http.ResponseWriter, r *http.Request) {
+	// Liveness stays green while the thumbnail cache is still being
+	// prewarmed; readiness waits for it, the database and writable
+	// directories.
+	w.Header().Set("Cache-Control", "no-store")
+	failed := make(map[string]string)
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	if err := h.db.Pool().Ping(ctx); err != nil {
+		failed["database"] = err.Error()
+	}
+	if err := checkWritable(h.cfg.MediaRoot); err != nil {
+		failed["media_root"] = err.Error()
+	}
+	if err := checkWritable(h.cfg.CacheDir); err != nil {
+		failed["cache_dir"] = err.Error()
+	}
+	if !h.thumbSvc.CacheWarm() {
+		failed["cache"] = "warming"
+	}
+
+	if len(failed) == 0 {
+		h.jsonResponse(w, map[string]string{"status": "ready"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	h.jsonResponse(w, map[string]interface{}{"status": "unavailable", "failed": failed})
+}
+
+// checkWritable creates and removes a file in dir, which also catches
+// read-only mounts and full disks that permission bits don't show.
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".photodock-ready-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	err = f.Close()
+	if rerr := os.Remove(name); err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/services"
+)
+
+func (h *Handlers) serveCustomImage(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	q := r.URL.Query()
+	width, ok := h.imageDimension(q.Get("w"), false)
+	if !ok {
+		http.Error(w, "Invalid width", http.StatusBadRequest)
+		return
+	}
+	height, ok := h.imageDimension(q.Get("h"), true)
+	if !ok {
+		http.Error(w, "Invalid height", http.StatusBadRequest)
+		return
+	}
+	fit := q.Get("fit")
+	switch fit {
+	case "":
+		fit = services.FitCover
+	case services.FitCover, services.FitContain:
+	default:
+		http.Error(w, "Invalid fit", http.StatusBadRequest)
+		return
+	}
+
+	var path string
+	var hidden bool
+	var lockedBy sql.NullInt64
+	if err := h.db.Pool().QueryRow(r.Context(), "SELECT path, hidden OR draft OR NOT photodock_live(live_from, live_until), locked_by FROM photos WHERE id = $1", id).Scan(&path, &hidden, &lockedBy); err != nil || hidden {
+		http.NotFound(w, r)
+		return
+	}
+	if !h.canView(r, lockedBy) {
+		denyLocked(w)
+		return
+	}
+
+	imgPath, err := h.thumbSvc.CustomImagePath(r.Context(), id, path, width, height, fit)
+	if errors.Is(err, services.ErrThumbnailFailed) {
+		services.SetThumbError(r.Context(), h.db, id, err)
+		h.serveBrokenThumbnail(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	h.setCacheControl(w, r, cacheThumbnails)
+	if lockedBy.Valid {
+		privateCache(w)
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	if notModified(w, r, id, imgPath) {
+		return
+	}
+
+	if r.Header.Get("X-Real-IP") != "" {
+		w.Header().Set("X-Accel-Redirect", fmt.Sprintf("/internal/cache/%s/%s", filepath.Base(filepath.Dir(imgPath)), filepath.Base(imgPath)))
+		return
+	}
+	http.ServeFile(w, r, imgPath)
+}
+
+// An empty value is only allowed where optional, as zero.
+func (h *Handlers) imageDimension(v string, optional bool) (int, bool) {
+	if v == "" {
+		return 0, optional
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 || n > h.cfg.ImageMaxEdge {
+		return 0, false
+	}
+	if len(h.cfg.ImageSizes) > 0 && !slices.Contains(h.cfg.ImageSizes, n) {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var assetPrefixes = []string{"/static/", "/thumb/", "/placeholder/", "/cover/", "/admin/thumb/"}
+
+var probePaths = []string{"/healthz", "/readyz"}
+
+// Successful asset requests are logged one in assetSample, or not at all
+// for zero, and successful health probes never.
+func LoggingMiddleware(next http.Handler, assetSample int) http.Handler {
+	var assets atomic.Uint64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w, status: 200}
+		defer func() {
+			if v := recover(); v != nil {
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				slog.Error("panic serving request",
+					"method", r.Method, "path", r.URL.Path,
+					"panic", fmt.Sprint(v), "stack", string(debug.Stack()))
+				if !rw.wroteHeader {
+					http.Error(rw, "Internal Server Error", http.StatusInternalServerError)
+				}
+				rw.status = http.StatusInternalServerError
+			}
+
+			duration := time.Since(start)
+			if rw.status < 400 && slices.Contains(probePaths, r.URL.Path) {
+				return
+			}
+			if rw.status < 400 && duration < 2*time.Second && isAsset(r.URL.Path) {
+				if assetSample <= 0 || assets.Add(1)%uint64(assetSample) != 0 {
+					return
+				}
+			}
+			level := slog.LevelInfo
+			if rw.status >= 500 {
+				level = slog.LevelError
+			}
+			slog.Log(r.Context(), level, "request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rw.status,
+				"bytes", rw.bytes,
+				"duration", duration)
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func isAsset(path string) bool {
+	for _, p := range assetPrefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.status = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the connection's writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,12 @@
+package handlers
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/testutil"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(testutil.Main(m))
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/models"
+)
+
+type manifestURLs struct {
+	Small    string `json:"small"`
+	Medium   string `json:"medium"`
+	Large    string `json:"large"`
+	Original string `json:"original"`
+}
+
+type manifestEntry struct {
+	ID      int          `json:"id"`
+	Title   string       `json:"title"`
+	TakenAt *time.Time   `json:"taken_at"`
+	Width   int          `json:"width"`
+	Height  int          `json:"height"`
+	URLs    manifestURLs `json:"urls"`
+}
+
+func (h *Handlers) folderManifest(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+
+	var folder models.Folder
+	err := h.db.Pool().QueryRow(r.Context(), "SELECT id, path, locked_by FROM folders WHERE id = $1 AND draft = false AND photodock_live(live_from, live_until)", id).Scan(&folder.ID, &folder.Path, &folder.LockedBy)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.serveManifest(w, r, &folder)
+}
+
+func (h *Handlers) serveManifest(w http.ResponseWriter, r *http.Request, folder *models.Folder) {
+	if !h.canView(r, folder.LockedBy) {
+		denyLocked(w)
+		return
+	}
+	ctx := r.Context()
+	listing := parsePhotoListing(r, h.viewerPrefs(r).Sort)
+
+	// Protected subfolders count only once they're unlocked too.
+	rows, err := h.db.Pool().Query(ctx, `
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM folders WHERE id = $1
+			UNION ALL
+			SELECT f.id FROM folders f JOIN subtree s ON f.parent_id = s.id
+		)
+		SELECT p.id, COALESCE(p.title, p.filename), p.taken_at, COALESCE(p.width, 0), COALESCE(p.height, 0), p.updated_at, p.version
+		FROM photos p
+		WHERE p.folder_id IN (SELECT id FROM subtree) AND p.hidden = false AND p.draft = false AND photodock_live(p.live_from, p.live_until)`+h.lockFilter(r, "p.locked_by")+listing.filter()+`
+		ORDER BY `+listing.order(), folder.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+
+	hasher := sha256.New()
+	entries := make([]manifestEntry, 0)
+	for rows.Next() {
+		var e manifestEntry
+		var updatedAt time.Time
+		var version int
+		if err := rows.Scan(&e.ID, &e.Title, &e.TakenAt, &e.Width, &e.Height, &updatedAt, &version); err != nil {
+			continue
+		}
+		e.URLs = manifestURLs{
+			Small:    mediaURL("thumb/small", e.ID, version),
+			Medium:   mediaURL("thumb/medium", e.ID, version),
+			Large:    mediaURL("thumb/large", e.ID, version),
+			Original: mediaURL("original", e.ID, version),
+		}
+		_, _ = fmt.Fprintf(hasher, "%d:%d:%d;", e.ID, updatedAt.UnixNano(), version)
+		entries = append(entries, e)
+	}
+
+	q := r.URL.Query()
+	if q.Get("shuffle") == "1" {
+		seed, err := strconv.ParseInt(q.Get("seed"), 10, 64)
+		if err != nil {
+			seed = time.Now().UnixNano()
+		}
+		rng := rand.New(rand.NewSource(seed))
+		rng.Shuffle(len(entries), func(i, j int) { entries[i], entries[j] = entries[j], entries[i] })
+		_, _ = fmt.Fprintf(hasher, "shuffle:%d", seed)
+	}
+
+	etag := `"` + hex.EncodeToString(hasher.Sum(nil))[:16] + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/testutil"
+)
+
+func TestManifestFollowsFolderSort(t *testing.T) {
+	app := newTestApp(t)
+	for name, taken := range map[string]string{
+		"b.jpg": "2021:01:01 12:00:00",
+		"c.jpg": "2023:01:01 12:00:00",
+		"a.jpg": "2022:01:01 12:00:00",
+	} {
+		app.writeMedia("Trip/"+name, testutil.JPEG(64, 48, &testutil.EXIF{DateTimeOriginal: taken}))
+	}
+	app.scan()
+	if _, err := app.db.Pool().Exec(context.Background(), "UPDATE photos SET rating = 5 WHERE filename = 'b.jpg'"); err != nil {
+		t.Fatal(err)
+	}
+
+	titles := func(query string, cookie *http.Cookie) []string {
+		t.Helper()
+		r, _ := http.NewRequest(http.MethodGet, "/p/Trip/manifest.json"+query, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := app.do(r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("manifest%s: %d", query, w.Code)
+		}
+		var entries []manifestEntry
+		if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+			t.Fatal(err)
+		}
+		out := []string{}
+		for _, e := range entries {
+			out = append(out, e.Title)
+		}
+		return out
+	}
+
+	tests := []struct {
+		query  string
+		cookie *http.Cookie
+		want   []string
+	}{
+		{"", nil, []string{"c.jpg", "a.jpg", "b.jpg"}},
+		{"?sort=taken_asc", nil, []string{"b.jpg", "a.jpg", "c.jpg"}},
+		{"?sort=name", nil, []string{"a.jpg", "b.jpg", "c.jpg"}},
+		{"?sort=rating", nil, []string{"b.jpg", "c.jpg", "a.jpg"}},
+		{"?sort=nonsense", nil, []string{"c.jpg", "a.jpg", "b.jpg"}},
+		{"", &http.Cookie{Name: prefsCookie, Value: "sort=name"}, []string{"a.jpg", "b.jpg", "c.jpg"}},
+		{"?min_rating=4", nil, []string{"b.jpg"}},
+	}
+	for _, tt := range tests {
+		if got := titles(tt.query, tt.cookie); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("manifest%s (cookie %v) = %v, want %v", tt.query, tt.cookie, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/models"
+)
+
+const settingContinueNav = "viewer.continue_nav"
+
+func (h *Handlers) continuesNav(ctx context.Context, folderID int) bool {
+	// The parent's continue_nav governs its subfolders; NULL defers to the
+	// site-wide setting.
+	var enabled *bool
+	_ = h.db.Pool().QueryRow(ctx,
+		`SELECT p.continue_nav FROM folders f LEFT JOIN folders p ON p.id = f.parent_id WHERE f.id = $1`,
+		folderID).Scan(&enabled)
+	if enabled != nil {
+		return *enabled
+	}
+	return h.settings.GetBool(ctx, settingContinueNav, false)
+}
+
+func (h *Handlers) siblingFolderPhoto(ctx context.Context, folderID int, forward bool) (id int, urlPath, folderName string) {
+	// Siblings follow the parent's listing order (newest first) and the
+	// photo picked is the one nearest the boundary being crossed.
+	// Navigation doesn't cross into or out of a protected folder.
+	query := `
+		SELECT p.id, COALESCE(p.url_path, ''), sf.name
+		FROM folders cur
+		JOIN folders sf ON sf.parent_id IS NOT DISTINCT FROM cur.parent_id AND sf.draft = false AND photodock_live(sf.live_from, sf.live_until)
+			AND (sf.created_at, sf.id) < (cur.created_at, cur.id)
+			AND sf.locked_by IS NOT DISTINCT FROM cur.locked_by
+		JOIN LATERAL (
+			SELECT id, url_path FROM photos
+			WHERE folder_id = sf.id AND hidden = false AND draft = false AND photodock_live(live_from, live_until)
+			ORDER BY COALESCE(taken_at, created_at) DESC, id DESC LIMIT 1
+		) p ON true
+		WHERE cur.id = $1
+		ORDER BY sf.created_at DESC, sf.id DESC LIMIT 1`
+	if !forward {
+		query = `
+		SELECT p.id, COALESCE(p.url_path, ''), sf.name
+		FROM folders cur
+		JOIN folders sf ON sf.parent_id IS NOT DISTINCT FROM cur.parent_id AND sf.draft = false AND photodock_live(sf.live_from, sf.live_until)
+			AND (sf.created_at, sf.id) > (cur.created_at, cur.id)
+			AND sf.locked_by IS NOT DISTINCT FROM cur.locked_by
+		JOIN LATERAL (
+			SELECT id, url_path FROM photos
+			WHERE folder_id = sf.id AND hidden = false AND draft = false AND photodock_live(live_from, live_until)
+			ORDER BY COALESCE(taken_at, created_at) ASC, id ASC LIMIT 1
+		) p ON true
+		WHERE cur.id = $1
+		ORDER BY sf.created_at ASC, sf.id ASC LIMIT 1`
+	}
+	_ = h.db.Pool().QueryRow(ctx, query, folderID).Scan(&id, &urlPath, &folderName)
+	return
+}
+
+type navPhoto struct {
+	ID      int
+	URLPath string
+}
+
+func (p navPhoto) url() string {
+	if p.URLPath != "" {
+		return "/p/" + p.URLPath
+	}
+	return fmt.Sprintf("/photo/%d", p.ID)
+}
+
+// ok is false when the listing leaves the photo out.
+func (h *Handlers) listingNav(ctx context.Context, photo *models.Photo, l photoListing) (prev, next navPhoto, position, total int, ok bool) {
+	rows, err := h.db.Pool().Query(ctx, fmt.Sprintf(`
+		WITH ordered AS (
+			SELECT id, COALESCE(url_path, '') AS url_path,
+				ROW_NUMBER() OVER (ORDER BY %s) AS n, COUNT(*) OVER () AS total
+			FROM photos
+			WHERE folder_id IS NOT DISTINCT FROM $1 AND hidden = false AND draft = false AND photodock_live(live_from, live_until)%s
+		)
+		SELECT o.id, o.url_path, o.n - c.n, c.n, c.total
+		FROM ordered c JOIN ordered o ON o.n BETWEEN c.n - 1 AND c.n + 1
+		WHERE c.id = $2`, l.order(), l.filter()), photo.FolderID, photo.ID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p navPhoto
+		var offset int
+		if err := rows.Scan(&p.ID, &p.URLPath, &offset, &position, &total); err != nil {
+			return navPhoto{}, navPhoto{}, 0, 0, false
+		}
+		switch offset {
+		case -1:
+			prev = p
+		case 1:
+			next = p
+		}
+	}
+	return prev, next, position, total, position > 0
+}
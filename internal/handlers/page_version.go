@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// startedAt goes into every page version, so a restart with new templates
+// or configuration is never answered from an old copy.
+var startedAt = time.Now()
+
+// A folder's content_updated_at moves whenever anything below it changes
+// and updated_at with its own settings; taking the latest along the
+// ancestor chain also catches renames of the folders in the breadcrumbs.
+const chainVersionSQL = `
+	SELECT GREATEST(max(a.content_updated_at), max(a.updated_at)), 0 FROM folders f
+	JOIN folders a ON a.path = f.path OR left(f.path, length(a.path) + 1) = a.path || '/'
+	WHERE f.id = $1`
+
+// The top level has no folder row to bubble into, so deletions there only
+// show in the counts.
+const rootVersionSQL = `
+	SELECT GREATEST(
+		(SELECT GREATEST(max(content_updated_at), max(updated_at)) FROM folders WHERE parent_id IS NULL),
+		(SELECT max(updated_at) FROM photos WHERE folder_id IS NULL)),
+		(SELECT count(*) FROM folders WHERE parent_id IS NULL) + (SELECT count(*) FROM photos WHERE folder_id IS NULL)`
+
+// Publish windows change what is visible without touching any row; the
+// latest boundary already passed marks when that last happened.
+const liveVersionSQL = `
+	SELECT GREATEST(
+		(SELECT max(live_from) FROM photos WHERE live_from <= NOW()),
+		(SELECT max(live_until) FROM photos WHERE live_until <= NOW()),
+		(SELECT max(live_from) FROM folders WHERE live_from <= NOW()),
+		(SELECT max(live_until) FROM folders WHERE live_until <= NOW())),
+		(SELECT max(updated_at) FROM settings)`
+
+// pageNotModified runs before the page's own queries; on a database
+// error the page is simply rendered. scope is 0 for the top level.
+func (h *Handlers) pageNotModified(w http.ResponseWriter, r *http.Request, scope int, prefs ViewerPrefs, locked bool) bool {
+	scopeSQL, args := rootVersionSQL, []interface{}{}
+	if scope != 0 {
+		scopeSQL, args = chainVersionSQL, []interface{}{scope}
+	}
+	var content, live, settings sql.NullTime
+	var count int
+	err := h.db.Pool().QueryRow(r.Context(), "SELECT * FROM ("+scopeSQL+") s, ("+liveVersionSQL+") l", args...).
+		Scan(&content, &count, &live, &settings)
+	if err != nil {
+		return false
+	}
+
+	// Who is asking changes the page too: admins and unlocked folders see
+	// more, and the viewer's own display preferences apply.
+	admin := h.isAdmin(r)
+	var unlocked []int
+	if !admin {
+		unlocked = h.unlockedFolders(r)
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprint(
+		content.Time.UnixNano(), count, live.Time.UnixNano(), settings.Time.UnixNano(), startedAt.UnixNano(),
+		prefs, h.baseURL(r), admin, unlocked)))
+	etag := `W/"` + hex.EncodeToString(sum[:12]) + `"`
+
+	modified := startedAt
+	for _, t := range []sql.NullTime{content, live, settings} {
+		if t.Valid && t.Time.After(modified) {
+			modified = t.Time
+		}
+	}
+	modified = modified.UTC().Truncate(time.Second)
+
+	h.setCacheControl(w, nil, cacheHTML)
+	if locked || admin || len(unlocked) > 0 {
+		privateCache(w)
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+
+	// If-None-Match wins when both are sent; clients that only remember
+	// the date miss a deletion at the top level, which moves no date.
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == strings.TrimPrefix(etag, "W/") || candidate == "*" {
+				w.WriteHeader(http.StatusNotModified)
+				return true
+			}
+		}
+		return false
+	}
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/testutil"
+)
+
+// newGrid is a folder of n photos with no cached placeholders.
+func newGrid(tb testing.TB, n int) (*testApp, []int) {
+	app := newTestApp(tb)
+	ids := make([]int, n)
+	for i := range ids {
+		app.writeMedia(fmt.Sprintf("Grid/%03d.jpg", i), testutil.JPEG(96, 64, nil))
+	}
+	app.scan()
+	for i := range ids {
+		ids[i], _ = app.photo(fmt.Sprintf("Grid/%03d.jpg", i))
+		app.h.thumbSvc.DeletePlaceholderByID(ids[i])
+	}
+	return app, ids
+}
+
+// loadGrid requests the placeholders of ids, as a page does, and returns
+// the queries those requests made.
+func (a *testApp) loadGrid(ids []int, want int) int64 {
+	a.t.Helper()
+	ctx, n := testutil.CountQueries(context.Background())
+	for _, id := range ids {
+		r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/placeholder/%d", id), nil).WithContext(ctx)
+		if w := a.do(r); w.Code != want {
+			a.t.Fatalf("placeholder %d: %d, want %d", id, w.Code, want)
+		}
+	}
+	return n.Load()
+}
+
+func TestCachedPlaceholdersSkipTheDatabase(t *testing.T) {
+	const grid = 12
+	app, ids := newGrid(t, grid)
+	queries := func() int64 { return app.loadGrid(ids, http.StatusOK) }
+
+	cold := queries()
+	if cold < grid {
+		t.Errorf("cold grid made %d queries, want at least one per photo", cold)
+	}
+	if warm := queries(); warm != 0 {
+		t.Errorf("cached grid made %d queries, want none (cold: %d)", warm, cold)
+	}
+}
+
+func TestCachedPlaceholdersFollowVisibility(t *testing.T) {
+	app, ids := newGrid(t, 3)
+	app.loadGrid(ids, http.StatusOK)
+	app.loadGrid(ids, http.StatusOK)
+
+	var folderID int
+	_ = app.db.Pool().QueryRow(context.Background(), "SELECT id FROM folders WHERE path = 'Grid'").Scan(&folderID)
+	r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/folders/%d", folderID), strings.NewReader("name=Grid&status=draft"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth(testAdminUser, testAdminPass)
+	if w := app.do(r); w.Code != http.StatusSeeOther {
+		t.Fatalf("set draft: %d", w.Code)
+	}
+	app.loadGrid(ids, http.StatusNotFound)
+
+	// A publish window closes without any write to announce it.
+	_, err := app.db.Pool().Exec(context.Background(),
+		"UPDATE folders SET status = 'published', draft = false; UPDATE photos SET draft = false, expires_at = NOW() + interval '1 second'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.loadGrid(ids, http.StatusOK)
+	time.Sleep(1100 * time.Millisecond)
+	app.loadGrid(ids, http.StatusNotFound)
+}
+
+// BenchmarkFolderRender renders a large folder page with all of its
+// placeholders and reports the queries a render makes, first with nothing
+// known and then with the placeholders cached.
+func BenchmarkFolderRender(b *testing.B) {
+	app, ids := newGrid(b, 300)
+	render := func() int64 {
+		ctx, n := testutil.CountQueries(context.Background())
+		r := httptest.NewRequest(http.MethodGet, "/p/Grid/", nil).WithContext(ctx)
+		if w := app.do(r); w.Code != http.StatusOK {
+			b.Fatalf("folder page: %d", w.Code)
+		}
+		return n.Load() + app.loadGrid(ids, http.StatusOK)
+	}
+
+	uncached := render()
+	b.ResetTimer()
+	var queries int64
+	for i := 0; i < b.N; i++ {
+		queries += render()
+	}
+	b.ReportMetric(float64(uncached), "uncached-queries")
+	b.ReportMetric(float64(queries)/float64(b.N), "queries/op")
+}
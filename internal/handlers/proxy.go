@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Anyone else could set the forwarding headers to whatever they like.
+func (h *Handlers) fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range h.cfg.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handlers) baseURL(r *http.Request) string {
+	if h.cfg.BaseURL != "" {
+		return h.cfg.BaseURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+	if h.fromTrustedProxy(r) {
+		if proto := firstHeaderValue(r, "X-Forwarded-Proto"); proto == "https" || proto == "http" {
+			scheme = proto
+		}
+		if fwd := firstHeaderValue(r, "X-Forwarded-Host"); fwd != "" {
+			host = fwd
+		}
+	}
+	return scheme + "://" + host
+}
+
+func firstHeaderValue(r *http.Request, name string) string {
+	v, _, _ := strings.Cut(r.Header.Get(name), ",")
+	return strings.TrimSpace(v)
+}
+
+// clientIP takes the last hop the trusted proxy header names.
+func (h *Handlers) clientIP(r *http.Request) string {
+	if name := h.cfg.TrustedProxyHeader; name != "" && h.fromTrustedProxy(r) {
+		if v := r.Header.Values(name); len(v) > 0 {
+			hops := strings.Split(v[len(v)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+)
+
+// Photos added since are merely not picked until the count expires.
+const randomCountTTL = time.Minute
+
+type randomCount struct {
+	n  int
+	at time.Time
+}
+
+// randomPhoto goes by offset into the visible set rather than sorting
+// all of it by random().
+func (h *Handlers) randomPhoto(r *http.Request) (id int, urlPath string, ok bool) {
+	ctx := r.Context()
+	visible := "hidden = false AND draft = false AND photodock_live(live_from, live_until)" + h.lockFilter(r, "locked_by")
+
+	// A cached count that has gone stale can point past the end; one retry
+	// with a fresh count covers deletions.
+	for attempt := 0; attempt < 2; attempt++ {
+		cached, hit := h.randomCounts.Load(visible)
+		c, _ := cached.(randomCount)
+		if !hit || attempt > 0 || time.Since(c.at) > randomCountTTL {
+			c = randomCount{at: time.Now()}
+			if err := h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE "+visible).Scan(&c.n); err != nil {
+				return 0, "", false
+			}
+			h.randomCounts.Store(visible, c)
+		}
+		if c.n == 0 {
+			return 0, "", false
+		}
+		err := h.db.Pool().QueryRow(ctx,
+			`SELECT id, COALESCE(url_path, '') FROM photos WHERE `+visible+`
+			OFFSET floor(random() * $1) LIMIT 1`, c.n).Scan(&id, &urlPath)
+		if err == nil {
+			return id, urlPath, true
+		}
+	}
+	return 0, "", false
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const defaultPhotoOrder = "COALESCE(taken_at, created_at) DESC, id DESC"
+
+// "random" is ordered by seed in photoListing.order.
+var photoSorts = map[string]string{
+	"taken_asc": "COALESCE(taken_at, created_at) ASC, id ASC",
+	"name":      "filename ASC, id ASC",
+	"size":      "size_bytes DESC NULLS LAST, id DESC",
+	"rating":    "rating DESC NULLS LAST, " + defaultPhotoOrder,
+	"random":    "",
+}
+
+func normalizeSort(s string) string {
+	if _, ok := photoSorts[s]; ok {
+		return s
+	}
+	return ""
+}
+
+type photoListing struct {
+	MinRating int
+	Sort      string
+	// Seed keeps a random order the same across pages and photo
+	// navigation.
+	Seed int64
+}
+
+func parsePhotoListing(r *http.Request, fallbackSort string) photoListing {
+	q := r.URL.Query()
+	var l photoListing
+	if n, err := strconv.Atoi(q.Get("min_rating")); err == nil && n >= 1 && n <= 5 {
+		l.MinRating = n
+	}
+	l.Sort = fallbackSort
+	if q.Has("sort") {
+		l.Sort = normalizeSort(q.Get("sort"))
+	}
+	if l.Sort == "random" {
+		seed, err := strconv.ParseInt(q.Get("seed"), 10, 64)
+		if err != nil || seed <= 0 {
+			seed = rand.Int63n(1_000_000_000) + 1
+		}
+		l.Seed = seed
+	}
+	return l
+}
+
+func (l photoListing) isDefault() bool {
+	return l.MinRating == 0 && l.Sort == ""
+}
+
+func (l photoListing) filter() string {
+	if l.MinRating == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" AND rating >= %d", l.MinRating)
+}
+
+func (l photoListing) order() string {
+	if l.Sort == "random" {
+		return fmt.Sprintf("md5(id::text || ':%d'), id", l.Seed)
+	}
+	if order := photoSorts[l.Sort]; order != "" {
+		return order
+	}
+	return defaultPhotoOrder
+}
+
+func (l photoListing) values() url.Values {
+	v := url.Values{}
+	if l.MinRating > 0 {
+		v.Set("min_rating", strconv.Itoa(l.MinRating))
+	}
+	if l.Sort != "" {
+		v.Set("sort", l.Sort)
+	}
+	if l.Seed > 0 {
+		v.Set("seed", strconv.FormatInt(l.Seed, 10))
+	}
+	return v
+}
+
+func (l photoListing) Query() template.URL {
+	return template.URL(l.values().Encode())
+}
+
+func stars(n int16) string {
+	if n < 0 || n > 5 {
+		return ""
+	}
+	return strings.Repeat("★", int(n)) + strings.Repeat("☆", 5-int(n))
+}
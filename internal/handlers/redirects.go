@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type urlRedirect struct {
+	ID        int
+	OldPath   string
+	NewPath   string
+	PhotoID   *int
+	CreatedAt time.Time
+}
+
+func (h *Handlers) urlRedirect(ctx context.Context, oldPath string) (string, bool) {
+	var target string
+	err := h.db.Pool().QueryRow(ctx, "SELECT new_path FROM url_redirects WHERE old_path = $1", oldPath).Scan(&target)
+	return target, err == nil
+}
+
+func (h *Handlers) adminRedirects(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	rows, err := h.db.Pool().Query(ctx,
+		"SELECT id, old_path, new_path, photo_id, created_at FROM url_redirects ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+
+	var redirects []urlRedirect
+	for rows.Next() {
+		var rd urlRedirect
+		if err := rows.Scan(&rd.ID, &rd.OldPath, &rd.NewPath, &rd.PhotoID, &rd.CreatedAt); err != nil {
+			continue
+		}
+		redirects = append(redirects, rd)
+	}
+
+	h.renderAdmin(w, r, "admin/redirects.html", map[string]interface{}{
+		"Redirects": redirects,
+		"Title":     "URL Redirects",
+	})
+}
+
+func (h *Handlers) adminPruneRedirects(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	ctx := r.Context()
+
+	var ids []int
+	for _, v := range r.Form["id"] {
+		if id, err := strconv.Atoi(v); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > 0 {
+		_, _ = h.db.Pool().Exec(ctx, "DELETE FROM url_redirects WHERE id = ANY($1)", ids)
+	}
+
+	if days, err := strconv.Atoi(r.FormValue("older_than_days")); err == nil && days > 0 {
+		_, _ = h.db.Pool().Exec(ctx,
+			"DELETE FROM url_redirects WHERE created_at < NOW() - make_interval(days => $1)", days)
+	}
+
+	http.Redirect(w, r, "/admin/redirects", http.StatusSeeOther)
+}
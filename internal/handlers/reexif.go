@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/services"
+)
+
+func (h *Handlers) adminReexifPhoto(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+
+	var path string
+	if err := h.db.Pool().QueryRow(r.Context(), "SELECT path FROM photos WHERE id = $1", id).Scan(&path); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err := h.scanSvc.ReexifPhoto(r.Context(), id, path)
+	if errors.Is(err, services.ErrPhotoFileMissing) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	h.jsonResponse(w, map[string]string{"status": "ok"})
+}
+
+func (h *Handlers) adminRescanPhoto(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+
+	var path string
+	if err := h.db.Pool().QueryRow(r.Context(), "SELECT path FROM photos WHERE id = $1", id).Scan(&path); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err := h.scanSvc.RescanPhoto(r.Context(), id, path)
+	if errors.Is(err, services.ErrPhotoFileMissing) {
+		// The row can only be deleted; the admin UI offers that.
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusGone)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error(), "path": path})
+		return
+	}
+	if errors.Is(err, services.ErrMaintenanceRunning) {
+		h.jobConflict(w, h.scanSvc.RunningJob())
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	photo, err := h.photoJSON(r.Context(), id, true)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	h.jsonResponse(w, photo)
+}
+
+func (h *Handlers) adminRotatePhoto(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	degrees, _ := strconv.Atoi(r.FormValue("degrees"))
+
+	var path string
+	if err := h.db.Pool().QueryRow(r.Context(), "SELECT path FROM photos WHERE id = $1", id).Scan(&path); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err := h.scanSvc.RotatePhoto(r.Context(), id, path, degrees)
+	switch {
+	case errors.Is(err, services.ErrBadRotation), errors.Is(err, services.ErrRotationUnsupported):
+		http.Error(w, err.Error(), 400)
+		return
+	case errors.Is(err, services.ErrPhotoFileMissing):
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	case errors.Is(err, services.ErrMaintenanceRunning):
+		h.jobConflict(w, h.scanSvc.RunningJob())
+		return
+	case err != nil:
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	photo, err := h.photoJSON(r.Context(), id, true)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	h.jsonResponse(w, photo)
+}
+
+func (h *Handlers) adminReexif(w http.ResponseWriter, r *http.Request) {
+	// An optional {"ids": [...]} body limits the run to a selection.
+	var req struct {
+		IDs []int `json:"ids"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", 400)
+			return
+		}
+	}
+
+	if !h.scanSvc.BeginReexif() {
+		h.jobConflict(w, h.scanSvc.RunningJob())
+		return
+	}
+	h.lifecycle.Go("reexif", func(ctx context.Context) {
+		if err := h.scanSvc.ReexifPhotos(ctx, req.IDs); err != nil {
+			log.Printf("re-extract EXIF: %v", err)
+		}
+	})
+	h.jsonResponse(w, map[string]string{"status": "started"})
+}
+
+func (h *Handlers) adminReexifStatus(w http.ResponseWriter, r *http.Request) {
+	h.jsonResponse(w, h.scanSvc.ReexifStatus())
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/models"
+)
+
+const sitemapLimit = 50000
+
+// noindexSQL is true when the folder idExpr, or any folder above it, is
+// marked noindex.
+func noindexSQL(idExpr string) string {
+	return `EXISTS (SELECT 1 FROM folders nf JOIN folders na
+		ON na.path = nf.path OR left(nf.path, length(na.path) + 1) = na.path || '/'
+		WHERE nf.id = ` + idExpr + ` AND na.noindex)`
+}
+
+func (h *Handlers) folderNoindex(ctx context.Context, w http.ResponseWriter, folderID int) bool {
+	var noindex bool
+	_ = h.db.Pool().QueryRow(ctx, "SELECT "+noindexSQL("$1"), folderID).Scan(&noindex)
+	if noindex {
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
+	return noindex
+}
+
+func (h *Handlers) robotsTxt(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	h.setCacheControl(w, nil, cacheHTML)
+	if h.cfg.PrivateMode {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /\n")
+		return
+	}
+	fmt.Fprintf(w, "User-agent: *\nDisallow: /admin/\nDisallow: /api/\n\nSitemap: %s/sitemap.xml\n", h.baseURL(r))
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// Everything under a noindex folder is left out.
+func (h *Handlers) sitemap(w http.ResponseWriter, r *http.Request) {
+	if h.cfg.PrivateMode {
+		http.NotFound(w, r)
+		return
+	}
+	ctx := r.Context()
+	base := h.baseURL(r)
+	set := sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	set.URLs = append(set.URLs, sitemapURL{Loc: base + "/"})
+
+	rows, err := h.db.Pool().Query(ctx, `
+		SELECT f.path, GREATEST(f.content_updated_at, f.updated_at) FROM folders f
+		WHERE f.draft = false AND photodock_live(f.live_from, f.live_until) AND f.locked_by IS NULL
+		AND NOT `+noindexSQL("f.id")+`
+		ORDER BY f.path LIMIT $1`, sitemapLimit)
+	if err == nil {
+		for rows.Next() {
+			var path string
+			var modified time.Time
+			if rows.Scan(&path, &modified) == nil {
+				set.URLs = append(set.URLs, sitemapURL{Loc: base + "/p/" + escapeURLPath(path) + "/", LastMod: modified.UTC().Format(time.RFC3339)})
+			}
+		}
+		rows.Close()
+	}
+
+	rows, err = h.db.Pool().Query(ctx, `
+		SELECT p.id, COALESCE(p.url_path, ''), p.updated_at FROM photos p
+		WHERE p.hidden = false AND p.draft = false AND photodock_live(p.live_from, p.live_until) AND p.locked_by IS NULL
+		AND (p.folder_id IS NULL OR NOT `+noindexSQL("p.folder_id")+`)
+		ORDER BY p.id LIMIT $1`, sitemapLimit-len(set.URLs))
+	if err == nil {
+		for rows.Next() {
+			var photo models.Photo
+			var modified time.Time
+			if rows.Scan(&photo.ID, &photo.URLPath, &modified) == nil {
+				set.URLs = append(set.URLs, sitemapURL{Loc: base + photoPageURL(&photo), LastMod: modified.UTC().Format(time.RFC3339)})
+			}
+		}
+		rows.Close()
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	h.setCacheControl(w, nil, cacheHTML)
+	_, _ = w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	_ = enc.Encode(set)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxSearchLen = 100
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// q's own LIKE metacharacters are taken literally.
+func likePattern(q string) string {
+	return "%" + likeEscaper.Replace(q) + "%"
+}
+
+func searchQuery(r *http.Request) string {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	for utf8.RuneCountInString(q) > maxSearchLen {
+		_, size := utf8.DecodeLastRuneInString(q)
+		q = q[:len(q)-size]
+	}
+	return q
+}
+
+// Camera make, model and lens are only matched while they aren't
+// private.
+func (h *Handlers) photoSearchSQL() string {
+	var camera []string
+	for _, field := range []string{"camera_make", "camera_model", "lens_model"} {
+		if !slices.Contains(h.cfg.ExifPrivateFields, field) {
+			camera = append(camera, "exif_data->>'"+field+"'")
+		}
+	}
+	where := "(filename ILIKE $1 OR title ILIKE $1 OR description ILIKE $1"
+	if len(camera) > 0 {
+		where += " OR concat_ws(' ', " + strings.Join(camera, ", ") + ") ILIKE $1"
+	}
+	return where + ")"
+}
+
+func (h *Handlers) publicSearch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prefs := h.viewerPrefs(r)
+	q := searchQuery(r)
+
+	data := map[string]interface{}{
+		"Query": q,
+		"Title": "Search",
+		"Prefs": prefs,
+	}
+	if q == "" {
+		h.render(w, "public/search.html", data)
+		return
+	}
+	data["Title"] = "Search: " + q
+	pattern := likePattern(q)
+
+	where := h.photoSearchSQL() + " AND hidden = false AND draft = false AND photodock_live(live_from, live_until)" + h.lockFilter(r, "locked_by")
+	var photoTotal int
+	_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE "+where, pattern).Scan(&photoTotal)
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	totalPages := pageCount(photoTotal, prefs.PerPage)
+	page = max(1, min(page, totalPages))
+
+	// Folders are few enough to list in full on the first page.
+	if page == 1 {
+		folders, _ := h.getFoldersWithCounts(ctx, "f.name ILIKE $1"+h.lockFilter(r, "f.locked_by"), pattern)
+		data["Folders"] = folders
+	}
+	photos, _ := h.getPhotosPageOrdered(ctx, where, defaultPhotoOrder, prefs.PerPage, (page-1)*prefs.PerPage, pattern)
+
+	data["Photos"] = photos
+	data["PhotoTotal"] = photoTotal
+	data["Page"] = page
+	data["TotalPages"] = totalPages
+	h.render(w, "public/search.html", data)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/config"
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+	"github.com/Alexander-D-Karpov/photodock/internal/services"
+)
+
+// BuildServer is everything main needs besides the listener and signal
+// handling, so the whole app can also be assembled in-process.
+func BuildServer(cfg *config.Config, db *database.DB, webFS fs.FS) (http.Handler, *services.Lifecycle) {
+	_, handler, lifecycle := newApp(cfg, db, webFS)
+	return handler, lifecycle
+}
+
+func newApp(cfg *config.Config, db *database.DB, webFS fs.FS) (*Handlers, http.Handler, *services.Lifecycle) {
+	thumbService := services.NewThumbnailService(cfg.MediaRoot, cfg.CacheDir, cfg.CacheCriticalBytes, cfg.CacheMaxBytes, cfg.DecodeMaxPixels, cfg.ThumbSizes, cfg.ThumbWorkers, cfg.ThumbBackend)
+
+	exifService := services.NewExifService(cfg.StripGPS, cfg.DefaultTimezone)
+	if cfg.StripGPS {
+		services.ClearLocations(context.Background(), db)
+	}
+	if unknown := services.UnknownExifFields(cfg.ExifPrivateFields); len(unknown) > 0 {
+		log.Printf("EXIF_PRIVATE_FIELDS: ignoring unknown fields %s", strings.Join(unknown, ", "))
+	}
+	scanService := services.NewScannerService(db, thumbService, exifService, cfg.MediaRoot, cfg.ScanWorkers, cfg.ScanIgnore)
+	settingsService := services.NewSettingsService(db)
+	backupService := services.NewBackupService(db, filepath.Join(cfg.CacheDir, "backups"), cfg.BackupInterval, cfg.BackupKeep, cfg.BackupMaxAge)
+
+	warningsService := services.NewWarningsService(
+		services.NewDiskSpaceCheck(cfg.MediaRoot, cfg.CacheDir, cfg.DiskReserveBytes),
+		services.NewExiftoolCheck(exifService),
+		services.NewScanErrorsCheck(scanService),
+		services.NewFailedThumbnailsCheck(db),
+		services.NewSluglessPhotosCheck(db),
+		services.NewOrphanedCacheCheck(db, thumbService),
+		services.NewBackupCheck(backupService),
+	)
+
+	lifecycle := services.NewLifecycle()
+	// In the background so the listener binds right away; /readyz reports
+	// when it is done.
+	lifecycle.Go("cache-prewarm", thumbService.PrewarmCache)
+	lifecycle.Go("warnings", func(ctx context.Context) {
+		warningsService.Run(ctx, 15*time.Minute)
+	})
+	lifecycle.Go("cache-janitor", thumbService.RunCacheJanitor)
+	lifecycle.Go("backups", backupService.Run)
+	if cfg.WatchMedia {
+		lifecycle.Go("media-watcher", services.NewMediaWatcher(scanService, cfg.MediaRoot, 3*time.Second).Run)
+	}
+	lifecycle.OnStop("exiftool", exifService.Close)
+
+	h := New(db, cfg, thumbService, scanService, settingsService, warningsService, backupService, lifecycle, webFS)
+	lifecycle.Go("upload-janitor", h.RunUploadJanitor)
+
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	return h, LoggingMiddleware(h.siteAuth(mux), cfg.LogAssetSample), lifecycle
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/services"
+)
+
+const (
+	prefsCookie    = "photodock_prefs"
+	defaultPerPage = 100
+	minPerPage     = 10
+	maxPerPage     = 500
+	defaultDensity = "small"
+	settingPerPage = "viewer.per_page"
+	settingDensity = "viewer.density"
+
+	settingAutoFilePattern = "upload.autofile_pattern"
+)
+
+type ViewerPrefs struct {
+	PerPage   int
+	ThumbSize string
+	Sort      string
+}
+
+func clampPerPage(n int) int {
+	if n < minPerPage {
+		return minPerPage
+	}
+	if n > maxPerPage {
+		return maxPerPage
+	}
+	return n
+}
+
+func normalizeDensity(d string) string {
+	if d == "medium" {
+		return "medium"
+	}
+	return defaultDensity
+}
+
+func (h *Handlers) viewerPrefs(r *http.Request) ViewerPrefs {
+	ctx := r.Context()
+	prefs := ViewerPrefs{
+		PerPage:   clampPerPage(h.settings.GetInt(ctx, settingPerPage, defaultPerPage)),
+		ThumbSize: normalizeDensity(h.settings.Get(ctx, settingDensity, defaultDensity)),
+	}
+
+	c, err := r.Cookie(prefsCookie)
+	if err != nil {
+		return prefs
+	}
+	values, err := url.ParseQuery(c.Value)
+	if err != nil {
+		return prefs
+	}
+	if n, err := strconv.Atoi(values.Get("per_page")); err == nil {
+		prefs.PerPage = clampPerPage(n)
+	}
+	if d := values.Get("density"); d != "" {
+		prefs.ThumbSize = normalizeDensity(d)
+	}
+	prefs.Sort = normalizeSort(values.Get("sort"))
+	return prefs
+}
+
+func perPageOptions(current int) []int {
+	opts := make([]int, 0, 6)
+	inserted := false
+	for _, n := range []int{25, 50, 100, 200, 500} {
+		if !inserted && current <= n {
+			if current != n {
+				opts = append(opts, current)
+			}
+			inserted = true
+		}
+		opts = append(opts, n)
+	}
+	if !inserted {
+		opts = append(opts, current)
+	}
+	return opts
+}
+
+func pageCount(total, perPage int) int {
+	if total <= 0 {
+		return 1
+	}
+	return (total + perPage - 1) / perPage
+}
+
+func (h *Handlers) adminSettings(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	h.renderAdmin(w, r, "admin/settings.html", map[string]interface{}{
+		"PerPage":     clampPerPage(h.settings.GetInt(ctx, settingPerPage, defaultPerPage)),
+		"Density":     normalizeDensity(h.settings.Get(ctx, settingDensity, defaultDensity)),
+		"MinPerPage":  minPerPage,
+		"MaxPerPage":  maxPerPage,
+		"AutoFile":    h.settings.Get(ctx, settingAutoFilePattern, services.DefaultAutoFilePattern),
+		"ContinueNav": h.settings.GetBool(ctx, settingContinueNav, false),
+		"Title":       "Settings",
+	})
+}
+
+func (h *Handlers) adminUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if v := r.FormValue("per_page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid per_page", 400)
+			return
+		}
+		if err := h.settings.Set(ctx, settingPerPage, strconv.Itoa(clampPerPage(n))); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+
+	if v := r.FormValue("density"); v != "" {
+		if err := h.settings.Set(ctx, settingDensity, normalizeDensity(v)); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+
+	if v := r.FormValue("continue_nav"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "invalid continue_nav", 400)
+			return
+		}
+		if err := h.settings.Set(ctx, settingContinueNav, strconv.FormatBool(enabled)); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+
+	if _, ok := r.Form["autofile_pattern"]; ok {
+		pattern := strings.Trim(strings.TrimSpace(r.FormValue("autofile_pattern")), "/")
+		if services.AutoFilePath(pattern, time.Time{}, nil) == "" {
+			http.Error(w, "auto-file pattern produces no folder", 400)
+			return
+		}
+		if err := h.settings.Set(ctx, settingAutoFilePattern, pattern); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/admin/settings", http.StatusSeeOther)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/models"
+	"github.com/Alexander-D-Karpov/photodock/internal/services"
+)
+
+// Link previews use the medium thumbnail, which is large enough for
+// every unfurler and fast to fetch.
+const shareThumbSize = "medium"
+
+// Thumbnails keep the aspect ratio at the size's width.
+func (h *Handlers) shareThumbDims(width, height int) (int, int) {
+	spec, ok := h.cfg.ThumbSizes[shareThumbSize]
+	if !ok || width <= 0 || height <= 0 {
+		return 0, 0
+	}
+	return spec.Width, (height*spec.Width + width/2) / width
+}
+
+func photoPageURL(photo *models.Photo) string {
+	if photo.URLPath != "" {
+		return "/p/" + escapeURLPath(photo.URLPath)
+	}
+	return fmt.Sprintf("/photo/%d", photo.ID)
+}
+
+var errNotPhotoURL = errors.New("not a photo URL on this site")
+
+func (h *Handlers) photoFromShareURL(r *http.Request, raw string) (*models.Photo, error) {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() {
+		return nil, errNotPhotoURL
+	}
+	base, _ := url.Parse(h.baseURL(r))
+	if !strings.EqualFold(u.Host, base.Host) {
+		return nil, errNotPhotoURL
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	if rest, ok := strings.CutPrefix(path, "/photo/"); ok {
+		id, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, errNotPhotoURL
+		}
+		return h.getPhotoByID(r.Context(), id)
+	}
+	if rest, ok := strings.CutPrefix(path, "/p/"); ok && rest != "" {
+		return h.getPhotoByURLPath(r.Context(), services.NormalizePath(rest))
+	}
+	return nil, errNotPhotoURL
+}
+
+func (h *Handlers) oembed(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if f := q.Get("format"); f != "" && f != "json" {
+		http.Error(w, "only json is supported", http.StatusNotImplemented)
+		return
+	}
+
+	photo, err := h.photoFromShareURL(r, q.Get("url"))
+	if err != nil || !h.canView(r, photo.LockedBy) {
+		http.NotFound(w, r)
+		return
+	}
+
+	size := shareThumbSize
+	width, height := h.shareThumbDims(photo.Width, photo.Height)
+	maxWidth, _ := strconv.Atoi(q.Get("maxwidth"))
+	maxHeight, _ := strconv.Atoi(q.Get("maxheight"))
+	if (maxWidth > 0 && width > maxWidth) || (maxHeight > 0 && height > maxHeight) {
+		if spec, ok := h.cfg.ThumbSizes["small"]; ok && photo.Width > 0 {
+			size = "small"
+			width, height = spec.Width, (photo.Height*spec.Width+photo.Width/2)/photo.Width
+		}
+	}
+
+	title := photo.Filename
+	if photo.Title.Valid && photo.Title.String != "" {
+		title = photo.Title.String
+	}
+	base := h.baseURL(r)
+	resp := map[string]interface{}{
+		"version":       "1.0",
+		"type":          "photo",
+		"title":         title,
+		"url":           base + mediaURL("thumb/"+size, photo.ID, photo.Version),
+		"width":         width,
+		"height":        height,
+		"provider_name": "PhotoDock",
+		"provider_url":  base + "/",
+	}
+	h.jsonResponse(w, resp)
+}
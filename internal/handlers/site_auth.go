@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	siteCookie = "photodock_site"
+	siteTTL    = 30 * 24 * time.Hour
+)
+
+// Admin routes check their own auth.
+var siteOpenPaths = []string{"/healthz", "/readyz", "/robots.txt", "/login", "/static/css/public.css", "/static/css/admin.css"}
+
+func siteOpen(path string) bool {
+	return slices.Contains(siteOpenPaths, path) || path == "/admin" || strings.HasPrefix(path, "/admin/")
+}
+
+// Media fails closed with a 401 instead of a redirect, so hotlinked
+// images get nothing.
+func (h *Handlers) siteAuth(next http.Handler) http.Handler {
+	if h.cfg.SitePassword == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if siteOpen(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !h.validSiteSession(r) && !h.isAdmin(r) {
+			w.Header().Set("Cache-Control", "private, no-store")
+			if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+				http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(&privateWriter{ResponseWriter: w}, r)
+	})
+}
+
+// The site credentials are signed too, so changing them signs everyone
+// out.
+func (h *Handlers) siteSig(expiry string) string {
+	digest := sha256.Sum256([]byte(h.cfg.SiteUser + "\x00" + h.cfg.SitePassword))
+	return h.sign("site", hex.EncodeToString(digest[:]), expiry)
+}
+
+func (h *Handlers) validSiteSession(r *http.Request) bool {
+	c, err := r.Cookie(siteCookie)
+	if err != nil {
+		return false
+	}
+	exp, sig, _ := strings.Cut(c.Value, ".")
+	expiry, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || expiry < time.Now().Unix() {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(h.siteSig(exp)))
+}
+
+func (h *Handlers) trySiteCredentials(r *http.Request, user, pass string) bool {
+	ip := h.clientIP(r)
+	if h.authFails.retryAfter(ip) > 0 {
+		return false
+	}
+	if digestEqual(user, h.cfg.SiteUser) && digestEqual(pass, h.cfg.SitePassword) {
+		h.authFails.succeed(ip)
+		return true
+	}
+	if h.authFails.fail(ip, user, pass) {
+		log.Printf("auth: locked out %s for %s after %d failed site logins", ip, h.cfg.AuthLockout, h.cfg.AuthMaxFailures)
+	}
+	return false
+}
+
+func (h *Handlers) siteLoginPage(w http.ResponseWriter, r *http.Request) {
+	next := safeNext(r.URL.Query().Get("next"))
+	if h.cfg.SitePassword == "" || h.validSiteSession(r) {
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+	h.renderSiteLogin(w, next, http.StatusOK, "")
+}
+
+func (h *Handlers) renderSiteLogin(w http.ResponseWriter, next string, status int, errMsg string) {
+	w.Header().Set("Cache-Control", "private, no-store")
+	h.renderStatus(w, status, "public/login.html", map[string]interface{}{
+		"Title":    "Log in",
+		"Next":     next,
+		"Error":    errMsg,
+		"WithUser": h.cfg.SiteUser != "",
+	})
+}
+
+func (h *Handlers) siteLogin(w http.ResponseWriter, r *http.Request) {
+	next := safeNext(r.FormValue("next"))
+	if h.cfg.SitePassword == "" {
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+	if h.authLockedOut(w, r) {
+		h.renderSiteLogin(w, next, http.StatusTooManyRequests, "Too many failed attempts. Try again later.")
+		return
+	}
+	if !h.trySiteCredentials(r, r.FormValue("username"), r.FormValue("password")) {
+		h.renderSiteLogin(w, next, http.StatusUnauthorized, "Wrong password.")
+		return
+	}
+
+	expires := time.Now().Add(siteTTL)
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     siteCookie,
+		Value:    exp + "." + h.siteSig(exp),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   h.secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// privateWriter keeps responses behind the visitor login out of shared
+// caches, whatever Cache-Control the handler chose.
+type privateWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (pw *privateWriter) WriteHeader(code int) {
+	if !pw.wroteHeader {
+		pw.wroteHeader = true
+		if pw.Header().Get("Cache-Control") == "" {
+			pw.Header().Set("Cache-Control", "private")
+		} else {
+			privateCache(pw.ResponseWriter)
+		}
+	}
+	pw.ResponseWriter.WriteHeader(code)
+}
+
+func (pw *privateWriter) Write(b []byte) (int, error) {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	return pw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the connection's writer.
+func (pw *privateWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
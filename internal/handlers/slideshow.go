@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/models"
+)
+
+const (
+	defaultSlideshowInterval = 5
+	slideshowBatch           = 20
+	maxSlideshowBatch        = 100
+)
+
+var slideshowOrders = map[string]string{
+	"date-desc": "COALESCE(p.taken_at, p.created_at) DESC, p.id DESC",
+	"date-asc":  "COALESCE(p.taken_at, p.created_at) ASC, p.id ASC",
+	"name-asc":  "p.filename ASC, p.id ASC",
+	"name-desc": "p.filename DESC, p.id DESC",
+	"size-desc": "p.size_bytes DESC, p.id DESC",
+	"size-asc":  "p.size_bytes ASC, p.id ASC",
+}
+
+type slideshowPhoto struct {
+	ID         int    `json:"id"`
+	Title      string `json:"title"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	URL        string `json:"url"`
+	Medium     string `json:"medium"`
+	Large      string `json:"large"`
+	DurationMS int    `json:"duration_ms"`
+}
+
+func (h *Handlers) renderSlideshow(w http.ResponseWriter, r *http.Request, folder *models.Folder) {
+	if !h.canView(r, folder.LockedBy) {
+		h.renderUnlock(w, r, int(folder.LockedBy.Int64), r.URL.RequestURI(), false)
+		return
+	}
+	h.render(w, "public/slideshow.html", map[string]interface{}{
+		"Folder":    *folder,
+		"FolderURL": "/p/" + escapeURLPath(folder.Path) + "/",
+		"Title":     folder.Name + " - Slideshow",
+		"Noindex":   h.folderNoindex(r.Context(), w, folder.ID),
+	})
+}
+
+func (h *Handlers) apiSlideshow(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	folderID, _ := strconv.Atoi(r.PathValue("folder_id"))
+	q := r.URL.Query()
+
+	var interval *int
+	if err := h.db.Pool().QueryRow(ctx,
+		"SELECT slideshow_interval FROM folders WHERE id = $1 AND draft = false AND photodock_live(live_from, live_until)", folderID).Scan(&interval); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	durationMS := defaultSlideshowInterval * 1000
+	if interval != nil && *interval > 0 {
+		durationMS = *interval * 1000
+	}
+
+	order, ok := slideshowOrders[q.Get("sort")]
+	if !ok {
+		order = slideshowOrders["date-desc"]
+	}
+
+	scope := "p.folder_id = $1"
+	if q.Get("recursive") == "1" {
+		scope = `p.folder_id IN (
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM folders WHERE id = $1
+				UNION ALL
+				SELECT f.id FROM folders f JOIN subtree s ON f.parent_id = s.id WHERE f.draft = false AND photodock_live(f.live_from, f.live_until)
+			)
+			SELECT id FROM subtree)`
+	}
+
+	// Only IDs are ordered here so shuffling a large folder stays cheap; the
+	// page's details are fetched separately below. Photos of protected
+	// folders the visitor hasn't unlocked are left out.
+	rows, err := h.db.Pool().Query(ctx, fmt.Sprintf(
+		"SELECT p.id FROM photos p WHERE %s AND p.hidden = false AND p.draft = false AND photodock_live(p.live_from, p.live_until)%s ORDER BY %s", scope, h.lockFilter(r, "p.locked_by"), order), folderID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	var seed int64
+	if q.Get("shuffle") == "1" {
+		seed, err = strconv.ParseInt(q.Get("seed"), 10, 64)
+		if err != nil {
+			seed = time.Now().UnixNano()
+		}
+		rng := rand.New(rand.NewSource(seed))
+		rng.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	}
+
+	cursor, _ := strconv.Atoi(q.Get("cursor"))
+	if cursor < 0 || cursor > len(ids) {
+		cursor = 0
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 {
+		limit = slideshowBatch
+	}
+	if limit > maxSlideshowBatch {
+		limit = maxSlideshowBatch
+	}
+	end := cursor + limit
+	if end > len(ids) {
+		end = len(ids)
+	}
+	page := ids[cursor:end]
+
+	byID := make(map[int]slideshowPhoto, len(page))
+	if len(page) > 0 {
+		rows, err := h.db.Pool().Query(ctx,
+			`SELECT id, COALESCE(title, filename), COALESCE(width, 0), COALESCE(height, 0), COALESCE(url_path, ''), version
+			FROM photos WHERE id = ANY($1)`, page)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		for rows.Next() {
+			var p slideshowPhoto
+			var urlPath string
+			var version int
+			if err := rows.Scan(&p.ID, &p.Title, &p.Width, &p.Height, &urlPath, &version); err != nil {
+				continue
+			}
+			p.URL = fmt.Sprintf("/photo/%d", p.ID)
+			if urlPath != "" {
+				p.URL = "/p/" + escapeURLPath(urlPath)
+			}
+			p.Medium = mediaURL("thumb/medium", p.ID, version)
+			p.Large = mediaURL("thumb/large", p.ID, version)
+			p.DurationMS = durationMS
+			byID[p.ID] = p
+		}
+		rows.Close()
+	}
+
+	photos := make([]slideshowPhoto, 0, len(page))
+	for _, id := range page {
+		if p, ok := byID[id]; ok {
+			photos = append(photos, p)
+		}
+	}
+
+	var nextCursor *int
+	if end < len(ids) {
+		nextCursor = &end
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	h.jsonResponse(w, map[string]interface{}{
+		"photos":      photos,
+		"next_cursor": nextCursor,
+		"total":       len(ids),
+		"seed":        seed,
+		"duration_ms": durationMS,
+	})
+}
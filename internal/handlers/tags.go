@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handlers) allTags(ctx context.Context) []string {
+	rows, err := h.db.Pool().Query(ctx, "SELECT name FROM tags ORDER BY lower(name)")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var tags []string
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			tags = append(tags, name)
+		}
+	}
+	return tags
+}
+
+func (h *Handlers) publicTag(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prefs := h.viewerPrefs(r)
+
+	var tagID int
+	var name string
+	if err := h.db.Pool().QueryRow(ctx, "SELECT id, name FROM tags WHERE lower(name) = lower($1)", r.PathValue("name")).Scan(&tagID, &name); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	where := fmt.Sprintf("id IN (SELECT photo_id FROM photo_tags WHERE tag_id = %d) AND hidden = false AND draft = false AND photodock_live(live_from, live_until)", tagID) + h.lockFilter(r, "locked_by")
+	var photoTotal int
+	_ = h.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM photos WHERE "+where).Scan(&photoTotal)
+	// A tag whose photos are all hidden doesn't exist as far as the public
+	// side is concerned.
+	if photoTotal == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	totalPages := pageCount(photoTotal, prefs.PerPage)
+	if page > totalPages {
+		page = totalPages
+	}
+	photos, _ := h.getPhotosPage(ctx, where, prefs.PerPage, (page-1)*prefs.PerPage)
+
+	h.render(w, "public/tag.html", map[string]interface{}{
+		"Tag":        name,
+		"Photos":     photos,
+		"Title":      "#" + name,
+		"Prefs":      prefs,
+		"Page":       page,
+		"TotalPages": totalPages,
+		"PhotoTotal": photoTotal,
+	})
+}
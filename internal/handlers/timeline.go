@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/models"
+)
+
+// Undated photos come after every dated one, ordered by when they were
+// added.
+type timelineCursor struct {
+	Time    time.Time
+	ID      int
+	Undated bool
+}
+
+// Anything malformed starts from the newest photo.
+func parseTimelineCursor(r *http.Request) (timelineCursor, bool) {
+	q := r.URL.Query()
+	c := timelineCursor{Undated: q.Get("undated") == "1"}
+	ts, id, ok := strings.Cut(q.Get("before"), ",")
+	if !ok {
+		return c, false
+	}
+	micros, err1 := strconv.ParseInt(ts, 10, 64)
+	n, err2 := strconv.Atoi(id)
+	if err1 != nil || err2 != nil {
+		return c, false
+	}
+	c.Time, c.ID = time.UnixMicro(micros), n
+	return c, true
+}
+
+func (c timelineCursor) Query() template.URL {
+	q := fmt.Sprintf("before=%d,%d", c.Time.UnixMicro(), c.ID)
+	if c.Undated {
+		q += "&undated=1"
+	}
+	return template.URL(q)
+}
+
+type timelineDay struct {
+	Label  string
+	Anchor string
+	Photos []models.Photo
+}
+
+type timelineMonth struct {
+	Label string
+	Count int
+	Query template.URL
+}
+
+type timelineYear struct {
+	Year   int
+	Months []timelineMonth
+}
+
+func (h *Handlers) publicTimeline(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prefs := h.viewerPrefs(r)
+	visible := "hidden = false AND draft = false AND photodock_live(live_from, live_until)" + h.lockFilter(r, "locked_by")
+	cursor, paged := parseTimelineCursor(r)
+
+	// One extra row tells whether there is a next page.
+	limit := prefs.PerPage + 1
+	var photos []models.Photo
+	if !cursor.Undated {
+		where := visible + " AND taken_at IS NOT NULL"
+		args := []interface{}{}
+		if paged {
+			where += " AND (taken_at, id) < ($1, $2)"
+			args = append(args, cursor.Time, cursor.ID)
+		}
+		photos, _ = h.getPhotosPageOrdered(ctx, where, "taken_at DESC, id DESC", limit, 0, args...)
+	}
+	if len(photos) < limit {
+		where := visible + " AND taken_at IS NULL"
+		args := []interface{}{}
+		if paged && cursor.Undated {
+			where += " AND (created_at, id) < ($1, $2)"
+			args = append(args, cursor.Time, cursor.ID)
+		}
+		undated, _ := h.getPhotosPageOrdered(ctx, where, "created_at DESC, id DESC", limit-len(photos), 0, args...)
+		photos = append(photos, undated...)
+	}
+
+	var next template.URL
+	if len(photos) == limit {
+		photos = photos[:prefs.PerPage]
+		last := photos[len(photos)-1]
+		c := timelineCursor{Time: last.CreatedAt, ID: last.ID, Undated: true}
+		if last.TakenAt.Valid {
+			c = timelineCursor{Time: last.TakenAt.Time, ID: last.ID}
+		}
+		next = c.Query()
+	}
+
+	h.render(w, "public/timeline.html", map[string]interface{}{
+		"Days":  h.timelineDays(photos),
+		"Years": h.timelineYears(ctx, visible),
+		"Next":  next,
+		"Paged": paged || cursor.Undated,
+		"Title": "Timeline",
+		"Prefs": prefs,
+	})
+}
+
+// Days are in DEFAULT_TIMEZONE.
+func (h *Handlers) timelineDays(photos []models.Photo) []timelineDay {
+	var days []timelineDay
+	for _, p := range photos {
+		label, anchor := "No date", "no-date"
+		if p.TakenAt.Valid {
+			t := p.TakenAt.Time.In(h.cfg.DefaultTimezone)
+			label, anchor = t.Format("Monday, 2 January 2006"), t.Format("2006-01-02")
+		}
+		if len(days) == 0 || days[len(days)-1].Anchor != anchor {
+			days = append(days, timelineDay{Label: label, Anchor: anchor})
+		}
+		days[len(days)-1].Photos = append(days[len(days)-1].Photos, p)
+	}
+	return days
+}
+
+func (h *Handlers) timelineYears(ctx context.Context, visible string) []timelineYear {
+	tz := h.cfg.DefaultTimezone
+	rows, err := h.db.Pool().Query(ctx, `
+		SELECT date_trunc('month', taken_at AT TIME ZONE $1) m, COUNT(*)
+		FROM photos WHERE taken_at IS NOT NULL AND `+visible+`
+		GROUP BY m ORDER BY m DESC`, tz.String())
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var years []timelineYear
+	for rows.Next() {
+		var month time.Time
+		var count int
+		if rows.Scan(&month, &count) != nil {
+			continue
+		}
+		end := time.Date(month.Year(), month.Month()+1, 1, 0, 0, 0, 0, tz)
+		m := timelineMonth{
+			Label: month.Format("January"),
+			Count: count,
+			Query: timelineCursor{Time: end}.Query(),
+		}
+		if len(years) == 0 || years[len(years)-1].Year != month.Year() {
+			years = append(years, timelineYear{Year: month.Year()})
+		}
+		years[len(years)-1].Months = append(years[len(years)-1].Months, m)
+	}
+	return years
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestChunkIndexBounded(t *testing.T) {
+	app := newTestApp(t)
+
+	for name, body := range map[string]string{
+		"no total_chunks": `{"filename":"a.jpg","size":3000000}`,
+		"no size":         `{"filename":"a.jpg","total_chunks":3}`,
+		"too many chunks": `{"filename":"a.jpg","size":3000000,"total_chunks":1000000000}`,
+		"negative chunks": `{"filename":"a.jpg","size":3000000,"total_chunks":-1}`,
+	} {
+		if w := app.admin(http.MethodPost, "/admin/upload/init", strings.NewReader(body)); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d, want 400", name, w.Code)
+		}
+	}
+
+	w := app.admin(http.MethodPost, "/admin/upload/init", strings.NewReader(`{"filename":"a.jpg","size":3000000,"total_chunks":3}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("init: %d %s", w.Code, w.Body)
+	}
+	var init struct {
+		UploadID string `json:"upload_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &init); err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range []string{"3", "1000000000"} {
+		code := app.postForm("/admin/upload/chunk", []formPart{
+			{field: "upload_id", value: init.UploadID},
+			{field: "chunk_index", value: index},
+			{field: "chunk", filename: "blob", data: []byte("data")},
+		})
+		if code != http.StatusBadRequest {
+			t.Errorf("chunk %s: %d, want 400", index, code)
+		}
+	}
+}
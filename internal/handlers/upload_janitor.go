@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const uploadJanitorInterval = 10 * time.Minute
+
+func (h *Handlers) uploadsDir() string {
+	return filepath.Join(h.cfg.CacheDir, "uploads")
+}
+
+// RunUploadJanitor discards chunked uploads that were never finished,
+// such as those of a closed browser tab.
+func (h *Handlers) RunUploadJanitor(ctx context.Context) {
+	h.sweepUploadsDir()
+	ticker := time.NewTicker(uploadJanitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.expireUploads()
+		}
+	}
+}
+
+func (h *Handlers) expireUploads() {
+	cutoff := time.Now().Add(-h.cfg.UploadTTL)
+	var expired []*ChunkedUpload
+	h.uploadsMux.Lock()
+	for id, upload := range h.uploads {
+		if upload.CreatedAt.Before(cutoff) {
+			expired = append(expired, upload)
+			delete(h.uploads, id)
+		}
+	}
+	h.uploadsMux.Unlock()
+
+	for _, upload := range expired {
+		_ = os.RemoveAll(upload.TempDir)
+	}
+	if len(expired) > 0 {
+		log.Printf("uploads: discarded %d unfinished uploads", len(expired))
+	}
+}
+
+// Auto-file temp files go once no request can still be writing them.
+func (h *Handlers) sweepUploadsDir() {
+	entries, err := os.ReadDir(h.uploadsDir())
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-h.cfg.UploadTTL)
+	removed, restored := 0, 0
+	for _, e := range entries {
+		path := filepath.Join(h.uploadsDir(), e.Name())
+		if e.IsDir() {
+			h.uploadsMux.Lock()
+			_, live := h.uploads[e.Name()]
+			if !live {
+				if upload := loadUpload(path); upload != nil && upload.CreatedAt.After(cutoff) {
+					h.uploads[upload.ID] = upload
+					live = true
+					restored++
+				}
+			}
+			h.uploadsMux.Unlock()
+			if live {
+				continue
+			}
+		} else if info, err := e.Info(); err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if os.RemoveAll(path) == nil {
+			removed++
+		}
+	}
+	if removed > 0 || restored > 0 {
+		log.Printf("uploads: picked up %d unfinished uploads, removed %d leftovers from %s", restored, removed, h.uploadsDir())
+	}
+}
+
+func (h *Handlers) adminUploadCancel(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	h.uploadsMux.Lock()
+	upload, exists := h.uploads[id]
+	delete(h.uploads, id)
+	h.uploadsMux.Unlock()
+
+	if !exists {
+		http.Error(w, "Upload not found", 404)
+		return
+	}
+	_ = os.RemoveAll(upload.TempDir)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const uploadStateFile = "upload.json"
+
+type uploadState struct {
+	ID          string    `json:"id"`
+	Filename    string    `json:"filename"`
+	Size        int64     `json:"size"`
+	TotalChunks int       `json:"total_chunks,omitempty"`
+	SHA256      string    `json:"sha256,omitempty"`
+	FolderID    *int      `json:"folder_id"`
+	Dirs        []string  `json:"dirs,omitempty"`
+	AutoFile    bool      `json:"auto_file,omitempty"`
+	Staged      string    `json:"staged,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// The chunks received aren't part of it: they are the chunk files
+// present.
+func (h *Handlers) saveUploadState(upload *ChunkedUpload) error {
+	h.uploadsMux.RLock()
+	state := uploadState{
+		ID:          upload.ID,
+		Filename:    upload.Filename,
+		Size:        upload.Size,
+		TotalChunks: upload.TotalChunks,
+		SHA256:      upload.SHA256,
+		FolderID:    upload.FolderID,
+		Dirs:        upload.Dirs,
+		AutoFile:    upload.AutoFile,
+		CreatedAt:   upload.CreatedAt,
+	}
+	if upload.Staged != "" {
+		state.Staged = filepath.Base(upload.Staged)
+	}
+	h.uploadsMux.RUnlock()
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(upload.TempDir, uploadStateFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func loadUpload(dir string) *ChunkedUpload {
+	b, err := os.ReadFile(filepath.Join(dir, uploadStateFile))
+	if err != nil {
+		return nil
+	}
+	var state uploadState
+	if json.Unmarshal(b, &state) != nil || state.ID != filepath.Base(dir) || state.TotalChunks < 1 {
+		return nil
+	}
+
+	upload := &ChunkedUpload{
+		ID:          state.ID,
+		Filename:    sanitizeFilename(state.Filename),
+		Size:        state.Size,
+		TotalChunks: state.TotalChunks,
+		SHA256:      state.SHA256,
+		FolderID:    state.FolderID,
+		Dirs:        state.Dirs,
+		AutoFile:    state.AutoFile,
+		TempDir:     dir,
+		Chunks:      make(map[int]bool),
+		CreatedAt:   state.CreatedAt,
+	}
+	if state.Staged != "" {
+		staged := filepath.Join(dir, filepath.Base(state.Staged))
+		if _, err := os.Stat(staged); err != nil {
+			return nil
+		}
+		upload.Staged = staged
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		if n, ok := strings.CutPrefix(e.Name(), "chunk_"); ok {
+			// Interrupted writes end in .part and don't parse.
+			if i, err := strconv.Atoi(n); err == nil && i >= 0 && i < upload.TotalChunks {
+				upload.Chunks[i] = true
+			}
+		}
+	}
+	return upload
+}
+
+func (h *Handlers) adminUploadStatus(w http.ResponseWriter, r *http.Request) {
+	h.uploadsMux.RLock()
+	upload, exists := h.uploads[r.PathValue("id")]
+	received := []int{}
+	staged := false
+	if exists {
+		for i := range upload.Chunks {
+			received = append(received, i)
+		}
+		staged = upload.Staged != ""
+	}
+	h.uploadsMux.RUnlock()
+
+	if !exists {
+		http.Error(w, "Upload not found", 404)
+		return
+	}
+	sort.Ints(received)
+	h.jsonResponse(w, map[string]interface{}{
+		"upload_id":    upload.ID,
+		"filename":     upload.Filename,
+		"size":         upload.Size,
+		"total_chunks": upload.TotalChunks,
+		"received":     received,
+		"staged":       staged,
+	})
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/services"
+)
+
+type uploadPreview struct {
+	UploadID    string        `json:"upload_id"`
+	Filename    string        `json:"filename"`
+	Destination string        `json:"destination,omitempty"`
+	Renamed     bool          `json:"renamed"`
+	Size        int64         `json:"size"`
+	TakenAt     *time.Time    `json:"taken_at,omitempty"`
+	Camera      string        `json:"camera,omitempty"`
+	Lens        string        `json:"lens,omitempty"`
+	StripsGPS   bool          `json:"strips_gps"`
+	DuplicateOf *duplicateRef `json:"duplicate_of,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+type uploadCommit struct {
+	UploadID    string        `json:"upload_id"`
+	Destination string        `json:"destination,omitempty"`
+	DuplicateOf *duplicateRef `json:"duplicate_of,omitempty"`
+	PhotoID     int           `json:"photo_id,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+func (h *Handlers) adminUploadPreview(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UploadIDs []string `json:"upload_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	ctx := r.Context()
+	reserved := make(map[string]bool)
+	previews := make([]uploadPreview, 0, len(req.UploadIDs))
+
+	for _, id := range req.UploadIDs {
+		p := uploadPreview{UploadID: id}
+
+		h.uploadsMux.RLock()
+		upload, exists := h.uploads[id]
+		h.uploadsMux.RUnlock()
+		if !exists {
+			p.Error = "upload not found"
+			previews = append(previews, p)
+			continue
+		}
+		p.Filename = upload.Filename
+
+		staged, err := h.stageUpload(upload)
+		if err != nil {
+			p.Error = err.Error()
+			previews = append(previews, p)
+			continue
+		}
+		if info, err := os.Stat(staged); err == nil {
+			p.Size = info.Size()
+		}
+
+		exifInfo, takenAt, hasGPS := h.scanSvc.InspectFile(staged)
+		if exifInfo != nil {
+			p.Camera = strings.TrimSpace(exifInfo.CameraMake + " " + exifInfo.CameraModel)
+			p.Lens = exifInfo.LensModel
+		}
+		if !takenAt.IsZero() {
+			p.TakenAt = &takenAt
+		}
+		p.StripsGPS = hasGPS
+		if sum, err := services.HashFile(staged); err == nil {
+			p.DuplicateOf = h.duplicateOf(ctx, sum)
+		}
+
+		destFolder := filepath.Join(append([]string{h.uploadFolderPath(ctx, upload.FolderID)}, upload.Dirs...)...)
+		if upload.AutoFile {
+			destFolder = h.autoFileFolder(ctx, destFolder, takenAt, exifInfo)
+		}
+		relPath := filepath.Join(destFolder, upload.Filename)
+		wanted := filepath.Join(h.cfg.MediaRoot, relPath)
+		dest := h.resolveConflictReserved(wanted, reserved)
+		reserved[dest] = true
+		p.Destination, _ = filepath.Rel(h.cfg.MediaRoot, dest)
+		p.Renamed = dest != wanted
+
+		previews = append(previews, p)
+	}
+
+	h.jsonResponse(w, map[string]interface{}{"files": previews})
+}
+
+func (h *Handlers) adminUploadConfirm(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UploadIDs []string `json:"upload_ids"`
+		Action    string   `json:"action"`
+		Force     bool     `json:"force"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	if req.Action != "commit" && req.Action != "discard" {
+		http.Error(w, "action must be commit or discard", 400)
+		return
+	}
+
+	if req.Action == "commit" {
+		var total int64
+		h.uploadsMux.RLock()
+		for _, id := range req.UploadIDs {
+			if upload, ok := h.uploads[id]; ok {
+				total += upload.Size
+			}
+		}
+		h.uploadsMux.RUnlock()
+
+		if err := h.checkDiskSpace(total); err != nil {
+			http.Error(w, err.Error(), http.StatusInsufficientStorage)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	results := make([]uploadCommit, 0, len(req.UploadIDs))
+	var saved []string
+
+	for _, id := range req.UploadIDs {
+		res := uploadCommit{UploadID: id}
+
+		h.uploadsMux.Lock()
+		upload, exists := h.uploads[id]
+		if exists {
+			delete(h.uploads, id)
+		}
+		h.uploadsMux.Unlock()
+
+		if !exists {
+			res.Error = "upload not found"
+			results = append(results, res)
+			continue
+		}
+
+		if req.Action == "commit" {
+			relPath, sum, err := "", "", h.verifyUpload(upload)
+			if err == nil {
+				relPath, sum, err = h.commitUpload(ctx, upload, req.Force)
+			}
+			if err != nil {
+				res.Error = err.Error()
+			} else {
+				res.Destination = relPath
+				res.DuplicateOf = h.duplicateOf(ctx, sum)
+				saved = append(saved, relPath)
+			}
+		}
+
+		_ = os.RemoveAll(upload.TempDir)
+		results = append(results, res)
+	}
+
+	ids := h.processUploads(ctx, saved)
+	for i, j := 0, 0; i < len(results); i++ {
+		if results[i].Destination != "" {
+			results[i].PhotoID = ids[j]
+			j++
+		}
+	}
+	h.jsonResponse(w, map[string]interface{}{"files": results})
+}
+
+func (h *Handlers) stageUpload(upload *ChunkedUpload) (string, error) {
+	h.uploadsMux.RLock()
+	staged := upload.Staged
+	h.uploadsMux.RUnlock()
+	if staged != "" {
+		return staged, nil
+	}
+	chunks, err := h.uploadChunks(upload)
+	if err != nil {
+		return "", err
+	}
+
+	stagedPath := filepath.Join(upload.TempDir, "staged"+strings.ToLower(filepath.Ext(upload.Filename)))
+	dst, err := os.Create(stagedPath)
+	if err != nil {
+		return "", err
+	}
+
+	var written int64
+	hasher := sha256.New()
+	for i := 0; i < chunks; i++ {
+		chunk, err := os.Open(chunkPath(upload, i))
+		if err != nil {
+			_ = dst.Close()
+			_ = os.Remove(stagedPath)
+			return "", &missingChunksError{Missing: []int{i}}
+		}
+		n, err := io.Copy(io.MultiWriter(dst, hasher), chunk)
+		_ = chunk.Close()
+		if err != nil {
+			_ = dst.Close()
+			_ = os.Remove(stagedPath)
+			return "", err
+		}
+		written += n
+	}
+	if err := dst.Close(); err != nil {
+		return "", err
+	}
+
+	if upload.Size > 0 && written != upload.Size {
+		_ = os.Remove(stagedPath)
+		return "", fmt.Errorf("%w: have %d of %d bytes", errUploadMismatch, written, upload.Size)
+	}
+	if sum := hex.EncodeToString(hasher.Sum(nil)); upload.SHA256 != "" && sum != upload.SHA256 {
+		_ = os.Remove(stagedPath)
+		return "", fmt.Errorf("%w: SHA-256 is %s", errUploadMismatch, sum)
+	}
+
+	for i := 0; i < chunks; i++ {
+		_ = os.Remove(chunkPath(upload, i))
+	}
+
+	h.uploadsMux.Lock()
+	upload.Staged = stagedPath
+	h.uploadsMux.Unlock()
+	if err := h.saveUploadState(upload); err != nil {
+		log.Printf("uploads: saving state of %s: %v", upload.ID, err)
+	}
+	return stagedPath, nil
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const maxFormValue = 64 << 10
+
+var (
+	errInvalidFileType = errors.New("invalid file type")
+	errMissingFile     = errors.New("no file in the upload")
+	errFolderNotFound  = errors.New("folder not found")
+	errUploadPaths     = errors.New("paths must come before the files, one for each file")
+)
+
+// storeError is a failure to write an upload rather than a bad request.
+type storeError struct{ err error }
+
+func (e *storeError) Error() string { return e.err.Error() }
+func (e *storeError) Unwrap() error { return e.err }
+
+type rejectedUpload struct {
+	Filename string `json:"filename"`
+	Error    string `json:"error"`
+}
+
+func (h *Handlers) limitUpload(w http.ResponseWriter, r *http.Request) bool {
+	if limit := h.cfg.MaxUploadSize; limit > 0 {
+		if r.ContentLength > limit {
+			http.Error(w, fmt.Sprintf("Upload larger than %d bytes", limit), http.StatusRequestEntityTooLarge)
+			return false
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	r.Body = newProgressReader(w, r.Body)
+	return true
+}
+
+func tooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+func uploadStatus(err error) int {
+	var se *storeError
+	switch {
+	case tooLarge(err):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return http.StatusBadRequest
+	case errors.As(err, &se):
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+// Each file part goes to onFile with the fields sent before it, so
+// clients send fields such as folder_id first.
+func readUploadForm(r *http.Request, onFile func(field, filename string, part io.Reader, values url.Values) error) (url.Values, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	values := url.Values{}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return values, err
+		}
+		if part.FileName() == "" {
+			b, err := io.ReadAll(io.LimitReader(part, maxFormValue))
+			_ = part.Close()
+			if err != nil {
+				return values, err
+			}
+			values.Add(part.FormName(), string(b))
+			continue
+		}
+		err = onFile(part.FormName(), part.FileName(), part, values)
+		_ = part.Close()
+		if err != nil {
+			return values, err
+		}
+	}
+}
+
+func (h *Handlers) formFolderPath(ctx context.Context, values url.Values) string {
+	var folderPath string
+	if fidStr := values.Get("folder_id"); fidStr != "" && fidStr != "null" {
+		fid, _ := strconv.Atoi(fidStr)
+		_ = h.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", fid).Scan(&folderPath)
+	}
+	return folderPath
+}
+
+func formFlag(values url.Values, name string) bool {
+	v := values.Get(name)
+	return v == "on" || v == "true"
+}
+
+func (h *Handlers) streamUploadFile(r *http.Request, field string, folderPath func(url.Values) (string, error)) (string, string, error) {
+	ctx := r.Context()
+	var relPath, sum string
+	var found bool
+	_, err := readUploadForm(r, func(name, filename string, part io.Reader, values url.Values) error {
+		if name != field || found {
+			return nil
+		}
+		found = true
+		if !isImageFile(filename) {
+			return errInvalidFileType
+		}
+		folder, err := folderPath(values)
+		if err != nil {
+			return err
+		}
+		relPath, sum, err = h.storeUpload(ctx, folder, sanitizeFilename(filename), part, formFlag(values, "auto_file"), formFlag(values, "force"))
+		if err != nil {
+			return &storeError{err}
+		}
+		return nil
+	})
+	switch {
+	case relPath != "":
+		// Saved; anything wrong after the file doesn't undo that.
+		return relPath, sum, nil
+	case err != nil:
+		return "", "", err
+	case !found:
+		return "", "", errMissingFile
+	}
+	return relPath, sum, nil
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A ".." anywhere rejects the whole path.
+func uploadDirs(rel string) ([]string, error) {
+	segs := strings.FieldsFunc(rel, func(r rune) bool { return r == '/' || r == '\\' })
+	if len(segs) == 0 {
+		return nil, nil
+	}
+	var dirs []string
+	for _, seg := range segs[:len(segs)-1] {
+		switch strings.TrimSpace(seg) {
+		case "..":
+			return nil, fmt.Errorf("invalid path %q: .. is not allowed", rel)
+		case ".", "":
+			continue
+		}
+		dirs = append(dirs, sanitizeFilename(seg))
+	}
+	return dirs, nil
+}
+
+type uploadTree struct {
+	h        *Handlers
+	rootID   *int
+	rootPath string
+	folders  map[string]int
+	created  []string
+}
+
+func (h *Handlers) newUploadTree(ctx context.Context, folderID *int) *uploadTree {
+	t := &uploadTree{h: h, folders: make(map[string]int), created: []string{}}
+	if folderID != nil {
+		if h.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", *folderID).Scan(&t.rootPath) == nil {
+			t.rootID = folderID
+		}
+	}
+	return t
+}
+
+func formFolderID(values url.Values) *int {
+	if fid, err := strconv.Atoi(values.Get("folder_id")); err == nil {
+		return &fid
+	}
+	return nil
+}
+
+func (t *uploadTree) folder(ctx context.Context, dirs []string) (string, error) {
+	parentID, path := t.rootID, t.rootPath
+	for _, name := range dirs {
+		path = filepath.Join(path, name)
+		if id, ok := t.folders[path]; ok {
+			parentID = &id
+			continue
+		}
+		var existing int
+		known := t.h.db.Pool().QueryRow(ctx, "SELECT id FROM folders WHERE path = $1", path).Scan(&existing) == nil
+		id, err := t.h.createFolder(ctx, name, parentID, false)
+		if err != nil {
+			return "", err
+		}
+		if !known {
+			t.created = append(t.created, path)
+		}
+		t.folders[path] = id
+		parentID = &id
+	}
+	return path, nil
+}
+
+// Browsers' FormData conventions differ on the name.
+func uploadPaths(values url.Values) []string {
+	if paths := values["paths"]; len(paths) > 0 {
+		return paths
+	}
+	return values["paths[]"]
+}
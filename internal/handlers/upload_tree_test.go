@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/testutil"
+)
+
+func TestUploadDirs(t *testing.T) {
+	tests := []struct {
+		rel     string
+		want    []string
+		wantErr bool
+	}{
+		{"IMG_1.jpg", nil, false},
+		{"Trip/IMG_1.jpg", []string{"Trip"}, false},
+		{"Trip/Day 1/IMG_1.jpg", []string{"Trip", "Day 1"}, false},
+		{`Trip\Day 1\IMG_1.jpg`, []string{"Trip", "Day 1"}, false},
+		{"/Trip/./IMG_1.jpg", []string{"Trip"}, false},
+		{"Trip/../../etc/passwd", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := uploadDirs(tt.rel)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("uploadDirs(%q) error = %v", tt.rel, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("uploadDirs(%q) = %q, want %q", tt.rel, got, tt.want)
+		}
+	}
+}
+
+type formPart struct {
+	field, filename, value string
+	data                   []byte
+}
+
+func (a *testApp) postForm(path string, parts []formPart) int {
+	a.t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, p := range parts {
+		if p.filename == "" {
+			_ = mw.WriteField(p.field, p.value)
+			continue
+		}
+		fw, _ := mw.CreateFormFile(p.field, p.filename)
+		_, _ = fw.Write(p.data)
+	}
+	_ = mw.Close()
+
+	r, _ := http.NewRequest(http.MethodPost, path, &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r.Header.Set("Accept", "application/json")
+	r.SetBasicAuth(testAdminUser, testAdminPass)
+	return a.do(r).Code
+}
+
+func TestUploadKeepsDirectories(t *testing.T) {
+	app := newTestApp(t)
+	jpg := testutil.JPEG(64, 48, nil)
+
+	code := app.postForm("/admin/upload/file", []formPart{
+		{field: "path", value: "Trip/Day 1/a.jpg"},
+		{field: "file", filename: "a.jpg", data: jpg},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("single upload: %d", code)
+	}
+	code = app.postForm("/admin/upload", []formPart{
+		{field: "paths", value: "Trip/Day 2/b.jpg"},
+		{field: "paths", value: "Trip/c.jpg"},
+		{field: "files", filename: "b.jpg", data: jpg},
+		{field: "files", filename: "c.jpg", data: jpg},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("batch upload: %d", code)
+	}
+	for _, rel := range []string{"Trip/Day 1/a.jpg", "Trip/Day 2/b.jpg", "Trip/c.jpg"} {
+		if _, err := os.Stat(filepath.Join(app.cfg.MediaRoot, rel)); err != nil {
+			t.Errorf("%s: %v", rel, err)
+		}
+	}
+}
+
+func TestUploadPathsMustPrecedeFiles(t *testing.T) {
+	app := newTestApp(t)
+	jpg := testutil.JPEG(64, 48, nil)
+
+	tests := map[string][]formPart{
+		"path after each file": {
+			{field: "files", filename: "a.jpg", data: jpg},
+			{field: "paths", value: "Trip/a.jpg"},
+			{field: "files", filename: "b.jpg", data: jpg},
+			{field: "paths", value: "Trip/b.jpg"},
+		},
+		"fewer paths than files": {
+			{field: "paths", value: "Trip/a.jpg"},
+			{field: "files", filename: "a.jpg", data: jpg},
+			{field: "files", filename: "b.jpg", data: jpg},
+		},
+		"more paths than files": {
+			{field: "paths", value: "Trip/a.jpg"},
+			{field: "paths", value: "Trip/b.jpg"},
+			{field: "files", filename: "a.jpg", data: jpg},
+		},
+	}
+	for name, parts := range tests {
+		if code := app.postForm("/admin/upload", parts); code != http.StatusBadRequest {
+			t.Errorf("%s: %d, want 400", name, code)
+		}
+	}
+	for _, rel := range []string{"a.jpg", "b.jpg", "Trip/a.jpg", "Trip/b.jpg"} {
+		if _, err := os.Stat(filepath.Join(app.cfg.MediaRoot, rel)); err == nil {
+			t.Errorf("%s kept after a rejected upload", rel)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	urlUploadTimeout      = 60 * time.Second
+	urlUploadMaxRedirects = 5
+)
+
+var (
+	errBlockedAddress = errors.New("address is not publicly routable")
+	errTooManyHops    = fmt.Errorf("stopped after %d redirects", urlUploadMaxRedirects)
+)
+
+var urlUploadTypes = map[string][]string{
+	"image/jpeg": {".jpg", ".jpeg"},
+	"image/png":  {".png"},
+	"image/webp": {".webp"},
+}
+
+// sharedAddrSpace is carrier-grade NAT space, which netip doesn't count as
+// private but is no more reachable from outside.
+var sharedAddrSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func blockedAddr(a netip.Addr) bool {
+	a = a.Unmap()
+	return !a.IsGlobalUnicast() || a.IsPrivate() || sharedAddrSpace.Contains(a)
+}
+
+// Addresses are checked as they are dialed, after DNS and on every
+// redirect. No proxy is used, since it would dial for us unchecked.
+var urlUploadClient = &http.Client{
+	Timeout: urlUploadTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(_, address string, _ syscall.RawConn) error {
+				ap, err := netip.ParseAddrPort(address)
+				if err != nil || blockedAddr(ap.Addr()) {
+					return errBlockedAddress
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		ForceAttemptHTTP2:     true,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= urlUploadMaxRedirects {
+			return errTooManyHops
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+		}
+		return nil
+	},
+}
+
+type remoteReader struct {
+	r   io.Reader
+	err error
+}
+
+func (rr *remoteReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	if err != nil && err != io.EOF {
+		rr.err = err
+	}
+	return n, err
+}
+
+func fetchStatus(err error) int {
+	switch {
+	case errors.Is(err, errBlockedAddress), errors.Is(err, errTooManyHops):
+		return http.StatusBadRequest
+	case tooLarge(err):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, context.DeadlineExceeded), netTimeout(err):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+func netTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+func urlUploadName(u *url.URL, contentType string) string {
+	exts := urlUploadTypes[contentType]
+	name := "image"
+	if base := path.Base(u.Path); base != "/" && base != "." {
+		name = sanitizeFilename(base)
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range exts {
+		if ext == e {
+			return name
+		}
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + exts[0]
+}
+
+func (h *Handlers) adminUploadURL(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL      string         `json:"url"`
+		FolderID IntPtrOrString `json:"folder_id"`
+		Force    bool           `json:"force"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	src, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (src.Scheme != "http" && src.Scheme != "https") || src.Host == "" {
+		http.Error(w, "Invalid url: only http and https addresses can be fetched", 400)
+		return
+	}
+
+	// The fetch alone may take longer than the server's WriteTimeout; the
+	// photo is stored and processed in the window after it.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(urlUploadTimeout + streamIdleTimeout))
+
+	ctx := r.Context()
+	fetchCtx, cancel := context.WithTimeout(ctx, urlUploadTimeout)
+	defer cancel()
+	fetchReq, err := http.NewRequestWithContext(fetchCtx, http.MethodGet, src.String(), nil)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	fetchReq.Header.Set("Accept", "image/jpeg, image/png, image/webp")
+	fetchReq.Header.Set("User-Agent", "photodock")
+
+	resp, err := urlUploadClient.Do(fetchReq)
+	if err != nil {
+		http.Error(w, err.Error(), fetchStatus(err))
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		http.Error(w, "Remote server answered "+resp.Status, http.StatusBadGateway)
+		return
+	}
+
+	limit := h.cfg.MaxUploadSize
+	if limit > 0 && resp.ContentLength > limit {
+		http.Error(w, fmt.Sprintf("Image larger than %d bytes", limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := h.checkDiskSpace(resp.ContentLength); err != nil {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	body := &remoteReader{r: resp.Body}
+	var capped io.Reader = body
+	if limit > 0 {
+		capped = http.MaxBytesReader(nil, io.NopCloser(body), limit)
+	}
+
+	// The type is taken from the bytes, not from what the server claims.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(capped, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		http.Error(w, err.Error(), fetchStatus(err))
+		return
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	if _, ok := urlUploadTypes[contentType]; !ok {
+		http.Error(w, "Unsupported content type "+contentType+": only JPEG, PNG and WebP can be fetched", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	filename := urlUploadName(resp.Request.URL, contentType)
+	relPath, sum, err := h.storeUpload(ctx, h.uploadFolderPath(ctx, req.FolderID.V), filename,
+		io.MultiReader(bytes.NewReader(head), capped), false, req.Force)
+	if err != nil {
+		if body.err != nil || tooLarge(err) {
+			http.Error(w, err.Error(), fetchStatus(err))
+			return
+		}
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	// Looked up before the upload itself is added.
+	dup := h.duplicateOf(ctx, sum)
+	ids := h.processUploads(ctx, []string{relPath})
+	res := uploadResponse(relPath, dup, ids[0])
+	if ids[0] == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(res)
+		return
+	}
+	var urlPath string
+	_ = h.db.Pool().QueryRow(ctx, "SELECT COALESCE(url_path, '') FROM photos WHERE id = $1", ids[0]).Scan(&urlPath)
+	res["url"] = fmt.Sprintf("/photo/%d", ids[0])
+	if urlPath != "" {
+		res["url"] = "/p/" + escapeURLPath(urlPath)
+	}
+	h.jsonResponse(w, res)
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var errUploadMismatch = errors.New("upload does not match")
+
+type missingChunksError struct {
+	Missing []int
+}
+
+func (e *missingChunksError) Error() string {
+	return fmt.Sprintf("upload is missing chunks %v", e.Missing)
+}
+
+func chunkPath(upload *ChunkedUpload, index int) string {
+	return filepath.Join(upload.TempDir, fmt.Sprintf("chunk_%d", index))
+}
+
+func validSHA256(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil && len(s) == 2*sha256.Size
+}
+
+// minUploadChunk is the smallest chunk size a chunked upload may use;
+// the browser sends 1 MiB chunks.
+const minUploadChunk = 64 << 10
+
+func maxUploadChunks(size int64) int {
+	return int((size + minUploadChunk - 1) / minUploadChunk)
+}
+
+func (h *Handlers) uploadChunks(upload *ChunkedUpload) (int, error) {
+	h.uploadsMux.RLock()
+	defer h.uploadsMux.RUnlock()
+	count := upload.TotalChunks
+	var missing []int
+	for i := 0; i < count; i++ {
+		if !upload.Chunks[i] {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) > 0 {
+		return count, &missingChunksError{Missing: missing}
+	}
+	return count, nil
+}
+
+// Staged uploads were checked when they were assembled.
+func (h *Handlers) verifyUpload(upload *ChunkedUpload) error {
+	h.uploadsMux.RLock()
+	staged := upload.Staged
+	h.uploadsMux.RUnlock()
+	if staged != "" {
+		return nil
+	}
+
+	count, err := h.uploadChunks(upload)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for i := 0; i < count; i++ {
+		info, err := os.Stat(chunkPath(upload, i))
+		if err != nil {
+			return &missingChunksError{Missing: []int{i}}
+		}
+		size += info.Size()
+	}
+	if upload.Size > 0 && size != upload.Size {
+		return fmt.Errorf("%w: have %d of %d bytes", errUploadMismatch, size, upload.Size)
+	}
+
+	if upload.SHA256 == "" {
+		return nil
+	}
+	hasher := sha256.New()
+	for i := 0; i < count; i++ {
+		f, err := os.Open(chunkPath(upload, i))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(hasher, f)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if sum := hex.EncodeToString(hasher.Sum(nil)); sum != upload.SHA256 {
+		return fmt.Errorf("%w: SHA-256 is %s", errUploadMismatch, sum)
+	}
+	return nil
+}
+
+// The upload is kept, so missing chunks can still be sent.
+func (h *Handlers) uploadVerifyError(w http.ResponseWriter, err error) {
+	var missing *missingChunksError
+	switch {
+	case errors.As(err, &missing):
+		sort.Ints(missing.Missing)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error(), "missing": missing.Missing})
+	case errors.Is(err, errUploadMismatch):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+func checkChunkSum(got []byte, want string) error {
+	if want == "" {
+		return nil
+	}
+	if sum := hex.EncodeToString(got); !strings.EqualFold(sum, want) {
+		return fmt.Errorf("%w: chunk SHA-256 is %s", errUploadMismatch, sum)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import "sync"
+
+// openPhotos holds photos seen visible with no end to their publish
+// window: nothing but an admin change can hide them, and every admin
+// write clears the set.
+type openPhotos struct {
+	mu  sync.RWMutex
+	gen uint64
+	ids map[int]struct{}
+}
+
+func (o *openPhotos) has(id int) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	_, ok := o.ids[id]
+	return ok
+}
+
+func (o *openPhotos) generation() uint64 {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.gen
+}
+
+// A check that started before the last reset may have seen the old
+// state, so it is not recorded.
+func (o *openPhotos) add(id int, gen uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.gen != gen {
+		return
+	}
+	if o.ids == nil {
+		o.ids = make(map[int]struct{})
+	}
+	o.ids[id] = struct{}{}
+}
+
+func (o *openPhotos) reset() {
+	o.mu.Lock()
+	o.gen++
+	o.ids = nil
+	o.mu.Unlock()
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/services"
+)
+
+func (h *Handlers) apiAdminWarnings(w http.ResponseWriter, r *http.Request) {
+	var warnings []services.Warning
+	var checkedAt time.Time
+	if r.URL.Query().Get("refresh") == "1" {
+		warnings = h.warnings.Refresh(r.Context())
+		checkedAt = time.Now()
+	} else {
+		warnings, checkedAt = h.warnings.Current()
+	}
+	if warnings == nil {
+		warnings = []services.Warning{}
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"warnings":   warnings,
+		"checked_at": checkedAt,
+	})
+}
+
+func (h *Handlers) adminScans(w http.ResponseWriter, r *http.Request) {
+	runs, err := h.scanSvc.ScanRuns(r.Context(), 50)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	h.renderAdmin(w, r, "admin/scans.html", map[string]interface{}{
+		"Runs":  runs,
+		"Title": "Scans",
+	})
+}
+
+func (h *Handlers) adminCacheGC(w http.ResponseWriter, r *http.Request) {
+	h.lifecycle.Go("cache-gc", func(ctx context.Context) {
+		known, err := services.KnownPhotos(ctx, h.db)
+		if err != nil {
+			log.Printf("cache gc error: %v", err)
+			return
+		}
+		n, size := h.thumbSvc.OrphanedCacheFiles(known, true)
+		log.Printf("cache gc removed %d files (%d MB)", n, size>>20)
+		h.warnings.Refresh(ctx)
+	})
+	h.jsonResponse(w, map[string]string{"status": "started"})
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const datetimeLocalLayout = "2006-01-02T15:04"
+
+type windowEvent struct {
+	Kind  string
+	Name  string
+	Link  string
+	Event string
+	At    time.Time
+}
+
+func parseDatetimeLocal(v string) *time.Time {
+	// <input type="datetime-local"> has no zone; it means server time.
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil
+	}
+	t, err := time.ParseInLocation(datetimeLocalLayout, v, time.Local)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+func formatDatetimeLocal(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Local().Format(datetimeLocalLayout)
+}
+
+func (h *Handlers) updateWindow(ctx context.Context, r *http.Request, table string, id int) {
+	// Only forms that carry the fields touch them.
+	if _, ok := r.Form["publish_at"]; !ok {
+		return
+	}
+	_, _ = h.db.Pool().Exec(ctx, "UPDATE "+table+" SET publish_at = $1, expires_at = $2 WHERE id = $3",
+		parseDatetimeLocal(r.FormValue("publish_at")), parseDatetimeLocal(r.FormValue("expires_at")), id)
+}
+
+func (h *Handlers) upcomingWindowEvents(ctx context.Context) []windowEvent {
+	rows, err := h.db.Pool().Query(ctx, `
+		SELECT kind, name, link, event, at FROM (
+			SELECT 'Photo' AS kind, COALESCE(title, filename) AS name, '/admin/photos/' || id AS link, 'goes live' AS event, publish_at AS at
+			FROM photos WHERE publish_at > NOW()
+			UNION ALL
+			SELECT 'Photo', COALESCE(title, filename), '/admin/photos/' || id, 'expires', expires_at
+			FROM photos WHERE expires_at > NOW()
+			UNION ALL
+			SELECT 'Folder', path, '/admin/folders/' || id, 'goes live', publish_at
+			FROM folders WHERE publish_at > NOW()
+			UNION ALL
+			SELECT 'Folder', path, '/admin/folders/' || id, 'expires', expires_at
+			FROM folders WHERE expires_at > NOW()
+		) e ORDER BY at LIMIT 20`)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var events []windowEvent
+	for rows.Next() {
+		var e windowEvent
+		if err := rows.Scan(&e.Kind, &e.Name, &e.Link, &e.Event, &e.At); err != nil {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events
+}
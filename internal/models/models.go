@@ -7,21 +7,34 @@ import (
 )
 
 type Folder struct {
-	ID             int
-	ParentID       sql.NullInt64
-	Name           string
-	Path           string
-	CoverPhotoID   sql.NullInt64
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	PhotoCount     int
-	SubfolderCount int
-	CoverURL       string
-	PreviewURLs    []string
-	Depth          int
-	HasChildren    bool
-	TotalSize      int64
-	LatestPhoto    sql.NullTime
+	ID                int
+	ParentID          sql.NullInt64
+	Name              string
+	Path              string
+	CoverPhotoID      sql.NullInt64
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	ContentUpdatedAt  time.Time
+	Status            string
+	Draft             bool
+	PublishedAt       sql.NullTime
+	PublishAt         sql.NullTime
+	ExpiresAt         sql.NullTime
+	LiveFrom          sql.NullTime
+	LiveUntil         sql.NullTime
+	ContinueNav       sql.NullBool
+	SlideshowInterval sql.NullInt32
+	LockedBy          sql.NullInt64
+	Noindex           bool
+	PhotoCount        int
+	SubfolderCount    int
+	CoverURL          string
+	Locked            bool
+	PreviewURLs       []string
+	Depth             int
+	HasChildren       bool
+	TotalSize         int64
+	LatestPhoto       sql.NullTime
 }
 
 type Photo struct {
@@ -37,11 +50,24 @@ type Photo struct {
 	Height      int
 	SizeBytes   int64
 	Blurhash    sql.NullString
+	SHA256      sql.NullString
 	ExifData    json.RawMessage
 	Hidden      bool
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 	TakenAt     sql.NullTime
+	Version     int
+	ThumbError  sql.NullString
+	PublishAt   sql.NullTime
+	ExpiresAt   sql.NullTime
+	LiveFrom    sql.NullTime
+	LiveUntil   sql.NullTime
+	Lat         sql.NullFloat64
+	Lon         sql.NullFloat64
+	Altitude    sql.NullFloat64
+	Tags        []string
+	Rating      sql.NullInt16
+	LockedBy    sql.NullInt64
 }
 
 type ExifInfo struct {
@@ -130,6 +156,20 @@ type ExifInfo struct {
 	CameraTemperature string `json:"camera_temperature,omitempty"`
 	FileNumber        string `json:"file_number,omitempty"`
 	ImageUniqueID     string `json:"image_unique_id,omitempty"`
+
+	// Never serialized: coordinates only reach the database through the
+	// lat/lon/altitude columns, and only when GPS retention is enabled.
+	Location *GeoPoint `json:"-"`
+	// IPTC keywords and XMP subjects; stored as tags, not in exif_data.
+	Keywords []string `json:"-"`
+	// 1-5 stars; stored in the rating column.
+	Rating int `json:"-"`
+}
+
+type GeoPoint struct {
+	Lat      float64
+	Lon      float64
+	Altitude *float64
 }
 
 type ColorInfo struct {
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const tempMarker = ".tmp-"
+
+func tempSibling(path string) string {
+	// Keep the extension: imaging.Save picks the encoder from it.
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + tempMarker + randHex(4) + ext
+}
+
+func isTempFile(name string) bool {
+	return strings.Contains(name, tempMarker)
+}
+
+func commitTemp(tmpPath, dstPath string, err error) error {
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+func savePNGAtomic(path string, img image.Image) error {
+	tmpPath := tempSibling(path)
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return commitTemp(tmpPath, path, err)
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/models"
+)
+
+const DefaultAutoFilePattern = "{year}/{month}"
+
+func AutoFilePath(pattern string, takenAt time.Time, info *models.ExifInfo) string {
+	if strings.TrimSpace(pattern) == "" {
+		pattern = DefaultAutoFilePattern
+	}
+
+	year, month, day := "undated", "undated", "undated"
+	if !takenAt.IsZero() {
+		year = fmt.Sprintf("%04d", takenAt.Year())
+		month = fmt.Sprintf("%02d", int(takenAt.Month()))
+		day = fmt.Sprintf("%02d", takenAt.Day())
+	}
+
+	var camMake, model string
+	if info != nil {
+		camMake = strings.TrimSpace(info.CameraMake)
+		model = strings.TrimSpace(info.CameraModel)
+	}
+	camera := model
+	if camMake != "" && !strings.HasPrefix(strings.ToLower(model), strings.ToLower(camMake)) {
+		camera = strings.TrimSpace(camMake + " " + model)
+	}
+
+	r := strings.NewReplacer(
+		"{year}", year,
+		"{month}", month,
+		"{day}", day,
+		"{camera}", orUnknown(camera),
+		"{make}", orUnknown(camMake),
+		"{model}", orUnknown(model),
+	)
+
+	var parts []string
+	for _, seg := range strings.Split(filepath.ToSlash(pattern), "/") {
+		if seg = cleanPathSegment(r.Replace(seg)); seg != "" {
+			parts = append(parts, seg)
+		}
+	}
+	return filepath.Join(parts...)
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+func cleanPathSegment(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == '*' || r == '?' || r == '"' || r == '<' || r == '>' || r == '|' {
+			return '_'
+		}
+		return r
+	}, NormalizePath(strings.TrimSpace(s)))
+	return strings.Trim(s, ". ")
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+	"github.com/jackc/pgx/v5"
+)
+
+const backupFormatVersion = 1
+
+// Restore order: parents before children, photos before the redirects and
+// folder covers that point at them.
+var backupTables = []struct {
+	name    string
+	orderBy string
+}{
+	{"settings", "key"},
+	{"folders", "array_length(string_to_array(path, '/'), 1), id"},
+	{"photos", "id"},
+	{"shared_content", "sha256"},
+	{"tags", "id"},
+	{"photo_tags", "photo_id, tag_id"},
+	{"url_redirects", "id"},
+}
+
+var backupName = regexp.MustCompile(`^photodock-\d{8}-\d{6}\.ndjson\.gz$`)
+
+var ErrBackupBusy = errors.New("a backup or restore is already running")
+
+type BackupInfo struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type backupHeader struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type backupLine struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+type BackupService struct {
+	db       *database.DB
+	dir      string
+	interval time.Duration
+	keep     int
+	maxAge   time.Duration
+
+	runMu       sync.Mutex
+	mu          sync.RWMutex
+	lastSuccess time.Time
+	lastErr     error
+	lastErrAt   time.Time
+}
+
+func NewBackupService(db *database.DB, dir string, interval time.Duration, keep int, maxAge time.Duration) *BackupService {
+	_ = os.MkdirAll(dir, 0755)
+	s := &BackupService{db: db, dir: dir, interval: interval, keep: keep, maxAge: maxAge}
+	if backups, err := s.List(); err == nil && len(backups) > 0 {
+		s.lastSuccess = backups[0].CreatedAt
+	}
+	return s
+}
+
+func (s *BackupService) Interval() time.Duration {
+	return s.interval
+}
+
+func (s *BackupService) Status() (lastSuccess time.Time, lastErr error, lastErrAt time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastSuccess, s.lastErr, s.lastErrAt
+}
+
+func (s *BackupService) Run(ctx context.Context) {
+	if s.interval <= 0 {
+		return
+	}
+	for {
+		// Pick up from the newest archive so a restart doesn't take an
+		// extra backup.
+		last, _, _ := s.Status()
+		wait := time.Until(last.Add(s.interval))
+		if wait < 0 {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		if _, err := s.Create(ctx); err != nil && !errors.Is(err, ErrBackupBusy) {
+			log.Printf("scheduled backup failed: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Hour):
+			}
+		}
+	}
+}
+
+func (s *BackupService) Create(ctx context.Context) (BackupInfo, error) {
+	if !s.runMu.TryLock() {
+		return BackupInfo{}, ErrBackupBusy
+	}
+	defer s.runMu.Unlock()
+
+	info, err := s.create(ctx)
+	s.mu.Lock()
+	if err != nil {
+		s.lastErr, s.lastErrAt = err, time.Now()
+	} else {
+		s.lastSuccess, s.lastErr = info.CreatedAt, nil
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return info, err
+	}
+
+	s.rotate()
+	return info, nil
+}
+
+func (s *BackupService) create(ctx context.Context) (BackupInfo, error) {
+	now := time.Now().UTC()
+	name := "photodock-" + now.Format("20060102-150405") + ".ndjson.gz"
+	path := filepath.Join(s.dir, name)
+	tmpPath := tempSibling(path)
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	err = s.write(ctx, f, now)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err := commitTemp(tmpPath, path, err); err != nil {
+		return BackupInfo{}, err
+	}
+
+	st, err := os.Stat(path)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	log.Printf("Backup written: %s (%d KB)", name, st.Size()>>10)
+	return BackupInfo{Name: name, Size: st.Size(), CreatedAt: now}, nil
+}
+
+func (s *BackupService) write(ctx context.Context, f *os.File, now time.Time) error {
+	// One repeatable-read snapshot so photos and the folders they point at
+	// come from the same moment.
+	tx, err := s.db.Pool().BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	gz := gzip.NewWriter(f)
+	buf := bufio.NewWriter(gz)
+	enc := json.NewEncoder(buf)
+
+	if err := enc.Encode(backupHeader{Version: backupFormatVersion, CreatedAt: now}); err != nil {
+		return err
+	}
+	for _, t := range backupTables {
+		rows, err := tx.Query(ctx, fmt.Sprintf("SELECT row_to_json(t)::text FROM %s t ORDER BY %s", t.name, t.orderBy))
+		if err != nil {
+			return fmt.Errorf("backup %s: %w", t.name, err)
+		}
+		for rows.Next() {
+			var row string
+			if err := rows.Scan(&row); err != nil {
+				rows.Close()
+				return fmt.Errorf("backup %s: %w", t.name, err)
+			}
+			if err := enc.Encode(backupLine{Table: t.name, Row: json.RawMessage(row)}); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("backup %s: %w", t.name, err)
+		}
+	}
+
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (s *BackupService) List() ([]BackupInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []BackupInfo
+	for _, e := range entries {
+		if e.IsDir() || !backupName.MatchString(e.Name()) {
+			continue
+		}
+		st, err := e.Info()
+		if err != nil {
+			continue
+		}
+		created, err := time.Parse("20060102-150405", e.Name()[len("photodock-"):len("photodock-")+15])
+		if err != nil {
+			continue
+		}
+		backups = append(backups, BackupInfo{Name: e.Name(), Size: st.Size(), CreatedAt: created})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+func (s *BackupService) Path(name string) (string, error) {
+	if !backupName.MatchString(name) {
+		return "", fmt.Errorf("invalid backup name %q", name)
+	}
+	path := filepath.Join(s.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (s *BackupService) rotate() {
+	backups, err := s.List()
+	if err != nil {
+		return
+	}
+	for i, b := range backups {
+		if i == 0 {
+			continue
+		}
+		tooMany := s.keep > 0 && i >= s.keep
+		tooOld := s.maxAge > 0 && time.Since(b.CreatedAt) > s.maxAge
+		if tooMany || tooOld {
+			_ = os.Remove(filepath.Join(s.dir, b.Name))
+		}
+	}
+}
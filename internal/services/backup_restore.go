@@ -0,0 +1,187 @@
+package services
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const restoreBatch = 500
+
+func (s *BackupService) Restore(ctx context.Context, name string) error {
+	if !s.runMu.TryLock() {
+		return ErrBackupBusy
+	}
+	defer s.runMu.Unlock()
+
+	path, err := s.Path(name)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = gz.Close() }()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 1<<20), 64<<20)
+
+	if !scanner.Scan() {
+		return fmt.Errorf("empty backup: %w", scanner.Err())
+	}
+	var header backupHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Version != backupFormatVersion {
+		return fmt.Errorf("unsupported backup format")
+	}
+
+	tx, err := s.db.Pool().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Undo tokens and the stats cache describe the data being replaced.
+	if _, err := tx.Exec(ctx, "TRUNCATE url_redirects, shared_content, photo_tags, tags, photos, folders, settings, undo_tokens, photo_stats_cache"); err != nil {
+		return err
+	}
+
+	var table string
+	var batch []json.RawMessage
+	var folders []json.RawMessage
+	counts := make(map[string]int)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := restoreRows(ctx, tx, table, batch); err != nil {
+			return fmt.Errorf("restore %s: %w", table, err)
+		}
+		counts[table] += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for scanner.Scan() {
+		var line backupLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return fmt.Errorf("corrupt backup line: %w", err)
+		}
+		if !knownBackupTable(line.Table) {
+			continue
+		}
+		if line.Table != table || len(batch) >= restoreBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+			table = line.Table
+		}
+		row := append(json.RawMessage(nil), line.Row...)
+		batch = append(batch, row)
+		if line.Table == "folders" {
+			folders = append(folders, row)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	// Covers point at photos, so they go in once photos exist; timestamps go
+	// last because the triggers touched them during the load.
+	if len(folders) > 0 {
+		all, _ := json.Marshal(folders)
+		if _, err := tx.Exec(ctx, `
+			UPDATE folders f SET cover_photo_id = (r->>'cover_photo_id')::int
+			FROM jsonb_array_elements($1::jsonb) r
+			WHERE f.id = (r->>'id')::int AND r->>'cover_photo_id' IS NOT NULL`, string(all)); err != nil {
+			return fmt.Errorf("restore covers: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE folders f SET
+				updated_at = COALESCE((r->>'updated_at')::timestamptz, f.updated_at),
+				content_updated_at = COALESCE((r->>'content_updated_at')::timestamptz, f.content_updated_at)
+			FROM jsonb_array_elements($1::jsonb) r
+			WHERE f.id = (r->>'id')::int`, string(all)); err != nil {
+			return fmt.Errorf("restore folder timestamps: %w", err)
+		}
+	}
+
+	for _, t := range []string{"folders", "photos", "tags", "url_redirects"} {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(
+			"SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %s", t, t)); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	log.Printf("Restored backup %s: %d folders, %d photos, %d settings, %d redirects",
+		name, counts["folders"], counts["photos"], counts["settings"], counts["url_redirects"])
+	return nil
+}
+
+func knownBackupTable(name string) bool {
+	for _, t := range backupTables {
+		if t.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func restoreRows(ctx context.Context, tx pgx.Tx, table string, rows []json.RawMessage) error {
+	// Only columns present in both the archive and the current schema are
+	// written, so older backups pick up defaults for newer columns.
+	colRows, err := tx.Query(ctx,
+		"SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1", table)
+	if err != nil {
+		return err
+	}
+	current := make(map[string]bool)
+	for colRows.Next() {
+		var c string
+		if err := colRows.Scan(&c); err == nil {
+			current[c] = true
+		}
+	}
+	colRows.Close()
+
+	var sample map[string]json.RawMessage
+	if err := json.Unmarshal(rows[0], &sample); err != nil {
+		return err
+	}
+	var cols []string
+	for c := range sample {
+		if !current[c] || (table == "folders" && c == "cover_photo_id") {
+			continue
+		}
+		cols = append(cols, pgx.Identifier{c}.Sanitize())
+	}
+	if len(cols) == 0 {
+		return nil
+	}
+
+	list := strings.Join(cols, ", ")
+	all, _ := json.Marshal(rows)
+	_, err = tx.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s (%s)
+		SELECT %s FROM jsonb_populate_recordset(NULL::%s, $1::jsonb)`,
+		table, list, list, table), string(all))
+	return err
+}
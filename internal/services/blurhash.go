@@ -0,0 +1,192 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+const (
+	blurhashXComponents = 4
+	blurhashYComponents = 3
+	base83Chars         = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+)
+
+func isLegacyBlurhash(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	data, err := base64.StdEncoding.DecodeString(hash)
+	return err == nil && len(data) == 48
+}
+
+func encode83(value, length int) string {
+	var sb strings.Builder
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		sb.WriteByte(base83Chars[digit])
+	}
+	return sb.String()
+}
+
+func decode83(s string) (int, error) {
+	value := 0
+	for _, c := range s {
+		idx := strings.IndexRune(base83Chars, c)
+		if idx < 0 {
+			return 0, fmt.Errorf("invalid blurhash character %q", c)
+		}
+		value = value*83 + idx
+	}
+	return value, nil
+}
+
+func sRGBToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(f float64) int {
+	v := math.Max(0, math.Min(1, f))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+func encodeBlurhash(img image.Image, xComp, yComp int) string {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Convert once; the basis loop below visits every pixel xComp*yComp times.
+	linear := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			linear[y*w+x] = [3]float64{sRGBToLinear(uint8(r >> 8)), sRGBToLinear(uint8(g >> 8)), sRGBToLinear(uint8(b >> 8))}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComp*yComp)
+	for j := 0; j < yComp; j++ {
+		for i := 0; i < xComp; i++ {
+			norm := 2.0
+			if i == 0 && j == 0 {
+				norm = 1
+			}
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				cy := math.Cos(math.Pi * float64(j) * float64(y) / float64(h))
+				for x := 0; x < w; x++ {
+					basis := norm * math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) * cy
+					px := linear[y*w+x]
+					f[0] += basis * px[0]
+					f[1] += basis * px[1]
+					f[2] += basis * px[2]
+				}
+			}
+			scale := 1 / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(encode83((xComp-1)+(yComp-1)*9, 1))
+
+	maxValue := 1.0
+	if len(factors) > 1 {
+		actualMax := 0.0
+		for _, f := range factors[1:] {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		sb.WriteString(encode83(quantisedMax, 1))
+	} else {
+		sb.WriteString(encode83(0, 1))
+	}
+
+	dc := factors[0]
+	sb.WriteString(encode83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+
+	for _, f := range factors[1:] {
+		q := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maxValue, 0.5)*9+9.5))))
+		}
+		sb.WriteString(encode83(q(f[0])*19*19+q(f[1])*19+q(f[2]), 2))
+	}
+
+	return sb.String()
+}
+
+func decodeBlurhash(hash string, width, height int) (image.Image, error) {
+	if len(hash) < 6 {
+		return nil, fmt.Errorf("blurhash too short")
+	}
+
+	sizeFlag, err := decode83(hash[:1])
+	if err != nil {
+		return nil, err
+	}
+	numY := sizeFlag/9 + 1
+	numX := sizeFlag%9 + 1
+	if len(hash) != 4+2*numX*numY {
+		return nil, fmt.Errorf("blurhash length %d does not match %dx%d components", len(hash), numX, numY)
+	}
+
+	quantisedMax, err := decode83(hash[1:2])
+	if err != nil {
+		return nil, err
+	}
+	maxValue := float64(quantisedMax+1) / 166
+
+	colors := make([][3]float64, numX*numY)
+	for i := range colors {
+		if i == 0 {
+			v, err := decode83(hash[2:6])
+			if err != nil {
+				return nil, err
+			}
+			colors[i] = [3]float64{sRGBToLinear(uint8(v >> 16)), sRGBToLinear(uint8(v >> 8)), sRGBToLinear(uint8(v))}
+			continue
+		}
+		v, err := decode83(hash[4+i*2 : 6+i*2])
+		if err != nil {
+			return nil, err
+		}
+		colors[i] = [3]float64{
+			signPow(float64(v/(19*19)-9)/9, 2) * maxValue,
+			signPow(float64((v/19)%19-9)/9, 2) * maxValue,
+			signPow(float64(v%19-9)/9, 2) * maxValue,
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var r, g, b float64
+			for j := 0; j < numY; j++ {
+				cy := math.Cos(math.Pi * float64(y) * float64(j) / float64(height))
+				for i := 0; i < numX; i++ {
+					basis := math.Cos(math.Pi*float64(x)*float64(i)/float64(width)) * cy
+					c := colors[i+j*numX]
+					r += c[0] * basis
+					g += c[1] * basis
+					b += c[2] * basis
+				}
+			}
+			img.Set(x, y, color.RGBA{uint8(linearToSRGB(r)), uint8(linearToSRGB(g)), uint8(linearToSRGB(b)), 255})
+		}
+	}
+	return img, nil
+}
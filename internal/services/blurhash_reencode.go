@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+)
+
+const blurhashCursorKey = "maintenance.reencode_blurhash.cursor"
+
+type BlurhashReencodeResult struct {
+	Checked   int  `json:"checked"`
+	Reencoded int  `json:"reencoded"`
+	Done      bool `json:"done"`
+}
+
+func (s *ScannerService) ReencodeBlurhashes(ctx context.Context, budget time.Duration) (BlurhashReencodeResult, error) {
+	var res BlurhashReencodeResult
+
+	if !s.maintMu.TryLock() {
+		return res, ErrMaintenanceRunning
+	}
+	defer s.maintMu.Unlock()
+
+	var cursorStr string
+	_ = s.db.Pool().QueryRow(ctx, "SELECT value FROM settings WHERE key = $1", blurhashCursorKey).Scan(&cursorStr)
+	cursor, _ := strconv.Atoi(cursorStr)
+
+	deadline := time.Now().Add(budget)
+	for time.Now().Before(deadline) {
+		batch, err := s.blurhashBatch(ctx, cursor)
+		if err != nil {
+			return res, err
+		}
+		if len(batch) == 0 {
+			_, _ = s.db.Pool().Exec(ctx, "DELETE FROM settings WHERE key = $1", blurhashCursorKey)
+			res.Done = true
+			break
+		}
+
+		for _, p := range batch {
+			if ctx.Err() != nil || time.Now().After(deadline) {
+				break
+			}
+			res.Checked++
+			cursor = p.id
+
+			hash, err := s.thumbSvc.GenerateBlurhash(p.path)
+			if err != nil {
+				continue
+			}
+			if _, err := s.db.Pool().Exec(ctx, "UPDATE photos SET blurhash = $1, version = version + 1 WHERE id = $2", hash, p.id); err != nil {
+				log.Printf("reencode blurhash error photo %d (%s): %v", p.id, p.path, err)
+				continue
+			}
+			s.thumbSvc.DeletePlaceholderByID(p.id)
+			res.Reencoded++
+		}
+
+		_, err = s.db.Pool().Exec(ctx,
+			`INSERT INTO settings (key, value, updated_at) VALUES ($1, $2, NOW())
+			ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()`,
+			blurhashCursorKey, strconv.Itoa(cursor))
+		if err != nil {
+			return res, err
+		}
+		if ctx.Err() != nil {
+			return res, ctx.Err()
+		}
+	}
+
+	if res.Reencoded > 0 {
+		log.Printf("BlurHash re-encode: updated %d of %d photos checked", res.Reencoded, res.Checked)
+	}
+	return res, nil
+}
+
+type blurhashRow struct {
+	id   int
+	path string
+}
+
+func (s *ScannerService) blurhashBatch(ctx context.Context, afterID int) ([]blurhashRow, error) {
+	rows, err := s.db.Pool().Query(ctx,
+		"SELECT id, path FROM photos WHERE id > $1 ORDER BY id LIMIT 100", afterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []blurhashRow
+	for rows.Next() {
+		var p blurhashRow
+		if err := rows.Scan(&p.id, &p.path); err != nil {
+			continue
+		}
+		batch = append(batch, p)
+	}
+	return batch, rows.Err()
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type cachedFile struct {
+	size     int64
+	accessed time.Time
+	keep     bool
+}
+
+type cacheBudget struct {
+	max   int64
+	mu    sync.Mutex
+	files map[string]*cachedFile
+	total int64
+	kick  chan struct{}
+}
+
+func newCacheBudget(max uint64) *cacheBudget {
+	return &cacheBudget{
+		max:   int64(max),
+		files: make(map[string]*cachedFile),
+		kick:  make(chan struct{}, 1),
+	}
+}
+
+func (s *ThumbnailService) markCached(path string) {
+	s.existsCache.Store(path, struct{}{})
+	if info, err := os.Stat(path); err == nil {
+		s.trackCached(path, info.Size(), time.Now())
+	}
+}
+
+func (s *ThumbnailService) trackCached(path string, size int64, accessed time.Time) {
+	b := s.budget
+	b.mu.Lock()
+	if f, ok := b.files[path]; ok {
+		b.total -= f.size
+	}
+	b.files[path] = &cachedFile{size: size, accessed: accessed, keep: s.keepCached(path)}
+	b.total += size
+	over := b.max > 0 && b.total > b.max
+	b.mu.Unlock()
+
+	if over {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *ThumbnailService) cacheHit(path string) bool {
+	if _, ok := s.existsCache.Load(path); !ok {
+		return false
+	}
+	b := s.budget
+	b.mu.Lock()
+	if f, ok := b.files[path]; ok {
+		f.accessed = time.Now()
+	}
+	b.mu.Unlock()
+	return true
+}
+
+func (s *ThumbnailService) dropCached(path string) {
+	_ = os.Remove(path)
+	s.existsCache.Delete(path)
+
+	b := s.budget
+	b.mu.Lock()
+	if f, ok := b.files[path]; ok {
+		b.total -= f.size
+		delete(b.files, path)
+	}
+	b.mu.Unlock()
+}
+
+func (s *ThumbnailService) keepCached(path string) bool {
+	// Placeholders and the smallest sizes are tiny and sit on every grid, so
+	// they only go once nothing else is left to evict.
+	dir := filepath.Base(filepath.Dir(path))
+	if dir == "placeholder" {
+		return true
+	}
+	spec, ok := s.sizes[strings.TrimSuffix(dir, "-webp")]
+	names := s.SizeNames()
+	return ok && len(names) > 0 && spec.Width <= s.sizes[names[0]].Width
+}
+
+func (s *ThumbnailService) CacheUsage() (used, max int64) {
+	b := s.budget
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.total, b.max
+}
+
+func (s *ThumbnailService) RunCacheJanitor(ctx context.Context) {
+	if s.budget.max <= 0 {
+		return
+	}
+	s.evictCache()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.budget.kick:
+			s.evictCache()
+		}
+	}
+}
+
+func (s *ThumbnailService) evictCache() {
+	b := s.budget
+	b.mu.Lock()
+	if b.max <= 0 || b.total <= b.max {
+		b.mu.Unlock()
+		return
+	}
+	// Evict down to 90% so a busy cache doesn't churn on every new file.
+	target := b.total - b.max*9/10
+	paths := make([]string, 0, len(b.files))
+	for path := range b.files {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		a, c := b.files[paths[i]], b.files[paths[j]]
+		if a.keep != c.keep {
+			return !a.keep
+		}
+		return a.accessed.Before(c.accessed)
+	})
+	var victims []string
+	var freed int64
+	for _, path := range paths {
+		if freed >= target {
+			break
+		}
+		freed += b.files[path].size
+		victims = append(victims, path)
+	}
+	b.mu.Unlock()
+
+	for _, path := range victims {
+		s.dropCached(path)
+	}
+	log.Printf("Cache janitor: evicted %d files (%d MB)", len(victims), freed>>20)
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	emptyCoverName    = "empty.png"
+	webDir            = "web"
+	legacyCacheMarker = ".keyed-by-id"
+)
+
+func (s *ThumbnailService) OrphanedCacheFiles(known map[int]string, remove bool) (int, int64) {
+	webNames := make(map[string]bool)
+	for _, p := range known {
+		if isHEIF(p) {
+			webNames[filepath.Base(s.webOriginalCachePath(p))] = true
+		}
+	}
+
+	var count int
+	var size int64
+	for _, dir := range s.cacheDirs() {
+		dirPath := filepath.Join(s.cacheDir, dir)
+		entries, err := os.ReadDir(dirPath)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			name := entry.Name()
+			if isTempFile(name) || name == emptyCoverName {
+				continue
+			}
+			if dir == webDir {
+				if webNames[name] {
+					continue
+				}
+			} else if id, ok := cacheFileID(name); ok && known[id] != "" && !s.staleThumbnail(dir, id, name) {
+				continue
+			}
+			count++
+			if info, err := entry.Info(); err == nil {
+				size += info.Size()
+			}
+			if remove {
+				path := filepath.Join(dirPath, name)
+				s.dropCached(path)
+			}
+		}
+	}
+	return count, size
+}
+
+func cacheFileID(name string) (int, bool) {
+	idPart := strings.TrimSuffix(name, filepath.Ext(name))
+	if i := strings.IndexAny(idPart, "-_"); i >= 0 {
+		idPart = idPart[:i]
+	}
+	id, err := strconv.Atoi(idPart)
+	return id, err == nil
+}
+
+func (s *ThumbnailService) migrateLegacyCache() {
+	// Cache files are keyed by photo ID. Anything else in the thumbnail
+	// directories was written under an older path-keyed scheme and can never
+	// be looked up again, so it is removed once and a marker records that.
+	marker := filepath.Join(s.cacheDir, legacyCacheMarker)
+	if _, err := os.Stat(marker); err == nil {
+		return
+	}
+	var removed int
+	for _, dir := range s.cacheDirs() {
+		if dir == webDir {
+			continue
+		}
+		dirPath := filepath.Join(s.cacheDir, dir)
+		entries, err := os.ReadDir(dirPath)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || isTempFile(name) || name == emptyCoverName {
+				continue
+			}
+			if _, ok := cacheFileID(name); ok {
+				continue
+			}
+			if os.Remove(filepath.Join(dirPath, name)) == nil {
+				removed++
+			}
+		}
+	}
+	if removed > 0 {
+		log.Printf("Removed %d legacy path-keyed cache files", removed)
+	}
+	_ = os.WriteFile(marker, nil, 0644)
+}
+
+func (s *ThumbnailService) staleThumbnail(dir string, id int, name string) bool {
+	// A live photo's thumbnail is still garbage once THUMB_SIZES asks for a
+	// different width or quality.
+	if dir == "placeholder" || dir == customDir {
+		return false
+	}
+	size := strings.TrimSuffix(dir, "-webp")
+	return name != s.thumbFilename(id, size, filepath.Ext(name))
+}
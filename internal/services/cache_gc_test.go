@@ -0,0 +1,36 @@
+package services
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/config"
+)
+
+func TestOrphanedWebOriginals(t *testing.T) {
+	sizes := map[string]config.ThumbSpec{"small": {Width: 300, Quality: 80}}
+	s := NewThumbnailService(t.TempDir(), t.TempDir(), 0, 0, 0, sizes, 1, "go")
+
+	kept := s.webOriginalCachePath("a/kept.heic")
+	orphan := s.webOriginalCachePath("a/deleted.heic")
+	for _, p := range []string{kept, orphan} {
+		if err := os.WriteFile(p, []byte("jpeg"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		s.markCached(p)
+	}
+
+	known := map[int]string{1: "a/kept.heic", 2: "a/plain.jpg"}
+	if n, size := s.OrphanedCacheFiles(known, true); n != 1 || size != 4 {
+		t.Errorf("orphans = %d (%d bytes), want 1 (4 bytes)", n, size)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("web original of a known photo: %v", err)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("orphaned web original: %v", err)
+	}
+	if used, _ := s.CacheUsage(); used != 4 {
+		t.Errorf("cache usage = %d, want 4", used)
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type CleanOptions struct {
+	DryRun bool
+	// Keep empty folders whose directory still holds files of any kind,
+	// together with their parents.
+	KeepFoldersWithFiles bool
+}
+
+type CleanReport struct {
+	DryRun         bool     `json:"dry_run"`
+	Photos         []string `json:"photos"`
+	Folders        []string `json:"folders"`
+	PhotosRemoved  int      `json:"photos_removed"`
+	FoldersRemoved int      `json:"folders_removed"`
+}
+
+// CleanOrphans must follow a successful BeginJob(JobClean) unless it is a
+// dry run, which only needs no job to be running.
+func (s *ScannerService) CleanOrphans(ctx context.Context, opts CleanOptions) (report *CleanReport, err error) {
+	if opts.DryRun {
+		if !s.maintMu.TryRLock() {
+			return nil, ErrMaintenanceRunning
+		}
+		defer s.maintMu.RUnlock()
+	} else {
+		defer func() {
+			if report != nil {
+				s.jobs.removed(report.PhotosRemoved + report.FoldersRemoved)
+			}
+			s.endJob(nil, err)
+		}()
+	}
+
+	report = &CleanReport{DryRun: opts.DryRun, Photos: []string{}, Folders: []string{}}
+	ignore := s.loadIgnore()
+
+	rows, err := s.db.Pool().Query(ctx, "SELECT id, path FROM photos ORDER BY path")
+	if err != nil {
+		return nil, err
+	}
+	// Never nil: pgx sends a nil slice as NULL, and "<> ALL(NULL)" would
+	// make every folder look empty.
+	orphanIDs := []int{}
+	for rows.Next() {
+		var id int
+		var path string
+		if err := rows.Scan(&id, &path); err != nil {
+			continue
+		}
+		orphan := ignore.matchPath(path, false)
+		if !orphan {
+			_, err := os.Stat(ResolveMediaPath(s.mediaRoot, path))
+			orphan = os.IsNotExist(err)
+		}
+		if orphan {
+			orphanIDs = append(orphanIDs, id)
+			report.Photos = append(report.Photos, path)
+		}
+	}
+	rows.Close()
+
+	ignoredFolders := []string{}
+	if ignore != nil {
+		rows, err := s.db.Pool().Query(ctx, "SELECT path FROM folders")
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var path string
+			if err := rows.Scan(&path); err == nil && ignore.matchPath(path, true) {
+				ignoredFolders = append(ignoredFolders, path)
+			}
+		}
+		rows.Close()
+	}
+
+	// Folders whose whole subtree is empty once the orphans above are gone,
+	// so a chain of empty parents goes in one run.
+	rows, err = s.db.Pool().Query(ctx, `
+		WITH RECURSIVE subtree AS (
+			SELECT id AS root, id FROM folders
+			UNION ALL
+			SELECT s.root, f.id FROM subtree s JOIN folders f ON f.parent_id = s.id
+		)
+		SELECT f.path, f.path = ANY($2) FROM folders f
+		WHERE f.path = ANY($2) OR NOT EXISTS (
+			SELECT 1 FROM subtree s JOIN photos p ON p.folder_id = s.id
+			WHERE s.root = f.id AND p.id <> ALL($1))
+		ORDER BY f.path`, orphanIDs, ignoredFolders)
+	if err != nil {
+		return nil, err
+	}
+	var empty []string
+	var kept []string
+	for rows.Next() {
+		var path string
+		var ignored bool
+		if err := rows.Scan(&path, &ignored); err != nil {
+			continue
+		}
+		if !ignored && opts.KeepFoldersWithFiles && s.dirHasFiles(path) {
+			kept = append(kept, path)
+			continue
+		}
+		empty = append(empty, path)
+	}
+	rows.Close()
+
+	// Deleting a folder takes its subfolders along, so the parents of a
+	// kept folder stay too.
+	for _, path := range empty {
+		if !hasDescendant(path, kept) {
+			report.Folders = append(report.Folders, path)
+		}
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	tag, err := s.db.Pool().Exec(ctx, "DELETE FROM photos WHERE id = ANY($1)", orphanIDs)
+	if err != nil {
+		return nil, err
+	}
+	report.PhotosRemoved = int(tag.RowsAffected())
+	for _, id := range orphanIDs {
+		_ = s.thumbSvc.DeleteThumbnailsByID(id)
+	}
+	tag, err = s.db.Pool().Exec(ctx, "DELETE FROM folders WHERE path = ANY($1)", report.Folders)
+	if err != nil {
+		return nil, err
+	}
+	report.FoldersRemoved = int(tag.RowsAffected())
+	return report, nil
+}
+
+// dirHasFiles also counts files the scanner doesn't import, such as
+// videos.
+func (s *ScannerService) dirHasFiles(relPath string) bool {
+	entries, err := os.ReadDir(ResolveMediaPath(s.mediaRoot, relPath))
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasDescendant(path string, paths []string) bool {
+	prefix := path + string(filepath.Separator)
+	for _, p := range paths {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
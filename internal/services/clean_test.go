@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/testutil"
+)
+
+func TestCleanOrphansPrunesNestedEmptyFolders(t *testing.T) {
+	lib := newTestLibrary(t)
+	ctx := context.Background()
+	lib.write("A/B/C/D/gone.jpg", testutil.JPEG(32, 32, nil))
+	lib.write("Keep/here.jpg", testutil.JPEG(32, 32, nil))
+	if err := lib.scanner.ScanFolder(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	// Gone without a scan noticing, so its row is the only thing left in
+	// the four folders.
+	if err := os.RemoveAll(filepath.Join(lib.root, "A")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := lib.scanner.BeginJob(JobClean); !ok {
+		t.Fatal("clean job refused")
+	}
+	report, err := lib.scanner.CleanOrphans(ctx, CleanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.PhotosRemoved != 1 || report.FoldersRemoved != 4 {
+		t.Errorf("removed %d photos and %d folders, want 1 and 4: %+v", report.PhotosRemoved, report.FoldersRemoved, report)
+	}
+	for _, path := range []string{"A", "A/B", "A/B/C", "A/B/C/D"} {
+		if lib.has("folders", path) {
+			t.Errorf("folder %s left", path)
+		}
+	}
+	if !lib.has("folders", "Keep") || !lib.has("photos", "Keep/here.jpg") {
+		t.Error("folder with a photo removed")
+	}
+
+	again, err := lib.scanner.CleanOrphans(ctx, CleanOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Photos)+len(again.Folders) > 0 {
+		t.Errorf("a second pass still finds %+v", again)
+	}
+}
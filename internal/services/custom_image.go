@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	FitCover   = "cover"
+	FitContain = "contain"
+
+	customDir     = "custom"
+	customQuality = 85
+)
+
+func (s *ThumbnailService) customImageFilename(photoID, width, height int, fit string) string {
+	return fmt.Sprintf("%d_%dx%d_%s.jpg", photoID, width, height, fit)
+}
+
+// A zero height keeps the aspect ratio; otherwise cover crops to exactly
+// width x height and contain fits inside it. Neither ever upscales.
+func (s *ThumbnailService) CustomImagePath(ctx context.Context, photoID int, photoPath string, width, height int, fit string) (string, error) {
+	if height == 0 {
+		fit = FitContain
+	}
+	dstPath := filepath.Join(s.cacheDir, customDir, s.customImageFilename(photoID, width, height, fit))
+
+	if s.cacheHit(dstPath) {
+		return dstPath, nil
+	}
+	if _, err := os.Stat(dstPath); err == nil {
+		s.markCached(dstPath)
+		return dstPath, nil
+	}
+	if s.knownBroken(photoPath) {
+		return "", ErrThumbnailFailed
+	}
+
+	err := s.pool.do(ctx, dstPath, false, func() error {
+		if _, err := os.Stat(dstPath); err == nil {
+			return nil
+		}
+		srcPath, err := s.sourcePath(photoPath)
+		if err != nil {
+			return s.recordFailure(photoPath, err)
+		}
+		// The short edge covers both dimensions, whichever way the fit
+		// crops.
+		img, err := s.openImageScaled(srcPath, max(width, height))
+		if err != nil {
+			return s.recordFailure(photoPath, err)
+		}
+
+		b := img.Bounds()
+		switch {
+		case fit == FitCover && b.Dx() >= width && b.Dy() >= height:
+			img = imaging.Fill(img, width, height, imaging.Center, imaging.Lanczos)
+		case fit == FitCover:
+			// Too small to fill the box: crop to its shape instead.
+			scale := min(float64(b.Dx())/float64(width), float64(b.Dy())/float64(height))
+			img = imaging.CropCenter(img, int(float64(width)*scale), int(float64(height)*scale))
+		case height == 0:
+			img = imaging.Fit(img, width, b.Dy(), imaging.Lanczos)
+		default:
+			img = imaging.Fit(img, width, height, imaging.Lanczos)
+		}
+
+		tmpPath := tempSibling(dstPath)
+		return commitTemp(tmpPath, dstPath, imaging.Save(img, tmpPath, imaging.JPEGQuality(customQuality)))
+	})
+	if err != nil {
+		return "", err
+	}
+
+	s.markCached(dstPath)
+	return dstPath, nil
+}
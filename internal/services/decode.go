@@ -0,0 +1,138 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/models"
+	"github.com/disintegration/imaging"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+func findScaledDecoder() string {
+	for _, bin := range []string{"vips", "djpeg"} {
+		if _, err := exec.LookPath(bin); err == nil {
+			return bin
+		}
+	}
+	return ""
+}
+
+func (s *ThumbnailService) decodeScale(srcPath string, minEdge int) int {
+	// image/jpeg can only decode at full size, so JPEGs over the budget are
+	// handed to a decoder that scales in the DCT domain instead.
+	if s.scaledDecoder == "" || s.decodeMaxPixels == 0 {
+		return 1
+	}
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return 1
+	}
+	defer func() { _ = f.Close() }()
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil || format != "jpeg" || uint64(cfg.Width)*uint64(cfg.Height) <= s.decodeMaxPixels {
+		return 1
+	}
+
+	// The short edge must still cover the requested width, whichever way
+	// the photo ends up rotated.
+	short := min(cfg.Width, cfg.Height)
+	for _, scale := range []int{8, 4, 2} {
+		if short/scale >= minEdge {
+			return scale
+		}
+	}
+	return 1
+}
+
+func (s *ThumbnailService) openImageScaled(srcPath string, minEdge int) (image.Image, error) {
+	scale := s.decodeScale(srcPath, minEdge)
+	if scale == 1 {
+		return openImage(srcPath)
+	}
+	img, err := s.decodeScaled(srcPath, scale)
+	if err != nil {
+		log.Printf("scaled decode of %s failed, decoding at full size: %v", srcPath, err)
+		return openImage(srcPath)
+	}
+	return img, nil
+}
+
+func (s *ThumbnailService) decodeScaled(srcPath string, scale int) (image.Image, error) {
+	// Under web/ so a crash leaves the temp file where prewarm sweeps it.
+	var tmpPath string
+	var cmd *exec.Cmd
+	if s.scaledDecoder == "vips" {
+		tmpPath = tempSibling(filepath.Join(s.cacheDir, "web", "decode.png"))
+		cmd = exec.Command("vips", "copy", fmt.Sprintf("%s[shrink=%d]", srcPath, scale), tmpPath)
+	} else {
+		tmpPath = tempSibling(filepath.Join(s.cacheDir, "web", "decode.bmp"))
+		cmd = exec.Command("djpeg", "-scale", "1/"+strconv.Itoa(scale), "-bmp", "-outfile", tmpPath, srcPath)
+	}
+	defer func() { _ = os.Remove(tmpPath) }()
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", s.scaledDecoder, err, strings.TrimSpace(string(out)))
+	}
+	img, err := imaging.Open(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	// The intermediate file has no EXIF, so orientation comes from the source.
+	return orient(img, jpegOrientation(srcPath)), nil
+}
+
+func jpegOrientation(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 1
+	}
+	defer func() { _ = f.Close() }()
+	x, err := exif.Decode(f)
+	if err != nil {
+		return 1
+	}
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+	o, err := tag.Int(0)
+	if err != nil {
+		return 1
+	}
+	return o
+}
+
+func photoOrientation(absPath string, info *models.ExifInfo) int {
+	if info != nil && info.Orientation != 0 {
+		return info.Orientation
+	}
+	return jpegOrientation(absPath)
+}
+
+func orient(img image.Image, orientation int) image.Image {
+	// Same transforms imaging.AutoOrientation applies.
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	}
+	return img
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/config"
+	"github.com/Alexander-D-Karpov/photodock/internal/testutil"
+)
+
+// BenchmarkOpenImageLarge decodes a 42-megapixel JPEG for a small
+// thumbnail at full size and, where vips or djpeg is installed, scaled.
+// live-MB is the heap still in use with the decoded image held, which is
+// what a thumbnail worker peaks at.
+func BenchmarkOpenImageLarge(b *testing.B) {
+	dir := b.TempDir()
+	src := filepath.Join(dir, "panorama.jpg")
+	if err := os.WriteFile(src, testutil.JPEG(7000, 6000, nil), 0644); err != nil {
+		b.Fatal(err)
+	}
+	sizes := map[string]config.ThumbSpec{"small": {Width: 300, Quality: 80}}
+
+	for _, bc := range []struct {
+		name      string
+		maxPixels uint64
+	}{
+		{"full", 0},
+		{"scaled", 40_000_000},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			svc := NewThumbnailService(dir, b.TempDir(), 0, 0, bc.maxPixels, sizes, 1, "go")
+			if bc.maxPixels > 0 && svc.scaledDecoder == "" {
+				b.Skip("neither vips nor djpeg is installed")
+			}
+			b.ReportAllocs()
+			var live uint64
+			var ms runtime.MemStats
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+				runtime.ReadMemStats(&ms)
+				before := ms.HeapAlloc
+				img, err := svc.openImageScaled(src, 300)
+				if err != nil {
+					b.Fatal(err)
+				}
+				runtime.ReadMemStats(&ms)
+				live = max(live, ms.HeapAlloc-min(before, ms.HeapAlloc))
+				runtime.KeepAlive(img)
+			}
+			b.ReportMetric(float64(live)/(1<<20), "live-MB")
+		})
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd)
+
+package services
+
+import "errors"
+
+func FreeSpace(path string) (uint64, error) {
+	return 0, errors.New("free space not supported on this platform")
+}
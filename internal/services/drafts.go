@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+)
+
+const (
+	FolderStatusDraft     = "draft"
+	FolderStatusPublished = "published"
+)
+
+var ErrBadFolderStatus = errors.New("status must be draft or published")
+
+func ValidFolderStatus(status string) bool {
+	return status == FolderStatusDraft || status == FolderStatusPublished
+}
+
+func RefreshDraftFlags(ctx context.Context, db *database.DB) error {
+	_, err := db.Pool().Exec(ctx, `
+		UPDATE folders f SET draft = x.draft
+		FROM (
+			SELECT f2.id, EXISTS(
+				SELECT 1 FROM folders d
+				WHERE d.status = 'draft' AND (d.id = f2.id OR left(f2.path, length(d.path) + 1) = d.path || '/')
+			) AS draft
+			FROM folders f2
+		) x
+		WHERE f.id = x.id AND f.draft IS DISTINCT FROM x.draft`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Pool().Exec(ctx, `
+		UPDATE photos p SET draft = f.draft
+		FROM folders f
+		WHERE f.id = p.folder_id AND p.draft IS DISTINCT FROM f.draft`)
+	if err != nil {
+		return err
+	}
+
+	return stampPublished(ctx, db)
+}
+
+func stampPublished(ctx context.Context, db *database.DB) error {
+	_, err := db.Pool().Exec(ctx,
+		"UPDATE photos SET published_at = NOW() WHERE published_at IS NULL AND draft = false")
+	return err
+}
+
+func SetFolderStatus(ctx context.Context, db *database.DB, folderID int, status string) error {
+	if !ValidFolderStatus(status) {
+		return ErrBadFolderStatus
+	}
+
+	_, err := db.Pool().Exec(ctx, `
+		UPDATE folders SET status = $1,
+			published_at = CASE WHEN $1 = 'published' THEN NOW() ELSE published_at END,
+			updated_at = NOW()
+		WHERE id = $2`, status, folderID)
+	if err != nil {
+		return err
+	}
+	return RefreshDraftFlags(ctx, db)
+}
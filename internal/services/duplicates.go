@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+)
+
+type DuplicatePhoto struct {
+	ID        int
+	Path      string
+	URLPath   string
+	SizeBytes int64
+	Version   int
+	CreatedAt time.Time
+}
+
+type DuplicateGroup struct {
+	Hash   string
+	Photos []DuplicatePhoto
+}
+
+func DuplicateGroups(ctx context.Context, db *database.DB) ([]DuplicateGroup, error) {
+	rows, err := db.Pool().Query(ctx, `
+		SELECT sha256, id, path, COALESCE(url_path, ''), COALESCE(size_bytes, 0), version, created_at
+		FROM photos
+		WHERE sha256 IN (SELECT sha256 FROM photos WHERE sha256 IS NOT NULL GROUP BY sha256 HAVING COUNT(*) > 1)
+		ORDER BY sha256, created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []DuplicateGroup
+	for rows.Next() {
+		var hash string
+		var p DuplicatePhoto
+		if err := rows.Scan(&hash, &p.ID, &p.Path, &p.URLPath, &p.SizeBytes, &p.Version, &p.CreatedAt); err != nil {
+			continue
+		}
+		if len(groups) == 0 || groups[len(groups)-1].Hash != hash {
+			groups = append(groups, DuplicateGroup{Hash: hash})
+		}
+		g := &groups[len(groups)-1]
+		g.Photos = append(g.Photos, p)
+	}
+	return groups, rows.Err()
+}
+
+func DuplicatesOf(ctx context.Context, db *database.DB, keepID int) ([]int, error) {
+	rows, err := db.Pool().Query(ctx,
+		"SELECT id FROM photos WHERE sha256 = (SELECT sha256 FROM photos WHERE id = $1) AND id <> $1", keepID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
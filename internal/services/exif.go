@@ -1,9 +1,13 @@
 package services
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"math"
 	"os"
 	"os/exec"
@@ -13,19 +17,40 @@ import (
 
 	"github.com/Alexander-D-Karpov/photodock/internal/models"
 	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
 )
 
 type ExifService struct {
 	hasExiftool bool
+	stripGPS    bool
+	defaultTZ   *time.Location
+	exiftool    exiftoolWorker
 }
 
-func NewExifService() *ExifService {
+func NewExifService(stripGPS bool, defaultTZ *time.Location) *ExifService {
 	_, err := exec.LookPath("exiftool")
+	if defaultTZ == nil {
+		defaultTZ = time.UTC
+	}
 	return &ExifService{
 		hasExiftool: err == nil,
+		stripGPS:    stripGPS,
+		defaultTZ:   defaultTZ,
 	}
 }
 
+func (s *ExifService) StripsGPS() bool {
+	return s.stripGPS
+}
+
+func (s *ExifService) HasExiftool() bool {
+	return s.hasExiftool
+}
+
+func (s *ExifService) Close(ctx context.Context) error {
+	return s.exiftool.close(ctx)
+}
+
 func (s *ExifService) Extract(path string) (*models.ExifInfo, time.Time, error) {
 	if s.hasExiftool {
 		return s.extractWithExiftool(path)
@@ -34,8 +59,7 @@ func (s *ExifService) Extract(path string) (*models.ExifInfo, time.Time, error)
 }
 
 func (s *ExifService) extractWithExiftool(path string) (*models.ExifInfo, time.Time, error) {
-	cmd := exec.Command("exiftool", "-json", "-a", "-G1", "-n", path)
-	output, err := cmd.Output()
+	output, err := s.exiftool.extract(path)
 	if err != nil {
 		return s.extractWithGoexif(path)
 	}
@@ -44,8 +68,11 @@ func (s *ExifService) extractWithExiftool(path string) (*models.ExifInfo, time.T
 	if err := json.Unmarshal(output, &results); err != nil || len(results) == 0 {
 		return s.extractWithGoexif(path)
 	}
+	info, takenAt := s.parseExiftool(results[0])
+	return info, takenAt, nil
+}
 
-	data := results[0]
+func (s *ExifService) parseExiftool(data map[string]interface{}) (*models.ExifInfo, time.Time) {
 	info := &models.ExifInfo{}
 	var takenAt time.Time
 
@@ -126,16 +153,13 @@ func (s *ExifService) extractWithExiftool(path string) (*models.ExifInfo, time.T
 	} else {
 		info.WhiteBalance = "Manual"
 	}
-	if ct := getInt(data, "Canon:ColorTemperature"); ct > 0 {
+	if ct := firstInt(data, "Canon:ColorTemperature", "Nikon:ColorTemperatureAuto", "Sony:ColorTemperature", "MakerNotes:ColorTemperature"); ct > 0 {
 		info.ColorTemperature = ct
 	}
 
 	info.ColorSpace = decodeColorSpace(getInt(data, "ExifIFD:ColorSpace"))
 
-	info.FocusMode = getString(data, "Canon:FocusMode")
-	if info.FocusMode == "" {
-		info.FocusMode = getString(data, "ExifIFD:FocusMode")
-	}
+	info.FocusMode = firstString(data, "Canon:FocusMode", "ExifIFD:FocusMode", "Nikon:FocusMode", "Sony:FocusMode", "MakerNotes:FocusMode")
 
 	if fdUpper := getFloat(data, "Canon:FocusDistanceUpper"); fdUpper > 0 {
 		fdLower := getFloat(data, "Canon:FocusDistanceLower")
@@ -169,13 +193,10 @@ func (s *ExifService) extractWithExiftool(path string) (*models.ExifInfo, time.T
 	if info.ShootingMode == "" {
 		info.ShootingMode = getString(data, "Canon:EasyMode")
 	}
-	info.DriveMode = getString(data, "Composite:DriveMode")
-	if info.DriveMode == "" {
-		info.DriveMode = getString(data, "Canon:ContinuousDrive")
-	}
+	info.DriveMode = firstString(data, "Composite:DriveMode", "Canon:ContinuousDrive", "Nikon:ShootingMode", "Sony:DriveMode", "Sony:ReleaseMode", "MakerNotes:DriveMode")
 	info.MacroMode = getString(data, "Canon:MacroMode")
 	info.SelfTimer = getString(data, "Canon:SelfTimer")
-	info.ImageStabilization = getString(data, "Canon:ImageStabilization")
+	info.ImageStabilization = firstString(data, "Canon:ImageStabilization", "Nikon:VibrationReduction", "Sony:SteadyShot", "Sony:ImageStabilization", "MakerNotes:ImageStabilization")
 
 	dzr := getFloat(data, "ExifIFD:DigitalZoomRatio")
 	if dzr <= 1 {
@@ -199,14 +220,8 @@ func (s *ExifService) extractWithExiftool(path string) (*models.ExifInfo, time.T
 		info.CustomRendered = "Custom"
 	}
 
-	info.FirmwareVersion = getString(data, "Canon:FirmwareVersion")
-	if info.FirmwareVersion == "" {
-		info.FirmwareVersion = getString(data, "Canon:CanonFirmwareVersion")
-	}
-	info.SerialNumber = getString(data, "Canon:SerialNumber")
-	if info.SerialNumber == "" {
-		info.SerialNumber = getString(data, "ExifIFD:SerialNumber")
-	}
+	info.FirmwareVersion = firstString(data, "Canon:FirmwareVersion", "Canon:CanonFirmwareVersion", "Nikon:FirmwareVersion", "Sony:FirmwareVersion", "MakerNotes:FirmwareVersion")
+	info.SerialNumber = firstString(data, "Canon:SerialNumber", "ExifIFD:SerialNumber", "Nikon:SerialNumber", "Sony:InternalSerialNumber", "MakerNotes:SerialNumber")
 	info.CameraTemperature = getString(data, "Canon:CameraTemperature")
 	info.FileNumber = getString(data, "Canon:FileNumber")
 	info.OwnerName = getString(data, "Canon:OwnerName")
@@ -216,7 +231,8 @@ func (s *ExifService) extractWithExiftool(path string) (*models.ExifInfo, time.T
 	}
 
 	if dto := getString(data, "ExifIFD:DateTimeOriginal"); dto != "" {
-		if t, err := time.Parse("2006:01:02 15:04:05", dto); err == nil {
+		offset := firstString(data, "ExifIFD:OffsetTimeOriginal", "ExifIFD:OffsetTime")
+		if t, err := parseExifTime(dto, offset, s.defaultTZ); err == nil {
 			takenAt = t
 			info.DateTimeOriginal = t.Format("2006-01-02 15:04:05")
 		}
@@ -232,7 +248,51 @@ func (s *ExifService) extractWithExiftool(path string) (*models.ExifInfo, time.T
 	info.ImageWidth = getInt(data, "File:ImageWidth")
 	info.ImageHeight = getInt(data, "File:ImageHeight")
 
-	return info, takenAt, nil
+	if !s.stripGPS {
+		info.Location = exiftoolLocation(data)
+	}
+
+	for _, key := range []string{"XMP-xmp:Rating", "IFD0:Rating"} {
+		if r := getInt(data, key); validRating(r) {
+			info.Rating = r
+			break
+		}
+	}
+
+	for _, key := range []string{"IPTC:Keywords", "XMP-dc:Subject"} {
+		for _, kw := range getStrings(data, key) {
+			info.Keywords = appendKeyword(info.Keywords, kw)
+		}
+	}
+
+	return info, takenAt
+}
+
+func exiftoolLocation(data map[string]interface{}) *models.GeoPoint {
+	// The composite tags are already signed by their N/S, E/W and
+	// above/below sea level refs when read with -n.
+	_, hasLat := data["Composite:GPSLatitude"]
+	_, hasLon := data["Composite:GPSLongitude"]
+	if !hasLat || !hasLon {
+		return nil
+	}
+	loc := &models.GeoPoint{
+		Lat: getFloat(data, "Composite:GPSLatitude"),
+		Lon: getFloat(data, "Composite:GPSLongitude"),
+	}
+	if _, ok := data["Composite:GPSAltitude"]; ok {
+		alt := getFloat(data, "Composite:GPSAltitude")
+		loc.Altitude = &alt
+	}
+	return validLocation(loc)
+}
+
+func validLocation(loc *models.GeoPoint) *models.GeoPoint {
+	// 0,0 is what a receiver without a fix writes.
+	if loc.Lat < -90 || loc.Lat > 90 || loc.Lon < -180 || loc.Lon > 180 || (loc.Lat == 0 && loc.Lon == 0) {
+		return nil
+	}
+	return loc
 }
 
 func getString(data map[string]interface{}, key string) string {
@@ -252,6 +312,49 @@ func getString(data map[string]interface{}, key string) string {
 	return ""
 }
 
+func firstString(data map[string]interface{}, keys ...string) string {
+	// Maker notes land in a per-brand group (Canon, Nikon, Sony, or the
+	// generic MakerNotes), so lookups try each in turn.
+	for _, key := range keys {
+		if s := getString(data, key); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func firstInt(data map[string]interface{}, keys ...string) int {
+	for _, key := range keys {
+		if i := getInt(data, key); i != 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+func validRating(r int) bool {
+	// 0 is unrated and -1 rejected; neither is a star rating.
+	return r >= 1 && r <= 5
+}
+
+func getStrings(data map[string]interface{}, key string) []string {
+	v, ok := data[key]
+	if !ok {
+		return nil
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		items = []interface{}{v}
+	}
+	var out []string
+	for _, item := range items {
+		if s := getString(map[string]interface{}{key: item}, key); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
 func getFloat(data map[string]interface{}, key string) float64 {
 	if v, ok := data[key]; ok {
 		switch val := v.(type) {
@@ -537,14 +640,111 @@ func (s *ExifService) extractWithGoexif(path string) (*models.ExifInfo, time.Tim
 		}
 	}
 
-	if tm, err := x.DateTime(); err == nil {
-		takenAt = tm
-		info.DateTimeOriginal = tm.Format("2006-01-02 15:04:05")
+	dto := s.getStringTag(x, exif.DateTimeOriginal)
+	if dto == "" {
+		dto = s.getStringTag(x, exif.DateTime)
+	}
+	if dto != "" {
+		// goexif's own DateTime() falls back to the server's zone; only
+		// Canon's TimeInfo zone is worth keeping from it.
+		loc := s.defaultTZ
+		if tz, err := x.TimeZone(); err == nil && tz != nil {
+			loc = tz
+		}
+		offset := goexifSubTag(x, exif.ExifIFDPointer, 0x9011)
+		if offset == "" {
+			offset = goexifSubTag(x, exif.ExifIFDPointer, 0x9010)
+		}
+		if tm, err := parseExifTime(dto, offset, loc); err == nil {
+			takenAt = tm
+			info.DateTimeOriginal = tm.Format("2006-01-02 15:04:05")
+		}
+	}
+
+	// Rating (0x4746) isn't one of goexif's named fields, so it is read
+	// from the raw IFD0 entries.
+	if len(x.Tiff.Dirs) > 0 {
+		for _, tag := range x.Tiff.Dirs[0].Tags {
+			if tag.Id == 0x4746 {
+				if r, err := tag.Int(0); err == nil && validRating(r) {
+					info.Rating = r
+				}
+			}
+		}
+	}
+
+	if !s.stripGPS {
+		if lat, lon, err := x.LatLong(); err == nil {
+			loc := &models.GeoPoint{Lat: lat, Lon: lon}
+			if tag, err := x.Get(exif.GPSAltitude); err == nil {
+				if num, den, err := tag.Rat2(0); err == nil && den != 0 {
+					alt := float64(num) / float64(den)
+					if ref, err := x.Get(exif.GPSAltitudeRef); err == nil {
+						if v, err := ref.Int(0); err == nil && v == 1 {
+							alt = -alt
+						}
+					}
+					loc.Altitude = &alt
+				}
+			}
+			info.Location = validLocation(loc)
+		}
 	}
 
 	return info, takenAt, nil
 }
 
+func goexifSubTag(x *exif.Exif, ptr exif.FieldName, id uint16) string {
+	// goexif drops sub-IFD tags it has no name for, such as the EXIF 2.31
+	// offset tags, so the sub-IFD is decoded again to find them.
+	tag, err := x.Get(ptr)
+	if err != nil {
+		return ""
+	}
+	offset, err := tag.Int64(0)
+	if err != nil || offset <= 0 || offset >= int64(len(x.Raw)) {
+		return ""
+	}
+	r := bytes.NewReader(x.Raw)
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return ""
+	}
+	dir, _, err := tiff.DecodeDir(r, x.Tiff.Order)
+	if err != nil {
+		return ""
+	}
+	for _, t := range dir.Tags {
+		if t.Id == id {
+			if v, err := t.StringVal(); err == nil {
+				return cleanString(v)
+			}
+		}
+	}
+	return ""
+}
+
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+func parseExifTime(value, offset string, fallback *time.Location) (time.Time, error) {
+	// The EXIF clock is the camera's wall time in no stated zone; the
+	// offset tags say which zone when the camera wrote them.
+	loc := fallback
+	if tz := parseExifOffset(offset); tz != nil {
+		loc = tz
+	}
+	return time.ParseInLocation(exifTimeLayout, strings.TrimSpace(value), loc)
+}
+
+func parseExifOffset(s string) *time.Location {
+	s = strings.TrimSpace(s)
+	t, err := time.Parse("Z07:00", s)
+	if err != nil {
+		return nil
+	}
+	_, off := t.Zone()
+	return time.FixedZone(s, off)
+}
+
 func (s *ExifService) getStringTag(x *exif.Exif, field exif.FieldName) string {
 	if tag, err := x.Get(field); err == nil {
 		if v, err := tag.StringVal(); err == nil {
@@ -555,17 +755,51 @@ func (s *ExifService) getStringTag(x *exif.Exif, field exif.FieldName) string {
 }
 
 func (s *ExifService) StripGPS(path string) error {
-	return stripGPSFromJPEG(path)
+	if !s.stripGPS {
+		return nil
+	}
+	if s.hasExiftool {
+		// In place so hard-linked copies of an upload stay linked and the
+		// file keeps its owner and mode.
+		out, err := s.exiftool.run([]string{"-gps:all=", "-xmp-exif:gps*=", "-overwrite_original_in_place"}, path)
+		if err == nil && !bytes.Contains(out, []byte("weren't updated due to errors")) {
+			return nil
+		}
+	}
+	return stripGPSFromFile(path)
+}
+
+func (s *ExifService) HasGPS(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	_, changed := removeGPS(data)
+	return changed
 }
 
-func stripGPSFromJPEG(path string) error {
+func stripGPSFromFile(path string) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
 
+	if result, modified := removeGPS(data); modified {
+		return os.WriteFile(path, result, 0644)
+	}
+	return nil
+}
+
+func removeGPS(data []byte) ([]byte, bool) {
+	if bytes.HasPrefix(data, pngSignature) {
+		return removeGPSFromPNG(data)
+	}
+	return removeGPSFromJPEG(data)
+}
+
+func removeGPSFromJPEG(data []byte) ([]byte, bool) {
 	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
-		return nil
+		return data, false
 	}
 
 	modified := false
@@ -592,14 +826,18 @@ func stripGPSFromJPEG(path string) error {
 			break
 		}
 		segLen := int(binary.BigEndian.Uint16(data[pos+2:pos+4])) + 2
+		if pos+segLen > len(data) {
+			result = append(result, data[pos:]...)
+			break
+		}
 
 		if marker == 0xE1 && pos+10 < len(data) {
 			if string(data[pos+4:pos+10]) == "Exif\x00\x00" {
-				cleaned, changed := removeGPSFromExif(data[pos : pos+segLen])
-				if changed {
+				segment := append([]byte(nil), data[pos:pos+segLen]...)
+				if removeGPSFromTIFF(segment[10:]) {
 					modified = true
 				}
-				result = append(result, cleaned...)
+				result = append(result, segment...)
 				pos += segLen
 				continue
 			}
@@ -609,65 +847,108 @@ func stripGPSFromJPEG(path string) error {
 		pos += segLen
 	}
 
-	if modified {
-		return os.WriteFile(path, result, 0644)
-	}
-	return nil
+	return result, modified
 }
 
-func removeGPSFromExif(segment []byte) ([]byte, bool) {
-	if len(segment) < 12 {
-		return segment, false
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func removeGPSFromPNG(data []byte) ([]byte, bool) {
+	result := append([]byte(nil), data...)
+	modified := false
+	pos := len(pngSignature)
+	for pos+12 <= len(result) {
+		length := int(binary.BigEndian.Uint32(result[pos : pos+4]))
+		if length < 0 || pos+12+length > len(result) {
+			break
+		}
+		kind := string(result[pos+4 : pos+8])
+		if kind == "eXIf" && removeGPSFromTIFF(result[pos+8:pos+8+length]) {
+			binary.BigEndian.PutUint32(result[pos+8+length:], crc32.ChecksumIEEE(result[pos+4:pos+8+length]))
+			modified = true
+		}
+		if kind == "IEND" {
+			break
+		}
+		pos += 12 + length
 	}
+	return result, modified
+}
 
-	exifData := segment[10:]
-	if len(exifData) < 8 {
-		return segment, false
+func removeGPSFromTIFF(tiff []byte) bool {
+	// Lengths and offsets stay put: the GPS pointer entry is dropped from
+	// IFD0 and the GPS IFD with every value it points at is zeroed.
+	if len(tiff) < 8 {
+		return false
 	}
 
 	var bo binary.ByteOrder
-	if string(exifData[0:2]) == "II" {
+	switch string(tiff[0:2]) {
+	case "II":
 		bo = binary.LittleEndian
-	} else if string(exifData[0:2]) == "MM" {
+	case "MM":
 		bo = binary.BigEndian
-	} else {
-		return segment, false
+	default:
+		return false
 	}
 
-	ifdOffset := bo.Uint32(exifData[4:8])
-	if int(ifdOffset) >= len(exifData) {
-		return segment, false
+	ifd := int(bo.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return false
+	}
+	count := int(bo.Uint16(tiff[ifd : ifd+2]))
+	end := ifd + 2 + count*12 + 4
+	if end > len(tiff) {
+		return false
 	}
 
-	result := make([]byte, len(segment))
-	copy(result, segment)
-	exifResult := result[10:]
-	modified := false
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if bo.Uint16(tiff[entry:entry+2]) != 0x8825 {
+			continue
+		}
+		zeroGPSIFD(tiff, bo, int(bo.Uint32(tiff[entry+8:entry+12])))
 
-	offset := int(ifdOffset)
-	if offset+2 > len(exifResult) {
-		return segment, false
+		copy(tiff[entry:], tiff[entry+12:end])
+		clear(tiff[end-12 : end])
+		bo.PutUint16(tiff[ifd:ifd+2], uint16(count-1))
+		return true
 	}
+	return false
+}
 
-	numEntries := int(bo.Uint16(exifResult[offset : offset+2]))
-	offset += 2
-
-	for i := 0; i < numEntries; i++ {
-		entryOffset := offset + i*12
-		if entryOffset+12 > len(exifResult) {
-			break
+func zeroGPSIFD(tiff []byte, bo binary.ByteOrder, ifd int) {
+	if ifd <= 0 || ifd+2 > len(tiff) {
+		return
+	}
+	count := int(bo.Uint16(tiff[ifd : ifd+2]))
+	end := ifd + 2 + count*12 + 4
+	if end > len(tiff) {
+		return
+	}
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		size := tiffTypeSize(bo.Uint16(tiff[entry+2:entry+4])) * int(bo.Uint32(tiff[entry+4:entry+8]))
+		if size <= 4 {
+			continue
 		}
-
-		tag := bo.Uint16(exifResult[entryOffset : entryOffset+2])
-		if tag == 0x8825 {
-			for j := entryOffset; j < entryOffset+12; j++ {
-				exifResult[j] = 0
-			}
-			modified = true
+		if off := int(bo.Uint32(tiff[entry+8 : entry+12])); off > 0 && off+size <= len(tiff) {
+			clear(tiff[off : off+size])
 		}
 	}
+	clear(tiff[ifd:end])
+}
 
-	return result, modified
+func tiffTypeSize(typ uint16) int {
+	switch typ {
+	case 3, 8:
+		return 2
+	case 4, 9, 11:
+		return 4
+	case 5, 10, 12:
+		return 8
+	default:
+		return 1
+	}
 }
 
 func cleanString(s string) string {
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/models"
+)
+
+var exifFields = sync.OnceValue(func() map[string]int {
+	// Keyed by the JSON name, which is what exif_data stores and what
+	// EXIF_PRIVATE_FIELDS lists, so a field added to ExifInfo is covered
+	// without touching this file.
+	t := reflect.TypeOf(models.ExifInfo{})
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+})
+
+func RedactExif(info *models.ExifInfo, names []string) {
+	if info == nil {
+		return
+	}
+	v := reflect.ValueOf(info).Elem()
+	for _, name := range names {
+		if i, ok := exifFields()[name]; ok {
+			f := v.Field(i)
+			f.Set(reflect.Zero(f.Type()))
+		}
+	}
+}
+
+func UnknownExifFields(names []string) []string {
+	var unknown []string
+	for _, name := range names {
+		if _, ok := exifFields()[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
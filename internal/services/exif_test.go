@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/testutil"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// exifBlock is the Exif data of a JPEG as it is, or the eXIf chunk of a
+// PNG.
+func exifBlock(t *testing.T, data []byte) []byte {
+	t.Helper()
+	if !bytes.HasPrefix(data, pngSignature) {
+		return data
+	}
+	for pos := len(pngSignature); pos+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if string(data[pos+4:pos+8]) == "eXIf" {
+			return data[pos+8 : pos+8+length]
+		}
+		pos += 12 + length
+	}
+	t.Fatal("no eXIf chunk")
+	return nil
+}
+
+func TestStripGPS(t *testing.T) {
+	meta := &testutil.EXIF{
+		Make:             "Canon",
+		DateTimeOriginal: "2023:07:14 10:30:00",
+		GPS:              &testutil.GPS{Lat: 60.1, Lon: -19.9},
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"photo.jpg", testutil.JPEG(64, 48, meta)},
+		{"photo.png", testutil.PNG(64, 48, meta)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := exif.Decode(bytes.NewReader(exifBlock(t, tt.data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := before.LatLong(); err != nil {
+				t.Fatalf("fixture has no GPS: %v", err)
+			}
+
+			path := filepath.Join(t.TempDir(), tt.name)
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := stripGPSFromFile(path); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) != len(tt.data) {
+				t.Errorf("size changed from %d to %d", len(tt.data), len(data))
+			}
+
+			after, err := exif.Decode(bytes.NewReader(exifBlock(t, data)))
+			if err != nil {
+				t.Fatalf("Exif unreadable after stripping: %v", err)
+			}
+			if _, err := after.Get(exif.GPSInfoIFDPointer); err == nil {
+				t.Error("GPS IFD pointer left in IFD0")
+			}
+			if _, _, err := after.LatLong(); err == nil {
+				t.Error("coordinates still readable")
+			}
+			if tag, err := after.Get(exif.Make); err != nil {
+				t.Errorf("Make lost: %v", err)
+			} else if s, _ := tag.StringVal(); s != "Canon" {
+				t.Errorf("Make = %q", s)
+			}
+			if _, err := after.DateTime(); err != nil {
+				t.Errorf("DateTimeOriginal lost: %v", err)
+			}
+
+			if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+				t.Errorf("image no longer decodes: %v", err)
+			}
+			if NewExifService(true, nil).HasGPS(path) {
+				t.Error("HasGPS still true")
+			}
+		})
+	}
+}
+
+func TestParseExifTime(t *testing.T) {
+	berlin := time.FixedZone("CET", 3600)
+	tests := []struct {
+		name   string
+		offset string
+		want   string
+	}{
+		{"with an offset", "+02:00", "2023-07-14T10:30:00+02:00"},
+		{"without one", "", "2023-07-14T10:30:00+01:00"},
+		{"negative", "-05:30", "2023-07-14T10:30:00-05:30"},
+		{"UTC", "+00:00", "2023-07-14T10:30:00Z"},
+		{"unparsable", "02:00", "2023-07-14T10:30:00+01:00"},
+	}
+	for _, tt := range tests {
+		got, err := parseExifTime("2023:07:14 10:30:00", tt.offset, berlin)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if s := got.Format(time.RFC3339); s != tt.want {
+			t.Errorf("%s: parseExifTime(%q) = %s, want %s", tt.name, tt.offset, s, tt.want)
+		}
+	}
+}
+
+func TestExtractOffsetTimeOriginal(t *testing.T) {
+	tests := []struct {
+		offset string
+		want   string
+	}{
+		{"+02:00", "2023-07-14T08:30:00Z"},
+		{"", "2023-07-14T10:30:00Z"},
+		{"-07:00", "2023-07-14T17:30:00Z"},
+	}
+	svc := NewExifService(false, time.UTC)
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "photo.jpg")
+		data := testutil.JPEG(32, 32, &testutil.EXIF{DateTimeOriginal: "2023:07:14 10:30:00", OffsetTimeOriginal: tt.offset})
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, takenAt, err := svc.extractWithGoexif(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := takenAt.UTC().Format(time.RFC3339); s != tt.want {
+			t.Errorf("offset %q: taken at %s, want %s", tt.offset, s, tt.want)
+		}
+	}
+}
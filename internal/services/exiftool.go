@@ -0,0 +1,169 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+var exiftoolArgs = []string{"-json", "-a", "-G1", "-n"}
+
+// A stuck read means exiftool is wedged on a file; the process is killed
+// and the next call starts a fresh one.
+const exiftoolTimeout = 30 * time.Second
+
+var errExiftoolClosed = errors.New("exiftool worker closed")
+
+type exiftoolWorker struct {
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	seq    int
+	closed bool
+	// Set when the process cannot even be started, so every photo of a scan
+	// doesn't pay for another failed exec.
+	broken bool
+}
+
+func (w *exiftoolWorker) extract(path string) ([]byte, error) {
+	return w.run(exiftoolArgs, path)
+}
+
+func (w *exiftoolWorker) run(args []string, path string) ([]byte, error) {
+	// Argument files are line based, so a name or value with a line break
+	// can only go through a one-shot invocation.
+	if strings.ContainsAny(path, "\r\n") || strings.ContainsAny(strings.Join(args, ""), "\r\n") {
+		return exiftoolOnce(args, path)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed || w.broken {
+		return exiftoolOnce(args, path)
+	}
+	if w.cmd == nil {
+		if err := w.start(); err != nil {
+			log.Printf("exiftool: persistent worker unavailable, using one-shot: %v", err)
+			w.broken = true
+			return exiftoolOnce(args, path)
+		}
+	}
+
+	out, err := w.request(args, path)
+	if err != nil {
+		log.Printf("exiftool: worker failed on %s, restarting: %v", path, err)
+		w.stop()
+		return exiftoolOnce(args, path)
+	}
+	return out, nil
+}
+
+func (w *exiftoolWorker) start() error {
+	cmd := exec.Command("exiftool", "-stay_open", "True", "-@", "-")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	w.cmd = cmd
+	w.stdin = stdin
+	w.stdout = bufio.NewReaderSize(stdout, 64*1024)
+	return nil
+}
+
+func (w *exiftoolWorker) request(args []string, path string) ([]byte, error) {
+	w.seq++
+	var req strings.Builder
+	for _, arg := range args {
+		req.WriteString(arg + "\n")
+	}
+	fmt.Fprintf(&req, "%s\n-execute%d\n", path, w.seq)
+	if _, err := io.WriteString(w.stdin, req.String()); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		out []byte
+		err error
+	}
+	done := make(chan result, 1)
+	marker := fmt.Sprintf("{ready%d}", w.seq)
+	stdout := w.stdout
+	go func() {
+		var buf bytes.Buffer
+		for {
+			line, err := stdout.ReadString('\n')
+			if strings.TrimSpace(line) == marker {
+				done <- result{out: buf.Bytes()}
+				return
+			}
+			buf.WriteString(line)
+			if err != nil {
+				done <- result{err: err}
+				return
+			}
+		}
+	}()
+
+	select {
+	case res := <-done:
+		return res.out, res.err
+	case <-time.After(exiftoolTimeout):
+		return nil, fmt.Errorf("no response after %s", exiftoolTimeout)
+	}
+}
+
+func (w *exiftoolWorker) stop() {
+	if w.cmd == nil {
+		return
+	}
+	_ = w.stdin.Close()
+	_ = w.cmd.Process.Kill()
+	_ = w.cmd.Wait()
+	w.cmd = nil
+}
+
+func (w *exiftoolWorker) close(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.cmd == nil {
+		return nil
+	}
+
+	// Ask politely first so exiftool finishes and exits on its own; kill it
+	// only if it doesn't within the shutdown deadline.
+	_, _ = io.WriteString(w.stdin, "-stay_open\nFalse\n")
+	_ = w.stdin.Close()
+	exited := make(chan error, 1)
+	go func() { exited <- w.cmd.Wait() }()
+	select {
+	case <-exited:
+	case <-ctx.Done():
+		_ = w.cmd.Process.Kill()
+		<-exited
+	}
+	w.cmd = nil
+	return nil
+}
+
+func exiftoolOnce(args []string, path string) ([]byte, error) {
+	argv := append(append([]string{}, args...), path)
+	return exec.Command("exiftool", argv...).Output()
+}
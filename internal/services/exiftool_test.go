@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/models"
+	"github.com/Alexander-D-Karpov/photodock/internal/testutil"
+)
+
+func loadExiftoolFixture(t *testing.T, name string) map[string]interface{} {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", "exiftool", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []map[string]interface{}
+	if err := json.Unmarshal(b, &results); err != nil || len(results) != 1 {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return results[0]
+}
+
+func parsedFields(info *models.ExifInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"make":          info.CameraMake,
+		"model":         info.CameraModel,
+		"lens":          info.LensModel,
+		"lens info":     info.LensInfo,
+		"focal 35mm":    info.FocalLength35mm,
+		"aperture":      info.Aperture,
+		"shutter":       info.ShutterSpeed,
+		"iso":           info.ISO,
+		"exposure comp": info.ExposureComp,
+		"white balance": info.WhiteBalance,
+		"color temp":    info.ColorTemperature,
+		"firmware":      info.FirmwareVersion,
+		"serial":        info.SerialNumber,
+		"focus mode":    info.FocusMode,
+		"focus dist":    info.FocusDistance,
+		"drive mode":    info.DriveMode,
+		"stabilization": info.ImageStabilization,
+		"digital zoom":  info.DigitalZoom,
+		"orientation":   info.Orientation,
+		"rating":        info.Rating,
+		"keywords":      info.Keywords,
+	}
+}
+
+func TestParseExiftool(t *testing.T) {
+	tests := []struct {
+		fixture string
+		takenAt string
+		want    map[string]interface{}
+	}{
+		{"canon.json", "2023-07-14T07:30:00Z", map[string]interface{}{
+			"make":          "Canon",
+			"model":         "Canon EOS R5",
+			"lens":          "RF24-70mm F2.8 L IS USM",
+			"lens info":     "24 - 70 mm",
+			"aperture":      "f/2.8",
+			"shutter":       "1/250 s",
+			"iso":           200,
+			"exposure comp": "-0.3 EV",
+			"white balance": "Auto",
+			"color temp":    5200,
+			"firmware":      "Firmware Version 1.8.1",
+			"serial":        "032021001234",
+			"focus mode":    "One-shot AF",
+			"focus dist":    "3.20 - 3.50 m",
+			"drive mode":    "Single",
+			"stabilization": "On",
+			"rating":        4,
+			"keywords":      []string{"beach", "summer", "Åland"},
+		}},
+		{"nikon.json", "2023-01-01T04:59:30Z", map[string]interface{}{
+			"make":          "NIKON CORPORATION",
+			"model":         "NIKON Z 6_2",
+			"lens":          "NIKKOR Z 14-30mm f/4 S",
+			"focal 35mm":    "14 mm",
+			"aperture":      "f/8.0",
+			"shutter":       "2.5 s",
+			"exposure comp": "0 EV",
+			"white balance": "Manual",
+			"color temp":    4800,
+			"firmware":      "1.40",
+			"serial":        "6012345",
+			"focus mode":    "AF-S",
+			"drive mode":    "Single-Frame",
+			"stabilization": "On",
+			"digital zoom":  "None",
+			"orientation":   6,
+		}},
+		{"sony.json", "2024-03-02T07:15:00Z", map[string]interface{}{
+			"make":          "SONY",
+			"model":         "ILCE-7M4",
+			"lens":          "FE 85mm F1.8",
+			"aperture":      "f/1.8",
+			"shutter":       "1/2000 s",
+			"iso":           800,
+			"exposure comp": "+0.7 EV",
+			"serial":        "a1b2c3d4e5f6",
+			"focus mode":    "AF-C",
+			"drive mode":    "Continuous",
+			"stabilization": "On",
+			"digital zoom":  "2.0x",
+			"rating":        2,
+		}},
+	}
+	// Sony writes no offset, so its time is in the default zone.
+	svc := NewExifService(true, time.FixedZone("CET", 3600))
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			info, takenAt := svc.parseExiftool(loadExiftoolFixture(t, tt.fixture))
+			if got := takenAt.UTC().Format(time.RFC3339); got != tt.takenAt {
+				t.Errorf("taken at %s, want %s", got, tt.takenAt)
+			}
+			got := parsedFields(info)
+			for field, want := range tt.want {
+				if !reflect.DeepEqual(got[field], want) {
+					t.Errorf("%s = %#v, want %#v", field, got[field], want)
+				}
+			}
+			if info.Location != nil {
+				t.Errorf("location kept while stripping GPS: %+v", info.Location)
+			}
+		})
+	}
+}
+
+func TestParseExiftoolLocation(t *testing.T) {
+	svc := NewExifService(false, time.UTC)
+	info, _ := svc.parseExiftool(loadExiftoolFixture(t, "canon.json"))
+	loc := info.Location
+	if loc == nil || loc.Lat != 60.1 || loc.Lon != 19.9 || loc.Altitude == nil || *loc.Altitude != 12.5 {
+		t.Errorf("location = %+v", loc)
+	}
+}
+
+// BenchmarkExiftool compares one extraction through the stay-open worker
+// with starting exiftool for each file, as every call did before.
+func BenchmarkExiftool(b *testing.B) {
+	if _, err := exec.LookPath("exiftool"); err != nil {
+		b.Skip("exiftool is not installed")
+	}
+	path := filepath.Join(b.TempDir(), "photo.jpg")
+	data := testutil.JPEG(640, 480, &testutil.EXIF{Make: "Canon", DateTimeOriginal: "2023:07:14 10:30:00"})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("stay-open", func(b *testing.B) {
+		w := &exiftoolWorker{}
+		defer func() { _ = w.close(context.Background()) }()
+		if _, err := w.extract(path); err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := w.extract(path); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("one-shot", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := exiftoolOnce(exiftoolArgs, path); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
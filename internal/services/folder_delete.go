@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrOutsideMediaRoot = errors.New("folder is not inside MEDIA_ROOT")
+
+type FolderDeleteResult struct {
+	Mode    string   `json:"mode"`
+	Folders int      `json:"folders"`
+	Photos  int      `json:"photos"`
+	Message string   `json:"message"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// Without purge the files stay, so a later scan adds them back.
+func (s *ScannerService) DeleteFolder(ctx context.Context, id int, purge bool) (FolderDeleteResult, error) {
+	res := FolderDeleteResult{Mode: "detach"}
+	if purge {
+		res.Mode = "purge"
+	}
+
+	if !s.maintMu.TryLock() {
+		return res, ErrMaintenanceRunning
+	}
+	defer s.maintMu.Unlock()
+
+	var relPath string
+	if err := s.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", id).Scan(&relPath); err != nil {
+		return res, err
+	}
+	absPath := ResolveMediaPath(s.mediaRoot, relPath)
+	if purge {
+		if err := s.checkInsideRoot(absPath); err != nil {
+			return res, err
+		}
+	}
+
+	tx, err := s.db.Pool().Begin(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Photos are the folders' rows plus, when the files go, any row whose
+	// file is in the tree but was moved to a folder elsewhere.
+	photoSQL := `DELETE FROM photos WHERE folder_id IN (SELECT id FROM folders WHERE ` + fmt.Sprintf(subtreeSQL, "path") + `)`
+	if purge {
+		photoSQL += " OR " + fmt.Sprintf(subtreeSQL, "path")
+	}
+	rows, err := tx.Query(ctx, photoSQL+" RETURNING id, path, COALESCE(sha256, '')", relPath)
+	if err != nil {
+		return res, err
+	}
+	photos := make(map[int]string)
+	sums := make(map[int]string)
+	for rows.Next() {
+		var pid int
+		var p, sum string
+		if rows.Scan(&pid, &p, &sum) == nil {
+			photos[pid] = p
+			sums[pid] = sum
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+
+	tag, err := tx.Exec(ctx, "DELETE FROM folders WHERE "+fmt.Sprintf(subtreeSQL, "path"), relPath)
+	if err != nil {
+		return res, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return res, err
+	}
+	res.Folders = int(tag.RowsAffected())
+	res.Photos = len(photos)
+
+	for pid, p := range photos {
+		_ = s.thumbSvc.DeleteThumbnailsByID(pid)
+		s.thumbSvc.DeleteWebOriginal(p)
+		if !purge || p == relPath || strings.HasPrefix(p, relPath+"/") {
+			continue
+		}
+		if err := RemovePhotoFile(ctx, s.db, s.mediaRoot, p, sums[pid]); err != nil {
+			res.Errors = append(res.Errors, err.Error())
+		}
+	}
+	if err := PruneSharedContent(ctx, s.db); err != nil {
+		log.Printf("pruning shared content markers: %v", err)
+	}
+
+	if !purge {
+		res.Message = "Removed from the library only. The files are still in MEDIA_ROOT, and the next scan will add them back."
+		return res, nil
+	}
+	if err := os.RemoveAll(absPath); err != nil {
+		res.Errors = append(res.Errors, err.Error())
+	}
+	res.Message = "Removed from the library and deleted from disk."
+	if len(res.Errors) > 0 {
+		res.Message = "Removed from the library, but some files could not be deleted."
+	}
+	log.Printf("Deleted folder %s from disk (%d photos)", relPath, res.Photos)
+	return res, nil
+}
+
+func (s *ScannerService) checkInsideRoot(absPath string) error {
+	root, target := s.mediaRoot, absPath
+	if _, err := os.Lstat(absPath); err == nil {
+		if root, err = filepath.EvalSymlinks(root); err != nil {
+			return err
+		}
+		if target, err = filepath.EvalSymlinks(target); err != nil {
+			return err
+		}
+	}
+	root, _ = filepath.Abs(root)
+	target, _ = filepath.Abs(target)
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ErrOutsideMediaRoot
+	}
+	return nil
+}
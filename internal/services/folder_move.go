@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrFolderIntoItself = errors.New("a folder can't be moved into itself or one of its subfolders")
+	ErrFolderExists     = errors.New("a folder with that name already exists there")
+)
+
+// subtreeSQL matches a path column against $1 and everything under it.
+const subtreeSQL = "(%[1]s = $1 OR left(%[1]s, length($1) + 1) = $1 || '/')"
+
+// MoveFolder returns the folder's new path; a nil parentID is the root.
+func (s *ScannerService) MoveFolder(ctx context.Context, id int, parentID *int, name string) (string, error) {
+	oldPath, newPath, err := s.folderTarget(ctx, id, parentID, name)
+	if err != nil {
+		return "", err
+	}
+	if newPath == oldPath {
+		_, err := s.db.Pool().Exec(ctx, "UPDATE folders SET name = $2 WHERE id = $1", id, name)
+		return oldPath, err
+	}
+
+	if !s.maintMu.TryLock() {
+		return "", ErrMaintenanceRunning
+	}
+	defer s.maintMu.Unlock()
+	return s.relocateFolder(ctx, id, parentID, name)
+}
+
+func (s *ScannerService) folderTarget(ctx context.Context, id int, parentID *int, name string) (string, string, error) {
+	var oldPath string
+	if err := s.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", id).Scan(&oldPath); err != nil {
+		return "", "", err
+	}
+
+	parentPath := ""
+	if parentID != nil {
+		if err := s.db.Pool().QueryRow(ctx, "SELECT path FROM folders WHERE id = $1", *parentID).Scan(&parentPath); err != nil {
+			return "", "", fmt.Errorf("target folder: %w", err)
+		}
+		if parentPath == oldPath || strings.HasPrefix(parentPath, oldPath+"/") {
+			return "", "", ErrFolderIntoItself
+		}
+	}
+	return oldPath, path.Join(parentPath, name), nil
+}
+
+// The transaction is committed only once the directory has moved.
+func (s *ScannerService) relocateFolder(ctx context.Context, id int, parentID *int, name string) (string, error) {
+	oldPath, newPath, err := s.folderTarget(ctx, id, parentID, name)
+	if err != nil || newPath == oldPath {
+		return oldPath, err
+	}
+
+	var taken bool
+	_ = s.db.Pool().QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM folders WHERE path = $1)", newPath).Scan(&taken)
+	oldAbs := ResolveMediaPath(s.mediaRoot, oldPath)
+	newAbs := ResolveMediaPath(s.mediaRoot, newPath)
+	// A case-only rename finds the old directory itself on a
+	// case-insensitive filesystem.
+	if _, err := os.Lstat(newAbs); err == nil && !strings.EqualFold(oldPath, newPath) {
+		taken = true
+	}
+	if taken {
+		return "", fmt.Errorf("%w: %s", ErrFolderExists, newPath)
+	}
+
+	var heifPaths []string
+	rows, err := s.db.Pool().Query(ctx, "SELECT path FROM photos WHERE "+fmt.Sprintf(subtreeSQL, "path"), oldPath)
+	if err != nil {
+		return "", err
+	}
+	for rows.Next() {
+		var p string
+		if rows.Scan(&p) == nil && isHEIF(p) {
+			heifPaths = append(heifPaths, p)
+		}
+	}
+	rows.Close()
+
+	tx, err := s.db.Pool().Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, "UPDATE folders SET parent_id = $2, name = $3 WHERE id = $1", id, parentID, name); err != nil {
+		return "", err
+	}
+	for _, q := range []string{
+		"UPDATE folders SET path = $2 || substr(path, length($1) + 1) WHERE " + fmt.Sprintf(subtreeSQL, "path"),
+		"UPDATE photos SET path = $2 || substr(path, length($1) + 1) WHERE " + fmt.Sprintf(subtreeSQL, "path"),
+		// Earlier folder redirects follow the folders to where they are now.
+		"UPDATE url_redirects SET new_path = $2 || substr(new_path, length($1) + 1) WHERE photo_id IS NULL AND " + fmt.Sprintf(subtreeSQL, "new_path"),
+		`INSERT INTO url_redirects (old_path, new_path)
+		SELECT $1 || substr(path, length($2) + 1), path FROM folders
+		WHERE path = $2 OR left(path, length($2) + 1) = $2 || '/'
+		ON CONFLICT (old_path) DO UPDATE SET new_path = EXCLUDED.new_path, photo_id = NULL, created_at = NOW()`,
+	} {
+		if _, err := tx.Exec(ctx, q, oldPath, newPath); err != nil {
+			return "", err
+		}
+	}
+	// Moving a folder back leaves redirects that point at themselves.
+	if _, err := tx.Exec(ctx, "DELETE FROM url_redirects WHERE old_path = new_path"); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(newAbs), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(oldAbs, newAbs); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		if rerr := os.Rename(newAbs, oldAbs); rerr != nil {
+			log.Printf("move folder %s back from %s: %v", oldPath, newPath, rerr)
+		}
+		return "", err
+	}
+
+	// The converted HEIF originals are cached by path.
+	for _, p := range heifPaths {
+		s.thumbSvc.DeleteWebOriginal(p)
+	}
+	if err := RefreshDraftFlags(ctx, s.db); err != nil {
+		log.Printf("refresh draft flags after moving %s: %v", oldPath, err)
+	}
+	log.Printf("Moved folder %s to %s", oldPath, newPath)
+	return newPath, nil
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const IgnoreFileName = ".photodockignore"
+
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+	// Patterns without a slash match a name at any depth; the others
+	// match the whole path from the media root.
+	anchored bool
+}
+
+// A nil matcher ignores nothing.
+type ignoreMatcher struct {
+	patterns []ignorePattern
+}
+
+func (s *ScannerService) loadIgnore() *ignoreMatcher {
+	lines := append([]string(nil), s.ignore...)
+	f, err := os.Open(filepath.Join(s.mediaRoot, IgnoreFileName))
+	if err == nil {
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		if err := sc.Err(); err != nil {
+			log.Printf("read %s: %v", IgnoreFileName, err)
+		}
+		_ = f.Close()
+	} else if !os.IsNotExist(err) {
+		log.Printf("read %s: %v", IgnoreFileName, err)
+	}
+
+	m := &ignoreMatcher{}
+	for _, line := range lines {
+		if p, ok := parseIgnorePattern(line); ok {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+	if len(m.patterns) == 0 {
+		return nil
+	}
+	return m
+}
+
+func parseIgnorePattern(line string) (ignorePattern, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+	var p ignorePattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignorePattern{}, false
+	}
+
+	re, err := regexp.Compile("^" + globToRegexp(NormalizePath(line)) + "$")
+	if err != nil {
+		log.Printf("ignore pattern %q: %v", line, err)
+		return ignorePattern{}, false
+	}
+	p.re = re
+	return p, true
+}
+
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			if end := strings.IndexByte(glob[i:], ']'); end > 1 {
+				class := glob[i+1 : i+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				b.WriteString("[" + class + "]")
+				i += end
+				continue
+			}
+			b.WriteString(`\[`)
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// The last matching pattern wins, so "!" can bring a path back.
+func (m *ignoreMatcher) match(relPath string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	relPath = filepath.ToSlash(relPath)
+	name := relPath[strings.LastIndexByte(relPath, '/')+1:]
+
+	ignored := false
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		subject := name
+		if p.anchored {
+			subject = relPath
+		}
+		if p.re.MatchString(subject) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// matchPath is match for a stored path whose parent directories were not
+// checked on the way down.
+func (m *ignoreMatcher) matchPath(relPath string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	for i := 1; i < len(parts); i++ {
+		if m.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(relPath, isDir)
+}
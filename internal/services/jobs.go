@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Jobs that change the library as a whole. Only one of them, or another
+// maintenance task, runs at a time; they all hold maintMu.
+const (
+	JobScan       = "scan"
+	JobClean      = "clean"
+	JobRegenerate = "regenerate-urls"
+)
+
+const (
+	JobIdle     = "idle"
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+type JobStatus struct {
+	Job            string     `json:"job,omitempty"`
+	State          string     `json:"state"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+	CurrentFolder  string     `json:"current_folder"`
+	FilesProcessed int        `json:"files_processed"`
+	Added          int        `json:"added"`
+	Updated        int        `json:"updated"`
+	Removed        int        `json:"removed"`
+	Errors         int        `json:"errors"`
+	Error          string     `json:"error,omitempty"`
+}
+
+type jobProgress struct {
+	mu     sync.Mutex
+	status JobStatus
+
+	cancel    context.CancelFunc
+	canceling bool
+
+	// Folder scans after uploads and from the watcher share maintMu and
+	// aren't jobs of their own; counted so a refused job can say why.
+	folderScans atomic.Int32
+}
+
+func (p *jobProgress) begin(name string) JobStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	started := time.Now()
+	p.status = JobStatus{Job: name, State: JobRunning, StartedAt: &started}
+	p.canceling = false
+	return p.status
+}
+
+func (p *jobProgress) setCancel(cancel context.CancelFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cancel = cancel
+	// Canceled between BeginJob and the walk starting.
+	if p.canceling {
+		cancel()
+	}
+}
+
+// The methods below are called from scanDir for every scan; only the full
+// scan passes a progress, so they do nothing on a nil receiver.
+
+func (p *jobProgress) folder(relPath string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.status.CurrentFolder = relPath
+	p.mu.Unlock()
+}
+
+func (p *jobProgress) file(err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.status.FilesProcessed++
+	if err != nil {
+		p.status.Errors++
+	}
+	p.mu.Unlock()
+}
+
+func (p *jobProgress) failed() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.status.Errors++
+	p.mu.Unlock()
+}
+
+func (p *jobProgress) removed(n int) {
+	p.mu.Lock()
+	p.status.Removed += n
+	p.mu.Unlock()
+}
+
+func (p *jobProgress) finish(stats *scanStats, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	finished := time.Now()
+	p.status.State = JobDone
+	p.status.FinishedAt = &finished
+	p.status.CurrentFolder = ""
+	if stats != nil {
+		p.status.Added, p.status.Updated, p.status.Removed = int(stats.Added.Load()), int(stats.Updated.Load()), int(stats.Removed.Load())
+	}
+	p.cancel = nil
+	switch {
+	case p.canceling || errors.Is(err, context.Canceled):
+		p.status.State = JobCanceled
+	case err != nil:
+		p.status.State = JobFailed
+		p.status.Error = err.Error()
+	}
+}
+
+// BeginJob claims maintMu before the job is started in the background,
+// so a status poll right after already sees it running. When something
+// else holds it, its status is returned instead.
+func (s *ScannerService) BeginJob(name string) (JobStatus, bool) {
+	if !s.maintMu.TryLock() {
+		return s.RunningJob(), false
+	}
+	return s.jobs.begin(name), true
+}
+
+func (s *ScannerService) RunningJob() JobStatus {
+	if st := s.JobStatus(); st.State == JobRunning {
+		return st
+	}
+	st := JobStatus{Job: "maintenance", State: JobRunning}
+	switch {
+	case s.ReexifStatus().Running:
+		st.Job = "reexif"
+	case s.jobs.folderScans.Load() > 0:
+		st.Job = "folder-scan"
+	}
+	return st
+}
+
+func (s *ScannerService) endJob(stats *scanStats, err error) {
+	s.jobs.finish(stats, err)
+	s.maintMu.Unlock()
+}
+
+// CancelScan stops the running full scan after its current entry.
+func (s *ScannerService) CancelScan() bool {
+	p := &s.jobs
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.status.State != JobRunning || p.status.Job != JobScan {
+		return false
+	}
+	p.canceling = true
+	if p.cancel != nil {
+		p.cancel()
+	}
+	return true
+}
+
+func (s *ScannerService) JobStatus() JobStatus {
+	s.jobs.mu.Lock()
+	defer s.jobs.mu.Unlock()
+	st := s.jobs.status
+	if st.State == "" {
+		st.State = JobIdle
+	}
+	return st
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+type stopFunc struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+type Lifecycle struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	stops    []stopFunc
+	stopping bool
+}
+
+func NewLifecycle() *Lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Lifecycle{ctx: ctx, cancel: cancel}
+}
+
+func (l *Lifecycle) Context() context.Context {
+	return l.ctx
+}
+
+func (l *Lifecycle) Go(name string, fn func(ctx context.Context)) {
+	l.mu.Lock()
+	if l.stopping {
+		l.mu.Unlock()
+		log.Printf("lifecycle: not starting %s, shutting down", name)
+		return
+	}
+	l.wg.Add(1)
+	l.mu.Unlock()
+
+	go func() {
+		defer l.wg.Done()
+		fn(l.ctx)
+	}()
+}
+
+func (l *Lifecycle) OnStop(name string, fn func(ctx context.Context) error) {
+	l.mu.Lock()
+	l.stops = append(l.stops, stopFunc{name: name, fn: fn})
+	l.mu.Unlock()
+}
+
+func (l *Lifecycle) Shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	l.stopping = true
+	stops := l.stops
+	l.mu.Unlock()
+
+	l.cancel()
+
+	for i := len(stops) - 1; i >= 0; i-- {
+		if err := stops[i].fn(ctx); err != nil {
+			log.Printf("lifecycle: stop %s: %v", stops[i].name, err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
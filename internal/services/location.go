@@ -0,0 +1,29 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+	"github.com/Alexander-D-Karpov/photodock/internal/models"
+)
+
+func locationColumns(info *models.ExifInfo) (lat, lon, altitude *float64) {
+	if info == nil || info.Location == nil {
+		return nil, nil, nil
+	}
+	return &info.Location.Lat, &info.Location.Lon, info.Location.Altitude
+}
+
+func ClearLocations(ctx context.Context, db *database.DB) {
+	// Coordinates stored while STRIP_GPS was off must not outlive turning
+	// it back on.
+	tag, err := db.Pool().Exec(ctx, "UPDATE photos SET lat = NULL, lon = NULL, altitude = NULL WHERE lat IS NOT NULL OR lon IS NOT NULL OR altitude IS NOT NULL")
+	if err != nil {
+		log.Printf("clear stored locations: %v", err)
+		return
+	}
+	if n := tag.RowsAffected(); n > 0 {
+		log.Printf("STRIP_GPS is on: cleared stored coordinates of %d photos", n)
+	}
+}
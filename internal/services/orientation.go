@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/models"
+)
+
+const orientationCursorKey = "maintenance.fix_orientation.cursor"
+
+type OrientationFixResult struct {
+	Checked   int  `json:"checked"`
+	Corrected int  `json:"corrected"`
+	Done      bool `json:"done"`
+}
+
+type orientationRow struct {
+	id          int
+	path        string
+	width       int
+	height      int
+	hasExif     bool
+	orientation int
+}
+
+func (s *ScannerService) FixOrientation(ctx context.Context, budget time.Duration) (OrientationFixResult, error) {
+	var res OrientationFixResult
+
+	if !s.maintMu.TryLock() {
+		return res, ErrMaintenanceRunning
+	}
+	defer s.maintMu.Unlock()
+
+	var cursorStr string
+	_ = s.db.Pool().QueryRow(ctx, "SELECT value FROM settings WHERE key = $1", orientationCursorKey).Scan(&cursorStr)
+	cursor, _ := strconv.Atoi(cursorStr)
+
+	deadline := time.Now().Add(budget)
+	for time.Now().Before(deadline) {
+		batch, err := s.orientationBatch(ctx, cursor)
+		if err != nil {
+			return res, err
+		}
+		if len(batch) == 0 {
+			_, _ = s.db.Pool().Exec(ctx, "DELETE FROM settings WHERE key = $1", orientationCursorKey)
+			res.Done = true
+			break
+		}
+
+		for _, p := range batch {
+			if ctx.Err() != nil || time.Now().After(deadline) {
+				break
+			}
+			if s.fixPhotoOrientation(ctx, p) {
+				res.Corrected++
+			}
+			res.Checked++
+			cursor = p.id
+		}
+
+		_, err = s.db.Pool().Exec(ctx,
+			`INSERT INTO settings (key, value, updated_at) VALUES ($1, $2, NOW())
+			ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()`,
+			orientationCursorKey, strconv.Itoa(cursor))
+		if err != nil {
+			return res, err
+		}
+		if ctx.Err() != nil {
+			return res, ctx.Err()
+		}
+	}
+
+	if res.Corrected > 0 {
+		log.Printf("Orientation fix-up: corrected %d of %d photos checked", res.Corrected, res.Checked)
+	}
+	return res, nil
+}
+
+func (s *ScannerService) orientationBatch(ctx context.Context, afterID int) ([]orientationRow, error) {
+	rows, err := s.db.Pool().Query(ctx,
+		`SELECT id, path, COALESCE(width, 0), COALESCE(height, 0), exif_data IS NOT NULL,
+		        COALESCE((exif_data->>'orientation')::int, 0)
+		FROM photos WHERE id > $1 ORDER BY id LIMIT 100`, afterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []orientationRow
+	for rows.Next() {
+		var p orientationRow
+		if err := rows.Scan(&p.id, &p.path, &p.width, &p.height, &p.hasExif, &p.orientation); err != nil {
+			continue
+		}
+		batch = append(batch, p)
+	}
+	return batch, rows.Err()
+}
+
+func (s *ScannerService) fixPhotoOrientation(ctx context.Context, p orientationRow) bool {
+	absPath := ResolveMediaPath(s.mediaRoot, p.path)
+	if _, err := os.Stat(absPath); err != nil {
+		return false
+	}
+
+	// A cached thumbnail is already upright, so when its shape agrees with
+	// the row there is nothing to re-read.
+	if tw, th, ok := s.thumbSvc.CachedThumbnailSize(p.id, p.path, "small"); ok && p.width > 0 && p.height > 0 &&
+		(tw > th) == (p.width > p.height) && (th > tw) == (p.height > p.width) {
+		return false
+	}
+
+	orientation := p.orientation
+	if !p.hasExif || orientation == 0 {
+		var info *models.ExifInfo
+		if !p.hasExif {
+			info, _, _ = s.exifSvc.Extract(absPath)
+		}
+		orientation = photoOrientation(absPath, info)
+	}
+
+	width, height, err := s.thumbSvc.DisplayDimensions(p.path, orientation)
+	if err != nil {
+		return false
+	}
+	if width == p.width && height == p.height {
+		return false
+	}
+
+	blurhash, _ := s.thumbSvc.GenerateBlurhash(p.path)
+	_, err = s.db.Pool().Exec(ctx,
+		`UPDATE photos SET width = $1, height = $2, blurhash = COALESCE(NULLIF($3, ''), blurhash),
+			version = version + 1, updated_at = NOW()
+		WHERE id = $4`,
+		width, height, blurhash, p.id)
+	if err != nil {
+		log.Printf("fix orientation error photo %d (%s): %v", p.id, p.path, err)
+		return false
+	}
+
+	s.thumbSvc.DeletePlaceholderByID(p.id)
+	return true
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func NormalizePath(p string) string {
+	return norm.NFC.String(p)
+}
+
+func ResolveMediaPath(root, rel string) string {
+	direct := filepath.Join(root, rel)
+	if _, err := os.Lstat(direct); !os.IsNotExist(err) {
+		return direct
+	}
+
+	dir := root
+	for _, part := range strings.Split(filepath.Clean(rel), string(filepath.Separator)) {
+		candidate := filepath.Join(dir, part)
+		if _, err := os.Lstat(candidate); err == nil {
+			dir = candidate
+			continue
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return direct
+		}
+
+		name := matchEntry(entries, part)
+		if name == "" {
+			return direct
+		}
+		dir = filepath.Join(dir, name)
+	}
+	return dir
+}
+
+func matchEntry(entries []os.DirEntry, name string) string {
+	want := NormalizePath(name)
+	for _, e := range entries {
+		if NormalizePath(e.Name()) == want {
+			return e.Name()
+		}
+	}
+	for _, e := range entries {
+		if strings.EqualFold(NormalizePath(e.Name()), want) {
+			return e.Name()
+		}
+	}
+	return ""
+}
+
+func (s *ScannerService) sameOnDisk(oldRel, newRel string) bool {
+	newInfo, err := os.Stat(ResolveMediaPath(s.mediaRoot, newRel))
+	if err != nil {
+		return false
+	}
+	oldInfo, err := os.Stat(filepath.Join(s.mediaRoot, oldRel))
+	if os.IsNotExist(err) {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	return os.SameFile(oldInfo, newInfo)
+}
+
+func (s *ScannerService) findCaseRenamedFolder(ctx context.Context, path, name string) (int, bool) {
+	var id int
+	var oldPath string
+	err := s.db.Pool().QueryRow(ctx,
+		"SELECT id, path FROM folders WHERE lower(path) = lower($1) AND path <> $1 LIMIT 1", path).
+		Scan(&id, &oldPath)
+	if err != nil || !s.sameOnDisk(oldPath, path) {
+		return 0, false
+	}
+
+	_, err = s.db.Pool().Exec(ctx,
+		`UPDATE folders SET path = $2 || substr(path, length($1) + 1), updated_at = NOW()
+		WHERE path = $1 OR left(path, length($1) + 1) = $1 || '/'`, oldPath, path)
+	if err != nil {
+		log.Printf("rename folder %s -> %s: %v", oldPath, path, err)
+		return 0, false
+	}
+	_, _ = s.db.Pool().Exec(ctx, "UPDATE folders SET name = $2 WHERE id = $1", id, name)
+	_, _ = s.db.Pool().Exec(ctx,
+		`UPDATE photos SET path = $2 || substr(path, length($1) + 1), updated_at = NOW()
+		WHERE left(path, length($1) + 1) = $1 || '/'`, oldPath, path)
+
+	log.Printf("folder %s renamed to %s", oldPath, path)
+	return id, true
+}
+
+func (s *ScannerService) adoptCaseRenamedPhoto(ctx context.Context, relPath string) bool {
+	var id int
+	var oldPath string
+	err := s.db.Pool().QueryRow(ctx,
+		"SELECT id, path FROM photos WHERE lower(path) = lower($1) AND path <> $1 LIMIT 1", relPath).
+		Scan(&id, &oldPath)
+	if err != nil || !s.sameOnDisk(oldPath, relPath) {
+		return false
+	}
+
+	_, err = s.db.Pool().Exec(ctx,
+		"UPDATE photos SET path = $2, filename = $3, updated_at = NOW() WHERE id = $1",
+		id, relPath, filepath.Base(relPath))
+	if err != nil {
+		log.Printf("rename photo %s -> %s: %v", oldPath, relPath, err)
+		return false
+	}
+	return true
+}
+
+func (s *ScannerService) normalizeStoredPaths(ctx context.Context) {
+	for _, table := range []string{"folders", "photos"} {
+		rows, err := s.db.Pool().Query(ctx, "SELECT id, path FROM "+table)
+		if err != nil {
+			continue
+		}
+
+		updates := make(map[int]string)
+		for rows.Next() {
+			var id int
+			var path string
+			if err := rows.Scan(&id, &path); err != nil {
+				continue
+			}
+			if n := NormalizePath(path); n != path {
+				updates[id] = n
+			}
+		}
+		rows.Close()
+
+		for id, path := range updates {
+			var err error
+			if table == "folders" {
+				_, err = s.db.Pool().Exec(ctx, "UPDATE folders SET path = $2, name = $3 WHERE id = $1", id, path, filepath.Base(path))
+			} else {
+				_, err = s.db.Pool().Exec(ctx, "UPDATE photos SET path = $2, filename = $3 WHERE id = $1", id, path, filepath.Base(path))
+			}
+			if err != nil {
+				log.Printf("normalize %s path %q: %v", table, path, err)
+			}
+		}
+	}
+}
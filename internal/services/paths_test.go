@@ -0,0 +1,61 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestNormalizePath(t *testing.T) {
+	nfd := norm.NFD.String("Åland")
+	if nfd == "Åland" {
+		t.Fatal("fixture is not decomposed")
+	}
+	tests := []struct {
+		in, want string
+	}{
+		{nfd, "Åland"},
+		{"Åland", "Åland"},
+		{nfd + "/" + norm.NFD.String("Mariehamn é.jpg"), "Åland/Mariehamn é.jpg"},
+		{"plain/ascii.jpg", "plain/ascii.jpg"},
+	}
+	for _, tt := range tests {
+		if got := NormalizePath(tt.in); got != tt.want {
+			t.Errorf("NormalizePath(%+q) = %+q, want %+q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestResolveMediaPath(t *testing.T) {
+	root := t.TempDir()
+	nfdDir := norm.NFD.String("Åland")
+	nfdFile := norm.NFD.String("Kökar.jpg")
+	if err := os.MkdirAll(filepath.Join(root, nfdDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	onDisk := filepath.Join(root, nfdDir, nfdFile)
+	if err := os.WriteFile(onDisk, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "Plain.jpg"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, rel, want string
+	}{
+		{"NFC URL to NFD names", "Åland/Kökar.jpg", onDisk},
+		{"NFD as stored on disk", nfdDir + "/" + nfdFile, onDisk},
+		{"NFC folder only", "Åland", filepath.Join(root, nfdDir)},
+		{"different case", "åland/kökar.jpg", onDisk},
+		{"exact match", "Plain.jpg", filepath.Join(root, "Plain.jpg")},
+		{"missing", "Åland/Missing.jpg", filepath.Join(root, "Åland/Missing.jpg")},
+	}
+	for _, tt := range tests {
+		if got := ResolveMediaPath(root, tt.rel); got != tt.want {
+			t.Errorf("%s: ResolveMediaPath(%+q) = %+q, want %+q", tt.name, tt.rel, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+)
+
+func RecordURLRedirect(ctx context.Context, db *database.DB, photoID int, oldPath, newPath string) error {
+	if oldPath == "" || oldPath == newPath {
+		return nil
+	}
+
+	tx, err := db.Pool().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, "DELETE FROM url_redirects WHERE old_path = $1", newPath); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "UPDATE url_redirects SET new_path = $2 WHERE new_path = $1", oldPath, newPath); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO url_redirects (old_path, new_path, photo_id) VALUES ($1, $2, $3)
+		ON CONFLICT (old_path) DO UPDATE SET new_path = EXCLUDED.new_path, photo_id = EXCLUDED.photo_id, created_at = NOW()`,
+		oldPath, newPath, photoID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
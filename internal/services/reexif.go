@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrPhotoFileMissing = errors.New("photo file is missing")
+
+type ReexifStatus struct {
+	Running    bool       `json:"running"`
+	Total      int        `json:"total"`
+	Done       int        `json:"done"`
+	Updated    int        `json:"updated"`
+	Missing    int        `json:"missing"`
+	Failed     int        `json:"failed"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+type reexifProgress struct {
+	mu     sync.Mutex
+	status ReexifStatus
+}
+
+func (p *reexifProgress) update(fn func(*ReexifStatus)) {
+	p.mu.Lock()
+	fn(&p.status)
+	p.mu.Unlock()
+}
+
+func (p *reexifProgress) begin() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.status.Running {
+		return false
+	}
+	started := time.Now()
+	p.status = ReexifStatus{Running: true, StartedAt: &started}
+	return true
+}
+
+func (s *ScannerService) BeginReexif() bool {
+	// Claimed before the background run starts, so a status poll right after
+	// the request already sees it running.
+	if !s.maintMu.TryLock() {
+		return false
+	}
+	if !s.reexif.begin() {
+		s.maintMu.Unlock()
+		return false
+	}
+	return true
+}
+
+func (s *ScannerService) ReexifStatus() ReexifStatus {
+	s.reexif.mu.Lock()
+	defer s.reexif.mu.Unlock()
+	return s.reexif.status
+}
+
+func (s *ScannerService) ReexifPhotos(ctx context.Context, ids []int) (err error) {
+	// Must follow a successful BeginReexif. An empty ids list means every
+	// photo.
+	defer s.reexif.update(func(st *ReexifStatus) {
+		finished := time.Now()
+		st.Running = false
+		st.FinishedAt = &finished
+		if err != nil {
+			st.Error = err.Error()
+		}
+	})
+	defer s.maintMu.Unlock()
+
+	rows, err := s.db.Pool().Query(ctx, "SELECT id, path FROM photos WHERE cardinality($1::int[]) = 0 OR id = ANY($1) ORDER BY id", ids)
+	if err != nil {
+		return err
+	}
+	type photoRow struct {
+		id   int
+		path string
+	}
+	var photos []photoRow
+	for rows.Next() {
+		var p photoRow
+		if err := rows.Scan(&p.id, &p.path); err != nil {
+			continue
+		}
+		photos = append(photos, p)
+	}
+	rows.Close()
+
+	s.reexif.update(func(st *ReexifStatus) { st.Total = len(photos) })
+	defer s.reexif.update(func(st *ReexifStatus) {
+		log.Printf("EXIF re-extraction: %d updated, %d missing, %d failed of %d", st.Updated, st.Missing, st.Failed, st.Total)
+	})
+
+	for _, p := range photos {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := s.ReexifPhoto(ctx, p.id, p.path)
+		s.reexif.update(func(st *ReexifStatus) {
+			st.Done++
+			switch {
+			case errors.Is(err, ErrPhotoFileMissing):
+				st.Missing++
+			case err != nil:
+				st.Failed++
+			default:
+				st.Updated++
+			}
+		})
+		if err != nil && !errors.Is(err, ErrPhotoFileMissing) {
+			log.Printf("re-extract EXIF photo %d (%s): %v", p.id, p.path, err)
+		}
+	}
+	return nil
+}
+
+func (s *ScannerService) ReexifPhoto(ctx context.Context, id int, relPath string) error {
+	// Unlike a full reprocess, an existing blurhash is kept; the image
+	// itself hasn't changed, only what we know about it.
+	return s.refreshMetadata(ctx, id, relPath, false)
+}
+
+func (s *ScannerService) refreshMetadata(ctx context.Context, id int, relPath string, regenBlurhash bool) error {
+	absPath := ResolveMediaPath(s.mediaRoot, relPath)
+	if _, err := os.Stat(absPath); os.IsNotExist(err) {
+		return ErrPhotoFileMissing
+	}
+
+	exifInfo, takenAt, _ := s.exifSvc.Extract(absPath)
+	width, height, _ := s.thumbSvc.DisplayDimensions(relPath, photoOrientation(absPath, exifInfo))
+
+	var exifJSON []byte
+	if exifInfo != nil {
+		exifJSON, _ = json.Marshal(exifInfo)
+	}
+
+	var takenAtPtr *time.Time
+	if !takenAt.IsZero() {
+		takenAtPtr = &takenAt
+	}
+
+	var blurhash *string
+	if !regenBlurhash {
+		_ = s.db.Pool().QueryRow(ctx, "SELECT NULLIF(blurhash, '') FROM photos WHERE id = $1", id).Scan(&blurhash)
+	}
+	if blurhash == nil {
+		if bh, err := s.thumbSvc.GenerateBlurhash(relPath); err == nil && bh != "" {
+			blurhash = &bh
+		}
+	}
+	lat, lon, altitude := locationColumns(exifInfo)
+
+	_, err := s.db.Pool().Exec(ctx,
+		`UPDATE photos SET 
+			width = $1, height = $2, exif_data = $3, taken_at = COALESCE($4, taken_at),
+			blurhash = COALESCE($5, blurhash), lat = $7, lon = $8, altitude = $9,
+			rating = COALESCE(rating, NULLIF($10, 0)), updated_at = NOW()
+		WHERE id = $6`,
+		width, height, exifJSON, takenAtPtr, blurhash, id, lat, lon, altitude, photoRating(exifInfo, nil))
+	if err != nil {
+		return err
+	}
+	applySidecar(ctx, s.db, relPath, ReadSidecar(absPath))
+	if exifInfo != nil {
+		if err := fillPhotoTags(ctx, s.db, relPath, exifInfo.Keywords); err != nil {
+			log.Printf("tag photo %s: %v", relPath, err)
+		}
+	}
+	return nil
+}
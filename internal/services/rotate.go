@@ -0,0 +1,235 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+var (
+	ErrBadRotation         = errors.New("rotation must be 90, 180 or 270 degrees")
+	ErrRotationUnsupported = errors.New("this file type can't be rotated")
+)
+
+var jpegtranUndo = map[int][]string{
+	2: {"-flip", "horizontal"},
+	3: {"-rotate", "180"},
+	4: {"-flip", "vertical"},
+	5: {"-transpose"},
+	6: {"-rotate", "90"},
+	7: {"-transverse"},
+	8: {"-rotate", "270"},
+}
+
+// RotatePhoto turns a photo clockwise by degrees as it is shown and
+// leaves its orientation tag at 1.
+func (s *ScannerService) RotatePhoto(ctx context.Context, id int, relPath string, degrees int) error {
+	if degrees != 90 && degrees != 180 && degrees != 270 {
+		return ErrBadRotation
+	}
+	if !s.maintMu.TryRLock() {
+		return ErrMaintenanceRunning
+	}
+	defer s.maintMu.RUnlock()
+
+	absPath := ResolveMediaPath(s.mediaRoot, relPath)
+	info, err := os.Stat(absPath)
+	if os.IsNotExist(err) {
+		return ErrPhotoFileMissing
+	}
+	if err != nil {
+		return err
+	}
+
+	// jpegtran -perfect refuses when the edges aren't MCU-aligned, and the
+	// pixels are rotated through a re-encode instead.
+	if err := rotateLossless(absPath, degrees); err != nil {
+		if err := rotatePixels(absPath, degrees); err != nil {
+			return err
+		}
+	}
+	_ = os.Chmod(absPath, info.Mode().Perm())
+	if err := s.exifSvc.ResetOrientation(absPath); err != nil {
+		return err
+	}
+	return s.refreshFile(ctx, id, relPath, nil)
+}
+
+func isJPEG(path string) bool {
+	format, err := imaging.FormatFromFilename(path)
+	return err == nil && format == imaging.JPEG
+}
+
+func rotateLossless(absPath string, degrees int) error {
+	if !isJPEG(absPath) {
+		return ErrRotationUnsupported
+	}
+	if _, err := exec.LookPath("jpegtran"); err != nil {
+		return err
+	}
+
+	// jpegtran applies one transform per run: the stored orientation is
+	// undone first so the rotation is relative to what is shown.
+	steps := [][]string{{"-rotate", strconv.Itoa(degrees)}}
+	if undo, ok := jpegtranUndo[jpegOrientation(absPath)]; ok {
+		steps = append([][]string{undo}, steps...)
+	}
+
+	src := absPath
+	for _, step := range steps {
+		dst := tempSibling(absPath)
+		args := append([]string{"-copy", "all", "-perfect"}, step...)
+		out, err := exec.Command("jpegtran", append(args, "-outfile", dst, src)...).CombinedOutput()
+		if src != absPath {
+			_ = os.Remove(src)
+		}
+		if err != nil {
+			_ = os.Remove(dst)
+			return fmt.Errorf("jpegtran: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		src = dst
+	}
+	return commitTemp(src, absPath, nil)
+}
+
+func rotatePixels(absPath string, degrees int) error {
+	// Only formats imaging can write back are rotated, and a GIF would
+	// lose every frame but the first.
+	format, err := imaging.FormatFromFilename(absPath)
+	if err != nil || format == imaging.GIF {
+		return ErrRotationUnsupported
+	}
+	img, err := openImage(absPath)
+	if err != nil {
+		return err
+	}
+
+	// imaging turns counter-clockwise.
+	var rotated image.Image
+	switch degrees {
+	case 90:
+		rotated = imaging.Rotate270(img)
+	case 180:
+		rotated = imaging.Rotate180(img)
+	default:
+		rotated = imaging.Rotate90(img)
+	}
+
+	tmpPath := tempSibling(absPath)
+	err = imaging.Save(rotated, tmpPath, imaging.JPEGQuality(95))
+	if err == nil && format == imaging.JPEG {
+		err = carryJPEGExif(absPath, tmpPath)
+	}
+	return commitTemp(tmpPath, absPath, err)
+}
+
+func carryJPEGExif(srcPath, dstPath string) error {
+	src, err := os.ReadFile(srcPath)
+	if err != nil {
+		return err
+	}
+	seg := jpegExifSegment(src)
+	if seg == nil {
+		return nil
+	}
+	dst, err := os.ReadFile(dstPath)
+	if err != nil {
+		return err
+	}
+	if len(dst) < 2 || dst[0] != 0xFF || dst[1] != 0xD8 {
+		return nil
+	}
+	out := make([]byte, 0, len(dst)+len(seg))
+	out = append(out, dst[:2]...)
+	out = append(out, seg...)
+	out = append(out, dst[2:]...)
+	return os.WriteFile(dstPath, out, 0644)
+}
+
+func jpegExifSegment(data []byte) []byte {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xD9 || marker == 0xDA {
+			break
+		}
+		segLen := int(binary.BigEndian.Uint16(data[pos+2:pos+4])) + 2
+		if pos+segLen > len(data) {
+			break
+		}
+		if marker == 0xE1 && segLen >= 10 && string(data[pos+4:pos+10]) == "Exif\x00\x00" {
+			return data[pos : pos+segLen]
+		}
+		pos += segLen
+	}
+	return nil
+}
+
+func (s *ExifService) ResetOrientation(path string) error {
+	if s.hasExiftool {
+		out, err := s.exiftool.run([]string{"-Orientation=1", "-n", "-overwrite_original_in_place"}, path)
+		if err == nil && !bytes.Contains(out, []byte("weren't updated due to errors")) {
+			return nil
+		}
+	}
+	if !isJPEG(path) {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if seg := jpegExifSegment(data); seg != nil && resetTIFFOrientation(seg[10:]) {
+		return os.WriteFile(path, data, 0644)
+	}
+	return nil
+}
+
+func resetTIFFOrientation(tiff []byte) bool {
+	if len(tiff) < 8 {
+		return false
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[0:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return false
+	}
+
+	ifd := int(bo.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return false
+	}
+	count := int(bo.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return false
+		}
+		if bo.Uint16(tiff[entry:entry+2]) != 0x0112 {
+			continue
+		}
+		// SHORT, count 1: the value sits in the entry itself.
+		if bo.Uint16(tiff[entry+2:entry+4]) != 3 || bo.Uint16(tiff[entry+8:entry+10]) == 1 {
+			return false
+		}
+		bo.PutUint16(tiff[entry+8:entry+10], 1)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/testutil"
+)
+
+func TestCancelledScanLeavesNoTempFiles(t *testing.T) {
+	lib := newTestLibrary(t)
+	jpg := testutil.JPEG(1600, 1200, nil)
+	for i := 0; i < 60; i++ {
+		lib.write(fmt.Sprintf("Trip/%03d.jpg", i), jpg)
+	}
+
+	if _, ok := lib.scanner.BeginJob(JobScan); !ok {
+		t.Fatal("scan job refused")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- lib.scanner.ScanAll(ctx) }()
+
+	// Cancelled once the first photos are in, while others are being
+	// thumbnailed.
+	lib.waitForPhoto()
+	cancel()
+	err := <-done
+	var stored int
+	_ = lib.db.Pool().QueryRow(context.Background(), "SELECT count(*) FROM photos").Scan(&stored)
+	if err == nil && stored == 60 {
+		t.Skip("the scan finished before it was cancelled")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("scan returned %v, want it cancelled", err)
+	}
+
+	assertCacheIntact(t, lib.cache)
+}
+
+func TestShutdownDuringProcessFiles(t *testing.T) {
+	lib := newTestLibrary(t)
+	jpg := testutil.JPEG(1600, 1200, nil)
+	paths := make([]string, 60)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("Upload/%03d.jpg", i)
+		lib.write(paths[i], jpg)
+	}
+
+	lifecycle := NewLifecycle()
+	done := make(chan error, 1)
+	lifecycle.Go("process-uploads", func(ctx context.Context) {
+		_, err := lib.scanner.ProcessFiles(ctx, paths)
+		done <- err
+	})
+
+	lib.waitForPhoto()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := lifecycle.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown did not drain: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil && !errors.Is(err, context.Canceled) {
+			t.Fatalf("ProcessFiles returned %v", err)
+		}
+	default:
+		t.Fatal("ProcessFiles still running after shutdown")
+	}
+
+	var state string
+	if err := lib.db.Pool().QueryRow(context.Background(),
+		"SELECT state FROM scan_runs ORDER BY id DESC LIMIT 1").Scan(&state); err != nil {
+		t.Fatal(err)
+	}
+	if state != JobDone && state != JobCanceled {
+		t.Errorf("upload run state = %q, want done or canceled", state)
+	}
+	assertCacheIntact(t, lib.cache)
+}
+
+func (l *testLibrary) waitForPhoto() {
+	l.t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		var n int
+		_ = l.db.Pool().QueryRow(context.Background(), "SELECT count(*) FROM photos").Scan(&n)
+		if n > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			l.t.Fatal("no photo stored")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func assertCacheIntact(t *testing.T, cache string) {
+	t.Helper()
+	err := filepath.WalkDir(cache, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if isTempFile(d.Name()) {
+			t.Errorf("temp file left: %s", path)
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		if _, _, err := image.Decode(f); err != nil {
+			t.Errorf("partial cache file %s: %v", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+type scanStats struct {
+	Added   atomic.Int64
+	Updated atomic.Int64
+	Removed atomic.Int64
+
+	progress *jobProgress
+	workers  chan struct{}
+	ignore   *ignoreMatcher
+	shallow  bool
+
+	// 0 if the scan_runs row couldn't be created.
+	runID  int
+	errors atomic.Int64
+
+	// Only appended to by the walk; removed once it is complete, so files
+	// moved elsewhere in the tree can claim their rows first.
+	gonePhotos  []storedPhoto
+	goneFolders []string
+}
+
+type storedFile struct {
+	id     int
+	size   *int64
+	mtime  *time.Time
+	hashed bool
+}
+
+// $1 is the directory's relative path, empty for the media root.
+const directChildSQL = `(($1 = '' AND strpos(path, '/') = 0) OR
+	($1 <> '' AND left(path, length($1) + 1) = $1 || '/' AND strpos(substr(path, length($1) + 2), '/') = 0))`
+
+func (s *ScannerService) refreshIfChanged(ctx context.Context, relPath string, f storedFile, stats *scanStats) error {
+	absPath := ResolveMediaPath(s.mediaRoot, relPath)
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return err
+	}
+
+	// Rows from before mtimes were kept take the file as it is now as their
+	// baseline; their size may predate GPS stripping, so it can't be
+	// trusted to detect a change.
+	if f.mtime == nil {
+		_, _ = s.db.Pool().Exec(ctx, "UPDATE photos SET size_bytes = $2, file_mtime = $3 WHERE id = $1", f.id, info.Size(), info.ModTime())
+		s.backfillHash(ctx, f, absPath)
+		return nil
+	}
+	// Postgres keeps microseconds, so compare at that precision.
+	if (f.size == nil || *f.size == info.Size()) && f.mtime.Equal(info.ModTime().Truncate(time.Microsecond)) {
+		s.backfillHash(ctx, f, absPath)
+		return nil
+	}
+
+	if err := s.refreshFile(ctx, f.id, relPath, stats); err != nil {
+		return err
+	}
+	stats.Updated.Add(1)
+	log.Printf("file changed on disk, refreshed %s", relPath)
+	return nil
+}
+
+func (s *ScannerService) RescanPhoto(ctx context.Context, id int, relPath string) error {
+	if !s.maintMu.TryRLock() {
+		return ErrMaintenanceRunning
+	}
+	defer s.maintMu.RUnlock()
+
+	if _, err := os.Stat(ResolveMediaPath(s.mediaRoot, relPath)); os.IsNotExist(err) {
+		return ErrPhotoFileMissing
+	}
+	return s.refreshFile(ctx, id, relPath, nil)
+}
+
+func (s *ScannerService) refreshFile(ctx context.Context, id int, relPath string, stats *scanStats) error {
+	absPath := ResolveMediaPath(s.mediaRoot, relPath)
+
+	dbCtx := context.WithoutCancel(ctx)
+
+	if err := s.exifSvc.StripGPS(absPath); err != nil {
+		s.scanFailed(ctx, stats, relPath, stageStripGPS, err)
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return err
+	}
+	if err := s.refreshMetadata(dbCtx, id, relPath, false); err != nil {
+		return err
+	}
+
+	_ = s.thumbSvc.DeleteThumbnailsByID(id)
+	s.thumbSvc.DeleteWebOriginal(relPath)
+	blurhash, src := s.thumbSvc.PrepareSource(relPath)
+	sum, err := HashFile(absPath)
+	if err != nil {
+		s.scanFailed(ctx, stats, relPath, stageHash, err)
+	}
+
+	// The version bump gives the new pixels new URLs past any browser or
+	// proxy cache.
+	_, err = s.db.Pool().Exec(dbCtx,
+		`UPDATE photos SET size_bytes = $2, file_mtime = $3, sha256 = NULLIF($4, ''),
+			blurhash = COALESCE(NULLIF($5, ''), blurhash), version = version + 1, updated_at = NOW()
+		WHERE id = $1`,
+		id, info.Size(), info.ModTime(), sum, blurhash)
+	if err != nil {
+		return err
+	}
+	s.pregenerateThumbnails(ctx, id, relPath, src, stats)
+	return nil
+}
+
+func (s *ScannerService) backfillHash(ctx context.Context, f storedFile, absPath string) {
+	if f.hashed {
+		return
+	}
+	sum, err := HashFile(absPath)
+	if err != nil {
+		log.Printf("hash error %s: %v", absPath, err)
+		return
+	}
+	_, _ = s.db.Pool().Exec(ctx, "UPDATE photos SET sha256 = $2 WHERE id = $1", f.id, sum)
+}
+
+func (s *ScannerService) removeVanished(ctx context.Context, relPath string, seen map[string]bool, stats *scanStats) {
+	var gone []storedPhoto
+
+	rows, err := s.db.Pool().Query(ctx, "SELECT id, path FROM photos WHERE "+directChildSQL, relPath)
+	if err != nil {
+		log.Printf("list photos in %q: %v", relPath, err)
+		return
+	}
+	for rows.Next() {
+		var p storedPhoto
+		if err := rows.Scan(&p.id, &p.path); err == nil && !seen[p.path] && s.missingOnDisk(p.path) {
+			gone = append(gone, p)
+		}
+	}
+	rows.Close()
+
+	var goneFolders []string
+	rows, err = s.db.Pool().Query(ctx, "SELECT path FROM folders WHERE "+directChildSQL, relPath)
+	if err != nil {
+		log.Printf("list folders in %q: %v", relPath, err)
+		return
+	}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err == nil && !seen[path] && s.missingOnDisk(path) {
+			goneFolders = append(goneFolders, path)
+		}
+	}
+	rows.Close()
+
+	for _, folder := range goneFolders {
+		rows, err := s.db.Pool().Query(ctx, "SELECT id, path FROM photos WHERE left(path, length($1) + 1) = $1 || '/'", folder)
+		if err != nil {
+			continue
+		}
+		for rows.Next() {
+			var p storedPhoto
+			if err := rows.Scan(&p.id, &p.path); err == nil {
+				gone = append(gone, p)
+			}
+		}
+		rows.Close()
+	}
+
+	stats.gonePhotos = append(stats.gonePhotos, gone...)
+	stats.goneFolders = append(stats.goneFolders, goneFolders...)
+}
+
+func (s *ScannerService) removeVanishedRows(ctx context.Context, stats *scanStats) {
+	s.removePhotos(ctx, stats.gonePhotos, stats)
+	for _, folder := range stats.goneFolders {
+		if _, err := s.db.Pool().Exec(ctx, "DELETE FROM folders WHERE path = $1 OR left(path, length($1) + 1) = $1 || '/'", folder); err != nil {
+			log.Printf("remove vanished folder %s: %v", folder, err)
+			continue
+		}
+		log.Printf("folder %s no longer exists, removed", folder)
+	}
+}
+
+type storedPhoto struct {
+	id   int
+	path string
+}
+
+func (s *ScannerService) missingOnDisk(relPath string) bool {
+	_, err := os.Lstat(ResolveMediaPath(s.mediaRoot, relPath))
+	return os.IsNotExist(err)
+}
+
+func (s *ScannerService) removePhotos(ctx context.Context, photos []storedPhoto, stats *scanStats) {
+	if len(photos) == 0 {
+		return
+	}
+	ids := make([]int, len(photos))
+	paths := make([]string, len(photos))
+	for i, p := range photos {
+		ids[i], paths[i] = p.id, p.path
+	}
+	rows, err := s.db.Pool().Query(ctx,
+		`DELETE FROM photos p USING unnest($1::int[], $2::text[]) AS g(id, path)
+		WHERE p.id = g.id AND p.path = g.path
+		RETURNING p.id, p.path`, ids, paths)
+	if err != nil {
+		log.Printf("remove vanished photos: %v", err)
+		return
+	}
+	var removed []storedPhoto
+	for rows.Next() {
+		var p storedPhoto
+		if err := rows.Scan(&p.id, &p.path); err == nil {
+			removed = append(removed, p)
+		}
+	}
+	rows.Close()
+
+	for _, p := range removed {
+		_ = s.thumbSvc.DeleteThumbnailsByID(p.id)
+		s.thumbSvc.DeleteWebOriginal(p.path)
+		log.Printf("file %s no longer exists, removed", p.path)
+	}
+	stats.Removed.Add(int64(len(removed)))
+}
+
+// adoptMovedPhoto gives a new file the row of an identical one that is
+// gone from disk.
+func (s *ScannerService) adoptMovedPhoto(ctx context.Context, relPath string, folderID *int, sum string, info os.FileInfo) bool {
+	rows, err := s.db.Pool().Query(ctx, "SELECT id, path FROM photos WHERE sha256 = $1 AND path <> $2 ORDER BY id", sum, relPath)
+	if err != nil {
+		return false
+	}
+	var candidates []storedPhoto
+	for rows.Next() {
+		var p storedPhoto
+		if err := rows.Scan(&p.id, &p.path); err == nil && s.missingOnDisk(p.path) {
+			candidates = append(candidates, p)
+		}
+	}
+	rows.Close()
+
+	var old *storedPhoto
+	for i, p := range candidates {
+		if filepath.Base(p.path) == filepath.Base(relPath) {
+			old = &candidates[i]
+			break
+		}
+	}
+	if old == nil && len(candidates) == 1 {
+		old = &candidates[0]
+	}
+	if old == nil {
+		return false
+	}
+
+	// Conditional on the old path, so two workers can't both claim it.
+	tag, err := s.db.Pool().Exec(context.WithoutCancel(ctx),
+		`UPDATE photos SET path = $3, filename = $4, folder_id = $5, size_bytes = $6, file_mtime = $7, updated_at = NOW()
+		WHERE id = $1 AND path = $2`,
+		old.id, old.path, relPath, filepath.Base(relPath), folderID, info.Size(), info.ModTime())
+	if err != nil {
+		log.Printf("move photo %s -> %s: %v", old.path, relPath, err)
+		return false
+	}
+	if tag.RowsAffected() != 1 {
+		return false
+	}
+	s.thumbSvc.DeleteWebOriginal(old.path)
+	log.Printf("file %s moved to %s", old.path, relPath)
+	return true
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	maxScanRuns = 200
+	// Per run; the run's error count keeps going past it.
+	maxScanErrors = 500
+)
+
+const (
+	ScanRunFull   = "full"
+	ScanRunFolder = "folder"
+	ScanRunUpload = "upload"
+)
+
+const (
+	stageFolder    = "folder"
+	stagePhoto     = "photo"
+	stageHash      = "hash"
+	stageStripGPS  = "strip-gps"
+	stageTags      = "tags"
+	stageThumbnail = "thumbnail"
+)
+
+type ScanError struct {
+	Path    string    `json:"path"`
+	Stage   string    `json:"stage"`
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+type ScanRun struct {
+	ID         int         `json:"id"`
+	Type       string      `json:"type"`
+	Path       string      `json:"path"`
+	State      string      `json:"state"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+	Added      int         `json:"added"`
+	Updated    int         `json:"updated"`
+	Removed    int         `json:"removed"`
+	ErrorCount int         `json:"error_count"`
+	Error      string      `json:"error,omitempty"`
+	Errors     []ScanError `json:"errors,omitempty"`
+}
+
+func (s *ScannerService) beginRun(ctx context.Context, stats *scanStats, runType, path string) {
+	err := s.db.Pool().QueryRow(ctx,
+		"INSERT INTO scan_runs (type, path) VALUES ($1, $2) RETURNING id", runType, path).Scan(&stats.runID)
+	if err != nil {
+		log.Printf("record scan run: %v", err)
+		return
+	}
+	_, _ = s.db.Pool().Exec(ctx,
+		"DELETE FROM scan_runs WHERE id <= (SELECT id FROM scan_runs ORDER BY id DESC OFFSET $1 LIMIT 1)", maxScanRuns)
+}
+
+func (s *ScannerService) finishRun(ctx context.Context, stats *scanStats, err error) {
+	if stats.runID == 0 {
+		return
+	}
+	state, msg := JobDone, ""
+	switch {
+	case ctx.Err() != nil:
+		state = JobCanceled
+	case err != nil:
+		state, msg = JobFailed, err.Error()
+	}
+	_, dbErr := s.db.Pool().Exec(context.WithoutCancel(ctx),
+		`UPDATE scan_runs SET state = $2, finished_at = NOW(), added = $3, updated = $4, removed = $5,
+			error_count = $6, error = NULLIF($7, '')
+		WHERE id = $1`,
+		stats.runID, state, stats.Added.Load(), stats.Updated.Load(), stats.Removed.Load(), stats.errors.Load(), msg)
+	if dbErr != nil {
+		log.Printf("record scan run: %v", dbErr)
+	}
+}
+
+// stats is nil outside of a scan, such as for a single photo's rescan.
+func (s *ScannerService) scanFailed(ctx context.Context, stats *scanStats, path, stage string, err error) {
+	log.Printf("%s error %s: %v", stage, path, err)
+	if stats == nil || stats.runID == 0 {
+		return
+	}
+	if stats.errors.Add(1) > maxScanErrors {
+		return
+	}
+	_, dbErr := s.db.Pool().Exec(context.WithoutCancel(ctx),
+		"INSERT INTO scan_errors (run_id, path, stage, message) VALUES ($1, $2, $3, $4)",
+		stats.runID, path, stage, err.Error())
+	if dbErr != nil {
+		log.Printf("record scan error: %v", dbErr)
+	}
+}
+
+func (s *ScannerService) ScanRuns(ctx context.Context, limit int) ([]ScanRun, error) {
+	rows, err := s.db.Pool().Query(ctx,
+		`SELECT id, type, path, state, started_at, finished_at, added, updated, removed, error_count, COALESCE(error, '')
+		FROM scan_runs ORDER BY id DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	var runs []ScanRun
+	index := map[int]int{}
+	ids := []int{}
+	for rows.Next() {
+		var r ScanRun
+		if err := rows.Scan(&r.ID, &r.Type, &r.Path, &r.State, &r.StartedAt, &r.FinishedAt,
+			&r.Added, &r.Updated, &r.Removed, &r.ErrorCount, &r.Error); err != nil {
+			continue
+		}
+		index[r.ID] = len(runs)
+		ids = append(ids, r.ID)
+		runs = append(runs, r)
+	}
+	rows.Close()
+
+	rows, err = s.db.Pool().Query(ctx,
+		"SELECT run_id, path, stage, message, created_at FROM scan_errors WHERE run_id = ANY($1) ORDER BY id", ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var runID int
+		var e ScanError
+		if err := rows.Scan(&runID, &e.Path, &e.Stage, &e.Message, &e.At); err != nil {
+			continue
+		}
+		r := &runs[index[runID]]
+		r.Errors = append(r.Errors, e)
+	}
+	return runs, rows.Err()
+}
+
+// ScanErrorCount counts the errors of the last full scan and of the
+// folder scans since.
+func (s *ScannerService) ScanErrorCount(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.Pool().QueryRow(ctx,
+		`SELECT COALESCE(SUM(error_count), 0) FROM scan_runs
+		WHERE id >= COALESCE((SELECT MAX(id) FROM scan_runs WHERE type = $1), 0)`, ScanRunFull).Scan(&n)
+	return n, err
+}
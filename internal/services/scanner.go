@@ -3,36 +3,90 @@ package services
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unicode"
 
 	"github.com/Alexander-D-Karpov/photodock/internal/database"
+	"github.com/Alexander-D-Karpov/photodock/internal/models"
+	"github.com/jackc/pgx/v5"
 )
 
+var ErrMaintenanceRunning = errors.New("another maintenance task is running")
+
 type ScannerService struct {
 	db        *database.DB
 	thumbSvc  *ThumbnailService
 	exifSvc   *ExifService
 	mediaRoot string
+	workers   int
+	ignore    []string
+	// Held exclusively by jobs and maintenance tasks; folder scans share it.
+	maintMu sync.RWMutex
+
+	lowSpaceWarned atomic.Bool
+	jobs           jobProgress
+	reexif         reexifProgress
+}
+
+func NewScannerService(db *database.DB, thumbSvc *ThumbnailService, exifSvc *ExifService, mediaRoot string, workers int, ignore []string) *ScannerService {
+	return &ScannerService{db: db, thumbSvc: thumbSvc, exifSvc: exifSvc, mediaRoot: mediaRoot, workers: max(workers, 1), ignore: ignore}
 }
 
-func NewScannerService(db *database.DB, thumbSvc *ThumbnailService, exifSvc *ExifService, mediaRoot string) *ScannerService {
-	return &ScannerService{db: db, thumbSvc: thumbSvc, exifSvc: exifSvc, mediaRoot: mediaRoot}
+func (s *ScannerService) newScanStats(progress *jobProgress) *scanStats {
+	return &scanStats{progress: progress, workers: make(chan struct{}, s.workers), ignore: s.loadIgnore()}
 }
 
 func (s *ScannerService) ScanAll(ctx context.Context) error {
-	return s.scanDir(ctx, "", nil)
+	// Must follow a successful BeginJob(JobScan).
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.jobs.setCancel(cancel)
+
+	s.normalizeStoredPaths(ctx)
+	stats := s.newScanStats(&s.jobs)
+	s.beginRun(ctx, stats, ScanRunFull, "")
+	err := s.scanDir(ctx, "", nil, stats)
+	if err == nil {
+		s.removeVanishedRows(ctx, stats)
+	}
+	s.finishRun(ctx, stats, err)
+	s.endJob(stats, err)
+	log.Printf("Scan finished: %d added, %d updated, %d removed", stats.Added.Load(), stats.Updated.Load(), stats.Removed.Load())
+	return err
 }
 
 func (s *ScannerService) ScanFolder(ctx context.Context, folderPath string) error {
+	return s.scanFolder(ctx, folderPath, false)
+}
+
+// RescanDir scans the direct entries of folderPath, descending only into
+// directories that have no folder yet.
+func (s *ScannerService) RescanDir(ctx context.Context, folderPath string) error {
+	return s.scanFolder(ctx, folderPath, true)
+}
+
+func (s *ScannerService) scanFolder(ctx context.Context, folderPath string, shallow bool) error {
+	// Waits for a running job rather than failing, since these follow
+	// uploads and file changes that would otherwise go unnoticed.
+	s.jobs.folderScans.Add(1)
+	defer s.jobs.folderScans.Add(-1)
+	s.maintMu.RLock()
+	defer s.maintMu.RUnlock()
+
 	var folderID *int
 	if folderPath != "" {
 		var id int
@@ -42,43 +96,189 @@ func (s *ScannerService) ScanFolder(ctx context.Context, folderPath string) erro
 		}
 		folderID = &id
 	}
-	return s.scanDir(ctx, folderPath, folderID)
+	stats := s.newScanStats(nil)
+	stats.shallow = shallow
+	if stats.ignore.matchPath(folderPath, true) {
+		return nil
+	}
+	s.beginRun(ctx, stats, ScanRunFolder, folderPath)
+	err := s.scanDir(ctx, folderPath, folderID, stats)
+	if err == nil {
+		s.removeVanishedRows(ctx, stats)
+	}
+	s.finishRun(ctx, stats, err)
+	return err
 }
 
-func (s *ScannerService) scanDir(ctx context.Context, relPath string, currentFolderID *int) error {
-	absPath := filepath.Join(s.mediaRoot, relPath)
+// ProcessFiles adds or refreshes files without walking their folders;
+// a file that couldn't be processed gets ID 0.
+func (s *ScannerService) ProcessFiles(ctx context.Context, paths []string) ([]int, error) {
+	s.jobs.folderScans.Add(1)
+	defer s.jobs.folderScans.Add(-1)
+	s.maintMu.RLock()
+	defer s.maintMu.RUnlock()
+	return s.processFiles(ctx, paths)
+}
+
+// TryProcessFiles is ProcessFiles that returns ErrMaintenanceRunning
+// instead of waiting.
+func (s *ScannerService) TryProcessFiles(ctx context.Context, paths []string) ([]int, error) {
+	if !s.maintMu.TryRLock() {
+		return nil, ErrMaintenanceRunning
+	}
+	defer s.maintMu.RUnlock()
+	return s.processFiles(ctx, paths)
+}
+
+func (s *ScannerService) processFiles(ctx context.Context, paths []string) ([]int, error) {
+	ids := make([]int, len(paths))
+	if len(paths) == 0 {
+		return ids, nil
+	}
+	stats := s.newScanStats(nil)
+	runPath := filepath.Dir(paths[0])
+	if runPath == "." {
+		runPath = ""
+	}
+	s.beginRun(ctx, stats, ScanRunUpload, runPath)
+
+	var photos sync.WaitGroup
+	for i, relPath := range paths {
+		relPath = NormalizePath(filepath.Clean(relPath))
+		if stats.ignore.matchPath(relPath, false) {
+			continue
+		}
+		folderID, err := s.ensureFolders(ctx, filepath.Dir(relPath))
+		if err != nil {
+			s.scanFailed(ctx, stats, relPath, stageFolder, err)
+			continue
+		}
+		select {
+		case stats.workers <- struct{}{}:
+		case <-ctx.Done():
+			photos.Wait()
+			s.finishRun(ctx, stats, ctx.Err())
+			return ids, ctx.Err()
+		}
+		photos.Add(1)
+		go func() {
+			defer photos.Done()
+			defer func() { <-stats.workers }()
+			if err := s.processPhoto(ctx, relPath, folderID, stats); err != nil {
+				s.scanFailed(ctx, stats, relPath, stagePhoto, err)
+				return
+			}
+			_ = s.db.Pool().QueryRow(ctx, "SELECT id FROM photos WHERE path = $1", relPath).Scan(&ids[i])
+		}()
+	}
+	photos.Wait()
+	s.finishRun(ctx, stats, nil)
+	return ids, nil
+}
+
+func (s *ScannerService) ensureFolders(ctx context.Context, relDir string) (*int, error) {
+	if relDir == "." || relDir == "" {
+		return nil, nil
+	}
+	var parentID *int
+	var path string
+	for _, name := range strings.Split(filepath.ToSlash(relDir), "/") {
+		path = filepath.Join(path, name)
+		id, err := s.ensureFolder(ctx, path, name, parentID)
+		if err != nil {
+			return nil, err
+		}
+		parentID = &id
+	}
+	return parentID, nil
+}
+
+func (s *ScannerService) scanDir(ctx context.Context, relPath string, currentFolderID *int, stats *scanStats) error {
+	absPath := ResolveMediaPath(s.mediaRoot, relPath)
 
 	entries, err := os.ReadDir(absPath)
 	if err != nil {
 		return err
 	}
+	seen := make(map[string]bool, len(entries))
+	stats.progress.folder(relPath)
+
+	// Only photos go to the workers, so a folder always exists before
+	// anything inside it.
+	var photos sync.WaitGroup
+	defer photos.Wait()
 
 	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if strings.HasPrefix(entry.Name(), ".") {
 			continue
 		}
 
-		entryRelPath := filepath.Join(relPath, entry.Name())
+		name := NormalizePath(entry.Name())
+		entryRelPath := filepath.Join(relPath, name)
+		if stats.ignore.match(entryRelPath, entry.IsDir()) {
+			continue
+		}
+		if entry.IsDir() || isImageFile(entry.Name()) {
+			seen[entryRelPath] = true
+		}
 
 		if entry.IsDir() {
-			childFolderID, err := s.ensureFolder(ctx, entryRelPath, entry.Name(), currentFolderID)
+			if stats.shallow && s.folderExists(ctx, entryRelPath) {
+				continue
+			}
+			childFolderID, err := s.ensureFolder(ctx, entryRelPath, name, currentFolderID)
 			if err != nil {
-				log.Printf("ensure folder error %s: %v", entryRelPath, err)
+				s.scanFailed(ctx, stats, entryRelPath, stageFolder, err)
+				stats.progress.failed()
 				continue
 			}
-			if err := s.scanDir(ctx, entryRelPath, &childFolderID); err != nil {
-				log.Printf("scan dir error %s: %v", entryRelPath, err)
+			if err := s.scanDir(ctx, entryRelPath, &childFolderID, stats); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				s.scanFailed(ctx, stats, entryRelPath, stageFolder, err)
+				stats.progress.failed()
 			}
+			stats.progress.folder(relPath)
 		} else if isImageFile(entry.Name()) {
-			if err := s.processPhoto(ctx, entryRelPath, currentFolderID); err != nil {
-				log.Printf("process photo error %s: %v", entryRelPath, err)
+			select {
+			case stats.workers <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
 			}
+			photos.Add(1)
+			go func() {
+				defer photos.Done()
+				defer func() { <-stats.workers }()
+				err := s.processPhoto(ctx, entryRelPath, currentFolderID, stats)
+				if err != nil && ctx.Err() == nil {
+					s.scanFailed(ctx, stats, entryRelPath, stagePhoto, err)
+				}
+				stats.progress.file(err)
+			}()
 		}
 	}
+	photos.Wait()
 
+	// An empty media root is more likely an unmounted volume than a
+	// library someone deleted on purpose.
+	if relPath == "" && len(entries) == 0 {
+		log.Printf("media root is empty, not removing any photos")
+		return nil
+	}
+	s.removeVanished(ctx, relPath, seen, stats)
 	return nil
 }
 
+func (s *ScannerService) folderExists(ctx context.Context, path string) bool {
+	var exists bool
+	_ = s.db.Pool().QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM folders WHERE path = $1)", path).Scan(&exists)
+	return exists
+}
+
 func (s *ScannerService) ensureFolder(ctx context.Context, path, name string, parentID *int) (int, error) {
 	var id int
 	err := s.db.Pool().QueryRow(ctx, "SELECT id FROM folders WHERE path = $1", path).Scan(&id)
@@ -86,8 +286,13 @@ func (s *ScannerService) ensureFolder(ctx context.Context, path, name string, pa
 		return id, nil
 	}
 
+	if id, ok := s.findCaseRenamedFolder(ctx, path, name); ok {
+		return id, nil
+	}
+
 	err = s.db.Pool().QueryRow(ctx,
-		`INSERT INTO folders (parent_id, name, path) VALUES ($1, $2, $3) 
+		`INSERT INTO folders (parent_id, name, path, draft)
+		VALUES ($1, $2, $3, COALESCE((SELECT draft FROM folders WHERE id = $1), false)) 
 		ON CONFLICT (path) DO UPDATE SET name = EXCLUDED.name 
 		RETURNING id`,
 		parentID, name, path).Scan(&id)
@@ -97,13 +302,19 @@ func (s *ScannerService) ensureFolder(ctx context.Context, path, name string, pa
 	return id, nil
 }
 
-func (s *ScannerService) processPhoto(ctx context.Context, relPath string, folderID *int) error {
-	var exists bool
-	err := s.db.Pool().QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM photos WHERE path = $1)", relPath).Scan(&exists)
-	if err != nil {
+func (s *ScannerService) processPhoto(ctx context.Context, relPath string, folderID *int, stats *scanStats) error {
+	var existing storedFile
+	err := s.db.Pool().QueryRow(ctx, "SELECT id, size_bytes, file_mtime, sha256 IS NOT NULL FROM photos WHERE path = $1", relPath).
+		Scan(&existing.id, &existing.size, &existing.mtime, &existing.hashed)
+	if err == nil {
+		applySidecar(ctx, s.db, relPath, ReadSidecar(ResolveMediaPath(s.mediaRoot, relPath)))
+		return s.refreshIfChanged(ctx, relPath, existing, stats)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
 		return fmt.Errorf("check exists: %w", err)
 	}
-	if exists {
+
+	if s.adoptCaseRenamedPhoto(ctx, relPath) {
 		return nil
 	}
 
@@ -116,19 +327,38 @@ func (s *ScannerService) processPhoto(ctx context.Context, relPath string, folde
 		}
 	}
 
-	absPath := filepath.Join(s.mediaRoot, relPath)
-	info, err := os.Stat(absPath)
+	absPath := ResolveMediaPath(s.mediaRoot, relPath)
+	before, err := os.Stat(absPath)
 	if err != nil {
 		return err
 	}
+	sum, err := HashFile(absPath)
+	if err != nil {
+		s.scanFailed(ctx, stats, relPath, stageHash, err)
+	} else if s.adoptMovedPhoto(ctx, relPath, folderID, sum, before) {
+		stats.Updated.Add(1)
+		return nil
+	}
 
 	if err := s.exifSvc.StripGPS(absPath); err != nil {
-		log.Printf("strip GPS error %s: %v", relPath, err)
+		s.scanFailed(ctx, stats, relPath, stageStripGPS, err)
+	}
+	// After stripping, so the stored size and mtime match the file as it
+	// now is and the next scan doesn't see it as modified.
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return err
+	}
+	if info.Size() != before.Size() || !info.ModTime().Equal(before.ModTime()) {
+		if sum, err = HashFile(absPath); err != nil {
+			s.scanFailed(ctx, stats, relPath, stageHash, err)
+		}
 	}
 
 	exifInfo, takenAt, _ := s.exifSvc.Extract(absPath)
-	width, height, _ := s.thumbSvc.GetImageDimensions(relPath)
-	blurhash, _ := s.thumbSvc.GenerateBlurhash(relPath)
+	width, height, _ := s.thumbSvc.DisplayDimensions(relPath, photoOrientation(absPath, exifInfo))
+
+	blurhash, src := s.thumbSvc.PrepareSource(relPath)
 
 	var exifJSON []byte
 	if exifInfo != nil {
@@ -139,26 +369,42 @@ func (s *ScannerService) processPhoto(ctx context.Context, relPath string, folde
 	if !takenAt.IsZero() {
 		takenAtPtr = &takenAt
 	}
+	lat, lon, altitude := locationColumns(exifInfo)
+	sidecar := ReadSidecar(absPath)
+	if sidecar == nil {
+		sidecar = &Sidecar{}
+	}
+
+	// Once the file has been read its row is written in full, even if the
+	// scan is canceled meanwhile.
+	dbCtx := context.WithoutCancel(ctx)
 
 	for attempt := 0; attempt < 5; attempt++ {
-		urlPath := s.generateURLPath(ctx, relPath)
+		// Probing isn't atomic: workers that pick the same path collide on
+		// photos_url_path_key and try again with the next free one.
+		urlPath := s.generateURLPath(dbCtx, relPath)
 
 		var photoID int
-		err = s.db.Pool().QueryRow(ctx,
-			`INSERT INTO photos (folder_id, filename, path, url_path, width, height, size_bytes, blurhash, exif_data, taken_at)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		err = s.db.Pool().QueryRow(dbCtx,
+			`INSERT INTO photos (folder_id, filename, path, url_path, width, height, size_bytes, blurhash, exif_data, taken_at, sha256, lat, lon, altitude, title, description, rating, file_mtime, draft, published_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), $12, $13, $14, NULLIF($15, ''), NULLIF($16, ''), NULLIF($17, 0), $18,
+				COALESCE((SELECT draft FROM folders WHERE id = $1), false),
+				CASE WHEN COALESCE((SELECT draft FROM folders WHERE id = $1), false) THEN NULL ELSE NOW() END)
 			ON CONFLICT (path) DO NOTHING
 			RETURNING id`,
-			folderID, filepath.Base(relPath), relPath, urlPath, width, height, info.Size(), blurhash, exifJSON, takenAtPtr).Scan(&photoID)
+			folderID, filepath.Base(relPath), relPath, urlPath, width, height, info.Size(), blurhash, exifJSON, takenAtPtr, sum, lat, lon, altitude,
+			sidecar.Title, sidecar.Description, photoRating(exifInfo, sidecar), info.ModTime()).Scan(&photoID)
 
 		if err != nil && strings.Contains(err.Error(), "no rows") {
 			return nil
 		}
 
 		if err == nil {
-			_, _ = s.thumbSvc.GetThumbnailPathByID(photoID, relPath, "small")
-			_, _ = s.thumbSvc.GetThumbnailPathByID(photoID, relPath, "medium")
-			_, _ = s.thumbSvc.GetThumbnailPathByID(photoID, relPath, "large")
+			stats.Added.Add(1)
+			if err := AddPhotoTags(dbCtx, s.db, photoID, photoKeywords(exifInfo, sidecar)); err != nil {
+				s.scanFailed(ctx, stats, relPath, stageTags, err)
+			}
+			s.pregenerateThumbnails(ctx, photoID, relPath, src, stats)
 			return nil
 		}
 
@@ -172,7 +418,47 @@ func (s *ScannerService) processPhoto(ctx context.Context, relPath string, folde
 	return fmt.Errorf("failed to insert photo %s after retries: %w", relPath, err)
 }
 
+func (s *ScannerService) pregenerateThumbnails(ctx context.Context, photoID int, relPath string, src image.Image, stats *scanStats) {
+	if free, low := s.thumbSvc.CacheSpaceLow(); low {
+		if !s.lowSpaceWarned.Swap(true) {
+			log.Printf("WARNING: cache filesystem has only %d MB free, pausing thumbnail generation", free>>20)
+		}
+		return
+	}
+	if s.lowSpaceWarned.Swap(false) {
+		log.Printf("cache filesystem has free space again, resuming thumbnail generation")
+	}
+	var thumbErr error
+	for _, size := range s.thumbSvc.SizeNames() {
+		if err := s.thumbSvc.PregenerateThumbnailFrom(ctx, photoID, relPath, size, src); errors.Is(err, ErrThumbnailFailed) {
+			thumbErr = err
+			s.scanFailed(ctx, stats, relPath, stageThumbnail, err)
+			break
+		}
+	}
+	SetThumbError(ctx, s.db, photoID, thumbErr)
+}
+
+// StripGPS strips a new file the way a scan would; false means
+// STRIP_GPS is off.
+func (s *ScannerService) StripGPS(absPath string) (bool, error) {
+	if !s.exifSvc.StripsGPS() {
+		return false, nil
+	}
+	return true, s.exifSvc.StripGPS(absPath)
+}
+
+func (s *ScannerService) InspectFile(absPath string) (*models.ExifInfo, time.Time, bool) {
+	info, takenAt, _ := s.exifSvc.Extract(absPath)
+	return info, takenAt, s.exifSvc.StripsGPS() && s.exifSvc.HasGPS(absPath)
+}
+
 func (s *ScannerService) ReprocessAllMetadata(ctx context.Context) error {
+	if !s.maintMu.TryLock() {
+		return ErrMaintenanceRunning
+	}
+	defer s.maintMu.Unlock()
+
 	rows, err := s.db.Pool().Query(ctx, "SELECT id, path FROM photos ORDER BY id")
 	if err != nil {
 		return err
@@ -196,34 +482,15 @@ func (s *ScannerService) ReprocessAllMetadata(ctx context.Context) error {
 	log.Printf("Reprocessing metadata for %d photos", len(photos))
 
 	for i, p := range photos {
-		absPath := filepath.Join(s.mediaRoot, p.path)
-		if _, err := os.Stat(absPath); os.IsNotExist(err) {
+		if err := ctx.Err(); err != nil {
+			log.Printf("Metadata reprocessing stopped after %d/%d photos", i, len(photos))
+			return err
+		}
+		err := s.refreshMetadata(ctx, p.id, p.path, true)
+		if errors.Is(err, ErrPhotoFileMissing) {
 			log.Printf("skip missing file: %s", p.path)
 			continue
 		}
-
-		exifInfo, takenAt, _ := s.exifSvc.Extract(absPath)
-		width, height, _ := s.thumbSvc.GetImageDimensions(p.path)
-
-		var exifJSON []byte
-		if exifInfo != nil {
-			exifJSON, _ = json.Marshal(exifInfo)
-		}
-
-		var takenAtPtr *time.Time
-		if !takenAt.IsZero() {
-			takenAtPtr = &takenAt
-		}
-
-		blurhash, _ := s.thumbSvc.GenerateBlurhash(p.path)
-
-		_, err := s.db.Pool().Exec(ctx,
-			`UPDATE photos SET 
-				width = $1, height = $2, exif_data = $3, taken_at = COALESCE($4, taken_at),
-				blurhash = COALESCE($5, blurhash), updated_at = NOW()
-			WHERE id = $6`,
-			width, height, exifJSON, takenAtPtr, blurhash, p.id)
-
 		if err != nil {
 			log.Printf("reprocess error photo %d (%s): %v", p.id, p.path, err)
 		}
@@ -238,7 +505,7 @@ func (s *ScannerService) ReprocessAllMetadata(ctx context.Context) error {
 }
 
 func (s *ScannerService) generateURLPath(ctx context.Context, filePath string) string {
-	urlPath := sanitizeURLPath(filePath)
+	urlPath := SanitizeURLPath(filePath)
 
 	var exists bool
 	_ = s.db.Pool().QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM photos WHERE url_path = $1)", urlPath).Scan(&exists)
@@ -260,14 +527,28 @@ func (s *ScannerService) generateURLPath(ctx context.Context, filePath string) s
 	return fmt.Sprintf("%s-%s%s", base, randHex(4), ext)
 }
 
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 func randHex(n int) string {
 	b := make([]byte, n)
 	_, _ = rand.Read(b)
 	return hex.EncodeToString(b)
 }
 
-func sanitizeURLPath(path string) string {
-	path = strings.ToLower(path)
+func SanitizeURLPath(path string) string {
+	path = strings.ToLower(NormalizePath(path))
 
 	var result strings.Builder
 	prevDash := false
@@ -301,57 +582,25 @@ func sanitizeURLPath(path string) string {
 	return urlPath
 }
 
-func (s *ScannerService) CleanOrphans(ctx context.Context) error {
-	rows, err := s.db.Pool().Query(ctx, "SELECT id, path FROM photos")
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
-	var orphanIDs []int
-	for rows.Next() {
-		var id int
-		var path string
-		if err := rows.Scan(&id, &path); err != nil {
-			continue
-		}
-		absPath := filepath.Join(s.mediaRoot, path)
-		if _, err := os.Stat(absPath); os.IsNotExist(err) {
-			orphanIDs = append(orphanIDs, id)
-		}
-	}
-
-	for _, id := range orphanIDs {
-		_, _ = s.db.Pool().Exec(ctx, "DELETE FROM photos WHERE id = $1", id)
-	}
-
-	_, err = s.db.Pool().Exec(ctx, `
-		DELETE FROM folders WHERE id IN (
-			SELECT f.id FROM folders f 
-			LEFT JOIN photos p ON p.folder_id = f.id 
-			LEFT JOIN folders sf ON sf.parent_id = f.id 
-			WHERE p.id IS NULL AND sf.id IS NULL
-		)
-	`)
-
-	return err
-}
+func (s *ScannerService) RegenerateURLPaths(ctx context.Context) (err error) {
+	// Must follow a successful BeginJob(JobRegenerate).
+	defer func() { s.endJob(nil, err) }()
 
-func (s *ScannerService) RegenerateURLPaths(ctx context.Context) error {
-	rows, err := s.db.Pool().Query(ctx, "SELECT id, path FROM photos ORDER BY id")
+	rows, err := s.db.Pool().Query(ctx, "SELECT id, path, COALESCE(url_path, '') FROM photos ORDER BY id")
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
 	type photoRow struct {
-		id   int
-		path string
+		id      int
+		path    string
+		urlPath string
 	}
 	var photos []photoRow
 	for rows.Next() {
 		var p photoRow
-		if err := rows.Scan(&p.id, &p.path); err != nil {
+		if err := rows.Scan(&p.id, &p.path, &p.urlPath); err != nil {
 			continue
 		}
 		photos = append(photos, p)
@@ -363,9 +612,19 @@ func (s *ScannerService) RegenerateURLPaths(ctx context.Context) error {
 		return err
 	}
 
+	// Every url_path is now cleared, so finish even if shutdown starts.
+	ctx = context.WithoutCancel(ctx)
+
 	for _, p := range photos {
 		urlPath := s.generateURLPath(ctx, p.path)
-		_, _ = s.db.Pool().Exec(ctx, "UPDATE photos SET url_path = $1 WHERE id = $2", urlPath, p.id)
+		if _, err := s.db.Pool().Exec(ctx, "UPDATE photos SET url_path = $1 WHERE id = $2", urlPath, p.id); err != nil {
+			s.jobs.file(err)
+			continue
+		}
+		s.jobs.file(nil)
+		if err := RecordURLRedirect(ctx, s.db, p.id, p.urlPath, urlPath); err != nil {
+			log.Printf("record redirect %s -> %s: %v", p.urlPath, urlPath, err)
+		}
 	}
 
 	return nil
@@ -373,5 +632,5 @@ func (s *ScannerService) RegenerateURLPaths(ctx context.Context) error {
 
 func isImageFile(name string) bool {
 	ext := strings.ToLower(filepath.Ext(name))
-	return ext == ".jpg" || ext == ".jpeg" || ext == ".png"
+	return ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".webp" || ext == ".gif" || ext == ".heic" || ext == ".heif"
 }
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/config"
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+	"github.com/Alexander-D-Karpov/photodock/internal/testutil"
+)
+
+type testLibrary struct {
+	t       *testing.T
+	db      *database.DB
+	root    string
+	cache   string
+	scanner *ScannerService
+}
+
+func newTestLibrary(t *testing.T) *testLibrary {
+	t.Helper()
+	db := testutil.Postgres(t)
+	root, cache := t.TempDir(), t.TempDir()
+	sizes := map[string]config.ThumbSpec{"small": {Width: 300, Quality: 80}}
+	thumbs := NewThumbnailService(root, cache, 0, 0, 0, sizes, 2, "go")
+	scanner := NewScannerService(db, thumbs, NewExifService(true, time.UTC), root, 2, nil)
+	return &testLibrary{t: t, db: db, root: root, cache: cache, scanner: scanner}
+}
+
+func (l *testLibrary) write(rel string, data []byte) string {
+	l.t.Helper()
+	abs := filepath.Join(l.root, rel)
+	if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+		l.t.Fatal(err)
+	}
+	if err := os.WriteFile(abs, data, 0644); err != nil {
+		l.t.Fatal(err)
+	}
+	return abs
+}
+
+func (l *testLibrary) has(table, path string) bool {
+	l.t.Helper()
+	var n int
+	if err := l.db.Pool().QueryRow(context.Background(), "SELECT count(*) FROM "+table+" WHERE path = $1", path).Scan(&n); err != nil {
+		l.t.Fatal(err)
+	}
+	return n > 0
+}
+
+func TestRescanDirWalksOnlyNewFolders(t *testing.T) {
+	lib := newTestLibrary(t)
+	ctx := context.Background()
+	jpg := testutil.JPEG(64, 48, nil)
+
+	lib.write("Known/a.jpg", jpg)
+	if err := lib.scanner.ScanFolder(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	lib.write("top.jpg", jpg)
+	lib.write("Known/b.jpg", jpg)
+	lib.write("New/Deeper/c.jpg", jpg)
+	if err := lib.scanner.RescanDir(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]bool{
+		"top.jpg":          true,
+		"New/Deeper/c.jpg": true,
+		"Known/a.jpg":      true,
+		"Known/b.jpg":      false,
+	} {
+		if got := lib.has("photos", path); got != want {
+			t.Errorf("%s stored = %v, want %v", path, got, want)
+		}
+	}
+	if !lib.has("folders", "New/Deeper") {
+		t.Error("new nested folder not added")
+	}
+
+	if err := lib.scanner.RescanDir(ctx, "Known"); err != nil {
+		t.Fatal(err)
+	}
+	if !lib.has("photos", "Known/b.jpg") {
+		t.Error("rescanning the folder itself missed its new photo")
+	}
+}
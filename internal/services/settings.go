@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+)
+
+type SettingsService struct {
+	db     *database.DB
+	mu     sync.RWMutex
+	cache  map[string]string
+	loaded bool
+}
+
+func NewSettingsService(db *database.DB) *SettingsService {
+	return &SettingsService{db: db, cache: make(map[string]string)}
+}
+
+func (s *SettingsService) load(ctx context.Context) {
+	s.mu.RLock()
+	loaded := s.loaded
+	s.mu.RUnlock()
+	if loaded {
+		return
+	}
+
+	rows, err := s.db.Pool().Query(ctx, "SELECT key, value FROM settings")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	values := make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			continue
+		}
+		values[k] = v
+	}
+
+	s.mu.Lock()
+	s.cache = values
+	s.loaded = true
+	s.mu.Unlock()
+}
+
+func (s *SettingsService) Reload() {
+	s.mu.Lock()
+	s.loaded = false
+	s.mu.Unlock()
+}
+
+func (s *SettingsService) Get(ctx context.Context, key, def string) string {
+	s.load(ctx)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if v, ok := s.cache[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+func (s *SettingsService) GetInt(ctx context.Context, key string, def int) int {
+	v, err := strconv.Atoi(s.Get(ctx, key, ""))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func (s *SettingsService) GetBool(ctx context.Context, key string, def bool) bool {
+	v, err := strconv.ParseBool(s.Get(ctx, key, ""))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func (s *SettingsService) Set(ctx context.Context, key, value string) error {
+	_, err := s.db.Pool().Exec(ctx,
+		`INSERT INTO settings (key, value, updated_at) VALUES ($1, $2, NOW())
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()`,
+		key, value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.cache[key] = value
+	s.mu.Unlock()
+	return nil
+}
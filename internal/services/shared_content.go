@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"os"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+)
+
+func MarkSharedContent(ctx context.Context, db *database.DB, sum string) error {
+	_, err := db.Pool().Exec(ctx,
+		"INSERT INTO shared_content (sha256) VALUES ($1) ON CONFLICT DO NOTHING", sum)
+	return err
+}
+
+// Called once the photo's row is gone. The file stays while another row
+// still names it, and the marker goes with the last row holding the
+// content.
+func RemovePhotoFile(ctx context.Context, db *database.DB, mediaRoot, relPath, sum string) error {
+	absPath := ResolveMediaPath(mediaRoot, relPath)
+	if sum != "" {
+		rows, err := db.Pool().Query(ctx, "SELECT path FROM photos WHERE sha256 = $1", sum)
+		if err != nil {
+			return err
+		}
+		var refs int
+		var named bool
+		for rows.Next() {
+			var p string
+			if rows.Scan(&p) == nil {
+				refs++
+				named = named || ResolveMediaPath(mediaRoot, p) == absPath
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if refs == 0 {
+			if _, err := db.Pool().Exec(ctx, "DELETE FROM shared_content WHERE sha256 = $1", sum); err != nil {
+				return err
+			}
+		}
+		if named {
+			return nil
+		}
+	}
+	if err := os.Remove(absPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func PruneSharedContent(ctx context.Context, db *database.DB) error {
+	_, err := db.Pool().Exec(ctx,
+		"DELETE FROM shared_content s WHERE NOT EXISTS (SELECT 1 FROM photos p WHERE p.sha256 = s.sha256)")
+	return err
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+	"github.com/Alexander-D-Karpov/photodock/internal/models"
+)
+
+// Tag names are unique case-insensitively; whichever spelling arrives
+// first is the one kept and shown.
+const upsertTagsSQL = `INSERT INTO tags (name) SELECT DISTINCT ON (lower(n)) n FROM unnest($1::text[]) n ON CONFLICT DO NOTHING`
+
+const linkTagsSQL = `
+	INSERT INTO photo_tags (photo_id, tag_id)
+	SELECT $1, id FROM tags WHERE lower(name) IN (SELECT lower(n) FROM unnest($2::text[]) n)
+	ON CONFLICT DO NOTHING`
+
+func NormalizeTags(names []string) []string {
+	var tags []string
+	for _, n := range names {
+		if n = strings.Join(strings.Fields(n), " "); n != "" {
+			tags = appendKeyword(tags, n)
+		}
+	}
+	return tags
+}
+
+func AddPhotoTags(ctx context.Context, db *database.DB, photoID int, names []string) error {
+	names = NormalizeTags(names)
+	if len(names) == 0 {
+		return nil
+	}
+	if _, err := db.Pool().Exec(ctx, upsertTagsSQL, names); err != nil {
+		return err
+	}
+	_, err := db.Pool().Exec(ctx, linkTagsSQL, photoID, names)
+	return err
+}
+
+func SetPhotoTags(ctx context.Context, db *database.DB, photoID int, names []string) error {
+	names = NormalizeTags(names)
+	tx, err := db.Pool().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, "DELETE FROM photo_tags WHERE photo_id = $1", photoID); err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		if _, err := tx.Exec(ctx, upsertTagsSQL, names); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, linkTagsSQL, photoID, names); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM tags t WHERE NOT EXISTS (SELECT 1 FROM photo_tags pt WHERE pt.tag_id = t.id)"); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func fillPhotoTags(ctx context.Context, db *database.DB, relPath string, names []string) error {
+	// Embedded and sidecar keywords only seed a photo that has no tags yet,
+	// so a rescan never undoes tags edited in the admin.
+	names = NormalizeTags(names)
+	if len(names) == 0 {
+		return nil
+	}
+	var id int
+	err := db.Pool().QueryRow(ctx, `
+		SELECT id FROM photos p WHERE path = $1
+		AND NOT EXISTS (SELECT 1 FROM photo_tags pt WHERE pt.photo_id = p.id)`, relPath).Scan(&id)
+	if err != nil {
+		return nil
+	}
+	return AddPhotoTags(ctx, db, id, names)
+}
+
+func PhotoTags(ctx context.Context, db *database.DB, photoID int) []string {
+	rows, err := db.Pool().Query(ctx, `
+		SELECT t.name FROM photo_tags pt JOIN tags t ON t.id = pt.tag_id
+		WHERE pt.photo_id = $1 ORDER BY lower(t.name)`, photoID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var tags []string
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			tags = append(tags, name)
+		}
+	}
+	return tags
+}
+
+func photoKeywords(info *models.ExifInfo, sc *Sidecar) []string {
+	var names []string
+	if info != nil {
+		names = append(names, info.Keywords...)
+	}
+	if sc != nil {
+		names = append(names, sc.Keywords...)
+	}
+	return NormalizeTags(names)
+}
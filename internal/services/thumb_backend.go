@@ -0,0 +1,97 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/config"
+	"github.com/disintegration/imaging"
+)
+
+const (
+	ThumbBackendGo   = "go"
+	ThumbBackendVips = "vips"
+)
+
+type thumbResizer interface {
+	// resize writes the thumbnail for spec; the output format follows
+	// dstPath's extension.
+	resize(srcPath, dstPath string, spec config.ThumbSpec) error
+	// preview decodes srcPath cheaply, but large enough to fit a
+	// minEdge x minEdge box without upscaling.
+	preview(srcPath string, minEdge int) (image.Image, error)
+}
+
+func (s *ThumbnailService) newResizer(backend string) thumbResizer {
+	goResizer := &imagingResizer{s: s}
+	if backend != ThumbBackendVips {
+		return goResizer
+	}
+	if _, err := exec.LookPath("vipsthumbnail"); err != nil {
+		log.Printf("THUMB_BACKEND=vips but vipsthumbnail is not installed, using the Go resizer")
+		return goResizer
+	}
+	return &vipsResizer{s: s, fallback: goResizer}
+}
+
+type imagingResizer struct {
+	s *ThumbnailService
+}
+
+func (r *imagingResizer) resize(srcPath, dstPath string, spec config.ThumbSpec) error {
+	img, err := r.s.openImageScaled(srcPath, spec.Width)
+	if err != nil {
+		return err
+	}
+	return r.s.generateThumbnail(img, dstPath, spec)
+}
+
+func (r *imagingResizer) preview(srcPath string, minEdge int) (image.Image, error) {
+	return r.s.openImageScaled(srcPath, minEdge)
+}
+
+// vipsthumbnail shrinks on load and auto-rotates, so it never holds the
+// full-size image; anything it can't handle goes to the Go resizer.
+type vipsResizer struct {
+	s        *ThumbnailService
+	fallback thumbResizer
+}
+
+func (r *vipsResizer) resize(srcPath, dstPath string, spec config.ThumbSpec) error {
+	tmpPath := tempSibling(dstPath)
+	out := tmpPath
+	if !strings.HasSuffix(strings.ToLower(dstPath), ".png") {
+		out += fmt.Sprintf("[Q=%d,strip]", spec.Quality)
+	}
+
+	args := []string{srcPath, "--size", strconv.Itoa(spec.Width) + "x", "-o", out}
+	if spec.Square {
+		args = []string{srcPath, "--size", fmt.Sprintf("%dx%d", spec.Width, spec.Width), "--smartcrop", "centre", "-o", out}
+	}
+	cmd := exec.Command("vipsthumbnail", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		_ = commitTemp(tmpPath, dstPath, err)
+		log.Printf("vipsthumbnail %s: %v: %s; falling back to the Go resizer", srcPath, err, strings.TrimSpace(string(output)))
+		return r.fallback.resize(srcPath, dstPath, spec)
+	}
+	return commitTemp(tmpPath, dstPath, nil)
+}
+
+func (r *vipsResizer) preview(srcPath string, minEdge int) (image.Image, error) {
+	// Under web/ so a crash leaves the temp file where prewarm sweeps it.
+	tmpPath := tempSibling(filepath.Join(r.s.cacheDir, "web", "preview.png"))
+	defer func() { _ = os.Remove(tmpPath) }()
+
+	cmd := exec.Command("vipsthumbnail", srcPath, "--size", fmt.Sprintf("%dx%d", minEdge, minEdge), "-o", tmpPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		log.Printf("vipsthumbnail %s: %v: %s; falling back to the Go resizer", srcPath, err, strings.TrimSpace(string(output)))
+		return r.fallback.preview(srcPath, minEdge)
+	}
+	return imaging.Open(tmpPath)
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+)
+
+var ErrThumbnailFailed = errors.New("thumbnail generation failed")
+
+func (s *ThumbnailService) knownBroken(photoPath string) bool {
+	// A source that failed once is not retried until it is replaced on disk.
+	failedAt, ok := s.failures.Load(photoPath)
+	if !ok {
+		return false
+	}
+	info, err := os.Stat(ResolveMediaPath(s.mediaRoot, photoPath))
+	if err == nil && info.ModTime().Equal(failedAt.(time.Time)) {
+		return true
+	}
+	s.failures.Delete(photoPath)
+	return false
+}
+
+func (s *ThumbnailService) recordFailure(photoPath string, err error) error {
+	var mtime time.Time
+	if info, statErr := os.Stat(ResolveMediaPath(s.mediaRoot, photoPath)); statErr == nil {
+		mtime = info.ModTime()
+	}
+	if _, loaded := s.failures.Swap(photoPath, mtime); !loaded {
+		log.Printf("thumbnail %s: %v", photoPath, err)
+	}
+	return fmt.Errorf("%w: %v", ErrThumbnailFailed, err)
+}
+
+func SetThumbError(ctx context.Context, db *database.DB, photoID int, thumbErr error) {
+	var msg *string
+	if thumbErr != nil {
+		m := thumbErr.Error()
+		msg = &m
+	}
+	_, _ = db.Pool().Exec(ctx,
+		"UPDATE photos SET thumb_error = $2 WHERE id = $1 AND thumb_error IS DISTINCT FROM $2",
+		photoID, msg)
+}
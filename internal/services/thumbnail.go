@@ -1,117 +1,455 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
+	"image/gif"
 	_ "image/jpeg"
-	"image/png"
+	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/Alexander-D-Karpov/photodock/internal/config"
 	"github.com/Alexander-D-Karpov/photodock/internal/models"
 	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp"
 )
 
+var retinaSizes = []string{"small", "medium"}
+
 type ThumbnailService struct {
-	mediaRoot   string
-	cacheDir    string
-	existsCache sync.Map
+	mediaRoot       string
+	cacheDir        string
+	criticalBytes   uint64
+	heifConverter   string
+	webpEncoder     string
+	scaledDecoder   string
+	decodeMaxPixels uint64
+	sizes           map[string]config.ThumbSpec
+	resizer         thumbResizer
+	warm            atomic.Bool
+	pool            *workPool
+	existsCache     sync.Map
+	failures        sync.Map
+	budget          *cacheBudget
 }
 
-func NewThumbnailService(mediaRoot, cacheDir string) *ThumbnailService {
-	_ = os.MkdirAll(filepath.Join(cacheDir, "small"), 0755)
-	_ = os.MkdirAll(filepath.Join(cacheDir, "medium"), 0755)
-	_ = os.MkdirAll(filepath.Join(cacheDir, "large"), 0755)
+func NewThumbnailService(mediaRoot, cacheDir string, criticalBytes, maxBytes, decodeMaxPixels uint64, sizes map[string]config.ThumbSpec, workers int, backend string) *ThumbnailService {
+	sizes = withRetinaSizes(sizes)
+	for size := range sizes {
+		_ = os.MkdirAll(filepath.Join(cacheDir, size), 0755)
+		_ = os.MkdirAll(filepath.Join(cacheDir, size+"-webp"), 0755)
+	}
 	_ = os.MkdirAll(filepath.Join(cacheDir, "placeholder"), 0755)
-	return &ThumbnailService{
-		mediaRoot: mediaRoot,
-		cacheDir:  cacheDir,
+	_ = os.MkdirAll(filepath.Join(cacheDir, customDir), 0755)
+	_ = os.MkdirAll(filepath.Join(cacheDir, webDir), 0755)
+
+	var heifConverter string
+	for _, bin := range []string{"heif-convert", "vips"} {
+		if _, err := exec.LookPath(bin); err == nil {
+			heifConverter = bin
+			break
+		}
 	}
+
+	var webpEncoder string
+	for _, bin := range []string{"cwebp", "vips"} {
+		if _, err := exec.LookPath(bin); err == nil {
+			webpEncoder = bin
+			break
+		}
+	}
+
+	s := &ThumbnailService{
+		mediaRoot:       mediaRoot,
+		cacheDir:        cacheDir,
+		criticalBytes:   criticalBytes,
+		heifConverter:   heifConverter,
+		webpEncoder:     webpEncoder,
+		scaledDecoder:   findScaledDecoder(),
+		decodeMaxPixels: decodeMaxPixels,
+		sizes:           sizes,
+		pool:            newWorkPool(workers),
+		budget:          newCacheBudget(maxBytes),
+	}
+	s.resizer = s.newResizer(backend)
+	return s
 }
 
-func (s *ThumbnailService) GetThumbnailPathByID(photoID int, photoPath, size string) (string, error) {
-	ext := ".jpg"
-	if strings.HasSuffix(strings.ToLower(photoPath), ".png") {
-		ext = ".png"
+func withRetinaSizes(sizes map[string]config.ThumbSpec) map[string]config.ThumbSpec {
+	out := make(map[string]config.ThumbSpec, len(sizes)+len(retinaSizes))
+	for name, spec := range sizes {
+		out[name] = spec
+	}
+	for _, name := range retinaSizes {
+		spec, ok := sizes[name]
+		if !ok {
+			continue
+		}
+		// Twice the pixels hide a bit more compression.
+		spec.Width *= 2
+		spec.Quality = max(spec.Quality-5, 1)
+		out[name+"@2x"] = spec
 	}
-	thumbPath := filepath.Join(s.cacheDir, size, fmt.Sprintf("%d%s", photoID, ext))
+	return out
+}
 
-	if _, ok := s.existsCache.Load(thumbPath); ok {
+func (s *ThumbnailService) HasSize(size string) bool {
+	_, ok := s.sizes[size]
+	return ok
+}
+
+func (s *ThumbnailService) Srcset(route, size string, photoID, version int) string {
+	if version < 1 {
+		version = 1
+	}
+	set := fmt.Sprintf("/%s/%s/%d?v=%d 1x", route, size, photoID, version)
+	if s.HasSize(size + "@2x") {
+		set += fmt.Sprintf(", /%s/%s@2x/%d?v=%d 2x", route, size, photoID, version)
+	}
+	return set
+}
+
+func (s *ThumbnailService) SizeNames() []string {
+	names := make([]string, 0, len(s.sizes))
+	for name := range s.sizes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		wi, wj := s.sizes[names[i]].Width, s.sizes[names[j]].Width
+		if wi != wj {
+			return wi < wj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func (s *ThumbnailService) thumbFilename(photoID int, size, ext string) string {
+	// Width and quality are part of the name so a THUMB_SIZES change misses
+	// the old files instead of serving them.
+	spec := s.sizes[size]
+	shape := "w"
+	if spec.Square {
+		shape = "s"
+	}
+	return fmt.Sprintf("%d-%s%dq%d%s", photoID, shape, spec.Width, spec.Quality, ext)
+}
+
+func (s *ThumbnailService) CacheSpaceLow() (uint64, bool) {
+	free, err := FreeSpace(s.cacheDir)
+	if err != nil {
+		return 0, false
+	}
+	return free, free < s.criticalBytes
+}
+
+func (s *ThumbnailService) GetThumbnailPathByID(ctx context.Context, photoID int, photoPath, size string) (string, error) {
+	return s.thumbnailPath(ctx, photoID, photoPath, size, false, nil)
+}
+
+func (s *ThumbnailService) PregenerateThumbnail(ctx context.Context, photoID int, photoPath, size string) error {
+	_, err := s.thumbnailPath(ctx, photoID, photoPath, size, true, nil)
+	return err
+}
+
+func (s *ThumbnailService) PregenerateThumbnailFrom(ctx context.Context, photoID int, photoPath, size string, src image.Image) error {
+	_, err := s.thumbnailPath(ctx, photoID, photoPath, size, true, src)
+	return err
+}
+
+func (s *ThumbnailService) PrepareSource(photoPath string) (string, image.Image) {
+	srcPath, err := s.sourcePath(photoPath)
+	if err != nil {
+		return "", nil
+	}
+
+	if _, ok := s.resizer.(*imagingResizer); !ok {
+		hash, _ := s.GenerateBlurhash(photoPath)
+		return hash, nil
+	}
+
+	var minEdge int
+	for _, spec := range s.sizes {
+		minEdge = max(minEdge, spec.Width)
+	}
+	img, err := s.openImageScaled(srcPath, minEdge)
+	if err != nil {
+		return "", nil
+	}
+	return BlurhashFromImage(img), img
+}
+
+func (s *ThumbnailService) thumbnailPath(ctx context.Context, photoID int, photoPath, size string, low bool, src image.Image) (string, error) {
+	if !s.HasSize(size) {
+		return "", fmt.Errorf("unknown thumbnail size %q", size)
+	}
+	thumbPath := filepath.Join(s.cacheDir, size, s.thumbFilename(photoID, size, thumbExt(photoPath)))
+
+	if s.cacheHit(thumbPath) {
 		return thumbPath, nil
 	}
 
 	if _, err := os.Stat(thumbPath); err == nil {
-		s.existsCache.Store(thumbPath, struct{}{})
+		s.markCached(thumbPath)
 		return thumbPath, nil
 	}
 
-	srcPath := filepath.Join(s.mediaRoot, photoPath)
-	if err := s.generateThumbnail(srcPath, thumbPath, size); err != nil {
+	if s.knownBroken(photoPath) {
+		return "", ErrThumbnailFailed
+	}
+
+	err := s.pool.do(ctx, thumbPath, low, func() error {
+		// A run that finished while this one was queued already wrote it.
+		if _, err := os.Stat(thumbPath); err == nil {
+			return nil
+		}
+		if src != nil {
+			if err := s.generateThumbnail(src, thumbPath, s.sizes[size]); err != nil {
+				return s.recordFailure(photoPath, err)
+			}
+			return nil
+		}
+		srcPath, err := s.sourcePath(photoPath)
+		if err != nil {
+			return s.recordFailure(photoPath, err)
+		}
+		if err := s.resizer.resize(srcPath, thumbPath, s.sizes[size]); err != nil {
+			return s.recordFailure(photoPath, err)
+		}
+		return nil
+	})
+	if err != nil {
 		return "", err
 	}
 
-	s.existsCache.Store(thumbPath, struct{}{})
+	s.markCached(thumbPath)
 	return thumbPath, nil
 }
 
-func (s *ThumbnailService) generateThumbnail(srcPath, dstPath, size string) error {
-	img, err := imaging.Open(srcPath, imaging.AutoOrientation(true))
+func (s *ThumbnailService) SupportsWebP() bool {
+	return s.webpEncoder != ""
+}
+
+func (s *ThumbnailService) GetThumbnailPathByIDFormat(ctx context.Context, photoID int, photoPath, size, format string) (string, error) {
+	if format != "webp" || s.webpEncoder == "" {
+		return s.GetThumbnailPathByID(ctx, photoID, photoPath, size)
+	}
+
+	if !s.HasSize(size) {
+		return "", fmt.Errorf("unknown thumbnail size %q", size)
+	}
+	webpPath := filepath.Join(s.cacheDir, size+"-webp", s.thumbFilename(photoID, size, ".webp"))
+	if s.cacheHit(webpPath) {
+		return webpPath, nil
+	}
+	if _, err := os.Stat(webpPath); err == nil {
+		s.markCached(webpPath)
+		return webpPath, nil
+	}
+
+	basePath, err := s.GetThumbnailPathByID(ctx, photoID, photoPath, size)
+	if err != nil {
+		return "", err
+	}
+	err = s.pool.do(ctx, webpPath, false, func() error {
+		if _, err := os.Stat(webpPath); err == nil {
+			return nil
+		}
+		return s.encodeWebP(basePath, webpPath, s.sizes[size].Quality)
+	})
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
 	if err != nil {
+		log.Printf("webp thumbnail %d/%s: %v", photoID, size, err)
+		return basePath, nil
+	}
+
+	s.markCached(webpPath)
+	return webpPath, nil
+}
+
+func (s *ThumbnailService) encodeWebP(srcPath, dstPath string, quality int) error {
+	tmpPath := tempSibling(dstPath)
+	var cmd *exec.Cmd
+	if s.webpEncoder == "vips" {
+		cmd = exec.Command("vips", "copy", srcPath, fmt.Sprintf("%s[Q=%d]", tmpPath, quality))
+	} else {
+		cmd = exec.Command("cwebp", "-quiet", "-q", strconv.Itoa(quality), srcPath, "-o", tmpPath)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return commitTemp(tmpPath, dstPath, fmt.Errorf("%s: %v: %s", s.webpEncoder, err, strings.TrimSpace(string(out))))
+	}
+	return commitTemp(tmpPath, dstPath, nil)
+}
+
+func isHEIF(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".heic" || ext == ".heif"
+}
+
+func IsGIF(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".gif"
+}
+
+func openImage(srcPath string) (image.Image, error) {
+	if !IsGIF(srcPath) {
+		return imaging.Open(srcPath, imaging.AutoOrientation(true))
+	}
+
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Image) == 0 {
+		return nil, fmt.Errorf("gif %s has no frames", srcPath)
+	}
+
+	// The first frame may cover only part of the logical screen.
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	if canvas.Bounds().Empty() {
+		canvas = image.NewRGBA(g.Image[0].Bounds())
+	}
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(canvas, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Over)
+	return canvas, nil
+}
+
+func (s *ThumbnailService) sourcePath(photoPath string) (string, error) {
+	srcPath := ResolveMediaPath(s.mediaRoot, photoPath)
+	if !isHEIF(photoPath) {
+		return srcPath, nil
+	}
+	return s.convertHEIF(photoPath, srcPath)
+}
+
+func (s *ThumbnailService) WebOriginalPath(ctx context.Context, photoPath string) (string, error) {
+	if !isHEIF(photoPath) {
+		return s.sourcePath(photoPath)
+	}
+	err := s.pool.do(ctx, s.webOriginalCachePath(photoPath), false, func() error {
+		_, err := s.sourcePath(photoPath)
 		return err
+	})
+	if err != nil {
+		return "", err
 	}
+	return s.sourcePath(photoPath)
+}
 
-	var width int
-	var quality int
-	switch size {
-	case "small":
-		width = 300
-		quality = 80
-	case "medium":
-		width = 800
-		quality = 85
-	case "large":
-		width = 1440
-		quality = 85
-	default:
-		width = 300
-		quality = 80
+func (s *ThumbnailService) webOriginalCachePath(photoPath string) string {
+	sum := sha256.Sum256([]byte(photoPath))
+	return filepath.Join(s.cacheDir, webDir, hex.EncodeToString(sum[:12])+".jpg")
+}
+
+func (s *ThumbnailService) DeleteWebOriginal(photoPath string) {
+	if !isHEIF(photoPath) {
+		return
 	}
+	path := s.webOriginalCachePath(photoPath)
+	s.dropCached(path)
+}
 
-	thumb := imaging.Resize(img, width, 0, imaging.Lanczos)
+func (s *ThumbnailService) convertHEIF(photoPath, srcPath string) (string, error) {
+	dstPath := s.webOriginalCachePath(photoPath)
+
+	if s.cacheHit(dstPath) {
+		return dstPath, nil
+	}
+	if _, err := os.Stat(dstPath); err == nil {
+		s.markCached(dstPath)
+		return dstPath, nil
+	}
 
+	if s.heifConverter == "" {
+		return "", fmt.Errorf("cannot decode %s: no HEIF converter (heif-convert or vips) installed", photoPath)
+	}
+
+	tmpPath := tempSibling(dstPath)
+	var cmd *exec.Cmd
+	if s.heifConverter == "vips" {
+		cmd = exec.Command("vips", "copy", srcPath, tmpPath+"[Q=92]")
+	} else {
+		cmd = exec.Command("heif-convert", "-q", "92", srcPath, tmpPath)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", commitTemp(tmpPath, dstPath, fmt.Errorf("%s %s: %v: %s", s.heifConverter, photoPath, err, strings.TrimSpace(string(out))))
+	}
+	if err := commitTemp(tmpPath, dstPath, nil); err != nil {
+		return "", err
+	}
+
+	s.markCached(dstPath)
+	return dstPath, nil
+}
+
+func thumbExt(photoPath string) string {
+	if strings.HasSuffix(strings.ToLower(photoPath), ".png") {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+func (s *ThumbnailService) generateThumbnail(img image.Image, dstPath string, spec config.ThumbSpec) error {
+	var err error
+	var thumb *image.NRGBA
+	if spec.Square {
+		thumb = imaging.Fill(img, spec.Width, spec.Width, imaging.Center, imaging.Lanczos)
+	} else {
+		thumb = imaging.Resize(img, spec.Width, 0, imaging.Lanczos)
+	}
+
+	tmpPath := tempSibling(dstPath)
 	if strings.HasSuffix(strings.ToLower(dstPath), ".png") {
-		return imaging.Save(thumb, dstPath)
+		err = imaging.Save(thumb, tmpPath)
+	} else {
+		err = imaging.Save(thumb, tmpPath, imaging.JPEGQuality(spec.Quality))
 	}
-	return imaging.Save(thumb, dstPath, imaging.JPEGQuality(quality))
+	return commitTemp(tmpPath, dstPath, err)
 }
 
 func (s *ThumbnailService) GenerateBlurhash(photoPath string) (string, error) {
-	srcPath := filepath.Join(s.mediaRoot, photoPath)
-	img, err := imaging.Open(srcPath, imaging.AutoOrientation(true))
+	srcPath, err := s.sourcePath(photoPath)
 	if err != nil {
 		return "", err
 	}
-
-	tiny := imaging.Resize(img, 4, 4, imaging.Box)
-	bounds := tiny.Bounds()
-	var pixels []byte
-
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, _ := tiny.At(x, y).RGBA()
-			pixels = append(pixels, byte(r>>8), byte(g>>8), byte(b>>8))
-		}
+	img, err := s.resizer.preview(srcPath, 64)
+	if err != nil {
+		return "", err
 	}
+	return BlurhashFromImage(img), nil
+}
 
-	return base64.StdEncoding.EncodeToString(pixels), nil
+func BlurhashFromImage(img image.Image) string {
+	small := imaging.Fit(img, 64, 64, imaging.Box)
+	return encodeBlurhash(small, blurhashXComponents, blurhashYComponents)
 }
 
 func (s *ThumbnailService) GetImageDimensions(photoPath string) (int, int, error) {
-	srcPath := filepath.Join(s.mediaRoot, photoPath)
+	srcPath, err := s.sourcePath(photoPath)
+	if err != nil {
+		return 0, 0, err
+	}
 	f, err := os.Open(srcPath)
 	if err != nil {
 		return 0, 0, err
@@ -126,7 +464,42 @@ func (s *ThumbnailService) GetImageDimensions(photoPath string) (int, int, error
 	return config.Width, config.Height, nil
 }
 
+func (s *ThumbnailService) DisplayDimensions(photoPath string, orientation int) (int, int, error) {
+	width, height, err := s.GetImageDimensions(photoPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	// Orientations 5-8 are shown a quarter turn off; HEIF is already
+	// upright after conversion.
+	if orientation >= 5 && orientation <= 8 && !isHEIF(photoPath) {
+		width, height = height, width
+	}
+	return width, height, nil
+}
+
+func (s *ThumbnailService) CachedThumbnailSize(photoID int, photoPath, size string) (int, int, bool) {
+	if !s.HasSize(size) {
+		return 0, 0, false
+	}
+	f, err := os.Open(filepath.Join(s.cacheDir, size, s.thumbFilename(photoID, size, thumbExt(photoPath))))
+	if err != nil {
+		return 0, 0, false
+	}
+	defer func() { _ = f.Close() }()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
+
 func (s *ThumbnailService) GeneratePlaceholder(blurhash string, width, height int) (image.Image, error) {
+	if blurhash != "" && !isLegacyBlurhash(blurhash) {
+		if img, err := decodeBlurhash(blurhash, width, height); err == nil {
+			return img, nil
+		}
+	}
+
 	data, err := base64.StdEncoding.DecodeString(blurhash)
 	if err != nil || len(data) < 48 {
 		img := image.NewRGBA(image.Rect(0, 0, width, height))
@@ -150,70 +523,162 @@ func (s *ThumbnailService) GeneratePlaceholder(blurhash string, width, height in
 	return imaging.Resize(tiny, width, height, imaging.Linear), nil
 }
 
-func (s *ThumbnailService) GetPlaceholderPathByID(photoID int, blurhash string) (string, error) {
-	placeholderPath := filepath.Join(s.cacheDir, "placeholder", fmt.Sprintf("%d.png", photoID))
+func (s *ThumbnailService) placeholderPath(photoID int) string {
+	return filepath.Join(s.cacheDir, "placeholder", fmt.Sprintf("%d.png", photoID))
+}
 
-	if _, ok := s.existsCache.Load(placeholderPath); ok {
-		return placeholderPath, nil
+func (s *ThumbnailService) CachedPlaceholderPath(photoID int) (string, bool) {
+	placeholderPath := s.placeholderPath(photoID)
+	if s.cacheHit(placeholderPath) {
+		return placeholderPath, true
 	}
-
 	if _, err := os.Stat(placeholderPath); err == nil {
-		s.existsCache.Store(placeholderPath, struct{}{})
-		return placeholderPath, nil
+		s.markCached(placeholderPath)
+		return placeholderPath, true
+	}
+	return "", false
+}
+
+func (s *ThumbnailService) GetPlaceholderPathByID(photoID int, blurhash string) (string, error) {
+	if path, ok := s.CachedPlaceholderPath(photoID); ok {
+		return path, nil
 	}
+	placeholderPath := s.placeholderPath(photoID)
 
 	img, err := s.GeneratePlaceholder(blurhash, 32, 32)
 	if err != nil {
 		return "", err
 	}
 
-	f, err := os.Create(placeholderPath)
+	if err := savePNGAtomic(placeholderPath, img); err != nil {
+		return "", err
+	}
+
+	s.markCached(placeholderPath)
+	return placeholderPath, nil
+}
+
+func (s *ThumbnailService) EmptyCoverPath() (string, error) {
+	path := filepath.Join(s.cacheDir, "placeholder", emptyCoverName)
+	if s.cacheHit(path) {
+		return path, nil
+	}
+	if _, err := os.Stat(path); err == nil {
+		s.markCached(path)
+		return path, nil
+	}
+
+	img, err := s.GeneratePlaceholder("", 32, 32)
 	if err != nil {
 		return "", err
 	}
-	defer func() { _ = f.Close() }()
 
-	if err := png.Encode(f, img); err != nil {
+	if err := savePNGAtomic(path, img); err != nil {
 		return "", err
 	}
 
-	s.existsCache.Store(placeholderPath, struct{}{})
-	return placeholderPath, nil
+	s.markCached(path)
+	return path, nil
+}
+
+func (s *ThumbnailService) DeletePlaceholderByID(photoID int) {
+	s.dropCached(s.placeholderPath(photoID))
 }
 
 func (s *ThumbnailService) DeleteThumbnailsByID(photoID int) error {
-	for _, size := range []string{"small", "medium", "large", "placeholder"} {
-		for _, ext := range []string{".jpg", ".png"} {
-			path := filepath.Join(s.cacheDir, size, fmt.Sprintf("%d%s", photoID, ext))
-			_ = os.Remove(path)
-			s.existsCache.Delete(path)
+	for _, dir := range s.cacheDirs() {
+		if dir == webDir {
+			continue
+		}
+		// Matches both the current name and variants left by older sizes;
+		// the dash has to be escaped inside the class.
+		matches, _ := filepath.Glob(filepath.Join(s.cacheDir, dir, fmt.Sprintf(`%d[._\-]*`, photoID)))
+		for _, path := range matches {
+			s.dropCached(path)
 		}
 	}
 	return nil
 }
 
-func (s *ThumbnailService) PrewarmCache() {
-	for _, size := range []string{"small", "medium", "large", "placeholder"} {
-		dir := filepath.Join(s.cacheDir, size)
-		entries, err := os.ReadDir(dir)
+func (s *ThumbnailService) cacheDirs() []string {
+	dirs := []string{"placeholder", customDir, webDir}
+	for _, size := range s.SizeNames() {
+		dirs = append(dirs, size, size+"-webp")
+	}
+	return dirs
+}
+
+func (s *ThumbnailService) PrewarmCache(ctx context.Context) {
+	// Requests are already being served, so only temp files older than this
+	// run are swept.
+	s.migrateLegacyCache()
+	started := time.Now()
+	var files int
+	for _, size := range s.cacheDirs() {
+		n, err := s.prewarmDir(ctx, filepath.Join(s.cacheDir, size), started)
+		files += n
 		if err != nil {
-			continue
+			log.Printf("Cache prewarm stopped after %d files: %v", files, err)
+			return
 		}
+	}
+	s.warm.Store(true)
+	log.Printf("Cache prewarm complete: %d files in %s", files, time.Since(started).Round(time.Millisecond))
+}
+
+func (s *ThumbnailService) prewarmDir(ctx context.Context, dir string, started time.Time) (int, error) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return 0, nil
+	}
+	defer func() { _ = d.Close() }()
+
+	var files int
+	for {
+		entries, err := d.ReadDir(1024)
 		for _, entry := range entries {
-			if !entry.IsDir() {
-				s.existsCache.Store(filepath.Join(dir, entry.Name()), struct{}{})
+			if entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			info, infoErr := entry.Info()
+			if infoErr != nil {
+				continue
+			}
+			if isTempFile(entry.Name()) {
+				if info.ModTime().Before(started) {
+					_ = os.Remove(path)
+				}
+				continue
 			}
+			files++
+			if _, seen := s.existsCache.LoadOrStore(path, struct{}{}); !seen {
+				s.trackCached(path, info.Size(), info.ModTime())
+			}
+		}
+		if err != nil {
+			return files, nil
+		}
+		if ctx.Err() != nil {
+			return files, ctx.Err()
 		}
 	}
 }
 
+func (s *ThumbnailService) CacheWarm() bool {
+	return s.warm.Load()
+}
+
 func (s *ThumbnailService) CacheDir() string {
 	return s.cacheDir
 }
 
 func (s *ThumbnailService) AnalyzeColors(photoPath string) (*models.ColorInfo, error) {
-	srcPath := filepath.Join(s.mediaRoot, photoPath)
-	img, err := imaging.Open(srcPath, imaging.AutoOrientation(true))
+	srcPath, err := s.sourcePath(photoPath)
+	if err != nil {
+		return nil, err
+	}
+	img, err := openImage(srcPath)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// workPool bounds how many images are decoded at once. Callers asking for the
+// same key share one run, and foreground requests are served before
+// low-priority (scanner) work waiting for a slot.
+type workPool struct {
+	mu      sync.Mutex
+	free    int
+	high    []chan struct{}
+	low     []chan struct{}
+	flights map[string]*flight
+}
+
+type flight struct {
+	done    chan struct{}
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func newWorkPool(size int) *workPool {
+	if size < 1 {
+		size = 1
+	}
+	return &workPool{free: size, flights: make(map[string]*flight)}
+}
+
+func (p *workPool) do(ctx context.Context, key string, low bool, fn func() error) error {
+	p.mu.Lock()
+	f, ok := p.flights[key]
+	if !ok {
+		fctx, cancel := context.WithCancel(context.Background())
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		p.flights[key] = f
+		go p.run(fctx, key, f, low, fn)
+	}
+	f.waiters++
+	p.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		p.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			// Nobody wants the result any more; drop it if still queued.
+			f.cancel()
+			if p.flights[key] == f {
+				delete(p.flights, key)
+			}
+		}
+		p.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (p *workPool) run(ctx context.Context, key string, f *flight, low bool, fn func() error) {
+	err := p.acquire(ctx, low)
+	if err == nil {
+		err = fn()
+		p.release()
+	}
+
+	p.mu.Lock()
+	if p.flights[key] == f {
+		delete(p.flights, key)
+	}
+	p.mu.Unlock()
+
+	f.err = err
+	f.cancel()
+	close(f.done)
+}
+
+func (p *workPool) acquire(ctx context.Context, low bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	if p.free > 0 {
+		p.free--
+		p.mu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{}, 1)
+	if low {
+		p.low = append(p.low, ch)
+	} else {
+		p.high = append(p.high, ch)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		queued := removeWaiter(&p.high, ch) || removeWaiter(&p.low, ch)
+		p.mu.Unlock()
+		if !queued {
+			// release already handed us the slot; pass it on.
+			p.release()
+		}
+		return ctx.Err()
+	}
+}
+
+func (p *workPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var ch chan struct{}
+	switch {
+	case len(p.high) > 0:
+		ch, p.high = p.high[0], p.high[1:]
+	case len(p.low) > 0:
+		ch, p.low = p.low[0], p.low[1:]
+	default:
+		p.free++
+		return
+	}
+	ch <- struct{}{}
+}
+
+func removeWaiter(queue *[]chan struct{}, ch chan struct{}) bool {
+	for i, c := range *queue {
+		if c == ch {
+			*queue = append((*queue)[:i], (*queue)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
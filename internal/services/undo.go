@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrUndoNotFound = errors.New("undo token not found or already used")
+	ErrUndoExpired  = errors.New("undo token has expired")
+)
+
+type PhotoPriorState struct {
+	ID       int  `json:"id"`
+	Hidden   bool `json:"hidden"`
+	FolderID *int `json:"folder_id"`
+}
+
+type UndoToken struct {
+	Token      string    `json:"token"`
+	Action     string    `json:"action"`
+	PhotoCount int       `json:"photo_count"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Used       bool      `json:"used"`
+	Expired    bool      `json:"expired"`
+}
+
+func RecordUndo(ctx context.Context, db *database.DB, action string, prior []PhotoPriorState, window time.Duration) (*UndoToken, error) {
+	payload, err := json.Marshal(prior)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _ = db.Pool().Exec(ctx, "DELETE FROM undo_tokens WHERE expires_at < NOW() - INTERVAL '7 days'")
+
+	t := &UndoToken{
+		Token:      randHex(16),
+		Action:     action,
+		PhotoCount: len(prior),
+	}
+	err = db.Pool().QueryRow(ctx,
+		`INSERT INTO undo_tokens (token, action, photo_count, payload, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at, expires_at`,
+		t.Token, action, len(prior), payload, time.Now().Add(window)).
+		Scan(&t.CreatedAt, &t.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func ApplyUndo(ctx context.Context, db *database.DB, token string) (*UndoToken, error) {
+	tx, err := db.Pool().Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	t := &UndoToken{Token: token}
+	var payload []byte
+	err = tx.QueryRow(ctx,
+		`SELECT action, photo_count, payload, created_at, expires_at FROM undo_tokens
+		WHERE token = $1 AND used_at IS NULL FOR UPDATE`, token).
+		Scan(&t.Action, &t.PhotoCount, &payload, &t.CreatedAt, &t.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUndoNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(t.ExpiresAt) {
+		return nil, ErrUndoExpired
+	}
+
+	var prior []PhotoPriorState
+	if err := json.Unmarshal(payload, &prior); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int32, len(prior))
+	hidden := make([]bool, len(prior))
+	folders := make([]*int32, len(prior))
+	for i, p := range prior {
+		ids[i] = int32(p.ID)
+		hidden[i] = p.Hidden
+		if p.FolderID != nil {
+			fid := int32(*p.FolderID)
+			folders[i] = &fid
+		}
+	}
+
+	switch t.Action {
+	case "hide", "unhide":
+		_, err = tx.Exec(ctx, `
+			UPDATE photos p SET hidden = u.hidden, updated_at = NOW()
+			FROM unnest($1::int[], $2::bool[]) AS u(id, hidden)
+			WHERE p.id = u.id`, ids, hidden)
+	case "move":
+		_, err = tx.Exec(ctx, `
+			UPDATE photos p SET folder_id = u.folder_id, updated_at = NOW()
+			FROM unnest($1::int[], $2::int[]) AS u(id, folder_id)
+			WHERE p.id = u.id AND (u.folder_id IS NULL OR EXISTS (SELECT 1 FROM folders WHERE id = u.folder_id))`, ids, folders)
+	default:
+		err = fmt.Errorf("cannot undo %q", t.Action)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE undo_tokens SET used_at = NOW() WHERE token = $1", token); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	if t.Action == "move" {
+		if err := RefreshDraftFlags(ctx, db); err != nil {
+			return t, err
+		}
+	}
+	t.Used = true
+	return t, nil
+}
+
+func RecentUndoTokens(ctx context.Context, db *database.DB, limit int) ([]UndoToken, error) {
+	rows, err := db.Pool().Query(ctx,
+		`SELECT token, action, photo_count, created_at, expires_at, used_at IS NOT NULL
+		FROM undo_tokens ORDER BY created_at DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []UndoToken
+	for rows.Next() {
+		var t UndoToken
+		if err := rows.Scan(&t.Token, &t.Action, &t.PhotoCount, &t.CreatedAt, &t.ExpiresAt, &t.Used); err != nil {
+			continue
+		}
+		t.Expired = time.Now().After(t.ExpiresAt)
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
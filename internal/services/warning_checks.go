@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+)
+
+type exiftoolCheck struct {
+	exifSvc *ExifService
+}
+
+func NewExiftoolCheck(exifSvc *ExifService) WarningCheck {
+	return &exiftoolCheck{exifSvc: exifSvc}
+}
+
+func (c *exiftoolCheck) Name() string { return "exiftool" }
+
+func (c *exiftoolCheck) Check(ctx context.Context) ([]Warning, error) {
+	if c.exifSvc.HasExiftool() {
+		return nil, nil
+	}
+	return []Warning{{
+		Key:      "exiftool_missing",
+		Severity: SeverityWarning,
+		Title:    "exiftool not installed",
+		Detail:   "Metadata is read with the built-in parser, which misses maker notes and non-JPEG formats.",
+	}}, nil
+}
+
+type scanErrorsCheck struct {
+	scanSvc *ScannerService
+}
+
+func NewScanErrorsCheck(scanSvc *ScannerService) WarningCheck {
+	return &scanErrorsCheck{scanSvc: scanSvc}
+}
+
+func (c *scanErrorsCheck) Name() string { return "scan_errors" }
+
+func (c *scanErrorsCheck) Check(ctx context.Context) ([]Warning, error) {
+	n, err := c.scanSvc.ScanErrorCount(ctx)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	return []Warning{{
+		Key:      "scan_errors",
+		Severity: SeverityWarning,
+		Title:    "Scan errors",
+		Detail:   fmt.Sprintf("%d files or folders failed during the last scan.", n),
+		Count:    n,
+		Link:     "/admin/scans",
+	}}, nil
+}
+
+type diskSpaceCheck struct {
+	paths   map[string]string
+	reserve uint64
+}
+
+func NewDiskSpaceCheck(mediaRoot, cacheDir string, reserve uint64) WarningCheck {
+	return &diskSpaceCheck{
+		paths:   map[string]string{"Media": mediaRoot, "Cache": cacheDir},
+		reserve: reserve,
+	}
+}
+
+func (c *diskSpaceCheck) Name() string { return "disk_space" }
+
+func (c *diskSpaceCheck) Check(ctx context.Context) ([]Warning, error) {
+	var out []Warning
+	for _, label := range []string{"Media", "Cache"} {
+		free, err := FreeSpace(c.paths[label])
+		if err != nil || free == 0 || free >= c.reserve {
+			continue
+		}
+		out = append(out, Warning{
+			Key:      "disk_low_" + label,
+			Severity: SeverityCritical,
+			Title:    label + " disk nearly full",
+			Detail:   fmt.Sprintf("Only %d MB free (reserve is %d MB).", free>>20, c.reserve>>20),
+		})
+	}
+	return out, nil
+}
+
+type failedThumbnailsCheck struct {
+	db *database.DB
+}
+
+func NewFailedThumbnailsCheck(db *database.DB) WarningCheck {
+	return &failedThumbnailsCheck{db: db}
+}
+
+func (c *failedThumbnailsCheck) Name() string { return "failed_thumbnails" }
+
+func (c *failedThumbnailsCheck) Check(ctx context.Context) ([]Warning, error) {
+	var n, broken int
+	err := c.db.Pool().QueryRow(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE blurhash IS NULL OR blurhash = '' OR COALESCE(width, 0) = 0 OR COALESCE(height, 0) = 0),
+			COUNT(*) FILTER (WHERE thumb_error IS NOT NULL)
+		FROM photos`).Scan(&n, &broken)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []Warning
+	if broken > 0 {
+		warnings = append(warnings, Warning{
+			Key:      "broken_thumbnails",
+			Severity: SeverityWarning,
+			Title:    "Photos that fail to render",
+			Detail:   fmt.Sprintf("%d photos are shown as gray placeholders because their thumbnails could not be generated; filter the Photos page by Broken Thumbnails to find them.", broken),
+			Count:    broken,
+		})
+	}
+	if n == 0 {
+		return warnings, nil
+	}
+	return append(warnings, Warning{
+		Key:         "failed_thumbnails",
+		Severity:    SeverityWarning,
+		Title:       "Photos without thumbnails",
+		Detail:      fmt.Sprintf("%d photos could not be decoded for dimensions or blurhash.", n),
+		Count:       n,
+		Action:      "/admin/reprocess",
+		ActionLabel: "Reprocess metadata",
+	}), nil
+}
+
+type orphanedCacheCheck struct {
+	db       *database.DB
+	thumbSvc *ThumbnailService
+}
+
+func NewOrphanedCacheCheck(db *database.DB, thumbSvc *ThumbnailService) WarningCheck {
+	return &orphanedCacheCheck{db: db, thumbSvc: thumbSvc}
+}
+
+func (c *orphanedCacheCheck) Name() string { return "orphaned_cache" }
+
+func (c *orphanedCacheCheck) Check(ctx context.Context) ([]Warning, error) {
+	known, err := KnownPhotos(ctx, c.db)
+	if err != nil {
+		return nil, err
+	}
+	n, size := c.thumbSvc.OrphanedCacheFiles(known, false)
+	if n == 0 {
+		return nil, nil
+	}
+	return []Warning{{
+		Key:         "orphaned_cache",
+		Severity:    SeverityInfo,
+		Title:       "Orphaned cache files",
+		Detail:      fmt.Sprintf("%d cached thumbnails (%d MB) belong to photos that no longer exist.", n, size>>20),
+		Count:       n,
+		Action:      "/admin/cache/gc",
+		ActionLabel: "Collect garbage",
+	}}, nil
+}
+
+type sluglessPhotosCheck struct {
+	db *database.DB
+}
+
+func NewSluglessPhotosCheck(db *database.DB) WarningCheck {
+	return &sluglessPhotosCheck{db: db}
+}
+
+func (c *sluglessPhotosCheck) Name() string { return "slugless_photos" }
+
+func (c *sluglessPhotosCheck) Check(ctx context.Context) ([]Warning, error) {
+	var n int
+	err := c.db.Pool().QueryRow(ctx,
+		"SELECT COUNT(*) FROM photos WHERE url_path IS NULL OR url_path = ''").Scan(&n)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	return []Warning{{
+		Key:         "slugless_photos",
+		Severity:    SeverityWarning,
+		Title:       "Photos without URL",
+		Detail:      fmt.Sprintf("%d photos have no public URL path and are only reachable by id.", n),
+		Count:       n,
+		Action:      "/admin/regenerate-urls",
+		ActionLabel: "Regenerate URLs",
+	}}, nil
+}
+
+func KnownPhotos(ctx context.Context, db *database.DB) (map[int]string, error) {
+	rows, err := db.Pool().Query(ctx, "SELECT id, path FROM photos")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	known := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var path string
+		if err := rows.Scan(&id, &path); err != nil {
+			continue
+		}
+		known[id] = path
+	}
+	return known, rows.Err()
+}
+
+type backupCheck struct {
+	backups *BackupService
+}
+
+func NewBackupCheck(backups *BackupService) WarningCheck {
+	return &backupCheck{backups: backups}
+}
+
+func (c *backupCheck) Name() string { return "backups" }
+
+func (c *backupCheck) Check(ctx context.Context) ([]Warning, error) {
+	last, lastErr, lastErrAt := c.backups.Status()
+	if lastErr != nil && lastErrAt.After(last) {
+		return []Warning{{
+			Key:      "backup_failed",
+			Severity: SeverityCritical,
+			Title:    "Backup failed",
+			Detail:   fmt.Sprintf("The backup at %s failed: %v", lastErrAt.Format("2006-01-02 15:04"), lastErr),
+			Link:     "/admin/backups",
+		}}, nil
+	}
+
+	interval := c.backups.Interval()
+	if interval <= 0 {
+		return nil, nil
+	}
+	// The first backup runs right after startup and failures are reported
+	// above; only complain after two missed runs.
+	if !last.IsZero() && time.Since(last) > 2*interval {
+		return []Warning{{
+			Key:      "backup_stale",
+			Severity: SeverityWarning,
+			Title:    "Backups are overdue",
+			Detail:   fmt.Sprintf("The last successful backup was at %s.", last.Local().Format("2006-01-02 15:04")),
+			Link:     "/admin/backups",
+		}}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+type Warning struct {
+	Key         string `json:"key"`
+	Severity    string `json:"severity"`
+	Title       string `json:"title"`
+	Detail      string `json:"detail"`
+	Count       int    `json:"count"`
+	Link        string `json:"link,omitempty"`
+	Action      string `json:"action,omitempty"`
+	ActionLabel string `json:"action_label,omitempty"`
+}
+
+type WarningCheck interface {
+	Name() string
+	Check(ctx context.Context) ([]Warning, error)
+}
+
+type WarningsService struct {
+	checks []WarningCheck
+
+	mu        sync.RWMutex
+	warnings  []Warning
+	checkedAt time.Time
+	refreshMu sync.Mutex
+}
+
+func NewWarningsService(checks ...WarningCheck) *WarningsService {
+	return &WarningsService{checks: checks}
+}
+
+func severityRank(s string) int {
+	switch s {
+	case SeverityCritical:
+		return 0
+	case SeverityWarning:
+		return 1
+	}
+	return 2
+}
+
+func (s *WarningsService) Refresh(ctx context.Context) []Warning {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	var all []Warning
+	for _, c := range s.checks {
+		ws, err := c.Check(ctx)
+		if err != nil {
+			log.Printf("warning check %s: %v", c.Name(), err)
+			continue
+		}
+		all = append(all, ws...)
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		ri, rj := severityRank(all[i].Severity), severityRank(all[j].Severity)
+		if ri != rj {
+			return ri < rj
+		}
+		return all[i].Count > all[j].Count
+	})
+
+	s.mu.Lock()
+	s.warnings = all
+	s.checkedAt = time.Now()
+	s.mu.Unlock()
+	return all
+}
+
+func (s *WarningsService) Current() ([]Warning, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.warnings, s.checkedAt
+}
+
+func (s *WarningsService) Run(ctx context.Context, interval time.Duration) {
+	s.Refresh(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Refresh(ctx)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// MediaWatcher rescans directories shortly after files in them change.
+type MediaWatcher struct {
+	scanner  *ScannerService
+	root     string
+	debounce time.Duration
+
+	mu      sync.Mutex
+	timers  map[string]*time.Timer
+	dirty   map[string]bool
+	wake    chan struct{}
+	stopped bool
+}
+
+func NewMediaWatcher(scanner *ScannerService, root string, debounce time.Duration) *MediaWatcher {
+	return &MediaWatcher{
+		scanner:  scanner,
+		root:     root,
+		debounce: debounce,
+		timers:   make(map[string]*time.Timer),
+		dirty:    make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+func (w *MediaWatcher) Run(ctx context.Context) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("watch: %v", err)
+		return
+	}
+	defer func() { _ = fw.Close() }()
+
+	n := w.addTree(fw, w.root)
+	log.Printf("watch: watching %d directories under %s", n, w.root)
+
+	var scans sync.WaitGroup
+	scans.Add(1)
+	go func() {
+		defer scans.Done()
+		w.scanLoop(ctx)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.stop()
+			scans.Wait()
+			return
+		case ev, ok := <-fw.Events:
+			if !ok {
+				return
+			}
+			w.handle(fw, ev)
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				log.Printf("watch: event queue overflowed, changes may have been missed; run a scan to pick them up")
+				w.schedule("")
+				continue
+			}
+			log.Printf("watch: %v", err)
+		}
+	}
+}
+
+func (w *MediaWatcher) addTree(fw *fsnotify.Watcher, dir string) int {
+	var n int
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != w.root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if err := fw.Add(path); err != nil {
+			log.Printf("watch %s: %v (raise fs.inotify.max_user_watches for large libraries)", path, err)
+			return filepath.SkipAll
+		}
+		n++
+		return nil
+	})
+	return n
+}
+
+func (w *MediaWatcher) handle(fw *fsnotify.Watcher, ev fsnotify.Event) {
+	rel, err := filepath.Rel(w.root, ev.Name)
+	if err != nil || rel == "." || hiddenPath(rel) {
+		return
+	}
+	dir := filepath.Dir(rel)
+	if dir == "." {
+		dir = ""
+	}
+
+	switch {
+	case ev.Has(fsnotify.Create):
+		if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+			// Whatever was copied into it before the watch was added is
+			// found by the parent's scan, which walks new folders.
+			w.addTree(fw, ev.Name)
+			w.schedule(dir)
+			return
+		}
+	case ev.Has(fsnotify.Remove), ev.Has(fsnotify.Rename):
+		// A moved directory would otherwise keep reporting under its old
+		// name.
+		_ = fw.Remove(ev.Name)
+		w.schedule(dir)
+		return
+	case !ev.Has(fsnotify.Write):
+		return
+	}
+
+	if isImageFile(ev.Name) || strings.EqualFold(filepath.Ext(ev.Name), ".xmp") {
+		w.schedule(dir)
+	}
+}
+
+func hiddenPath(rel string) bool {
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *MediaWatcher) schedule(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+	if t, ok := w.timers[dir]; ok {
+		t.Reset(w.debounce)
+		return
+	}
+	w.timers[dir] = time.AfterFunc(w.debounce, func() {
+		w.mu.Lock()
+		delete(w.timers, dir)
+		w.dirty[dir] = true
+		w.mu.Unlock()
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	})
+}
+
+func (w *MediaWatcher) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	for dir, t := range w.timers {
+		t.Stop()
+		delete(w.timers, dir)
+	}
+}
+
+// scanLoop runs the rescans one at a time, so a burst of changes never
+// walks the same tree concurrently.
+func (w *MediaWatcher) scanLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		}
+
+		w.mu.Lock()
+		dirs := make([]string, 0, len(w.dirty))
+		for dir := range w.dirty {
+			dirs = append(dirs, dir)
+		}
+		w.dirty = make(map[string]bool)
+		w.mu.Unlock()
+
+		for _, dir := range dirs {
+			if ctx.Err() != nil {
+				return
+			}
+			w.rescan(ctx, dir)
+		}
+	}
+}
+
+func (w *MediaWatcher) rescan(ctx context.Context, dir string) {
+	dir = NormalizePath(dir)
+	for {
+		err := w.scanner.RescanDir(ctx, dir)
+		if err == nil {
+			log.Printf("watch: rescanned %q", dir)
+			return
+		}
+		if dir == "" || ctx.Err() != nil {
+			log.Printf("watch: rescan %q: %v", dir, err)
+			return
+		}
+		// A directory that is new, or gone, is added or removed by
+		// scanning its parent.
+		if dir = filepath.Dir(dir); dir == "." {
+			dir = ""
+		}
+	}
+}
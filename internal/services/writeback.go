@@ -0,0 +1,97 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var ErrNoExiftool = errors.New("writing captions into files needs exiftool, which is not installed")
+
+func (s *ExifService) WriteCaption(path, title, description string) error {
+	if !s.hasExiftool {
+		return ErrNoExiftool
+	}
+
+	// exiftool edits a hidden copy that then replaces the file, so a failed
+	// write leaves the original intact and a hard-linked duplicate keeps
+	// its own caption. Empty values remove the tags.
+	tmpPath := filepath.Join(filepath.Dir(path), "."+filepath.Base(tempSibling(path)))
+	if err := copyFileMode(path, tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	out, err := s.exiftool.run([]string{
+		"-overwrite_original_in_place",
+		"-IFD0:ImageDescription=" + description,
+		"-XMP-dc:Title=" + title,
+		"-XMP-dc:Description=" + description,
+	}, tmpPath)
+	if err == nil && !bytes.Contains(out, []byte("1 image files updated")) && !bytes.Contains(out, []byte("1 image files unchanged")) {
+		err = fmt.Errorf("exiftool: %s", bytes.TrimSpace(out))
+	}
+	return commitTemp(tmpPath, path, err)
+}
+
+func copyFileMode(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (s *ScannerService) CanWriteCaptions() bool {
+	return s.exifSvc.HasExiftool()
+}
+
+func (s *ScannerService) WriteCaptionToFile(ctx context.Context, id int) error {
+	var relPath string
+	var title, description sql.NullString
+	err := s.db.Pool().QueryRow(ctx, "SELECT path, title, description FROM photos WHERE id = $1", id).
+		Scan(&relPath, &title, &description)
+	if err != nil {
+		return err
+	}
+	absPath := ResolveMediaPath(s.mediaRoot, relPath)
+	if _, err := os.Stat(absPath); os.IsNotExist(err) {
+		return ErrPhotoFileMissing
+	}
+
+	if err := s.exifSvc.WriteCaption(absPath, title.String, description.String); err != nil {
+		return err
+	}
+
+	// The pixels are unchanged, so thumbnails and version stay; only what
+	// describes the file itself is refreshed.
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return err
+	}
+	sum, err := HashFile(absPath)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Pool().Exec(ctx,
+		"UPDATE photos SET size_bytes = $1, sha256 = $2, file_mtime = $3, updated_at = NOW() WHERE id = $4",
+		info.Size(), sum, info.ModTime(), id)
+	return err
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Alexander-D-Karpov/photodock/internal/database"
+	"github.com/Alexander-D-Karpov/photodock/internal/models"
+)
+
+const (
+	nsDC  = "http://purl.org/dc/elements/1.1/"
+	nsRDF = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsXML = "http://www.w3.org/XML/1998/namespace"
+	nsXMP = "http://ns.adobe.com/xap/1.0/"
+)
+
+type Sidecar struct {
+	Title       string
+	Description string
+	Keywords    []string
+	Rating      int
+}
+
+func sidecarPaths(absPath string) []string {
+	// Lightroom writes IMG_1.xmp, darktable and others IMG_1.jpg.xmp.
+	base := strings.TrimSuffix(absPath, filepath.Ext(absPath))
+	return []string{absPath + ".xmp", absPath + ".XMP", base + ".xmp", base + ".XMP"}
+}
+
+func ReadSidecar(absPath string) *Sidecar {
+	for _, p := range sidecarPaths(absPath) {
+		f, err := os.Open(p)
+		if err != nil {
+			continue
+		}
+		sc, err := parseXMP(f)
+		_ = f.Close()
+		if err != nil {
+			log.Printf("xmp sidecar %s: %v", p, err)
+			return nil
+		}
+		return sc
+	}
+	return nil
+}
+
+func parseXMP(r io.Reader) (*Sidecar, error) {
+	// Title and description are rdf:Alt lists where the x-default entry
+	// wins.
+	var sc Sidecar
+	var field string
+	var titles, descriptions []string
+	var titleDefault, descDefault string
+	var liText strings.Builder
+	inLi, liDefault := false, false
+
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Space == nsDC && (t.Name.Local == "title" || t.Name.Local == "description" || t.Name.Local == "subject"):
+				field = t.Name.Local
+			case t.Name.Space == nsRDF && t.Name.Local == "li" && field != "":
+				inLi, liDefault = true, false
+				liText.Reset()
+				for _, a := range t.Attr {
+					if a.Name.Space == nsXML && a.Name.Local == "lang" && a.Value == "x-default" {
+						liDefault = true
+					}
+				}
+			case t.Name.Space == nsXMP && t.Name.Local == "Rating":
+				var v string
+				if dec.DecodeElement(&v, &t) == nil {
+					sc.Rating = parseRating(v)
+				}
+			case t.Name.Space == nsRDF && t.Name.Local == "Description":
+				// The compact form puts simple properties in attributes.
+				for _, a := range t.Attr {
+					switch {
+					case a.Name.Space == nsDC && a.Name.Local == "title":
+						titles = append(titles, a.Value)
+					case a.Name.Space == nsDC && a.Name.Local == "description":
+						descriptions = append(descriptions, a.Value)
+					case a.Name.Space == nsXMP && a.Name.Local == "Rating":
+						sc.Rating = parseRating(a.Value)
+					}
+				}
+			}
+		case xml.CharData:
+			if inLi {
+				liText.Write(t)
+			}
+		case xml.EndElement:
+			switch {
+			case t.Name.Space == nsRDF && t.Name.Local == "li" && inLi:
+				inLi = false
+				v := strings.TrimSpace(liText.String())
+				if v == "" {
+					continue
+				}
+				switch field {
+				case "title":
+					titles = append(titles, v)
+					if liDefault {
+						titleDefault = v
+					}
+				case "description":
+					descriptions = append(descriptions, v)
+					if liDefault {
+						descDefault = v
+					}
+				case "subject":
+					sc.Keywords = appendKeyword(sc.Keywords, v)
+				}
+			case t.Name.Space == nsDC && t.Name.Local == field:
+				field = ""
+			}
+		}
+	}
+
+	sc.Title = firstNonEmpty(titleDefault, titles)
+	sc.Description = firstNonEmpty(descDefault, descriptions)
+	return &sc, nil
+}
+
+func parseRating(s string) int {
+	r, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || !validRating(r) {
+		return 0
+	}
+	return r
+}
+
+func firstNonEmpty(preferred string, all []string) string {
+	if preferred != "" {
+		return preferred
+	}
+	for _, v := range all {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func appendKeyword(keywords []string, kw string) []string {
+	for _, k := range keywords {
+		if strings.EqualFold(k, kw) {
+			return keywords
+		}
+	}
+	return append(keywords, kw)
+}
+
+func applySidecar(ctx context.Context, db *database.DB, relPath string, sc *Sidecar) {
+	// Fills only what is still empty, so anything set in the admin survives
+	// a rescan; clearing a field there lets the sidecar value back in.
+	if sc == nil {
+		return
+	}
+	if sc.Title != "" || sc.Description != "" || sc.Rating > 0 {
+		_, err := db.Pool().Exec(ctx,
+			`UPDATE photos SET title = COALESCE(title, NULLIF($2, '')),
+				description = COALESCE(description, NULLIF($3, '')),
+				rating = COALESCE(rating, NULLIF($4, 0)), updated_at = NOW()
+			WHERE path = $1 AND ((title IS NULL AND $2 <> '') OR (description IS NULL AND $3 <> '')
+				OR (rating IS NULL AND $4 > 0))`,
+			relPath, sc.Title, sc.Description, sc.Rating)
+		if err != nil {
+			log.Printf("apply xmp sidecar %s: %v", relPath, err)
+		}
+	}
+	if err := fillPhotoTags(ctx, db, relPath, sc.Keywords); err != nil {
+		log.Printf("apply xmp sidecar tags %s: %v", relPath, err)
+	}
+}
+
+func photoRating(info *models.ExifInfo, sc *Sidecar) int {
+	// A sidecar holds the editor's latest state, so it beats the rating
+	// the camera embedded.
+	if sc != nil && sc.Rating > 0 {
+		return sc.Rating
+	}
+	if info != nil {
+		return info.Rating
+	}
+	return 0
+}
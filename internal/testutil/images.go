@@ -0,0 +1,215 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"sort"
+)
+
+// EXIF is the metadata a fixture image carries. Empty fields are left out.
+type EXIF struct {
+	Make               string
+	Model              string
+	DateTimeOriginal   string // "2006:01:02 15:04:05"
+	OffsetTimeOriginal string // "+02:00"
+	GPS                *GPS
+}
+
+type GPS struct {
+	Lat, Lon float64
+}
+
+// JPEG encodes a w×h gradient, with an APP1 Exif segment when e is set.
+func JPEG(w, h int, e *EXIF) []byte {
+	var buf bytes.Buffer
+	_ = jpeg.Encode(&buf, gradient(w, h), &jpeg.Options{Quality: 90})
+	data := buf.Bytes()
+	if e == nil {
+		return data
+	}
+	tiff := TIFF(*e)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(2+6+len(tiff)))
+	seg = append(seg, "Exif\x00\x00"...)
+	seg = append(seg, tiff...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, seg...)
+	return append(out, data[2:]...)
+}
+
+// PNG encodes a w×h gradient, with an eXIf chunk after IHDR when e is set.
+func PNG(w, h int, e *EXIF) []byte {
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, gradient(w, h))
+	data := buf.Bytes()
+	if e == nil {
+		return data
+	}
+	tiff := TIFF(*e)
+	chunk := make([]byte, 8, 12+len(tiff))
+	binary.BigEndian.PutUint32(chunk, uint32(len(tiff)))
+	copy(chunk[4:], "eXIf")
+	chunk = append(chunk, tiff...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	// Signature, then IHDR: length, type, 13 bytes of data and a CRC.
+	ihdrEnd := 8 + 4 + 4 + 13 + 4
+	out := append([]byte{}, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...)
+}
+
+func gradient(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / max(w, 1)), uint8(y * 255 / max(h, 1)), 128, 255})
+		}
+	}
+	return img
+}
+
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+	// sub, when set, makes the entry a pointer to that IFD.
+	sub []tiffEntry
+}
+
+const (
+	tiffASCII    = 2
+	tiffLong     = 4
+	tiffRational = 5
+)
+
+// TIFF builds the little-endian TIFF block Exif metadata is stored as.
+func TIFF(e EXIF) []byte {
+	var ifd0, exifIFD, gpsIFD []tiffEntry
+	if e.Make != "" {
+		ifd0 = append(ifd0, ascii(0x010F, e.Make))
+	}
+	if e.Model != "" {
+		ifd0 = append(ifd0, ascii(0x0110, e.Model))
+	}
+	if e.DateTimeOriginal != "" {
+		exifIFD = append(exifIFD, ascii(0x9003, e.DateTimeOriginal))
+	}
+	if e.OffsetTimeOriginal != "" {
+		exifIFD = append(exifIFD, ascii(0x9011, e.OffsetTimeOriginal))
+	}
+	if e.GPS != nil {
+		latRef, lonRef := "N", "E"
+		if e.GPS.Lat < 0 {
+			latRef = "S"
+		}
+		if e.GPS.Lon < 0 {
+			lonRef = "W"
+		}
+		gpsIFD = []tiffEntry{
+			{tag: 0x0000, typ: 1, count: 4, data: []byte{2, 3, 0, 0}},
+			ascii(0x0001, latRef),
+			degrees(0x0002, e.GPS.Lat),
+			ascii(0x0003, lonRef),
+			degrees(0x0004, e.GPS.Lon),
+		}
+	}
+	if len(exifIFD) > 0 {
+		ifd0 = append(ifd0, tiffEntry{tag: 0x8769, typ: tiffLong, count: 1, sub: exifIFD})
+	}
+	if len(gpsIFD) > 0 {
+		ifd0 = append(ifd0, tiffEntry{tag: 0x8825, typ: tiffLong, count: 1, sub: gpsIFD})
+	}
+
+	out := []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	return writeIFD(out, ifd0)
+}
+
+// writeIFD appends the IFD at the end of out, followed by its values and
+// then the IFDs it points at.
+func writeIFD(out []byte, entries []tiffEntry) []byte {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+	le := binary.LittleEndian
+	start := len(out)
+	dataAt := start + 2 + 12*len(entries) + 4
+	var values []byte
+	for _, en := range entries {
+		if en.sub == nil && len(en.data) > 4 {
+			values = append(values, en.data...)
+			if len(values)%2 == 1 {
+				values = append(values, 0)
+			}
+		}
+	}
+	subAt := dataAt + len(values)
+
+	out = le.AppendUint16(out, uint16(len(entries)))
+	var subs [][]tiffEntry
+	valueOff := dataAt
+	for _, en := range entries {
+		out = le.AppendUint16(out, en.tag)
+		out = le.AppendUint16(out, en.typ)
+		out = le.AppendUint32(out, en.count)
+		switch {
+		case en.sub != nil:
+			// Sub-IFDs follow one another in order; their sizes are
+			// known up front because they hold no pointers themselves.
+			off := subAt
+			for _, s := range subs {
+				off += ifdSize(s)
+			}
+			out = le.AppendUint32(out, uint32(off))
+			subs = append(subs, en.sub)
+		case len(en.data) > 4:
+			out = le.AppendUint32(out, uint32(valueOff))
+			valueOff += len(en.data) + len(en.data)%2
+		default:
+			var inline [4]byte
+			copy(inline[:], en.data)
+			out = append(out, inline[:]...)
+		}
+	}
+	out = le.AppendUint32(out, 0)
+	out = append(out, values...)
+	for _, s := range subs {
+		out = writeIFD(out, s)
+	}
+	return out
+}
+
+func ifdSize(entries []tiffEntry) int {
+	n := 2 + 12*len(entries) + 4
+	for _, en := range entries {
+		if len(en.data) > 4 {
+			n += len(en.data) + len(en.data)%2
+		}
+	}
+	return n
+}
+
+func ascii(tag uint16, s string) tiffEntry {
+	data := append([]byte(s), 0)
+	return tiffEntry{tag: tag, typ: tiffASCII, count: uint32(len(data)), data: data}
+}
+
+// degrees encodes an angle as degrees, minutes and seconds rationals.
+func degrees(tag uint16, v float64) tiffEntry {
+	v = math.Abs(v)
+	d := math.Floor(v)
+	m := math.Floor((v - d) * 60)
+	s := ((v-d)*60 - m) * 60
+	var data []byte
+	for _, r := range [][2]uint32{{uint32(d), 1}, {uint32(m), 1}, {uint32(math.Round(s * 1000)), 1000}} {
+		data = binary.LittleEndian.AppendUint32(data, r[0])
+		data = binary.LittleEndian.AppendUint32(data, r[1])
+	}
+	return tiffEntry{tag: tag, typ: tiffRational, count: 3, data: data}
+}